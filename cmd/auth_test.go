@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireAPIKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		headers map[string]string
+		want    int
+	}{
+		{name: "disabled", want: http.StatusOK},
+		{name: "missing", key: "secret", want: http.StatusUnauthorized},
+		{name: "bearer", key: "secret", headers: map[string]string{"Authorization": "Bearer secret"}, want: http.StatusOK},
+		{name: "header", key: "secret", headers: map[string]string{"X-API-Key": "secret"}, want: http.StatusOK},
+		{name: "wrong key", key: "secret", headers: map[string]string{"X-API-Key": "guess"}, want: http.StatusUnauthorized},
+		{name: "prefix of the key", key: "secret", headers: map[string]string{"X-API-Key": "secre"}, want: http.StatusUnauthorized},
+		{name: "other scheme", key: "secret", headers: map[string]string{"Authorization": "Basic secret"}, want: http.StatusUnauthorized},
+		{
+			name:    "bearer wins over header",
+			key:     "secret",
+			headers: map[string]string{"Authorization": "Bearer guess", "X-API-Key": "secret"},
+			want:    http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(requireAPIKey(tt.key))
+			r.GET("/get", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, "/get", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d", w.Code, tt.want)
+			}
+			if challenge := w.Header().Get("WWW-Authenticate"); (challenge != "") != (tt.want == http.StatusUnauthorized) {
+				t.Fatalf("WWW-Authenticate %q with status %d", challenge, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// limitBody caps request bodies at n bytes, so a huge request can't make
+// a handler buffer it all in memory. Reading past the cap fails, which
+// bindJSON answers with 413. A non-positive n disables the cap.
+func limitBody(n int64) gin.HandlerFunc {
+	if n <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, n)
+		c.Next()
+	}
+}
+
+// bindJSON decodes the request body into v and reports whether it worked.
+// Otherwise it has already answered: 413 for a body over the limitBody
+// cap and 400 saying what is wrong for anything else.
+func bindJSON(c *gin.Context, v any) bool {
+	err := c.ShouldBindJSON(v)
+	if err == nil {
+		return true
+	}
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit)})
+	case errors.Is(err, io.EOF):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Empty request body"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLimitBody(t *testing.T) {
+	big := strings.Repeat("x", 2048)
+	tests := []struct {
+		name     string
+		limit    int64
+		route    string
+		handler  gin.HandlerFunc
+		body     string
+		wantCode int
+		wantKey  string // A key that must be set afterwards
+	}{
+		{name: "set under limit", limit: 1024, route: "/set", handler: handleSet, body: `{"key":"a","value":"v"}`, wantCode: http.StatusOK, wantKey: "a"},
+		{name: "set over limit", limit: 1024, route: "/set", handler: handleSet, body: `{"key":"a","value":"` + big + `"}`, wantCode: http.StatusRequestEntityTooLarge},
+		{name: "set no limit", route: "/set", handler: handleSet, body: `{"key":"a","value":"` + big + `"}`, wantCode: http.StatusOK, wantKey: "a"},
+		{name: "batch under limit", limit: 1024, route: "/batch", handler: handleBatch, body: `[{"key":"a","value":"1"},{"key":"b","value":"2"}]`, wantCode: http.StatusOK, wantKey: "b"},
+		{name: "batch over limit", limit: 1024, route: "/batch", handler: handleBatch, body: `[{"key":"a","value":"` + big + `"}]`, wantCode: http.StatusRequestEntityTooLarge},
+		{name: "empty body", limit: 1024, route: "/set", handler: handleSet, wantCode: http.StatusBadRequest},
+		{name: "malformed JSON", limit: 1024, route: "/set", handler: handleSet, body: `{"key":`, wantCode: http.StatusBadRequest},
+		{name: "wrong type", limit: 1024, route: "/batch", handler: handleBatch, body: `{"key":"a"}`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			w := serve(t, http.MethodPost, tt.route, tt.route, tt.body, limitBody(tt.limit), tt.handler)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.wantKey != "" {
+				if _, err := database.Get(tt.wantKey); err != nil {
+					t.Fatalf("Get(%q): %v", tt.wantKey, err)
+				}
+				return
+			}
+			if n := database.Len(); n != 0 {
+				t.Fatalf("%d keys written by a rejected request", n)
+			}
+		})
+	}
+}
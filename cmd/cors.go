@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsMaxAge is how long, in seconds, browsers may cache a preflight answer
+const corsMaxAge = "600"
+
+// corsExposed lists the response headers scripts on other origins may read
+const corsExposed = "ETag, X-TTL, X-Next-Cursor"
+
+// allowCORS lets browsers on the given origins call the API. origins,
+// methods and headers are comma-separated lists; an origin of * allows any
+// origin and an empty origins list disables CORS. Preflight requests from
+// an allowed origin are answered with 204 straight away, so they need no
+// API key. Requests from other origins get no CORS headers, which makes
+// the browser block them.
+func allowCORS(origins, methods, headers string) gin.HandlerFunc {
+	if origins == "" {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	allowed := make(map[string]bool)
+	for _, origin := range strings.Split(origins, ",") {
+		allowed[strings.TrimSpace(origin)] = true
+	}
+
+	return func(c *gin.Context) {
+		// Responses differ by origin, so caches must not share them
+		c.Writer.Header().Add("Vary", "Origin")
+
+		origin := c.GetHeader("Origin")
+		if origin == "" || !(allowed["*"] || allowed[origin]) {
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Access-Control-Expose-Headers", corsExposed)
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", methods)
+			c.Header("Access-Control-Allow-Headers", headers)
+			c.Header("Access-Control-Max-Age", corsMaxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsRouter is a router answering GET /get behind allowCORS with origins
+func corsRouter(origins string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(allowCORS(origins, "GET,POST", "Content-Type,X-API-Key"))
+	r.GET("/get", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func TestAllowCORS(t *testing.T) {
+	tests := []struct {
+		name          string
+		origins       string
+		method        string
+		origin        string
+		preflight     bool // Whether to send Access-Control-Request-Method
+		wantCode      int
+		wantAllowed   string // Access-Control-Allow-Origin, empty if absent
+		wantPreflight bool   // Whether the preflight headers are sent
+	}{
+		{name: "allowed origin", origins: "https://a.example, https://b.example", method: http.MethodGet, origin: "https://b.example", wantCode: http.StatusOK, wantAllowed: "https://b.example"},
+		{name: "disallowed origin", origins: "https://a.example", method: http.MethodGet, origin: "https://evil.example", wantCode: http.StatusOK},
+		{name: "no origin", origins: "https://a.example", method: http.MethodGet, wantCode: http.StatusOK},
+		{name: "any origin", origins: "*", method: http.MethodGet, origin: "https://c.example", wantCode: http.StatusOK, wantAllowed: "https://c.example"},
+		{name: "disabled", method: http.MethodGet, origin: "https://a.example", wantCode: http.StatusOK},
+		{name: "preflight", origins: "https://a.example", method: http.MethodOptions, origin: "https://a.example", preflight: true, wantCode: http.StatusNoContent, wantAllowed: "https://a.example", wantPreflight: true},
+		{name: "preflight disallowed origin", origins: "https://a.example", method: http.MethodOptions, origin: "https://evil.example", preflight: true, wantCode: http.StatusNotFound},
+		{name: "options without preflight", origins: "https://a.example", method: http.MethodOptions, origin: "https://a.example", wantCode: http.StatusNotFound, wantAllowed: "https://a.example"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/get", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			w := httptest.NewRecorder()
+			corsRouter(tt.origins).ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d", w.Code, tt.wantCode)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowed {
+				t.Fatalf("Access-Control-Allow-Origin %q, want %q", got, tt.wantAllowed)
+			}
+			gotPreflight := w.Header().Get("Access-Control-Allow-Methods") != ""
+			if gotPreflight != tt.wantPreflight {
+				t.Fatalf("Access-Control-Allow-Methods %q, want preflight headers %v", w.Header().Get("Access-Control-Allow-Methods"), tt.wantPreflight)
+			}
+			if tt.wantPreflight {
+				if got := w.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type,X-API-Key" {
+					t.Fatalf("Access-Control-Allow-Headers %q", got)
+				}
+				if got := w.Header().Get("Access-Control-Max-Age"); got != corsMaxAge {
+					t.Fatalf("Access-Control-Max-Age %q, want %q", got, corsMaxAge)
+				}
+			}
+			if tt.origins != "" && w.Header().Get("Vary") != "Origin" {
+				t.Fatalf("Vary %q, want Origin", w.Header().Get("Vary"))
+			}
+		})
+	}
+}
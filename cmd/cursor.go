@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// nextCursorHeader carries the cursor for the next page from endpoints
+// whose body is the page itself
+const nextCursorHeader = "X-Next-Cursor"
+
+// encodeCursor turns the last key of a page into an opaque cursor for the
+// next one. The empty key, meaning there is no next page, stays empty.
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// queryCursor decodes the ?cursor parameter back into the key the previous
+// page ended at, responding 400 if it isn't one of ours
+func queryCursor(c *gin.Context) (string, bool) {
+	key, err := base64.RawURLEncoding.DecodeString(c.Query("cursor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return "", false
+	}
+	return string(key), true
+}
+
+// pageStart returns where a page of keys starting at start continues after
+// the key cursor: the smallest key after it, or start if that is later
+func pageStart(start, cursor string) string {
+	if cursor == "" || cursor < start {
+		return start
+	}
+	return cursor + "\x00"
+}
+
+// prefixEnd returns the first key after every key starting with prefix,
+// or "" for no bound when there is none
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
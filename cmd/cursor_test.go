@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"saaster.tech/own-db/db"
+)
+
+func TestPageStart(t *testing.T) {
+	tests := []struct {
+		name          string
+		start, cursor string
+		want          string
+	}{
+		{name: "no cursor", start: "a", want: "a"},
+		{name: "cursor after start", start: "a", cursor: "b", want: "b\x00"},
+		{name: "cursor before start", start: "c", cursor: "b", want: "c"},
+		{name: "no start", cursor: "b", want: "b\x00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pageStart(tt.start, tt.cursor); got != tt.want {
+				t.Fatalf("pageStart(%q, %q) = %q, want %q", tt.start, tt.cursor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{prefix: "user:", want: "user;"},
+		{prefix: "a\xff", want: "b"},
+		{prefix: "\xff\xff", want: ""},
+		{prefix: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			if got := prefixEnd(tt.prefix); got != tt.want {
+				t.Fatalf("prefixEnd(%q) = %q, want %q", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryCursor(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		want     string
+		wantCode int
+	}{
+		{name: "none", wantCode: http.StatusOK},
+		{name: "round trip", query: "cursor=" + encodeCursor("user:\x00/é"), want: "user:\x00/é", wantCode: http.StatusOK},
+		{name: "invalid", query: "cursor=***", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			w := serve(t, http.MethodGet, "/", "/?"+tt.query, "", func(c *gin.Context) {
+				if key, ok := queryCursor(c); ok {
+					got = key
+					c.Status(http.StatusOK)
+				}
+			})
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d", w.Code, tt.wantCode)
+			}
+			if got != tt.want {
+				t.Fatalf("key %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// pageKeys fetches one page from an endpoint and returns its keys and the
+// cursor for the next page
+type pageKeys func(t *testing.T, cursor string) ([]string, string)
+
+func TestPaging(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		page  pageKeys
+	}{
+		{name: "keys", limit: 7, page: func(t *testing.T, cursor string) ([]string, string) {
+			w := serve(t, http.MethodGet, "/keys", "/keys?limit=7&cursor="+url.QueryEscape(cursor), "", handleKeys)
+			var body struct {
+				Keys       []string `json:"keys"`
+				NextCursor string   `json:"next_cursor"`
+			}
+			decodePage(t, w.Code, w.Body.Bytes(), &body)
+			return body.Keys, body.NextCursor
+		}},
+		{name: "scan", limit: 5, page: func(t *testing.T, cursor string) ([]string, string) {
+			w := serve(t, http.MethodGet, "/scan", "/scan?prefix=k&limit=5&cursor="+url.QueryEscape(cursor), "", handleScan)
+			var pairs map[string]string
+			decodePage(t, w.Code, w.Body.Bytes(), &pairs)
+			keys := make([]string, 0, len(pairs))
+			for key := range pairs {
+				keys = append(keys, key)
+			}
+			return keys, w.Header().Get(nextCursorHeader)
+		}},
+		{name: "range", limit: 3, page: func(t *testing.T, cursor string) ([]string, string) {
+			w := serve(t, http.MethodGet, "/range", "/range?start=k&end=l&limit=3&cursor="+url.QueryEscape(cursor), "", handleRange)
+			var pairs []db.KVPair
+			decodePage(t, w.Code, w.Body.Bytes(), &pairs)
+			keys := make([]string, 0, len(pairs))
+			for _, pair := range pairs {
+				keys = append(keys, pair.Key)
+			}
+			return keys, w.Header().Get(nextCursorHeader)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			const n = 50
+			for i := 0; i < n; i++ {
+				if err := database.Set(fmt.Sprintf("k%03d", i), "v"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Light writes while paging: overwrites of existing keys and
+			// new keys landing between them
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			defer wg.Wait()
+			defer close(stop)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; ; i++ {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					database.Set(fmt.Sprintf("k%03d", i%n), "w")
+					database.Set(fmt.Sprintf("k%03d.%d", i%n, i), "new")
+					time.Sleep(100 * time.Microsecond)
+				}
+			}()
+
+			seen := make(map[string]int)
+			cursor := ""
+			for pages := 0; ; pages++ {
+				if pages > 10*n {
+					t.Fatal("paging never ended")
+				}
+				keys, next := tt.page(t, cursor)
+				if len(keys) > tt.limit {
+					t.Fatalf("page of %d keys, limit %d", len(keys), tt.limit)
+				}
+				for _, key := range keys {
+					seen[key]++
+				}
+				if next == "" {
+					break
+				}
+				cursor = next
+			}
+
+			for key, count := range seen {
+				if count != 1 {
+					t.Errorf("%q seen %d times", key, count)
+				}
+			}
+			for i := 0; i < n; i++ {
+				if key := fmt.Sprintf("k%03d", i); seen[key] != 1 {
+					t.Errorf("%q seen %d times, want once", key, seen[key])
+				}
+			}
+		})
+	}
+}
+
+// decodePage checks a page came back 200 and decodes it into v
+func decodePage(t *testing.T, code int, body []byte, v any) {
+	t.Helper()
+	if code != http.StatusOK {
+		t.Fatalf("status %d: %s", code, body)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		t.Fatal(err)
+	}
+}
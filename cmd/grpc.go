@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"saaster.tech/own-db/db/rpc"
+	"saaster.tech/own-db/db/rpc/pb"
+)
+
+// serveGRPC starts the gRPC API on addr in the background, with the same
+// API key and TLS settings as the HTTP server. A replica rejects writes.
+func serveGRPC(addr, apiKey, tlsCert, tlsKey string, replica bool) (*grpc.Server, error) {
+	var opts []grpc.ServerOption
+	if tlsCert != "" {
+		creds, err := credentials.NewServerTLSFromFile(tlsCert, tlsKey)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	if apiKey != "" {
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				if err := checkAPIKey(ctx, apiKey); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := checkAPIKey(ss.Context(), apiKey); err != nil {
+					return err
+				}
+				return handler(srv, ss)
+			}),
+		)
+	}
+
+	// After the API key check, so unauthenticated callers learn nothing
+	if replica {
+		opts = append(opts, grpc.ChainUnaryInterceptor(rejectGRPCWrites))
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := grpc.NewServer(opts...)
+	svc := rpc.Register(s, database)
+	go func() {
+		<-shuttingDown
+		svc.Stop()
+	}()
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Fatalf("gRPC server failed: %v", err)
+		}
+	}()
+	return s, nil
+}
+
+// rejectGRPCWrites is the gRPC counterpart of rejectWrites
+func rejectGRPCWrites(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	switch info.FullMethod {
+	case pb.OwnDB_Set_FullMethodName, pb.OwnDB_Delete_FullMethodName:
+		return nil, status.Error(codes.FailedPrecondition, "this server is a read-only replica")
+	}
+	return handler(ctx, req)
+}
+
+// checkAPIKey is the gRPC counterpart of requireAPIKey, reading the key from
+// the authorization or x-api-key metadata
+func checkAPIKey(ctx context.Context, key string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var presented string
+	if values := md.Get("x-api-key"); len(values) > 0 {
+		presented = values[0]
+	}
+	if values := md.Get("authorization"); len(values) > 0 && strings.HasPrefix(values[0], "Bearer ") {
+		presented = strings.TrimPrefix(values[0], "Bearer ")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(presented), []byte(key)) != 1 {
+		return status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return nil
+}
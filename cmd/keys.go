@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"saaster.tech/own-db/db"
+)
+
+// The /keys/*key routes address a single key by its path, with any value in
+// the body. The key is everything after /keys/, percent-decoded, so it may
+// hold slashes either as they are or encoded as %2F; other reserved
+// characters such as ? and # must be encoded.
+
+// pathKey returns the key addressed by a /keys/*key route
+func pathKey(c *gin.Context) string {
+	return strings.TrimPrefix(c.Param("key"), "/")
+}
+
+// handleGetKey is handleGet for the key in the path
+func handleGetKey(c *gin.Context) {
+	getKey(c, pathKey(c))
+}
+
+// handlePutKey creates or replaces the key in the path with the value in the
+// body, so repeating the request has no further effect
+func handlePutKey(c *gin.Context) {
+	var body struct {
+		Value string `json:"value"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	if err := database.SetContext(c.Request.Context(), pathKey(c), body.Value); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// handlePatchKey replaces the value of the key in the path, responding 404
+// rather than creating it if it doesn't exist
+func handlePatchKey(c *gin.Context) {
+	var body struct {
+		Value string `json:"value"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	set, err := database.SetIfExists(pathKey(c), body.Value)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !set {
+		c.JSON(http.StatusNotFound, gin.H{"error": db.ErrKeyNotFound.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// handleDeleteKey is handleDelete for the key in the path
+func handleDeleteKey(c *gin.Context) {
+	deleteKey(c, pathKey(c))
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"saaster.tech/own-db/db"
+)
+
+func TestHandlePutKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		body     string
+		wantCode int
+		key      string // The key the request addresses
+		want     string // Its value afterwards
+	}{
+		{name: "create", target: "/keys/b", body: `{"value":"new"}`, wantCode: http.StatusOK, key: "b", want: "new"},
+		{name: "replace", target: "/keys/a", body: `{"value":"new"}`, wantCode: http.StatusOK, key: "a", want: "new"},
+		{name: "slashes", target: "/keys/users/1", body: `{"value":"new"}`, wantCode: http.StatusOK, key: "users/1", want: "new"},
+		{name: "encoded slash", target: "/keys/a%2Fb", body: `{"value":"new"}`, wantCode: http.StatusOK, key: "a/b", want: "new"},
+		{name: "not JSON", target: "/keys/a", body: `new`, wantCode: http.StatusBadRequest, key: "a", want: "one"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if err := database.Set("a", "one"); err != nil {
+				t.Fatal(err)
+			}
+
+			// PUT is idempotent, so a repeat gives the same result
+			for i := 0; i < 2; i++ {
+				w := serve(t, http.MethodPut, "/keys/*key", tt.target, tt.body, handlePutKey)
+				if w.Code != tt.wantCode {
+					t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+				}
+			}
+			if got, err := database.Get(tt.key); err != nil || got != tt.want {
+				t.Fatalf("Get(%q) = %q, %v, want %q", tt.key, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlePatchKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		body     string
+		wantCode int
+		key      string // The key the request addresses
+		want     string // Its value afterwards; "" means missing
+	}{
+		{name: "update", target: "/keys/a", body: `{"value":"new"}`, wantCode: http.StatusOK, key: "a", want: "new"},
+		{name: "missing", target: "/keys/b", body: `{"value":"new"}`, wantCode: http.StatusNotFound, key: "b"},
+		{name: "slashes", target: "/keys/users/1", body: `{"value":"new"}`, wantCode: http.StatusOK, key: "users/1", want: "new"},
+		{name: "not JSON", target: "/keys/a", body: `new`, wantCode: http.StatusBadRequest, key: "a", want: "one"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if err := database.Set("a", "one"); err != nil {
+				t.Fatal(err)
+			}
+			if err := database.Set("users/1", "one"); err != nil {
+				t.Fatal(err)
+			}
+
+			w := serve(t, http.MethodPatch, "/keys/*key", tt.target, tt.body, handlePatchKey)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			got, err := database.Get(tt.key)
+			if tt.want == "" {
+				if !errors.Is(err, db.ErrKeyNotFound) {
+					t.Fatalf("Get(%q) = %q, %v, want ErrKeyNotFound", tt.key, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Get(%q) = %q, %v, want %q", tt.key, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// keysRouter is a router with the /keys/*key routes and the older /get
+func keysRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/keys/*key", handleGetKey)
+	r.PUT("/keys/*key", handlePutKey)
+	r.PATCH("/keys/*key", handlePatchKey)
+	r.DELETE("/keys/*key", handleDeleteKey)
+	r.GET("/get", handleGet)
+	return r
+}
+
+func TestKeyRoutes(t *testing.T) {
+	tests := []struct {
+		name string
+		path string // The key as it appears in the URL
+		key  string // The key as stored
+	}{
+		{name: "plain", path: "user", key: "user"},
+		{name: "slash", path: "users/1/name", key: "users/1/name"},
+		{name: "encoded slash", path: "users%2F1", key: "users/1"},
+		{name: "leading slash", path: "%2Fabs", key: "/abs"},
+		{name: "space", path: "a%20b", key: "a b"},
+		{name: "question mark", path: "what%3F", key: "what?"},
+		{name: "hash", path: "tag%231", key: "tag#1"},
+		{name: "percent", path: "100%25", key: "100%"},
+		{name: "plus", path: "a+b", key: "a+b"},
+		{name: "colon", path: "user:1", key: "user:1"},
+		{name: "unicode", path: "caf%C3%A9", key: "café"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			r := keysRouter()
+			do := func(method, target, body string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, target, strings.NewReader(body))
+				if body != "" {
+					req.Header.Set("Content-Type", "application/json")
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				return w
+			}
+			target := "/keys/" + tt.path
+
+			if w := do(http.MethodPut, target, `{"value":"one"}`); w.Code != http.StatusOK {
+				t.Fatalf("PUT status %d: %s", w.Code, w.Body)
+			}
+			if got, err := database.Get(tt.key); err != nil || got != "one" {
+				t.Fatalf("Get(%q) = %q, %v after PUT", tt.key, got, err)
+			}
+			if w := do(http.MethodPatch, target, `{"value":"two"}`); w.Code != http.StatusOK {
+				t.Fatalf("PATCH status %d: %s", w.Code, w.Body)
+			}
+
+			w := do(http.MethodGet, target, "")
+			var body struct {
+				Key   string `json:"key"`
+				Value string `json:"value"`
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET status %d: %s", w.Code, w.Body)
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Key != tt.key || body.Value != "two" {
+				t.Fatalf("GET = %+v, want %q holding two", body, tt.key)
+			}
+
+			// The older endpoints see the same key
+			if w := do(http.MethodGet, "/get?key="+url.QueryEscape(tt.key), ""); w.Code != http.StatusOK {
+				t.Fatalf("GET /get status %d: %s", w.Code, w.Body)
+			}
+
+			if w := do(http.MethodDelete, target, ""); w.Code != http.StatusOK {
+				t.Fatalf("DELETE status %d: %s", w.Code, w.Body)
+			}
+			if w := do(http.MethodGet, target, ""); w.Code != http.StatusNotFound {
+				t.Fatalf("GET after DELETE status %d, want 404", w.Code)
+			}
+		})
+	}
+}
+
+func TestKeyRoutesEmptyKey(t *testing.T) {
+	tests := []struct {
+		method   string
+		body     string
+		wantCode int
+	}{
+		{method: http.MethodGet, wantCode: http.StatusNotFound},
+		{method: http.MethodPut, body: `{"value":"one"}`, wantCode: http.StatusBadRequest},
+		{method: http.MethodPatch, body: `{"value":"one"}`, wantCode: http.StatusNotFound},
+		{method: http.MethodDelete, wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			openTestDatabase(t)
+			req := httptest.NewRequest(tt.method, "/keys/", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			keysRouter().ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if n := database.Len(); n != 0 {
+				t.Fatalf("%d keys after a request for the empty key", n)
+			}
+		})
+	}
+}
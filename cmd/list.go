@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleLPush adds values to the head of a list
+func handleLPush(c *gin.Context) {
+	handlePush(c, database.LPush)
+}
+
+// handleRPush adds values to the tail of a list
+func handleRPush(c *gin.Context) {
+	handlePush(c, database.RPush)
+}
+
+// handlePush runs push, LPush or RPush, with the key and values in the
+// request body and responds with the new length
+func handlePush(c *gin.Context, push func(key string, values ...string) (int, error)) {
+	var body struct {
+		Key    string   `json:"key"`
+		Values []string `json:"values"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	n, err := push(body.Key, body.Values...)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key": body.Key, "length": n})
+}
+
+// handleLPop removes the first item of a list
+func handleLPop(c *gin.Context) {
+	handlePop(c, database.LPop)
+}
+
+// handleRPop removes the last item of a list
+func handleRPop(c *gin.Context) {
+	handlePop(c, database.RPop)
+}
+
+// handlePop runs pop, LPop or RPop, with the key in the request body. An
+// empty list gets 404, as it is stored as no key at all.
+func handlePop(c *gin.Context, pop func(key string) (string, bool, error)) {
+	var body struct {
+		Key string `json:"key"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	value, ok, err := pop(body.Key)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "List is empty"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key": body.Key, "value": value})
+}
+
+// handleLRange returns the items of a list from ?start (default 0) to
+// ?stop (default -1, the last item), both included
+func handleLRange(c *gin.Context) {
+	key := c.Query("key")
+	start, err := strconv.Atoi(c.DefaultQuery("start", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start"})
+		return
+	}
+	stop, err := strconv.Atoi(c.DefaultQuery("stop", "-1"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stop"})
+		return
+	}
+
+	items, err := database.LRange(key, start, stop)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key": key, "items": items})
+}
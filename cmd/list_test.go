@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandlePush(t *testing.T) {
+	tests := []struct {
+		name     string
+		route    string
+		handler  gin.HandlerFunc
+		body     string
+		wantCode int
+		want     string
+		wantList string // /lrange afterwards
+	}{
+		{name: "rpush", route: "/rpush", handler: handleRPush, body: `{"key":"q","values":["c","d"]}`, wantCode: http.StatusOK, want: `{"key":"q","length":4}`, wantList: `["a","b","c","d"]`},
+		{name: "lpush", route: "/lpush", handler: handleLPush, body: `{"key":"q","values":["c","d"]}`, wantCode: http.StatusOK, want: `{"key":"q","length":4}`, wantList: `["d","c","a","b"]`},
+		{name: "new key", route: "/rpush", handler: handleRPush, body: `{"key":"new","values":["x"]}`, wantCode: http.StatusOK, want: `{"key":"new","length":1}`, wantList: `["a","b"]`},
+		{name: "no values", route: "/rpush", handler: handleRPush, body: `{"key":"q"}`, wantCode: http.StatusOK, want: `{"key":"q","length":2}`, wantList: `["a","b"]`},
+		{name: "not a list", route: "/lpush", handler: handleLPush, body: `{"key":"text","values":["x"]}`, wantCode: http.StatusBadRequest, wantList: `["a","b"]`},
+		{name: "bad body", route: "/rpush", handler: handleRPush, body: `{"key":"q","values":"x"}`, wantCode: http.StatusBadRequest, wantList: `["a","b"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if _, err := database.RPush("q", "a", "b"); err != nil {
+				t.Fatal(err)
+			}
+			if err := database.Set("text", "plain"); err != nil {
+				t.Fatal(err)
+			}
+
+			w := serve(t, http.MethodPost, tt.route, tt.route, tt.body, tt.handler)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Fatalf("body %s, want %s", w.Body, tt.want)
+			}
+
+			w = serve(t, http.MethodGet, "/lrange", "/lrange?key=q", "", handleLRange)
+			if want := `{"items":` + tt.wantList + `,"key":"q"}`; w.Body.String() != want {
+				t.Fatalf("list %s, want %s", w.Body, want)
+			}
+		})
+	}
+}
+
+func TestHandlePop(t *testing.T) {
+	tests := []struct {
+		name     string
+		route    string
+		handler  gin.HandlerFunc
+		body     string
+		wantCode int
+		want     string
+	}{
+		{name: "lpop", route: "/lpop", handler: handleLPop, body: `{"key":"q"}`, wantCode: http.StatusOK, want: `{"key":"q","value":"a"}`},
+		{name: "rpop", route: "/rpop", handler: handleRPop, body: `{"key":"q"}`, wantCode: http.StatusOK, want: `{"key":"q","value":"b"}`},
+		{name: "empty", route: "/lpop", handler: handleLPop, body: `{"key":"missing"}`, wantCode: http.StatusNotFound},
+		{name: "not a list", route: "/rpop", handler: handleRPop, body: `{"key":"text"}`, wantCode: http.StatusBadRequest},
+		{name: "bad body", route: "/lpop", handler: handleLPop, body: `q`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if _, err := database.RPush("q", "a", "b"); err != nil {
+				t.Fatal(err)
+			}
+			if err := database.Set("text", "plain"); err != nil {
+				t.Fatal(err)
+			}
+
+			w := serve(t, http.MethodPost, tt.route, tt.route, tt.body, tt.handler)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Fatalf("body %s, want %s", w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleLRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		want     string
+	}{
+		{name: "defaults", query: "?key=q", wantCode: http.StatusOK, want: `{"items":["a","b","c"],"key":"q"}`},
+		{name: "bounds", query: "?key=q&start=1&stop=1", wantCode: http.StatusOK, want: `{"items":["b"],"key":"q"}`},
+		{name: "negative", query: "?key=q&start=-2", wantCode: http.StatusOK, want: `{"items":["b","c"],"key":"q"}`},
+		{name: "out of range", query: "?key=q&start=5", wantCode: http.StatusOK, want: `{"items":[],"key":"q"}`},
+		{name: "missing key", query: "?key=missing", wantCode: http.StatusOK, want: `{"items":[],"key":"missing"}`},
+		{name: "bad start", query: "?key=q&start=x", wantCode: http.StatusBadRequest},
+		{name: "bad stop", query: "?key=q&stop=1.5", wantCode: http.StatusBadRequest},
+		{name: "not a list", query: "?key=text", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if _, err := database.RPush("q", "a", "b", "c"); err != nil {
+				t.Fatal(err)
+			}
+			if err := database.Set("text", "plain"); err != nil {
+				t.Fatal(err)
+			}
+
+			w := serve(t, http.MethodGet, "/lrange", "/lrange"+tt.query, "", handleLRange)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Fatalf("body %s, want %s", w.Body, tt.want)
+			}
+		})
+	}
+}
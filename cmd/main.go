@@ -1,66 +1,1070 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
 	"saaster.tech/own-db/db"
+	"saaster.tech/own-db/db/metrics"
+	"saaster.tech/own-db/db/replica"
 )
 
 var database *db.SimpleDB
 
+// shuttingDown is closed when the server starts shutting down, to end
+// streams such as watches that would otherwise hold the shutdown up
+var shuttingDown = make(chan struct{})
+
+// shutdownTimeout bounds how long in-flight requests get to finish on exit
+const shutdownTimeout = 10 * time.Second
+
 func main() {
+	apiKey := flag.String("api-key", os.Getenv("OWNDB_API_KEY"), "key clients must present as a bearer token or X-API-Key header (default $OWNDB_API_KEY)")
+	tlsCert := flag.String("tls-cert", os.Getenv("OWNDB_TLS_CERT"), "TLS certificate file; serves HTTPS with HTTP/2 when set with -tls-key (default $OWNDB_TLS_CERT)")
+	tlsKey := flag.String("tls-key", os.Getenv("OWNDB_TLS_KEY"), "TLS private key file (default $OWNDB_TLS_KEY)")
+	rateLimit := flag.Float64("rate", 0, "requests per second allowed before responding 429; zero disables rate limiting")
+	rateBurst := flag.Int("burst", 20, "requests allowed in a burst above -rate")
+	ratePerIP := flag.Bool("rate-per-ip", true, "apply -rate to each client IP separately instead of to all clients together")
+	trustedProxies := flag.String("trusted-proxies", "", "comma-separated addresses or CIDRs of proxies whose X-Forwarded-For header gives the client IP; empty uses the connection's address")
+	grpcAddr := flag.String("grpc-addr", "", "address to serve the gRPC API on, e.g. :9090; empty disables it")
+	addr := flag.String("addr", ":8080", "address to serve the HTTP API on")
+	corsOrigins := flag.String("cors-origins", "", "comma-separated origins browsers may call the API from, or * for any; empty disables CORS")
+	corsMethods := flag.String("cors-methods", "GET,POST,PUT,PATCH,DELETE", "comma-separated methods allowed in cross-origin requests")
+	corsHeaders := flag.String("cors-headers", "Authorization,Content-Type,If-Match,If-None-Match,X-API-Key", "comma-separated request headers allowed in cross-origin requests")
+	maxBody := flag.Int64("max-body", 8<<20, "largest JSON request body accepted, in bytes, before responding 413; zero disables the limit")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "URL of an OTLP/HTTP collector to send traces to, e.g. http://localhost:4318; empty disables tracing")
+	replicaOf := flag.String("replica-of", "", "URL of a primary server to replicate, e.g. http://primary:8080; the server then rejects writes of its own")
+	primaryAPIKey := flag.String("primary-api-key", os.Getenv("OWNDB_PRIMARY_API_KEY"), "key presented to the server given by -replica-of (default $OWNDB_PRIMARY_API_KEY)")
+	flag.Usage = usage
+	flag.Parse()
+
+	switch flag.Arg(0) {
+	case "rebuild":
+		if err := rebuild(flag.Arg(1)); err != nil {
+			log.Fatalf("Rebuild failed: %v", err)
+		}
+		return
+	case "maintain":
+		if err := maintain(flag.Arg(1)); err != nil {
+			log.Fatalf("Maintenance failed: %v", err)
+		}
+		return
+	case "verify":
+		ok, err := verify(flag.Arg(1))
+		if err != nil {
+			log.Fatalf("Verify failed: %v", err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatal("-tls-cert and -tls-key must be set together")
+	}
+	if *apiKey == "" {
+		log.Println("No API key configured; the server accepts unauthenticated requests")
+	}
+
+	tracer, shutdownTracing, err := setupTracing(*otlpEndpoint)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	// Initialize the database
-	var err error
-	database, err = db.OpenDB("mydb.data")
+	collector := metrics.New()
+
+	database, err = db.OpenDBWithOptions(defaultPath, db.Options{Observer: collector, Tracer: tracer, Logger: slog.Default()})
 	if err != nil {
 		panic("Failed to open database: " + err.Error())
 	}
-	defer database.Close()
+	collector.Track(database)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
 
 	r := gin.Default()
+	if err := trustProxies(r, *trustedProxies); err != nil {
+		log.Fatalf("Invalid -trusted-proxies: %v", err)
+	}
+	// First, so preflights are answered before anything asks for a key
+	r.Use(allowCORS(*corsOrigins, *corsMethods, *corsHeaders), propagateTrace)
+
+	// Probes come before the middleware so orchestrators need no API key
+	r.GET("/healthz", handleHealthz)
+	r.GET("/readyz", handleReadyz)
+
+	r.Use(limit(*rateLimit, *rateBurst, *ratePerIP), requireAPIKey(*apiKey))
+
+	// Unlike the probes, /ping writes to disk, so it sits behind the limits
+	r.GET("/ping", handlePing)
+
+	// A replica's data only changes through replication
+	writable := func(*gin.Context) {}
+	if *replicaOf != "" {
+		writable = rejectWrites
+	}
 
-	r.POST("/set", handleSet)
+	// Bulk endpoints that stream their body (/restore, /import) aren't capped
+	sized := limitBody(*maxBody)
+
+	r.POST("/set", writable, sized, handleSet)
+	r.POST("/setnx", writable, sized, handleSetNX)
+	r.POST("/getorset", writable, sized, handleGetOrSet)
+	r.GET("/keys/*key", handleGetKey)
+	r.PUT("/keys/*key", writable, sized, handlePutKey)
+	r.PATCH("/keys/*key", writable, sized, handlePatchKey)
+	r.DELETE("/keys/*key", writable, handleDeleteKey)
+	r.POST("/batch", writable, sized, handleBatch)
+	r.POST("/cas", writable, sized, handleCAS)
+	r.POST("/incr", writable, sized, handleIncr)
+	r.POST("/append", writable, sized, handleAppend)
+	r.POST("/touch", writable, sized, handleTouch)
+	r.POST("/field", writable, sized, handleSetField)
+	r.POST("/lpush", writable, sized, handleLPush)
+	r.POST("/rpush", writable, sized, handleRPush)
+	r.POST("/lpop", writable, sized, handleLPop)
+	r.POST("/rpop", writable, sized, handleRPop)
+	r.POST("/sadd", writable, sized, handleSAdd)
+	r.POST("/srem", writable, sized, handleSRem)
+	r.POST("/copy", writable, sized, handleCopy)
+	r.POST("/rename", writable, sized, handleRename)
+	r.POST("/mget", sized, handleMGet)
+	r.POST("/mdel", writable, sized, handleMDel)
 	r.GET("/get", handleGet)
-	r.DELETE("/delete", handleDelete)
+	r.GET("/field", handleGetField)
+	r.GET("/lrange", handleLRange)
+	r.GET("/smembers", handleSMembers)
+	r.GET("/sismember", handleSIsMember)
+	r.GET("/exists", handleExists)
+	r.GET("/keys", handleKeys)
+	r.GET("/scan", handleScan)
+	r.GET("/range", handleRange)
+	r.GET("/stream", handleStream)
+	r.GET("/watch", handleWatch)
+	r.GET("/count", handleCount)
+	r.GET("/stats", handleStats)
+	r.GET("/compact/estimate", handleCompactEstimate)
+	r.POST("/maintenance", writable, handleMaintenance)
+	r.POST("/backup", handleBackup)
+	r.POST("/restore", writable, handleRestore)
+	r.GET("/export", handleExport)
+	r.POST("/import", writable, handleImport)
+	r.POST("/clear", writable, handleClear)
+	r.DELETE("/delete", writable, handleDelete)
+	r.DELETE("/range", writable, handleDeleteRange)
+	r.GET("/replication/snapshot", handleReplicationSnapshot)
+	r.GET("/replication/log", handleReplicationLog)
+	r.GET("/log", handleLog)
+	r.GET("/metrics", gin.WrapH(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
+
+	srv := &http.Server{
+		Addr:    *addr,
+		Handler: r,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	following := make(chan struct{})
+	if *replicaOf != "" {
+		go func() {
+			follower := &replica.Follower{
+				DB:        database,
+				Primary:   *replicaOf,
+				APIKey:    *primaryAPIKey,
+				StatePath: defaultPath + positionSuffix,
+				Logger:    slog.Default(),
+			}
+			follower.Run(ctx)
+			close(following)
+		}()
+	} else {
+		close(following)
+	}
+
+	go func() {
+		if err := listen(srv, *tlsCert, *tlsKey); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	var grpcServer *grpc.Server
+	if *grpcAddr != "" {
+		grpcServer, err = serveGRPC(*grpcAddr, *apiKey, *tlsCert, *tlsKey, *replicaOf != "")
+		if err != nil {
+			log.Fatalf("gRPC server failed: %v", err)
+		}
+	}
+
+	<-ctx.Done()
+	stop()
+	shutdown(srv, grpcServer, following, shutdownTracing)
+}
+
+// listen serves srv over HTTPS if a certificate is given and plain HTTP
+// otherwise, until it is shut down
+func listen(srv *http.Server, tlsCert, tlsKey string) error {
+	if tlsCert != "" {
+		// net/http negotiates HTTP/2 over TLS automatically
+		return srv.ListenAndServeTLS(tlsCert, tlsKey)
+	}
+	return srv.ListenAndServe()
+}
+
+// shutdown stops the servers, waiting up to shutdownTimeout for in-flight
+// requests, then waits for replication to stop before flushing and closing
+// the database, so no write is cut off halfway
+func shutdown(srv *http.Server, grpcServer *grpc.Server, following <-chan struct{}, shutdownTracing func(context.Context) error) {
+	log.Println("Shutting down server...")
+	close(shuttingDown)
+
+	// Stop accepting connections and wait for in-flight requests, so no
+	// write is cut off before the database is closed underneath it
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown: %v", err)
+	}
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-shutdownCtx.Done():
+			grpcServer.Stop()
+		}
+	}
+
+	<-following
+
+	if err := database.Flush(); err != nil {
+		log.Printf("Failed to flush database: %v", err)
+	}
+	if err := database.Close(); err != nil {
+		log.Printf("Failed to close database: %v", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+}
+
+// etag formats a key version as an HTTP entity tag
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseIfMatch reads the versions an If-Match header asks for: * for any
+// version of a key that exists, or a comma-separated list of ETags from
+// etag. If-Match compares tags strongly, so weak tags are left out; they
+// never match, and a header of nothing but weak tags matches no version.
+func parseIfMatch(match string) ([]int64, bool) {
+	if strings.TrimSpace(match) == "*" {
+		return []int64{db.AnyVersion}, true
+	}
+	versions := []int64{}
+	for _, tag := range strings.Split(match, ",") {
+		tag = strings.TrimSpace(tag)
+		weak := strings.HasPrefix(tag, "W/")
+		version, ok := parseETag(strings.TrimPrefix(tag, "W/"))
+		if !ok {
+			return nil, false
+		}
+		if !weak {
+			versions = append(versions, version)
+		}
+	}
+	return versions, true
+}
+
+// parseETag reads the version in an ETag from etag
+func parseETag(tag string) (int64, bool) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil || version < 0 {
+		return 0, false
+	}
+	return version, true
+}
 
-	r.Run(":8080")
+// noneMatch reports whether an If-None-Match header matches the ETag of
+// version. Unlike If-Match it compares tags weakly, so W/"7" matches "7";
+// the header may list several tags, and * matches any version.
+func noneMatch(header string, version int64) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag(version) {
+			return true
+		}
+	}
+	return false
 }
 
+// setIfMatch writes key if its version is one of those parseIfMatch
+// returned, failing with db.ErrVersionMismatch otherwise
+func setIfMatch(key, value string, versions []int64) (int64, error) {
+	switch len(versions) {
+	case 0:
+		return 0, db.ErrVersionMismatch
+	case 1:
+		return database.SetIfVersion(key, value, versions[0])
+	}
+	for {
+		_, current, err := database.GetVersioned(key)
+		if err != nil && !errors.Is(err, db.ErrKeyNotFound) {
+			return 0, err
+		}
+		if !slices.Contains(versions, current) {
+			return 0, db.ErrVersionMismatch
+		}
+		// A write in between may have moved the key to another listed version
+		version, err := database.SetIfVersion(key, value, current)
+		if !errors.Is(err, db.ErrVersionMismatch) {
+			return version, err
+		}
+	}
+}
+
+// errorStatus maps an error from the database to its HTTP status
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, db.ErrKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, db.ErrKeyTooLarge), errors.Is(err, db.ErrValueTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, db.ErrVersionMismatch):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, db.ErrNotInteger), errors.Is(err, db.ErrInvalidKey),
+		errors.Is(err, db.ErrNotObject), errors.Is(err, db.ErrInvalidJSON),
+		errors.Is(err, db.ErrNotList), errors.Is(err, db.ErrNotSet),
+		errors.Is(err, db.ErrNotBoundary):
+		return http.StatusBadRequest
+	case errors.Is(err, db.ErrReadOnly):
+		return http.StatusForbidden
+	case errors.Is(err, db.ErrClosed):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, db.ErrOffsetOutOfRange):
+		return http.StatusRequestedRangeNotSatisfiable
+	case errors.Is(err, db.ErrStalePosition):
+		return http.StatusGone
+	}
+	return http.StatusInternalServerError
+}
+
+// handleSet writes a key. With an If-Match header holding the ETag from
+// /get, or a list of them, the write only happens if the key is still at
+// one of those versions, and fails with 412 otherwise; If-Match: * only
+// writes a key that exists.
 func handleSet(c *gin.Context) {
 	var body struct {
 		Key   string `json:"key"`
 		Value string `json:"value"`
+		TTL   int64  `json:"ttl"` // Seconds until the key expires; zero means never
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	if match := c.GetHeader("If-Match"); match != "" {
+		expected, ok := parseIfMatch(match)
+		if !ok || body.TTL > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "If-Match must be * or an ETag from /get and can't be combined with ttl"})
+			return
+		}
+		version, err := setIfMatch(body.Key, body.Value, expected)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("ETag", etag(version))
+		c.Status(http.StatusOK)
+		return
+	}
+
+	var err error
+	if body.TTL > 0 {
+		err = database.SetWithTTL(body.Key, body.Value, time.Duration(body.TTL)*time.Second)
+	} else {
+		err = database.SetContext(c.Request.Context(), body.Key, body.Value)
+	}
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func handleSetNX(c *gin.Context) {
+	var body struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	set, err := database.SetNX(body.Key, body.Value)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"set": set})
+}
+
+// handleGetOrSet responds with the value of the key, setting it to the value
+// in the body first if it doesn't exist, and whether that write happened
+func handleGetOrSet(c *gin.Context) {
+	var body struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	value, set, err := database.GetOrSet(body.Key, body.Value)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key": body.Key, "value": value, "set": set})
+}
+
+func handleBatch(c *gin.Context) {
+	var pairs []db.KVPair
+	if !bindJSON(c, &pairs) {
+		return
+	}
+
+	if err := database.BatchSet(pairs); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func handleCAS(c *gin.Context) {
+	var body struct {
+		Key string `json:"key"`
+		Old string `json:"old"`
+		New string `json:"new"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	swapped, err := database.CompareAndSwap(body.Key, body.Old, body.New)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"swapped": swapped})
+}
+
+func handleIncr(c *gin.Context) {
+	var body struct {
+		Key   string `json:"key"`
+		Delta int64  `json:"delta"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	value, err := database.Increment(body.Key, body.Delta)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key": body.Key, "value": value})
+}
+
+func handleAppend(c *gin.Context) {
+	var body struct {
+		Key    string `json:"key"`
+		Suffix string `json:"suffix"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	value, err := database.Append(body.Key, body.Suffix)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key": body.Key, "value": value})
+}
+
+// handleSetField sets one field of a JSON object value. The field value is
+// sent as JSON, so {"value": 42} stores a number and {"value": "42"} a
+// string.
+func handleSetField(c *gin.Context) {
+	var body struct {
+		Key   string          `json:"key"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+	if body.Path == "" || body.Value == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a key, a path and a value"})
+		return
+	}
+
+	if err := database.SetField(body.Key, body.Path, string(body.Value)); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// handleGetField returns one field of a JSON object value
+func handleGetField(c *gin.Context) {
+	key, path := c.Query("key"), c.Query("path")
+	if path == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing path"})
+		return
 	}
-	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+
+	value, err := database.GetField(key, path)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := database.Set(body.Key, body.Value); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	c.JSON(http.StatusOK, gin.H{"key": key, "path": path, "value": json.RawMessage(value)})
+}
+
+// handleCopy copies the value of one key to another
+func handleCopy(c *gin.Context) {
+	handleMove(c, database.Copy)
+}
+
+// handleRename moves the value of one key to another
+func handleRename(c *gin.Context) {
+	handleMove(c, database.Rename)
+}
+
+// handleMove runs move, Copy or Rename, with the keys in the request body
+func handleMove(c *gin.Context, move func(src, dst string) error) {
+	var body struct {
+		Src string `json:"src"`
+		Dst string `json:"dst"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	if err := move(body.Src, body.Dst); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.Status(http.StatusOK)
 }
 
+// handleTouch resets a key's TTL to ttl seconds from now without resending
+// its value
+func handleTouch(c *gin.Context) {
+	var body struct {
+		Key string `json:"key"`
+		TTL int64  `json:"ttl"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+	if body.TTL <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a key and a positive ttl in seconds"})
+		return
+	}
+
+	if err := database.Touch(body.Key, time.Duration(body.TTL)*time.Second); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// handleMGet responds with an object mapping the requested keys that exist to
+// their values, or with ?ordered=true an array of values in request order
+// with null for missing keys
+func handleMGet(c *gin.Context) {
+	var keys []string
+	if !bindJSON(c, &keys) {
+		return
+	}
+
+	if c.Query("ordered") == "true" {
+		values, err := database.GetMultiOrdered(keys)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, values)
+		return
+	}
+
+	values, err := database.GetMulti(keys)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, values)
+}
+
+func handleMDel(c *gin.Context) {
+	var keys []string
+	if !bindJSON(c, &keys) {
+		return
+	}
+
+	deleted, err := database.DeleteMulti(keys)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
+
+// handleGet returns the value along with its version as the ETag, which can
+// be sent back in If-Match to /set, and for keys with a TTL the whole seconds
+// left in X-TTL. A request whose If-None-Match already holds the current
+// ETag, weak or strong, or is * gets 304 with no body. A missing key gets 404, unless the request has
+// a default query parameter, which is then returned as the value with 200
+// and no ETag.
 func handleGet(c *gin.Context) {
-	key := c.Query("key")
-	value, err := database.Get(key)
+	getKey(c, c.Query("key"))
+}
+
+// getKey responds with the value and metadata of key for handleGet and
+// handleGetKey
+func getKey(c *gin.Context, key string) {
+	value, meta, err := database.GetWithMetaContext(c.Request.Context(), key)
+	if errors.Is(err, db.ErrKeyNotFound) {
+		if fallback, ok := c.GetQuery("default"); ok {
+			c.JSON(http.StatusOK, gin.H{"key": key, "value": fallback})
+			return
+		}
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Key not found"})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
+	if !meta.ExpiresAt.IsZero() {
+		c.Header("X-TTL", strconv.FormatInt(int64(time.Until(meta.ExpiresAt)/time.Second), 10))
+	}
+	c.Header("ETag", etag(meta.Version))
+	if noneMatch(c.GetHeader("If-None-Match"), meta.Version) {
+		c.Status(http.StatusNotModified)
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"key": key, "value": value})
 }
 
-func handleDelete(c *gin.Context) {
+func handleExists(c *gin.Context) {
 	key := c.Query("key")
-	err := database.Delete(key)
+	if !database.Exists(key) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// handleKeys lists keys in sorted order. Pages are requested with limit and
+// continued by passing next_cursor back as cursor. Pages follow key order
+// rather than positions, so keys written or deleted between requests never
+// make a page repeat or skip a key that stayed put. The older after and
+// next parameters do the same with plain keys.
+func handleKeys(c *gin.Context) {
+	cursor, ok := queryCursor(c)
+	if !ok {
+		return
+	}
+	limit, ok := queryLimit(c)
+	if !ok {
+		return
+	}
+
+	keys := database.Keys()
+	after := c.Query("after")
+	if cursor != "" {
+		after = cursor
+	}
+	if after != "" {
+		keys = keys[sort.Search(len(keys), func(i int) bool { return keys[i] > after }):]
+	}
+
+	next := ""
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		next = keys[limit-1]
+	}
+
+	c.JSON(http.StatusOK, gin.H{"keys": keys, "next": next, "next_cursor": encodeCursor(next)})
+}
+
+// handleScan returns the pairs whose key starts with prefix. With limit it
+// returns them a page at a time, like /keys, and the cursor for the next
+// page comes in the X-Next-Cursor header.
+func handleScan(c *gin.Context) {
+	prefix := c.Query("prefix")
+	cursor, ok := queryCursor(c)
+	if !ok {
+		return
+	}
+	limit, ok := queryLimit(c)
+	if !ok {
+		return
+	}
+
+	if limit == 0 && cursor == "" {
+		pairs, err := database.ScanPrefixContext(c.Request.Context(), prefix)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, pairs)
+		return
+	}
+
+	pairs, ok := scanPage(c, pageStart(prefix, cursor), prefixEnd(prefix), limit)
+	if !ok {
+		return
+	}
+	result := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		result[pair.Key] = pair.Value
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// handleRange returns the pairs with start <= key < end in key order,
+// paged like /scan
+func handleRange(c *gin.Context) {
+	cursor, ok := queryCursor(c)
+	if !ok {
+		return
+	}
+	limit, ok := queryLimit(c)
+	if !ok {
+		return
+	}
+
+	pairs, ok := scanPage(c, pageStart(c.Query("start"), cursor), c.Query("end"), limit)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, pairs)
+}
+
+// scanPage reads up to limit pairs from the range, setting X-Next-Cursor
+// if there are more. It responds with the error itself if the scan fails.
+func scanPage(c *gin.Context, start, end string, limit int) ([]db.KVPair, bool) {
+	fetch := limit
+	if limit > 0 {
+		// One extra tells whether there is another page
+		fetch++
+	}
+	pairs, err := database.ScanRangeLimit(c.Request.Context(), start, end, fetch)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Key not found"})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if limit > 0 && len(pairs) > limit {
+		pairs = pairs[:limit]
+		c.Header(nextCursorHeader, encodeCursor(pairs[limit-1].Key))
+	}
+	return pairs, true
+}
+
+// handleDeleteRange deletes the keys with start <= key < end. At least one
+// bound is required so a bare request can't wipe the database.
+func handleDeleteRange(c *gin.Context) {
+	start, end := c.Query("start"), c.Query("end")
+	if start == "" && end == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start or end is required"})
+		return
+	}
+
+	deleted, err := database.DeleteRange(start, end)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error(), "deleted": deleted})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
+
+// handleStream writes every key-value pair as newline-delimited JSON,
+// reading values one at a time so large databases aren't buffered in memory
+func handleStream(c *gin.Context) {
+	it, err := database.NewIterator()
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	defer it.Close()
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+	for it.Next() {
+		value, err := it.Value()
+		if err != nil {
+			// Headers are already sent; all we can do is stop the stream
+			return
+		}
+		if err := enc.Encode(db.KVPair{Key: it.Key(), Value: value}); err != nil {
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+// handleWatch streams every set and delete of a key starting with prefix as
+// server-sent events until the client disconnects or the server shuts down
+func handleWatch(c *gin.Context) {
+	events, cancel := database.WatchPrefix(c.Query("prefix"))
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-shuttingDown:
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type.String(), gin.H{"key": event.Key, "value": event.Value})
+			return true
+		}
+	})
+}
+
+// handleHealthz is the liveness probe; answering at all means the server is up
+func handleHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// handleReadyz is the readiness probe. It fails while the last write to disk
+// or background job on the database has failed.
+func handleReadyz(c *gin.Context) {
+	if err := database.Health(); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// handlePing writes an internal record and reads it back, a deeper check
+// than /readyz that the disk still takes writes
+func handlePing(c *gin.Context) {
+	if err := database.Ping(); err != nil {
+		c.JSON(errorStatus(err), gin.H{"status": "unavailable", "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func handleCount(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"count": database.Len()})
+}
+
+func handleStats(c *gin.Context) {
+	stats, err := database.Stats()
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// handleCompactEstimate reports how many bytes a compaction would keep and
+// reclaim, without running one
+func handleCompactEstimate(c *gin.Context) {
+	liveBytes, deadBytes, err := database.EstimateCompaction()
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"live_bytes": liveBytes, "dead_bytes": deadBytes})
+}
+
+// handleMaintenance sweeps expired keys and compacts the database, for cron
+// jobs to call, and responds with the before and after figures
+func handleMaintenance(c *gin.Context) {
+	report, err := database.Maintenance()
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func handleBackup(c *gin.Context) {
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", `attachment; filename="backup.data"`)
+	c.Status(http.StatusOK)
+
+	if err := database.Backup(c.Writer); err != nil {
+		// Headers are already sent, so the client sees a truncated body
+		log.Printf("Backup failed: %v", err)
+	}
+}
+
+// handleRestore loads a dump from the request body. Existing keys are kept
+// unless overwrite=true is passed.
+func handleRestore(c *gin.Context) {
+	overwrite := c.Query("overwrite") == "true"
+
+	imported, err := database.Restore(c.Request.Body, overwrite)
+	if errors.Is(err, db.ErrCorrupt) || errors.Is(err, io.ErrUnexpectedEOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "imported": imported})
+		return
+	}
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error(), "imported": imported})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"imported": imported})
+}
+
+// handleExport dumps all pairs as JSON (the default) or CSV
+func handleExport(c *gin.Context) {
+	var export func(io.Writer) error
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.Header("Content-Type", "application/json")
+		export = database.ExportJSON
+	case "csv":
+		c.Header("Content-Type", "text/csv")
+		export = database.ExportCSV
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown format"})
+		return
+	}
+
+	c.Status(http.StatusOK)
+	if err := export(c.Writer); err != nil {
+		log.Printf("Export failed: %v", err)
+	}
+}
+
+// handleImport sets every pair in a JSON (the default) or CSV request body
+func handleImport(c *gin.Context) {
+	var importer func(io.Reader) (int, error)
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		importer = database.ImportJSON
+	case "csv":
+		importer = database.ImportCSV
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown format"})
+		return
+	}
+
+	imported, err := importer(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "imported": imported})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"imported": imported})
+}
+
+// handleClear deletes every key. It requires confirm=true so a stray request
+// can't empty the database.
+func handleClear(c *gin.Context) {
+	if c.Query("confirm") != "true" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "pass confirm=true to delete every key"})
+		return
+	}
+
+	if err := database.Clear(); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// queryLimit parses the optional limit query parameter, returning zero when it
+// is absent. On an invalid value it writes a 400 response and returns false.
+func queryLimit(c *gin.Context) (int, bool) {
+	limitParam := c.Query("limit")
+	if limitParam == "" {
+		return 0, true
+	}
+
+	limit, err := strconv.Atoi(limitParam)
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return 0, false
+	}
+	return limit, true
+}
+
+func handleDelete(c *gin.Context) {
+	deleteKey(c, c.Query("key"))
+}
+
+// deleteKey deletes key for handleDelete and handleDeleteKey
+func deleteKey(c *gin.Context, key string) {
+	if err := database.DeleteContext(c.Request.Context(), key); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
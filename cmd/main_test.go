@@ -0,0 +1,1597 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"saaster.tech/own-db/db"
+)
+
+// openTestDatabase points the global database at a fresh one for the test
+func openTestDatabase(t *testing.T) {
+	t.Helper()
+	openTestDatabaseWith(t, db.Options{})
+}
+
+// openTestDatabaseWith is openTestDatabase with options
+func openTestDatabaseWith(t *testing.T, opts db.Options) {
+	t.Helper()
+	d, err := db.OpenDBWithOptions(filepath.Join(t.TempDir(), "test.db"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database = d
+	t.Cleanup(func() { d.Close() })
+}
+
+// serve sends a request for target through a router with handlers on
+// route and returns the response
+func serve(t *testing.T, method, route, target, body string, handlers ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Handle(method, route, handlers...)
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestWatchStreamEnds(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name string
+		end  func()
+	}{
+		{name: "shutdown", end: func() { close(shuttingDown) }},
+		{name: "database closed", end: func() { database.Close() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			shuttingDown = make(chan struct{})
+
+			r := gin.New()
+			r.GET("/watch", handleWatch)
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL + "/watch?prefix=a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			// Once an event comes through the watch is in place
+			if err := database.Set("a", "1"); err != nil {
+				t.Fatal(err)
+			}
+			lines := make(chan string)
+			go func() {
+				defer close(lines)
+				scanner := bufio.NewScanner(resp.Body)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+			for line := range lines {
+				if strings.HasPrefix(line, "event:") {
+					break
+				}
+			}
+
+			tt.end()
+			timeout := time.After(5 * time.Second)
+			for {
+				select {
+				case _, ok := <-lines:
+					if !ok {
+						return
+					}
+				case <-timeout:
+					t.Fatal("watch stream did not end")
+				}
+			}
+		})
+	}
+}
+
+func TestHandleSetIfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name    string
+		key     string // "a" exists; "missing" doesn't
+		ifMatch func(version int64) string
+		want    int
+	}{
+		{name: "current ETag", key: "a", ifMatch: func(v int64) string { return etag(v) }, want: http.StatusOK},
+		{name: "weak ETag", key: "a", ifMatch: func(v int64) string { return "W/" + etag(v) }, want: http.StatusPreconditionFailed},
+		{name: "list with the current ETag", key: "a", ifMatch: func(v int64) string { return etag(v-1) + ", " + etag(v) }, want: http.StatusOK},
+		{name: "list without it", key: "a", ifMatch: func(v int64) string { return etag(v-1) + "," + etag(v+1) }, want: http.StatusPreconditionFailed},
+		{name: "list with it weak", key: "a", ifMatch: func(v int64) string { return etag(v-1) + ", W/" + etag(v) }, want: http.StatusPreconditionFailed},
+		{name: "list on a missing key", key: "missing", ifMatch: func(v int64) string { return etag(v) + `, "0"` }, want: http.StatusOK},
+		{name: "list with a bad tag", key: "a", ifMatch: func(v int64) string { return etag(v) + ", abc" }, want: http.StatusBadRequest},
+		{name: "stale ETag", key: "a", ifMatch: func(v int64) string { return etag(v - 1) }, want: http.StatusPreconditionFailed},
+		{name: "star on an existing key", key: "a", ifMatch: func(int64) string { return "*" }, want: http.StatusOK},
+		{name: "star on a missing key", key: "missing", ifMatch: func(int64) string { return "*" }, want: http.StatusPreconditionFailed},
+		{name: "not an ETag", key: "a", ifMatch: func(int64) string { return "abc" }, want: http.StatusBadRequest},
+		{name: "unquoted", key: "a", ifMatch: func(v int64) string { return strings.Trim(etag(v), `"`) }, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if err := database.Set("a", "old"); err != nil {
+				t.Fatal(err)
+			}
+			_, version, err := database.GetVersioned("a")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := gin.New()
+			r.POST("/set", handleSet)
+			req := httptest.NewRequest(http.MethodPost, "/set", strings.NewReader(`{"key":"`+tt.key+`","value":"new"}`))
+			req.Header.Set("If-Match", tt.ifMatch(version))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			value, err := database.Get(tt.key)
+			if tt.want != http.StatusOK {
+				if tt.key == "a" && value != "old" || tt.key != "a" && err == nil {
+					t.Fatalf("Get() = %q, %v after a failed write", value, err)
+				}
+				return
+			}
+			if err != nil || value != "new" {
+				t.Fatalf("Get() = %q, %v, want new", value, err)
+			}
+			_, next, _ := database.GetVersioned(tt.key)
+			if got := w.Header().Get("ETag"); got != etag(next) {
+				t.Fatalf("ETag %s, want %s", got, etag(next))
+			}
+		})
+	}
+}
+
+func TestHandleExists(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want int
+	}{
+		{name: "present", key: "a", want: http.StatusOK},
+		{name: "deleted", key: "b", want: http.StatusNotFound},
+		{name: "never set", key: "c", want: http.StatusNotFound},
+	}
+
+	openTestDatabase(t)
+	for _, key := range []string{"a", "b"} {
+		if err := database.Set(key, "x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(t, http.MethodGet, "/exists", "/exists?key="+tt.key, "", handleExists)
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		want     []string
+		wantNext string
+		wantCode int
+	}{
+		{name: "all", want: []string{"a", "b", "c", "d"}, wantCode: http.StatusOK},
+		{name: "first page", query: "limit=2", want: []string{"a", "b"}, wantNext: "b", wantCode: http.StatusOK},
+		{name: "after", query: "limit=2&after=b", want: []string{"c", "d"}, wantCode: http.StatusOK},
+		{name: "after a missing key", query: "after=bb", want: []string{"c", "d"}, wantCode: http.StatusOK},
+		{name: "cursor", query: "limit=1&cursor=" + encodeCursor("a"), want: []string{"b"}, wantNext: "b", wantCode: http.StatusOK},
+		{name: "past the end", query: "after=d", want: []string{}, wantCode: http.StatusOK},
+		{name: "bad limit", query: "limit=x", wantCode: http.StatusBadRequest},
+		{name: "bad cursor", query: "cursor=!", wantCode: http.StatusBadRequest},
+	}
+
+	openTestDatabase(t)
+	for _, key := range []string{"d", "b", "a", "c"} {
+		if err := database.Set(key, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(t, http.MethodGet, "/keys", "/keys?"+tt.query, "", handleKeys)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var body struct {
+				Keys       []string `json:"keys"`
+				Next       string   `json:"next"`
+				NextCursor string   `json:"next_cursor"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(body.Keys, tt.want) {
+				t.Fatalf("keys %v, want %v", body.Keys, tt.want)
+			}
+			if body.Next != tt.wantNext || body.NextCursor != encodeCursor(tt.wantNext) {
+				t.Fatalf("next %q, cursor %q, want %q", body.Next, body.NextCursor, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestHandleScan(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		want     map[string]string
+		wantNext string
+	}{
+		{name: "prefix", query: "prefix=user:", want: map[string]string{"user:1": "ann", "user:2": "bob", "user:3": "cat"}},
+		{name: "first page", query: "prefix=user:&limit=2", want: map[string]string{"user:1": "ann", "user:2": "bob"}, wantNext: "user:2"},
+		{name: "next page", query: "prefix=user:&limit=2&cursor=" + encodeCursor("user:2"), want: map[string]string{"user:3": "cat"}},
+		{name: "no match", query: "prefix=order:", want: map[string]string{}},
+	}
+
+	openTestDatabase(t)
+	for key, value := range tests[0].want {
+		if err := database.Set(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.Set("users", "3"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(t, http.MethodGet, "/scan", "/scan?"+tt.query, "", handleScan)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var got map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if next := w.Header().Get(nextCursorHeader); next != encodeCursor(tt.wantNext) {
+				t.Fatalf("%s %q, want %q", nextCursorHeader, next, encodeCursor(tt.wantNext))
+			}
+		})
+	}
+}
+
+func TestHandleCAS(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "match", body: `{"key":"a","old":"one","new":"two"}`, want: `{"swapped":true}`},
+		{name: "mismatch", body: `{"key":"a","old":"zero","new":"two"}`, want: `{"swapped":false}`},
+		{name: "create", body: `{"key":"b","old":"","new":"two"}`, want: `{"swapped":true}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if err := database.Set("a", "one"); err != nil {
+				t.Fatal(err)
+			}
+			w := serve(t, http.MethodPost, "/cas", "/cas", tt.body, handleCAS)
+			if w.Code != http.StatusOK || w.Body.String() != tt.want {
+				t.Fatalf("got %d %s, want 200 %s", w.Code, w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleIncr(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		want     string
+	}{
+		{name: "missing key", body: `{"key":"b","delta":2}`, wantCode: http.StatusOK, want: `{"key":"b","value":2}`},
+		{name: "existing", body: `{"key":"a","delta":-3}`, wantCode: http.StatusOK, want: `{"key":"a","value":7}`},
+		{name: "not an integer", body: `{"key":"s","delta":1}`, wantCode: http.StatusBadRequest},
+		{name: "bad body", body: `{"key":"a","delta":"x"}`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if err := database.Set("a", "10"); err != nil {
+				t.Fatal(err)
+			}
+			if err := database.Set("s", "text"); err != nil {
+				t.Fatal(err)
+			}
+			w := serve(t, http.MethodPost, "/incr", "/incr", tt.body, handleIncr)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Fatalf("body %s, want %s", w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleSetTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantTTL bool // Whether /get reports the seconds left in X-TTL
+	}{
+		{name: "with ttl", body: `{"key":"a","value":"v","ttl":60}`, wantTTL: true},
+		{name: "without ttl", body: `{"key":"a","value":"v"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			w := serve(t, http.MethodPost, "/set", "/set", tt.body, handleSet)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			w = serve(t, http.MethodGet, "/get", "/get?key=a", "", handleGet)
+			if w.Code != http.StatusOK {
+				t.Fatalf("get status %d: %s", w.Code, w.Body)
+			}
+			header := w.Header().Get("X-TTL")
+			if !tt.wantTTL {
+				if header != "" {
+					t.Fatalf("X-TTL %q on a key without a TTL", header)
+				}
+				return
+			}
+			if left, err := strconv.Atoi(header); err != nil || left <= 0 || left > 60 {
+				t.Fatalf("X-TTL %q, want up to 60 seconds", header)
+			}
+		})
+	}
+}
+
+func TestHandleStream(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		want string
+	}{
+		{name: "empty"},
+		{name: "sorted", keys: []string{"b", "a"}, want: "{\"key\":\"a\",\"value\":\"v\"}\n{\"key\":\"b\",\"value\":\"v\"}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			for _, key := range tt.keys {
+				if err := database.Set(key, "v"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w := serve(t, http.MethodGet, "/stream", "/stream", "", handleStream)
+			if w.Code != http.StatusOK || w.Body.String() != tt.want {
+				t.Fatalf("got %d %q, want 200 %q", w.Code, w.Body, tt.want)
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/x-ndjson" {
+				t.Fatalf("Content-Type %q", got)
+			}
+		})
+	}
+}
+
+func TestHandleRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		want     []string
+		wantNext string
+	}{
+		{name: "bounded", query: "start=b&end=d", want: []string{"b", "c"}},
+		{name: "open end", query: "start=c", want: []string{"c", "d"}},
+		{name: "first page", query: "limit=2", want: []string{"a", "b"}, wantNext: "b"},
+		{name: "last page", query: "limit=2&cursor=" + encodeCursor("b"), want: []string{"c", "d"}},
+		{name: "cursor before start", query: "start=c&cursor=" + encodeCursor("a"), want: []string{"c", "d"}},
+	}
+
+	openTestDatabase(t)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		if err := database.Set(key, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(t, http.MethodGet, "/range", "/range?"+tt.query, "", handleRange)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var pairs []db.KVPair
+			if err := json.Unmarshal(w.Body.Bytes(), &pairs); err != nil {
+				t.Fatal(err)
+			}
+			var keys []string
+			for _, pair := range pairs {
+				keys = append(keys, pair.Key)
+			}
+			if !slices.Equal(keys, tt.want) {
+				t.Fatalf("keys %v, want %v", keys, tt.want)
+			}
+			if next := w.Header().Get(nextCursorHeader); next != encodeCursor(tt.wantNext) {
+				t.Fatalf("%s %q, want %q", nextCursorHeader, next, encodeCursor(tt.wantNext))
+			}
+		})
+	}
+}
+
+func TestHandleMGet(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		body     string
+		wantCode int
+		want     string
+	}{
+		{name: "map", target: "/mget", body: `["a","x"]`, wantCode: http.StatusOK, want: `{"a":"one"}`},
+		{name: "ordered", target: "/mget?ordered=true", body: `["x","a","a"]`, wantCode: http.StatusOK, want: `[null,"one","one"]`},
+		{name: "ordered empty value", target: "/mget?ordered=true", body: `["empty","x"]`, wantCode: http.StatusOK, want: `["",null]`},
+		{name: "ordered no keys", target: "/mget?ordered=true", body: `[]`, wantCode: http.StatusOK, want: `[]`},
+		{name: "not a list", target: "/mget", body: `{"a":1}`, wantCode: http.StatusBadRequest},
+	}
+
+	openTestDatabase(t)
+	if err := database.Set("a", "one"); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Set("empty", ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(t, http.MethodPost, "/mget", tt.target, tt.body, handleMGet)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Fatalf("body %s, want %s", w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleMDel(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		want     string
+	}{
+		{name: "some missing", body: `["a","b","x"]`, wantCode: http.StatusOK, want: `{"deleted":2}`},
+		{name: "empty", body: `[]`, wantCode: http.StatusOK, want: `{"deleted":0}`},
+		{name: "not a list", body: `"a"`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			for _, key := range []string{"a", "b"} {
+				if err := database.Set(key, "v"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w := serve(t, http.MethodPost, "/mdel", "/mdel", tt.body, handleMDel)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Fatalf("body %s, want %s", w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleSetNX(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "missing", body: `{"key":"b","value":"new"}`, want: `{"set":true}`},
+		{name: "present", body: `{"key":"a","value":"new"}`, want: `{"set":false}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if err := database.Set("a", "old"); err != nil {
+				t.Fatal(err)
+			}
+			w := serve(t, http.MethodPost, "/setnx", "/setnx", tt.body, handleSetNX)
+			if w.Code != http.StatusOK || w.Body.String() != tt.want {
+				t.Fatalf("got %d %s, want 200 %s", w.Code, w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleStats(t *testing.T) {
+	tests := []struct {
+		name     string
+		closed   bool
+		wantCode int
+	}{
+		{name: "open", wantCode: http.StatusOK},
+		{name: "closed", closed: true, wantCode: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			for _, key := range []string{"a", "b", "a"} {
+				if err := database.Set(key, "v"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.closed {
+				database.Close()
+			}
+
+			w := serve(t, http.MethodGet, "/stats", "/stats", "", handleStats)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.closed {
+				return
+			}
+			var stats db.Stats
+			if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+				t.Fatal(err)
+			}
+			if stats.Keys != 2 || stats.Writes != 3 || stats.DeadBytes == 0 {
+				t.Fatalf("stats %+v, want 2 keys, 3 writes and some dead bytes", stats)
+			}
+		})
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name      string
+		inFlight  bool // Whether a /set is being handled when shutdown starts
+		following bool // Whether replication is still writing when shutdown starts
+		want      []string
+	}{
+		{name: "idle"},
+		{name: "in-flight request", inFlight: true, want: []string{"request"}},
+		{name: "replication still writing", following: true, want: []string{"replicated"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.db")
+			d, err := db.OpenDB(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			database = d
+			shuttingDown = make(chan struct{})
+
+			started := make(chan struct{})
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.POST("/set", func(c *gin.Context) {
+				close(started)
+				// Give shutdown time to start while the request is in flight
+				time.Sleep(50 * time.Millisecond)
+				handleSet(c)
+			})
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			responded := make(chan int, 1)
+			if tt.inFlight {
+				go func() {
+					resp, err := http.Post(srv.URL+"/set", "application/json", strings.NewReader(`{"key":"request","value":"v"}`))
+					if err != nil {
+						t.Error(err)
+						responded <- 0
+						return
+					}
+					resp.Body.Close()
+					responded <- resp.StatusCode
+				}()
+				<-started
+			}
+			following := make(chan struct{})
+			if tt.following {
+				go func() {
+					time.Sleep(50 * time.Millisecond)
+					if err := database.Set("replicated", "v"); err != nil {
+						t.Error(err)
+					}
+					close(following)
+				}()
+			} else {
+				close(following)
+			}
+
+			shutdown(srv.Config, nil, following, func(context.Context) error { return nil })
+			if tt.inFlight {
+				if code := <-responded; code != http.StatusOK {
+					t.Fatalf("in-flight request got %d", code)
+				}
+			}
+			if _, err := database.Get("x"); !errors.Is(err, db.ErrClosed) {
+				t.Fatalf("database still open after shutdown: %v", err)
+			}
+
+			d, err = db.OpenDB(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+			if got := d.Keys(); !slices.Equal(got, tt.want) {
+				t.Fatalf("keys after shutdown %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlersCancelled(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		route   string
+		target  string
+		body    string
+		handler gin.HandlerFunc
+	}{
+		{name: "get", method: http.MethodGet, route: "/get", target: "/get?key=a", handler: handleGet},
+		{name: "set", method: http.MethodPost, route: "/set", target: "/set", body: `{"key":"a","value":"two"}`, handler: handleSet},
+		{name: "put key", method: http.MethodPut, route: "/keys/*key", target: "/keys/a", body: `{"value":"two"}`, handler: handlePutKey},
+		{name: "delete", method: http.MethodDelete, route: "/delete", target: "/delete?key=a", handler: handleDelete},
+		{name: "scan", method: http.MethodGet, route: "/scan", target: "/scan?prefix=a", handler: handleScan},
+		{name: "range", method: http.MethodGet, route: "/range", target: "/range", handler: handleRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if err := database.Set("a", "one"); err != nil {
+				t.Fatal(err)
+			}
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Handle(tt.method, tt.route, tt.handler)
+
+			// As if the client had gone away before the handler ran
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)).WithContext(ctx)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code == http.StatusOK {
+				t.Fatalf("cancelled request succeeded: %s", w.Body)
+			}
+			if value, err := database.Get("a"); err != nil || value != "one" {
+				t.Fatalf("Get(a) = %q, %v after a cancelled request", value, err)
+			}
+		})
+	}
+}
+
+func TestHandleAppend(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		want     string
+	}{
+		{name: "existing", body: `{"key":"a","suffix":"2"}`, wantCode: http.StatusOK, want: `{"key":"a","value":"12"}`},
+		{name: "missing key", body: `{"key":"b","suffix":"x"}`, wantCode: http.StatusOK, want: `{"key":"b","value":"x"}`},
+		{name: "bad body", body: `{"key":`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if err := database.Set("a", "1"); err != nil {
+				t.Fatal(err)
+			}
+			w := serve(t, http.MethodPost, "/append", "/append", tt.body, handleAppend)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Fatalf("body %s, want %s", w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleBackup(t *testing.T) {
+	tests := []struct {
+		name string
+		want map[string]string
+	}{
+		{name: "empty", want: map[string]string{}},
+		{name: "keys", want: map[string]string{"a": "one", "b": "two"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			for key, value := range tt.want {
+				if err := database.Set(key, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w := serve(t, http.MethodPost, "/backup", "/backup", "", handleBackup)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+
+			restored, err := db.OpenDB(filepath.Join(t.TempDir(), "restored.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer restored.Close()
+			if _, err := restored.Restore(w.Body, false); err != nil {
+				t.Fatal(err)
+			}
+			got, err := restored.ScanPrefix("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Fatalf("backup holds %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleRestore(t *testing.T) {
+	src, err := db.OpenDB(filepath.Join(t.TempDir(), "src.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	for _, key := range []string{"a", "b"} {
+		if err := src.Set(key, "restored"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var dump strings.Builder
+	if err := src.Backup(&dump); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		body     string
+		wantCode int
+		want     string
+		wantA    string
+	}{
+		{name: "keep existing", target: "/restore", body: dump.String(), wantCode: http.StatusOK, want: `{"imported":1}`, wantA: "mine"},
+		{name: "overwrite", target: "/restore?overwrite=true", body: dump.String(), wantCode: http.StatusOK, want: `{"imported":2}`, wantA: "restored"},
+		{name: "truncated", target: "/restore", body: dump.String()[:dump.Len()-1], wantCode: http.StatusBadRequest, wantA: "mine"},
+		{name: "garbage", target: "/restore", body: "not a dump", wantCode: http.StatusBadRequest, wantA: "mine"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if err := database.Set("a", "mine"); err != nil {
+				t.Fatal(err)
+			}
+			w := serve(t, http.MethodPost, "/restore", tt.target, tt.body, handleRestore)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Fatalf("body %s, want %s", w.Body, tt.want)
+			}
+			if value, err := database.Get("a"); err != nil || value != tt.wantA {
+				t.Fatalf("Get(a) = %q, %v, want %q", value, err, tt.wantA)
+			}
+		})
+	}
+}
+
+func TestHandleExportImport(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		wantCode    int
+		contentType string
+	}{
+		{name: "default", wantCode: http.StatusOK, contentType: "application/json"},
+		{name: "json", format: "json", wantCode: http.StatusOK, contentType: "application/json"},
+		{name: "csv", format: "csv", wantCode: http.StatusOK, contentType: "text/csv"},
+		{name: "unknown", format: "xml", wantCode: http.StatusBadRequest},
+	}
+
+	want := map[string]string{"a": "1,2", "b": "line\nbreak"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := ""
+			if tt.format != "" {
+				query = "?format=" + tt.format
+			}
+			openTestDatabase(t)
+			for key, value := range want {
+				if err := database.Set(key, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w := serve(t, http.MethodGet, "/export", "/export"+query, "", handleExport)
+			if w.Code != tt.wantCode {
+				t.Fatalf("export status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Fatalf("Content-Type %q, want %q", got, tt.contentType)
+			}
+
+			dump := w.Body.String()
+			openTestDatabase(t)
+			w = serve(t, http.MethodPost, "/import", "/import"+query, dump, handleImport)
+			if w.Code != http.StatusOK || w.Body.String() != `{"imported":2}` {
+				t.Fatalf("import got %d %s", w.Code, w.Body)
+			}
+			got, err := database.ScanPrefix("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, want) {
+				t.Fatalf("imported %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestHandleImportInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		body   string
+	}{
+		{name: "unknown format", target: "/import?format=xml", body: "[]"},
+		{name: "bad json", target: "/import", body: "{"},
+		{name: "bad csv", target: "/import?format=csv", body: "a,b,c\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			w := serve(t, http.MethodPost, "/import", tt.target, tt.body, handleImport)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestHandleCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     []string
+		deleted []string
+		want    string
+	}{
+		{name: "empty", want: `{"count":0}`},
+		{name: "sets", set: []string{"a", "b", "a"}, want: `{"count":2}`},
+		{name: "deletes", set: []string{"a", "b"}, deleted: []string{"a"}, want: `{"count":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			for _, key := range tt.set {
+				if err := database.Set(key, "v"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, key := range tt.deleted {
+				if err := database.Delete(key); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w := serve(t, http.MethodGet, "/count", "/count", "", handleCount)
+			if w.Code != http.StatusOK || w.Body.String() != tt.want {
+				t.Fatalf("got %d %s, want 200 %s", w.Code, w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleSetTooLarge(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "within the limits", body: `{"key":"key","value":"value"}`, want: http.StatusOK},
+		{name: "key too large", body: `{"key":"` + strings.Repeat("k", 9) + `","value":"v"}`, want: http.StatusRequestEntityTooLarge},
+		{name: "value too large", body: `{"key":"k","value":"` + strings.Repeat("v", 17) + `"}`, want: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabaseWith(t, db.Options{MaxKeySize: 8, MaxValueSize: 16})
+			w := serve(t, http.MethodPost, "/set", "/set", tt.body, handleSet)
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestHandleDeleteRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		want     string
+		left     []string
+	}{
+		{name: "bounded", query: "start=b&end=d", wantCode: http.StatusOK, want: `{"deleted":2}`, left: []string{"a", "d"}},
+		{name: "open end", query: "start=c", wantCode: http.StatusOK, want: `{"deleted":2}`, left: []string{"a", "b"}},
+		{name: "open start", query: "end=b", wantCode: http.StatusOK, want: `{"deleted":1}`, left: []string{"b", "c", "d"}},
+		{name: "empty range", query: "start=b&end=b", wantCode: http.StatusOK, want: `{"deleted":0}`, left: []string{"a", "b", "c", "d"}},
+		{name: "no bounds", wantCode: http.StatusBadRequest, left: []string{"a", "b", "c", "d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			for _, key := range []string{"a", "b", "c", "d"} {
+				if err := database.Set(key, "v"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w := serve(t, http.MethodDelete, "/range", "/range?"+tt.query, "", handleDeleteRange)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Fatalf("body %s, want %s", w.Body, tt.want)
+			}
+			if got := database.Keys(); !slices.Equal(got, tt.left) {
+				t.Fatalf("keys left %v, want %v", got, tt.left)
+			}
+		})
+	}
+}
+
+func TestHandleClear(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		left     int
+	}{
+		{name: "confirmed", query: "confirm=true", wantCode: http.StatusOK},
+		{name: "unconfirmed", wantCode: http.StatusBadRequest, left: 2},
+		{name: "not true", query: "confirm=yes", wantCode: http.StatusBadRequest, left: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			for _, key := range []string{"a", "b"} {
+				if err := database.Set(key, "v"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w := serve(t, http.MethodPost, "/clear", "/clear?"+tt.query, "", handleClear)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if got := database.Len(); got != tt.left {
+				t.Fatalf("Len() = %d, want %d", got, tt.left)
+			}
+		})
+	}
+}
+
+func TestHandleGetDefault(t *testing.T) {
+	tests := []struct {
+		name     string
+		route    string
+		target   string
+		handler  gin.HandlerFunc
+		wantCode int
+		want     string
+	}{
+		{name: "present", route: "/get", target: "/get?key=a", handler: handleGet, wantCode: http.StatusOK, want: `{"key":"a","value":"one"}`},
+		{name: "present ignores default", route: "/get", target: "/get?key=a&default=x", handler: handleGet, wantCode: http.StatusOK, want: `{"key":"a","value":"one"}`},
+		{name: "missing", route: "/get", target: "/get?key=missing", handler: handleGet, wantCode: http.StatusNotFound},
+		{name: "missing with default", route: "/get", target: "/get?key=missing&default=x", handler: handleGet, wantCode: http.StatusOK, want: `{"key":"missing","value":"x"}`},
+		{name: "missing with empty default", route: "/get", target: "/get?key=missing&default=", handler: handleGet, wantCode: http.StatusOK, want: `{"key":"missing","value":""}`},
+		{name: "expired with default", route: "/get", target: "/get?key=gone&default=x", handler: handleGet, wantCode: http.StatusOK, want: `{"key":"gone","value":"x"}`},
+		{name: "key path", route: "/keys/*key", target: "/keys/missing?default=x", handler: handleGetKey, wantCode: http.StatusOK, want: `{"key":"missing","value":"x"}`},
+		{name: "key path without default", route: "/keys/*key", target: "/keys/missing", handler: handleGetKey, wantCode: http.StatusNotFound},
+	}
+
+	openTestDatabase(t)
+	if err := database.Set("a", "one"); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SetWithTTL("gone", "v", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(t, http.MethodGet, tt.route, tt.target, "", tt.handler)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Fatalf("body %s, want %s", w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleGetETag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name        string
+		query       string
+		ifNoneMatch func(version int64) string
+		want        int
+		wantETag    bool
+	}{
+		{name: "plain", query: "key=a", want: http.StatusOK, wantETag: true},
+		{name: "current ETag", query: "key=a", ifNoneMatch: func(v int64) string { return etag(v) }, want: http.StatusNotModified, wantETag: true},
+		{name: "stale ETag", query: "key=a", ifNoneMatch: func(v int64) string { return etag(v - 1) }, want: http.StatusOK, wantETag: true},
+		{name: "weak current ETag", query: "key=a", ifNoneMatch: func(v int64) string { return "W/" + etag(v) }, want: http.StatusNotModified, wantETag: true},
+		{name: "weak stale ETag", query: "key=a", ifNoneMatch: func(v int64) string { return "W/" + etag(v-1) }, want: http.StatusOK, wantETag: true},
+		{name: "list with the current ETag", query: "key=a", ifNoneMatch: func(v int64) string { return etag(v-1) + ", W/" + etag(v) }, want: http.StatusNotModified, wantETag: true},
+		{name: "list without it", query: "key=a", ifNoneMatch: func(v int64) string { return etag(v-1) + "," + etag(v+1) }, want: http.StatusOK, wantETag: true},
+		{name: "star", query: "key=a", ifNoneMatch: func(int64) string { return "*" }, want: http.StatusNotModified, wantETag: true},
+		{name: "missing", query: "key=missing", want: http.StatusNotFound},
+		{name: "star on a missing key", query: "key=missing", ifNoneMatch: func(int64) string { return "*" }, want: http.StatusNotFound},
+		{name: "missing with default", query: "key=missing&default=x", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if err := database.Set("a", "old"); err != nil {
+				t.Fatal(err)
+			}
+			if err := database.Set("a", "new"); err != nil {
+				t.Fatal(err)
+			}
+			_, version, err := database.GetVersioned("a")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := gin.New()
+			r.GET("/get", handleGet)
+			req := httptest.NewRequest(http.MethodGet, "/get?"+tt.query, nil)
+			if tt.ifNoneMatch != nil {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch(version))
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			want := ""
+			if tt.wantETag {
+				want = etag(version)
+			}
+			if got := w.Header().Get("ETag"); got != want {
+				t.Fatalf("ETag %q, want %q", got, want)
+			}
+			if w.Code == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Fatalf("304 with a body: %s", w.Body)
+			}
+		})
+	}
+}
+
+func TestNoneMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{header: `"7"`, want: true},
+		{header: `W/"7"`, want: true},
+		{header: ` "7" `, want: true},
+		{header: `"6", "7"`, want: true},
+		{header: `"6",W/"7"`, want: true},
+		{header: "*", want: true},
+		{header: `"6"`},
+		{header: `"6", "8"`},
+		{header: "7"},
+		{header: `W/7`},
+		{header: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := noneMatch(tt.header, 7); got != tt.want {
+				t.Fatalf("noneMatch(%q, 7) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		match  string
+		want   []int64
+		wantOK bool
+	}{
+		{match: `"7"`, want: []int64{7}, wantOK: true},
+		{match: ` "7" `, want: []int64{7}, wantOK: true},
+		{match: `W/"7"`, want: []int64{}, wantOK: true},
+		{match: "*", want: []int64{db.AnyVersion}, wantOK: true},
+		{match: `"0"`, want: []int64{0}, wantOK: true},
+		{match: `"3", "4"`, want: []int64{3, 4}, wantOK: true},
+		{match: `"3",W/"4","5"`, want: []int64{3, 5}, wantOK: true},
+		{match: "7"},
+		{match: `"-1"`},
+		{match: `"x"`},
+		{match: `"`},
+		{match: ""},
+		{match: `"3",`},
+		{match: `"3", *`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.match, func(t *testing.T) {
+			got, ok := parseIfMatch(tt.match)
+			if ok != tt.wantOK || !slices.Equal(got, tt.want) {
+				t.Fatalf("parseIfMatch(%q) = %v, %v, want %v, %v", tt.match, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestProbes(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		closed  bool // Whether the database is closed first
+		want    int
+	}{
+		{name: "healthz", handler: handleHealthz, want: http.StatusOK},
+		{name: "healthz on a closed database", handler: handleHealthz, closed: true, want: http.StatusOK},
+		{name: "readyz", handler: handleReadyz, want: http.StatusOK},
+		{name: "readyz on a closed database", handler: handleReadyz, closed: true, want: http.StatusServiceUnavailable},
+		{name: "ping", handler: handlePing, want: http.StatusOK},
+		{name: "ping on a closed database", handler: handlePing, closed: true, want: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if tt.closed {
+				if err := database.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w := serve(t, http.MethodGet, "/probe", "/probe", "", tt.handler)
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestHandleTouch(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{name: "existing", body: `{"key":"a","ttl":60}`, wantCode: http.StatusOK},
+		{name: "missing", body: `{"key":"missing","ttl":60}`, wantCode: http.StatusNotFound},
+		{name: "no ttl", body: `{"key":"a"}`, wantCode: http.StatusBadRequest},
+		{name: "negative ttl", body: `{"key":"a","ttl":-1}`, wantCode: http.StatusBadRequest},
+		{name: "not JSON", body: `a`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if err := database.Set("a", "v"); err != nil {
+				t.Fatal(err)
+			}
+			w := serve(t, http.MethodPost, "/touch", "/touch", tt.body, handleTouch)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+
+			value, left, err := database.GetWithTTL("a")
+			if err != nil || value != "v" {
+				t.Fatalf("GetWithTTL() = %q, %v", value, err)
+			}
+			if touched := left > 0; touched != (tt.wantCode == http.StatusOK) {
+				t.Fatalf("GetWithTTL() left %v after status %d", left, w.Code)
+			}
+		})
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{err: db.ErrKeyNotFound, want: http.StatusNotFound},
+		{err: db.ErrKeyTooLarge, want: http.StatusRequestEntityTooLarge},
+		{err: db.ErrValueTooLarge, want: http.StatusRequestEntityTooLarge},
+		{err: db.ErrVersionMismatch, want: http.StatusPreconditionFailed},
+		{err: db.ErrNotInteger, want: http.StatusBadRequest},
+		{err: db.ErrInvalidKey, want: http.StatusBadRequest},
+		{err: db.ErrReservedKey, want: http.StatusBadRequest},
+		{err: db.ErrNotObject, want: http.StatusBadRequest},
+		{err: db.ErrInvalidJSON, want: http.StatusBadRequest},
+		{err: db.ErrNotList, want: http.StatusBadRequest},
+		{err: db.ErrNotSet, want: http.StatusBadRequest},
+		{err: db.ErrNotBoundary, want: http.StatusBadRequest},
+		{err: db.ErrReadOnly, want: http.StatusForbidden},
+		{err: db.ErrClosed, want: http.StatusServiceUnavailable},
+		{err: db.ErrOffsetOutOfRange, want: http.StatusRequestedRangeNotSatisfiable},
+		{err: db.ErrStalePosition, want: http.StatusGone},
+		{err: fmt.Errorf("reading: %w", db.ErrKeyNotFound), want: http.StatusNotFound},
+		{err: db.ErrCorrupt, want: http.StatusInternalServerError},
+		{err: errors.New("disk full"), want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			if got := errorStatus(tt.err); got != tt.want {
+				t.Fatalf("errorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleCompactEstimate(t *testing.T) {
+	tests := []struct {
+		name       string
+		overwrites int
+		closed     bool
+		wantCode   int
+		wantDead   bool
+	}{
+		{name: "fresh", wantCode: http.StatusOK},
+		{name: "overwritten", overwrites: 10, wantCode: http.StatusOK, wantDead: true},
+		{name: "closed", closed: true, wantCode: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			for i := 0; i <= tt.overwrites; i++ {
+				if err := database.Set("a", strconv.Itoa(i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.closed {
+				if err := database.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w := serve(t, http.MethodGet, "/compact/estimate", "/compact/estimate", "", handleCompactEstimate)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var got struct {
+				LiveBytes int64 `json:"live_bytes"`
+				DeadBytes int64 `json:"dead_bytes"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.LiveBytes == 0 || (got.DeadBytes > 0) != tt.wantDead {
+				t.Fatalf("estimate %+v, want dead bytes: %v", got, tt.wantDead)
+			}
+		})
+	}
+}
+
+func TestHandleSetField(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		want     string // The stored value afterwards
+	}{
+		{name: "absent key", body: `{"key":"u","path":"user.email","value":"b@x"}`, wantCode: http.StatusOK, want: `{"user":{"email":"b@x"}}`},
+		{name: "number", body: `{"key":"o","path":"n","value":42}`, wantCode: http.StatusOK, want: `{"n":42,"name":"bob"}`},
+		{name: "string of a number", body: `{"key":"o","path":"n","value":"42"}`, wantCode: http.StatusOK, want: `{"n":"42","name":"bob"}`},
+		{name: "not an object", body: `{"key":"text","path":"a","value":1}`, wantCode: http.StatusBadRequest},
+		{name: "no path", body: `{"key":"o","value":1}`, wantCode: http.StatusBadRequest},
+		{name: "no value", body: `{"key":"o","path":"n"}`, wantCode: http.StatusBadRequest},
+		{name: "not JSON", body: `o`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if err := database.Set("o", `{"name":"bob"}`); err != nil {
+				t.Fatal(err)
+			}
+			if err := database.Set("text", "plain"); err != nil {
+				t.Fatal(err)
+			}
+
+			w := serve(t, http.MethodPost, "/field", "/field", tt.body, handleSetField)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.want == "" {
+				return
+			}
+			var body struct {
+				Key string `json:"key"`
+			}
+			if err := json.Unmarshal([]byte(tt.body), &body); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := database.Get(body.Key); err != nil || got != tt.want {
+				t.Fatalf("Get(%q) = %q, %v, want %q", body.Key, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleGetField(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		wantCode int
+		want     string // The value field of the response
+	}{
+		{name: "nested", target: "/field?key=o&path=user.email", wantCode: http.StatusOK, want: `"b@x"`},
+		{name: "object", target: "/field?key=o&path=user", wantCode: http.StatusOK, want: `{"email":"b@x"}`},
+		{name: "missing field", target: "/field?key=o&path=user.name", wantCode: http.StatusNotFound},
+		{name: "missing key", target: "/field?key=missing&path=a", wantCode: http.StatusNotFound},
+		{name: "not an object", target: "/field?key=text&path=a", wantCode: http.StatusBadRequest},
+		{name: "no path", target: "/field?key=o", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if err := database.Set("o", `{"user":{"email":"b@x"}}`); err != nil {
+				t.Fatal(err)
+			}
+			if err := database.Set("text", "plain"); err != nil {
+				t.Fatal(err)
+			}
+
+			w := serve(t, http.MethodGet, "/field", tt.target, "", handleGetField)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.want == "" {
+				return
+			}
+			var body struct {
+				Value json.RawMessage `json:"value"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if string(body.Value) != tt.want {
+				t.Fatalf("value %s, want %s", body.Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleCopyAndRename(t *testing.T) {
+	tests := []struct {
+		name     string
+		route    string
+		handler  gin.HandlerFunc
+		body     string
+		wantCode int
+		want     map[string]string // Values afterwards; "" means missing
+	}{
+		{name: "copy onto existing", route: "/copy", handler: handleCopy, body: `{"src":"a","dst":"b"}`, wantCode: http.StatusOK, want: map[string]string{"a": "one", "b": "one"}},
+		{name: "copy missing", route: "/copy", handler: handleCopy, body: `{"src":"missing","dst":"b"}`, wantCode: http.StatusNotFound, want: map[string]string{"b": "two"}},
+		{name: "rename", route: "/rename", handler: handleRename, body: `{"src":"a","dst":"c"}`, wantCode: http.StatusOK, want: map[string]string{"a": "", "c": "one"}},
+		{name: "rename missing", route: "/rename", handler: handleRename, body: `{"src":"missing","dst":"b"}`, wantCode: http.StatusNotFound, want: map[string]string{"b": "two"}},
+		{name: "not JSON", route: "/rename", handler: handleRename, body: `a`, wantCode: http.StatusBadRequest, want: map[string]string{"a": "one"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if err := database.Set("a", "one"); err != nil {
+				t.Fatal(err)
+			}
+			if err := database.Set("b", "two"); err != nil {
+				t.Fatal(err)
+			}
+
+			w := serve(t, http.MethodPost, tt.route, tt.route, tt.body, tt.handler)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			for key, want := range tt.want {
+				got, err := database.Get(key)
+				if want == "" && !errors.Is(err, db.ErrKeyNotFound) {
+					t.Fatalf("Get(%q) = %q, %v, want ErrKeyNotFound", key, got, err)
+				}
+				if want != "" && (err != nil || got != want) {
+					t.Fatalf("Get(%q) = %q, %v, want %q", key, got, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleMaintenance(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     db.Options
+		wantCode int
+	}{
+		{name: "writable", wantCode: http.StatusOK},
+		{name: "read-only", opts: db.Options{ReadOnly: true}, wantCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeDatabase(t, map[string]string{"a": "0"})
+			d, err := db.OpenDB(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := d.SetWithTTL("gone", "v", time.Millisecond); err != nil {
+				t.Fatal(err)
+			}
+			for i := 1; i < 5; i++ {
+				if err := d.Set("a", strconv.Itoa(i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			d.Close()
+			time.Sleep(5 * time.Millisecond)
+
+			database, err = db.OpenDBWithOptions(path, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer database.Close()
+
+			w := serve(t, http.MethodPost, "/maintenance", "/maintenance", "", handleMaintenance)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var report db.MaintenanceReport
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			if report.Expired != 1 || report.KeysBefore != 2 || report.KeysAfter != 1 || report.SizeAfter >= report.SizeBefore {
+				t.Fatalf("report %+v", report)
+			}
+		})
+	}
+}
+
+func TestHandleGetOrSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		want     string
+	}{
+		{name: "present", body: `{"key":"a","value":"default"}`, wantCode: http.StatusOK, want: `{"key":"a","set":false,"value":"one"}`},
+		{name: "missing", body: `{"key":"b","value":"default"}`, wantCode: http.StatusOK, want: `{"key":"b","set":true,"value":"default"}`},
+		{name: "not JSON", body: `b`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if err := database.Set("a", "one"); err != nil {
+				t.Fatal(err)
+			}
+			w := serve(t, http.MethodPost, "/getorset", "/getorset", tt.body, handleGetOrSet)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Fatalf("body %s, want %s", w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleSetInvalidKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		route    string
+		target   string
+		body     string
+		handler  gin.HandlerFunc
+		wantCode int
+	}{
+		{name: "set", method: http.MethodPost, route: "/set", target: "/set", body: `{"key":"a","value":"v"}`, handler: handleSet, wantCode: http.StatusOK},
+		{name: "set empty key", method: http.MethodPost, route: "/set", target: "/set", body: `{"key":"","value":"v"}`, handler: handleSet, wantCode: http.StatusBadRequest},
+		{name: "set reserved", method: http.MethodPost, route: "/set", target: "/set", body: `{"key":"bucket:a","value":"v"}`, handler: handleSet, wantCode: http.StatusBadRequest},
+		{name: "put reserved", method: http.MethodPut, route: "/keys/*key", target: "/keys/bucket:a", body: `{"value":"v"}`, handler: handlePutKey, wantCode: http.StatusBadRequest},
+		{name: "batch reserved", method: http.MethodPost, route: "/batch", target: "/batch", body: `[{"key":"a","value":"v"},{"key":"bucket:a","value":"v"}]`, handler: handleBatch, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabaseWith(t, db.Options{ReservedPrefixes: []string{"bucket:"}})
+			w := serve(t, tt.method, tt.route, tt.target, tt.body, tt.handler)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if n := database.Len(); w.Code != http.StatusOK && n != 0 {
+				t.Fatalf("%d keys written by a rejected request", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// limiterIdle is how long a client's limiter is kept after its last request
+const limiterIdle = 10 * time.Minute
+
+// rateLimiter hands out token buckets, one shared by all clients or one per
+// client IP
+type rateLimiter struct {
+	limit rate.Limit
+	burst int
+	perIP bool
+
+	mu        sync.Mutex
+	global    *rate.Limiter
+	clients   map[string]*clientLimiter
+	lastPrune time.Time
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// limit rejects requests beyond perSecond requests a second, with bursts of
+// up to burst, with 429. A non-positive rate disables limiting.
+func limit(perSecond float64, burst int, perIP bool) gin.HandlerFunc {
+	if perSecond <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	rl := &rateLimiter{
+		limit:   rate.Limit(perSecond),
+		burst:   max(burst, 1),
+		perIP:   perIP,
+		clients: make(map[string]*clientLimiter),
+	}
+	rl.global = rate.NewLimiter(rl.limit, rl.burst)
+
+	return func(c *gin.Context) {
+		if !rl.get(c.ClientIP()).Allow() {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// trustProxies sets the proxies, a comma-separated list of addresses or
+// CIDRs, whose X-Forwarded-For header r believes. By default gin believes
+// any peer, which would let a client dodge per-IP limits, and grow the
+// limiter map, by sending a new address with every request; with no
+// proxies the client IP is always the connection's address.
+func trustProxies(r *gin.Engine, proxies string) error {
+	if proxies == "" {
+		return r.SetTrustedProxies(nil)
+	}
+	var list []string
+	for _, proxy := range strings.Split(proxies, ",") {
+		list = append(list, strings.TrimSpace(proxy))
+	}
+	return r.SetTrustedProxies(list)
+}
+
+// get returns the limiter for a client, dropping limiters of clients that
+// have been idle for a while so the map doesn't grow without bound
+func (rl *rateLimiter) get(ip string) *rate.Limiter {
+	if !rl.perIP {
+		return rl.global
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(rl.lastPrune) > limiterIdle {
+		for key, client := range rl.clients {
+			if now.Sub(client.lastSeen) > limiterIdle {
+				delete(rl.clients, key)
+			}
+		}
+		rl.lastPrune = now
+	}
+
+	client, ok := rl.clients[ip]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.clients[ip] = client
+	}
+	client.lastSeen = now
+	return client.limiter
+}
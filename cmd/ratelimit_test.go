@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// limitedRouter is a router answering /ping behind limit
+func limitedRouter(perSecond float64, burst int, perIP bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ping", limit(perSecond, burst, perIP), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+// ping sends a request to /ping from ip and returns the status
+func ping(r *gin.Engine, ip string) int {
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.RemoteAddr = ip + ":1234"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		perSecond float64
+		burst     int
+		perIP     bool
+		ips       []string
+		want      []int
+	}{
+		{
+			name: "disabled",
+			ips:  []string{"10.0.0.1", "10.0.0.1", "10.0.0.1"},
+			want: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+		{
+			name:      "burst",
+			perSecond: 0.01,
+			burst:     2,
+			ips:       []string{"10.0.0.1", "10.0.0.1", "10.0.0.1"},
+			want:      []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:      "zero burst allows one",
+			perSecond: 0.01,
+			ips:       []string{"10.0.0.1", "10.0.0.1"},
+			want:      []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:      "global is shared",
+			perSecond: 0.01,
+			burst:     1,
+			ips:       []string{"10.0.0.1", "10.0.0.2"},
+			want:      []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:      "per IP",
+			perSecond: 0.01,
+			burst:     1,
+			perIP:     true,
+			ips:       []string{"10.0.0.1", "10.0.0.2", "10.0.0.1"},
+			want:      []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := limitedRouter(tt.perSecond, tt.burst, tt.perIP)
+			for i, ip := range tt.ips {
+				if got := ping(r, ip); got != tt.want[i] {
+					t.Fatalf("request %d from %s: status %d, want %d", i, ip, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLimitForwardedFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies string
+		peer    string
+		want    []int // For requests claiming to come from 10.0.1.1, 10.0.1.2 and so on
+	}{
+		{
+			name: "no trusted proxies",
+			peer: "10.0.0.1",
+			want: []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests},
+		},
+		{
+			name:    "untrusted peer",
+			proxies: "192.168.0.1",
+			peer:    "10.0.0.1",
+			want:    []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests},
+		},
+		{
+			name:    "trusted proxy",
+			proxies: "192.168.0.1, 10.0.0.0/24",
+			peer:    "10.0.0.1",
+			want:    []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			if err := trustProxies(r, tt.proxies); err != nil {
+				t.Fatal(err)
+			}
+			r.GET("/ping", limit(0.01, 1, true), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			for i, want := range tt.want {
+				req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+				req.RemoteAddr = tt.peer + ":1234"
+				req.Header.Set("X-Forwarded-For", fmt.Sprintf("10.0.1.%d", i+1))
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				if w.Code != want {
+					t.Fatalf("request %d: status %d, want %d", i, w.Code, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTrustProxiesInvalid(t *testing.T) {
+	if err := trustProxies(gin.New(), "not-an-address"); err == nil {
+		t.Fatal("trustProxies() accepted an invalid address")
+	}
+}
+
+func TestLimitRecovers(t *testing.T) {
+	r := limitedRouter(20, 1, false)
+	if got := ping(r, "10.0.0.1"); got != http.StatusOK {
+		t.Fatalf("first request: status %d", got)
+	}
+	if got := ping(r, "10.0.0.1"); got != http.StatusTooManyRequests {
+		t.Fatalf("second request: status %d, want %d", got, http.StatusTooManyRequests)
+	}
+
+	// A token comes back every 50ms
+	time.Sleep(100 * time.Millisecond)
+	if got := ping(r, "10.0.0.1"); got != http.StatusOK {
+		t.Fatalf("after waiting: status %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestLimiterPrunesIdleClients(t *testing.T) {
+	rl := &rateLimiter{limit: 1, burst: 1, perIP: true, clients: make(map[string]*clientLimiter)}
+	rl.get("10.0.0.1")
+	rl.get("10.0.0.2")
+	rl.clients["10.0.0.1"].lastSeen = time.Now().Add(-2 * limiterIdle)
+	rl.lastPrune = time.Now().Add(-2 * limiterIdle)
+
+	rl.get("10.0.0.3")
+	if _, ok := rl.clients["10.0.0.1"]; ok {
+		t.Fatal("idle client was kept")
+	}
+	if len(rl.clients) != 2 {
+		t.Fatalf("%d clients, want 2", len(rl.clients))
+	}
+}
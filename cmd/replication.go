@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"saaster.tech/own-db/db"
+	"saaster.tech/own-db/db/replica"
+)
+
+// positionSuffix is appended to the database path for the file where a
+// replica keeps the primary's log position it has applied up to
+const positionSuffix = ".replica"
+
+// handleReplicationSnapshot sends a dump of the database for a new replica
+// to load. The log position it corresponds to follows in the X-Log-Position
+// trailer, since it is only known once the dump is written.
+func handleReplicationSnapshot(c *gin.Context) {
+	c.Header("Trailer", "X-Log-Position")
+	c.Header("Content-Type", "application/octet-stream")
+	c.Status(http.StatusOK)
+
+	pos, err := database.Checkpoint(c.Writer)
+	if err != nil {
+		// Too late for a status code; a missing trailer tells the replica
+		c.Error(err)
+		return
+	}
+	c.Writer.Header().Set("X-Log-Position", pos.String())
+}
+
+// handleLog sends the records in the log from position ?from (default the
+// start of the log) up to its current end as newline-delimited JSON, in
+// the same form as /replication/log. Unlike /replication/log it returns
+// once it reaches the end; pass the last position as ?from to pick up from
+// there. ?to stops at an earlier position, such as one taken by
+// SnapshotAt.
+func handleLog(c *gin.Context) {
+	var from db.Position
+	if param := c.Query("from"); param != "" {
+		var err error
+		if from, err = db.ParsePosition(param); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var lr *db.LogReader
+	var err error
+	if param, ok := c.GetQuery("to"); ok {
+		to, parseErr := db.ParsePosition(param)
+		if parseErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": parseErr.Error()})
+			return
+		}
+		lr, err = database.ReadRange(from, to)
+	} else {
+		lr, err = database.ReadFrom(from)
+	}
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	defer lr.Close()
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	for lr.Next() {
+		if err := enc.Encode(replica.LogRecord{Position: lr.Position().String(), Record: lr.Record()}); err != nil {
+			return
+		}
+	}
+	if err := lr.Err(); err != nil {
+		// Too late for a status code; the stream just ends early
+		log.Printf("Reading log failed: %v", err)
+	}
+}
+
+// handleReplicationLog streams every record appended to the log from the
+// position in ?from as newline-delimited JSON, staying open for new ones.
+// A position the log has moved on from gets 410 Gone, telling the replica
+// to start over from a snapshot. The stream ends when the replica
+// disconnects or the server shuts down.
+func handleReplicationLog(c *gin.Context) {
+	from, err := db.ParsePosition(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Replicas stay connected for good, so shutdown ends the stream rather
+	// than waiting on it as it would on other requests
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-shuttingDown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	c.Header("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(c.Writer)
+	started := false
+	err = database.ReadLog(ctx, from, func(entry db.Record, next db.Position) error {
+		started = true
+		if err := enc.Encode(replica.LogRecord{Position: next.String(), Record: entry}); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if started || errors.Is(err, context.Canceled) {
+		return
+	}
+	c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+}
+
+// rejectWrites guards the write routes of a replica, whose data only
+// changes through replication
+func rejectWrites(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "this server is a read-only replica"})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"saaster.tech/own-db/db"
+	"saaster.tech/own-db/db/replica"
+)
+
+func TestHandleLog(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    func(snapshot db.Position) string // Snapshot is taken after a and b are written, before c
+		want     int
+		wantKeys []string
+	}{
+		{
+			name:     "whole log",
+			query:    func(db.Position) string { return "" },
+			want:     http.StatusOK,
+			wantKeys: []string{"a", "b", "a", "c"},
+		},
+		{
+			name:     "up to snapshot",
+			query:    func(p db.Position) string { return "?to=" + p.String() },
+			want:     http.StatusOK,
+			wantKeys: []string{"a", "b"},
+		},
+		{
+			name:     "from snapshot",
+			query:    func(p db.Position) string { return "?from=" + p.String() },
+			want:     http.StatusOK,
+			wantKeys: []string{"a", "c"},
+		},
+		{
+			name:  "empty range",
+			query: func(p db.Position) string { return "?from=" + p.String() + "&to=" + p.String() },
+			want:  http.StatusOK,
+		},
+		{
+			name:  "bad from",
+			query: func(db.Position) string { return "?from=nonsense" },
+			want:  http.StatusBadRequest,
+		},
+		{
+			name:  "bad to",
+			query: func(db.Position) string { return "?to=nonsense" },
+			want:  http.StatusBadRequest,
+		},
+		{
+			name: "past the end",
+			query: func(p db.Position) string {
+				p.Offset += 1 << 20
+				return "?to=" + p.String()
+			},
+			want: http.StatusRequestedRangeNotSatisfiable,
+		},
+		{
+			name: "other generation",
+			query: func(p db.Position) string {
+				p.Generation++
+				return "?from=" + p.String()
+			},
+			want: http.StatusGone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			for _, key := range []string{"a", "b"} {
+				if err := database.Set(key, "before"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			snapshot, _, err := database.SnapshotAt()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Written after the snapshot, so never part of a read up to it
+			for _, key := range []string{"a", "c"} {
+				if err := database.Set(key, "after"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w := serve(t, http.MethodGet, "/log", "/log"+tt.query(snapshot), "", handleLog)
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var keys []string
+			scanner := bufio.NewScanner(w.Body)
+			for scanner.Scan() {
+				var record replica.LogRecord
+				if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+					t.Fatal(err)
+				}
+				keys = append(keys, record.Record.Key)
+			}
+			if len(keys) != len(tt.wantKeys) {
+				t.Fatalf("keys %v, want %v", keys, tt.wantKeys)
+			}
+			for i := range keys {
+				if keys[i] != tt.wantKeys[i] {
+					t.Fatalf("keys %v, want %v", keys, tt.wantKeys)
+				}
+			}
+		})
+	}
+}
+
+func TestReplicationLogShutdown(t *testing.T) {
+	openTestDatabase(t)
+	shuttingDown = make(chan struct{})
+	if err := database.Set("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/replication/log", handleReplicationLog)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/replication/log?from=" + db.Position{}.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// Once a record comes through the replica is following the log
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	<-lines
+
+	following := make(chan struct{})
+	close(following)
+	done := make(chan struct{})
+	go func() {
+		shutdown(srv.Config, nil, following, func(context.Context) error { return nil })
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout / 2):
+		t.Fatal("shutdown waited on the connected replica")
+	}
+	for range lines {
+	}
+}
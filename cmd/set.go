@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleSAdd adds members to a set, responding with how many were new
+func handleSAdd(c *gin.Context) {
+	var body struct {
+		Key     string   `json:"key"`
+		Members []string `json:"members"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	added, err := database.SAdd(body.Key, body.Members...)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key": body.Key, "added": added})
+}
+
+// handleSRem removes members from a set, responding with how many were in it
+func handleSRem(c *gin.Context) {
+	var body struct {
+		Key     string   `json:"key"`
+		Members []string `json:"members"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	removed, err := database.SRem(body.Key, body.Members...)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key": body.Key, "removed": removed})
+}
+
+// handleSMembers returns the members of a set in ascending order
+func handleSMembers(c *gin.Context) {
+	key := c.Query("key")
+	members, err := database.SMembers(key)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key": key, "members": members})
+}
+
+// handleSIsMember reports whether ?member is in a set
+func handleSIsMember(c *gin.Context) {
+	key, member := c.Query("key"), c.Query("member")
+	ok, err := database.SIsMember(key, member)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key": key, "member": member, "is_member": ok})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandleSAddSRem(t *testing.T) {
+	tests := []struct {
+		name        string
+		route       string
+		handler     gin.HandlerFunc
+		body        string
+		wantCode    int
+		want        string
+		wantMembers string // /smembers afterwards
+	}{
+		{name: "add", route: "/sadd", handler: handleSAdd, body: `{"key":"s","members":["c","a"]}`, wantCode: http.StatusOK, want: `{"added":1,"key":"s"}`, wantMembers: `["a","b","c"]`},
+		{name: "add duplicates", route: "/sadd", handler: handleSAdd, body: `{"key":"s","members":["a","b","a"]}`, wantCode: http.StatusOK, want: `{"added":0,"key":"s"}`, wantMembers: `["a","b"]`},
+		{name: "remove", route: "/srem", handler: handleSRem, body: `{"key":"s","members":["a","x"]}`, wantCode: http.StatusOK, want: `{"key":"s","removed":1}`, wantMembers: `["b"]`},
+		{name: "remove all", route: "/srem", handler: handleSRem, body: `{"key":"s","members":["a","b"]}`, wantCode: http.StatusOK, want: `{"key":"s","removed":2}`, wantMembers: `[]`},
+		{name: "add to not a set", route: "/sadd", handler: handleSAdd, body: `{"key":"text","members":["a"]}`, wantCode: http.StatusBadRequest, wantMembers: `["a","b"]`},
+		{name: "remove from not a set", route: "/srem", handler: handleSRem, body: `{"key":"text","members":["a"]}`, wantCode: http.StatusBadRequest, wantMembers: `["a","b"]`},
+		{name: "bad body", route: "/sadd", handler: handleSAdd, body: `{"key":"s","members":"a"}`, wantCode: http.StatusBadRequest, wantMembers: `["a","b"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if _, err := database.SAdd("s", "a", "b"); err != nil {
+				t.Fatal(err)
+			}
+			if err := database.Set("text", "plain"); err != nil {
+				t.Fatal(err)
+			}
+
+			w := serve(t, http.MethodPost, tt.route, tt.route, tt.body, tt.handler)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Fatalf("body %s, want %s", w.Body, tt.want)
+			}
+
+			w = serve(t, http.MethodGet, "/smembers", "/smembers?key=s", "", handleSMembers)
+			if want := `{"key":"s","members":` + tt.wantMembers + `}`; w.Body.String() != want {
+				t.Fatalf("members %s, want %s", w.Body, want)
+			}
+		})
+	}
+}
+
+func TestHandleSIsMember(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		want     string
+	}{
+		{name: "member", query: "?key=s&member=a", wantCode: http.StatusOK, want: `{"is_member":true,"key":"s","member":"a"}`},
+		{name: "not a member", query: "?key=s&member=z", wantCode: http.StatusOK, want: `{"is_member":false,"key":"s","member":"z"}`},
+		{name: "missing key", query: "?key=missing&member=a", wantCode: http.StatusOK, want: `{"is_member":false,"key":"missing","member":"a"}`},
+		{name: "not a set", query: "?key=text&member=a", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDatabase(t)
+			if _, err := database.SAdd("s", "a", "b"); err != nil {
+				t.Fatal(err)
+			}
+			if err := database.Set("text", "plain"); err != nil {
+				t.Fatal(err)
+			}
+
+			w := serve(t, http.MethodGet, "/sismember", "/sismember"+tt.query, "", handleSIsMember)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.want != "" && w.Body.String() != tt.want {
+				t.Fatalf("body %s, want %s", w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleSMembersNotASet(t *testing.T) {
+	openTestDatabase(t)
+	if err := database.Set("text", "plain"); err != nil {
+		t.Fatal(err)
+	}
+	w := serve(t, http.MethodGet, "/smembers", "/smembers?key=text", "", handleSMembers)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400: %s", w.Code, w.Body)
+	}
+}
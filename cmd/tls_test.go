@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 and its
+// key to dir and returns their paths along with the certificate
+func writeCertificate(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "owndb test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath, cert
+}
+
+// freeAddr returns a local address nothing is listening on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestListen(t *testing.T) {
+	tests := []struct {
+		name      string
+		tls       bool
+		wantProto int // Major HTTP version negotiated
+	}{
+		{name: "plaintext", wantProto: 1},
+		{name: "tls", tls: true, wantProto: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &http.Server{
+				Addr:    freeAddr(t),
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+			}
+			client := &http.Client{Timeout: time.Second}
+			scheme, certPath, keyPath := "http", "", ""
+			if tt.tls {
+				var cert *x509.Certificate
+				certPath, keyPath, cert = writeCertificate(t, t.TempDir())
+				roots := x509.NewCertPool()
+				roots.AddCert(cert)
+				client.Transport = &http.Transport{
+					TLSClientConfig:   &tls.Config{RootCAs: roots},
+					ForceAttemptHTTP2: true,
+				}
+				scheme = "https"
+			}
+
+			done := make(chan error, 1)
+			go func() { done <- listen(srv, certPath, keyPath) }()
+			defer func() {
+				srv.Close()
+				if err := <-done; err != http.ErrServerClosed {
+					t.Errorf("listen() = %v, want %v", err, http.ErrServerClosed)
+				}
+			}()
+
+			var resp *http.Response
+			var err error
+			for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+				if resp, err = client.Get(scheme + "://" + srv.Addr + "/"); err == nil {
+					break
+				}
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.ProtoMajor != tt.wantProto {
+				t.Fatalf("served over %s, want HTTP/%d", resp.Proto, tt.wantProto)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"saaster.tech/own-db/db"
+)
+
+// defaultPath is the data file the server and subcommands use
+const defaultPath = "mydb.data"
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage:\n")
+	fmt.Fprintf(out, "  %s [flags]          serve the HTTP API\n", os.Args[0])
+	fmt.Fprintf(out, "  %s rebuild [path]   rebuild the index of a database (default %s)\n", os.Args[0], defaultPath)
+	fmt.Fprintf(out, "  %s verify [path]    check a database for corrupt records\n", os.Args[0])
+	fmt.Fprintf(out, "  %s maintain [path]  sweep expired keys and compact a database; use POST /maintenance on a running server\n", os.Args[0])
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// existingPath defaults an empty path and fails if no database is there,
+// since opening one would otherwise create it
+func existingPath(path string) (string, error) {
+	if path == "" {
+		path = defaultPath
+	}
+	if segments, _ := filepath.Glob(path + ".[0-9]*"); len(segments) == 0 {
+		if _, err := os.Stat(path); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
+
+// rebuild rescans the database at path from scratch, writes a fresh index
+// snapshot and reports what it found. Corrupt records are skipped and
+// counted rather than aborting the rebuild. The server must not be running
+// against the same file.
+func rebuild(path string) error {
+	path, err := existingPath(path)
+	if err != nil {
+		return err
+	}
+
+	d, err := db.OpenDBWithOptions(path, db.Options{SkipCorrupt: true, Logger: slog.Default()})
+	if err != nil {
+		return err
+	}
+	if err := d.RebuildIndex(); err != nil {
+		d.Close()
+		return err
+	}
+
+	stats, err := d.Stats()
+	if err != nil {
+		d.Close()
+		return err
+	}
+	fmt.Printf("Indexed %d keys from %d segments (%d bytes); skipped %d corrupt records\n",
+		stats.Keys, stats.Segments, stats.FileSize, stats.Corrupt)
+	return d.Close()
+}
+
+// verify checks every record of the database at path and prints any
+// problems, returning whether it is clean. The file is opened read-only, so
+// this is safe to run against a live database.
+func verify(path string) (bool, error) {
+	path, err := existingPath(path)
+	if err != nil {
+		return false, err
+	}
+
+	d, err := db.OpenDBWithOptions(path, db.Options{ReadOnly: true, SkipCorrupt: true, Logger: slog.Default()})
+	if err != nil {
+		return false, err
+	}
+	defer d.Close()
+
+	report, err := d.Verify()
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Printf("Read %d records\n", report.Records)
+	for _, bad := range report.Corrupt {
+		fmt.Printf("Corrupt record in segment %d at offset %d: %s\n", bad.Segment, bad.Offset, bad.Reason)
+	}
+	for _, key := range report.Orphaned {
+		fmt.Printf("Index entry for %q does not point to a readable record\n", key)
+	}
+	if report.OK() {
+		fmt.Println("OK")
+	}
+	return report.OK(), nil
+}
+
+// maintain sweeps expired keys from the database at path, compacts it and
+// reports how much it shrank. The server must not be running against the
+// same file; POST /maintenance does the same on a live server.
+func maintain(path string) error {
+	path, err := existingPath(path)
+	if err != nil {
+		return err
+	}
+
+	d, err := db.OpenDBWithOptions(path, db.Options{Logger: slog.Default()})
+	if err != nil {
+		return err
+	}
+	report, err := d.Maintenance()
+	if err != nil {
+		d.Close()
+		return err
+	}
+
+	fmt.Printf("Swept %d expired keys; %d keys and %d bytes before, %d keys and %d bytes after\n",
+		report.Expired, report.KeysBefore, report.SizeBefore, report.KeysAfter, report.SizeAfter)
+	return d.Close()
+}
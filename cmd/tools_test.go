@@ -0,0 +1,187 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"saaster.tech/own-db/db"
+)
+
+// writeDatabase creates a database in a temporary directory holding pairs
+// and returns its path
+func writeDatabase(t *testing.T, pairs map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	d, err := db.OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range pairs {
+		if err := d.Set(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRebuild(t *testing.T) {
+	tests := []struct {
+		name    string
+		missing bool // No database at the path
+		pairs   map[string]string
+	}{
+		{name: "missing", missing: true},
+		{name: "empty"},
+		{name: "keys", pairs: map[string]string{"a": "one", "b": "two"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "missing.db")
+			if !tt.missing {
+				path = writeDatabase(t, tt.pairs)
+			}
+			err := rebuild(path)
+			if tt.missing {
+				if err == nil {
+					t.Fatal("rebuild() of a missing database succeeded")
+				}
+				if _, statErr := os.Stat(path); !os.IsNotExist(statErr) {
+					t.Fatalf("rebuild() created %s", path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d, err := db.OpenDB(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+			if got := d.Len(); got != len(tt.pairs) {
+				t.Fatalf("Len() = %d, want %d", got, len(tt.pairs))
+			}
+			for key, want := range tt.pairs {
+				if got, err := d.Get(key); err != nil || got != want {
+					t.Fatalf("Get(%q) = %q, %v, want %q", key, got, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		missing bool   // No database at the path
+		garbage []byte // Appended to the file
+		want    bool
+	}{
+		{name: "missing", missing: true},
+		{name: "clean", want: true},
+		{name: "garbage tail", garbage: []byte("not a record")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "missing.db")
+			if !tt.missing {
+				path = writeDatabase(t, map[string]string{"a": "one", "b": "two"})
+			}
+			if tt.garbage != nil {
+				f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := f.Write(tt.garbage); err != nil {
+					t.Fatal(err)
+				}
+				f.Close()
+			}
+
+			ok, err := verify(path)
+			if tt.missing {
+				if err == nil {
+					t.Fatal("verify() of a missing database succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.want {
+				t.Fatalf("verify() = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaintain(t *testing.T) {
+	tests := []struct {
+		name       string
+		missing    bool // No database at the path
+		overwrites int  // Times each key is overwritten before maintain runs
+	}{
+		{name: "missing", missing: true},
+		{name: "clean"},
+		{name: "overwritten", overwrites: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "missing.db")
+			if !tt.missing {
+				path = writeDatabase(t, map[string]string{"a": "one", "b": "two"})
+				d, err := db.OpenDB(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i := 0; i < tt.overwrites; i++ {
+					if err := d.Set("a", "one"); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := d.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before, _ := os.Stat(path)
+
+			err := maintain(path)
+			if tt.missing {
+				if err == nil {
+					t.Fatal("maintain() of a missing database succeeded")
+				}
+				if _, statErr := os.Stat(path); !os.IsNotExist(statErr) {
+					t.Fatalf("maintain() created %s", path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			after, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if shrank := after.Size() < before.Size(); shrank != (tt.overwrites > 0) {
+				t.Fatalf("%d bytes before and %d after", before.Size(), after.Size())
+			}
+			d, err := db.OpenDB(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+			if got, err := d.Get("a"); err != nil || got != "one" {
+				t.Fatalf("Get(a) = %q, %v after maintain", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"saaster.tech/own-db/db"
+	"saaster.tech/own-db/db/tracing"
+)
+
+// setupTracing exports spans to the OTLP/HTTP collector at endpoint, e.g.
+// http://localhost:4318, and returns the tracer to open the database with
+// and a function that flushes spans still buffered on exit. An empty
+// endpoint disables tracing and returns a nil tracer.
+func setupTracing(endpoint string) (db.Tracer, func(context.Context) error, error) {
+	if endpoint == "" {
+		return nil, func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "owndb"))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return tracing.New(provider), provider.Shutdown, nil
+}
+
+// propagateTrace picks up the trace context a caller sent in traceparent
+// headers, so spans started for the request's database operations join the
+// caller's trace
+func propagateTrace(c *gin.Context) {
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"saaster.tech/own-db/db"
+	"saaster.tech/own-db/db/tracing"
+)
+
+func TestSetupTracingDisabled(t *testing.T) {
+	tracer, shutdown, err := setupTracing("")
+	if err != nil || tracer != nil {
+		t.Fatalf("setupTracing(\"\") = %v, %v, want no tracer", tracer, err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPropagateTrace(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	tests := []struct {
+		name        string
+		traceparent string
+		wantTraceID string // Empty for a new trace
+		wantParent  string
+	}{
+		{name: "caller's trace", traceparent: "00-" + traceID + "-" + spanID + "-01", wantTraceID: traceID, wantParent: spanID},
+		{name: "no trace context"},
+		{name: "malformed", traceparent: "00-nonsense"},
+	}
+
+	old := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(old) })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			openTestDatabaseWith(t, db.Options{Tracer: tracing.New(provider)})
+
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(propagateTrace)
+			r.GET("/get", handleGet)
+			req := httptest.NewRequest(http.MethodGet, "/get?key=a", nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("%d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != "owndb.get" {
+				t.Fatalf("span %q, want owndb.get", span.Name())
+			}
+			if tt.wantTraceID == "" {
+				if span.Parent().IsValid() {
+					t.Fatalf("span has parent %v, want a new trace", span.Parent())
+				}
+				return
+			}
+			if got := span.SpanContext().TraceID().String(); got != tt.wantTraceID {
+				t.Fatalf("trace %s, want %s", got, tt.wantTraceID)
+			}
+			if got := span.Parent().SpanID().String(); got != tt.wantParent {
+				t.Fatalf("parent %s, want %s", got, tt.wantParent)
+			}
+		})
+	}
+}
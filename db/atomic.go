@@ -0,0 +1,277 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+var (
+	// ErrNotInteger is returned by Increment when the stored value isn't an integer
+	ErrNotInteger = errors.New("value is not an integer")
+
+	// ErrDeleteKey can be returned by an Update callback to delete the key
+	ErrDeleteKey = errors.New("delete key")
+
+	// ErrVersionMismatch is returned by SetIfVersion when the key has moved
+	// on from the expected version
+	ErrVersionMismatch = errors.New("version mismatch")
+)
+
+// CompareAndSwap sets key to new only if its current value equals old,
+// reporting whether the swap happened. A missing key is treated as holding
+// the empty string, so passing an empty old creates the key only if it is
+// absent (or currently empty).
+func (db *SimpleDB) CompareAndSwap(key, old, new string) (bool, error) {
+	key = db.normalize(key)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return false, ErrClosed
+	}
+
+	current, _, err := db.lookup(key)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(current, []byte(old)) {
+		return false, nil
+	}
+
+	if err := db.set(key, []byte(new)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Increment adds delta to the integer stored at key and returns the result.
+// A missing key starts from zero.
+func (db *SimpleDB) Increment(key string, delta int64) (int64, error) {
+	key = db.normalize(key)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return 0, ErrClosed
+	}
+
+	current, exists, err := db.lookup(key)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	if exists {
+		n, err = strconv.ParseInt(string(current), 10, 64)
+		if err != nil {
+			return 0, ErrNotInteger
+		}
+	}
+
+	n += delta
+	if err := db.set(key, []byte(strconv.FormatInt(n, 10))); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// SetNX sets key only if it doesn't already exist, reporting whether the
+// write happened
+func (db *SimpleDB) SetNX(key, value string) (bool, error) {
+	key = db.normalize(key)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return false, ErrClosed
+	}
+
+	exists, err := db.exists(key)
+	if err != nil || exists {
+		return false, err
+	}
+
+	if err := db.set(key, []byte(value)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetOrSet returns the value of key, first setting it to defaultValue if it
+// doesn't exist, and reports whether that write happened. Concurrent callers
+// all see the same value and only one of them writes it.
+func (db *SimpleDB) GetOrSet(key, defaultValue string) (string, bool, error) {
+	key = db.normalize(key)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return "", false, ErrClosed
+	}
+
+	value, exists, err := db.lookup(key)
+	if err != nil {
+		return "", false, err
+	}
+	if exists {
+		return string(value), false, nil
+	}
+
+	if err := db.set(key, []byte(defaultValue)); err != nil {
+		return "", false, err
+	}
+	return defaultValue, true, nil
+}
+
+// SetIfExists replaces the value of key only if it already exists,
+// reporting whether the write happened. Like Set, it clears any TTL.
+func (db *SimpleDB) SetIfExists(key, value string) (bool, error) {
+	key = db.normalize(key)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return false, ErrClosed
+	}
+
+	exists, err := db.exists(key)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	if err := db.set(key, []byte(value)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Update atomically replaces the value of key with the result of fn, which
+// receives the current value and whether the key exists. If fn returns
+// ErrDeleteKey the key is deleted instead; any other error aborts the update
+// without writing anything and is returned to the caller.
+func (db *SimpleDB) Update(key string, fn func(old string, exists bool) (string, error)) error {
+	key = db.normalize(key)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	current, exists, err := db.lookup(key)
+	if err != nil {
+		return err
+	}
+
+	value, err := fn(string(current), exists)
+	if errors.Is(err, ErrDeleteKey) {
+		if !exists {
+			return nil
+		}
+		return db.del(key)
+	}
+	if err != nil {
+		return err
+	}
+
+	return db.set(key, []byte(value))
+}
+
+// Append atomically adds suffix to the end of the value stored at key,
+// treating a missing key as empty, and returns the new value
+func (db *SimpleDB) Append(key, suffix string) (string, error) {
+	key = db.normalize(key)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return "", ErrClosed
+	}
+
+	current, _, err := db.lookup(key)
+	if err != nil {
+		return "", err
+	}
+
+	value := append(current, suffix...)
+	if err := db.set(key, value); err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// AnyVersion passed to SetIfVersion matches whatever version key has, as
+// long as it exists
+const AnyVersion int64 = -1
+
+// SetIfVersion sets key only if its current version is expectedVersion and
+// returns the new version. A missing key has version zero, so an expected
+// version of zero creates the key only if it is absent, and AnyVersion
+// replaces it only if it is present. Otherwise it fails with
+// ErrVersionMismatch, letting callers that read a value with GetVersioned
+// write back without overwriting a concurrent change.
+func (db *SimpleDB) SetIfVersion(key, value string, expectedVersion int64) (int64, error) {
+	key = db.normalize(key)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return 0, ErrClosed
+	}
+
+	if err := db.promote(key); err != nil {
+		return 0, err
+	}
+	if expectedVersion == AnyVersion {
+		exists, err := db.exists(key)
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			return 0, ErrVersionMismatch
+		}
+	} else if db.version(key) != expectedVersion {
+		return 0, ErrVersionMismatch
+	}
+
+	if err := db.set(key, []byte(value)); err != nil {
+		return 0, err
+	}
+	return db.data[key].Version, nil
+}
+
+// Copy atomically writes the value of src to dst, replacing whatever dst
+// held. dst gets src's TTL, if it has one. A missing src is reported as
+// ErrKeyNotFound.
+func (db *SimpleDB) Copy(src, dst string) error {
+	return db.copyKey(src, dst, false)
+}
+
+// Rename atomically moves the value of src, and its TTL, to dst, replacing
+// whatever dst held. The new value and the tombstone for src go to disk in
+// a single write, so a crash never leaves both keys or neither. Renaming a
+// key onto itself does nothing.
+func (db *SimpleDB) Rename(src, dst string) error {
+	return db.copyKey(src, dst, true)
+}
+
+// copyKey implements Copy and, with move set, Rename
+func (db *SimpleDB) copyKey(src, dst string, move bool) error {
+	src, dst = db.normalize(src), db.normalize(dst)
+	return db.UpdateTx(func(tx *WriteTx) error {
+		value, err := tx.Get(src)
+		if err != nil || src == dst {
+			return err
+		}
+		if err := db.checkKey(dst, len(value)); err != nil {
+			return err
+		}
+
+		tx.buffer(Record{Key: dst, Value: []byte(value), ExpiresAt: db.expires[src]})
+		if move {
+			tx.buffer(Record{Key: src, Deleted: true})
+		}
+		return nil
+	})
+}
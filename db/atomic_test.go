@@ -0,0 +1,621 @@
+package db
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCompareAndSwap(t *testing.T) {
+	tests := []struct {
+		name        string
+		key         string // "a" holds "one"; "missing" doesn't exist
+		old         string
+		wantSwapped bool
+		want        string // Value afterwards, "" for missing
+	}{
+		{name: "match", key: "a", old: "one", wantSwapped: true, want: "two"},
+		{name: "mismatch", key: "a", old: "zero", want: "one"},
+		{name: "empty against a value", key: "a", old: "", want: "one"},
+		{name: "empty creates a missing key", key: "missing", old: "", wantSwapped: true, want: "two"},
+		{name: "value against a missing key", key: "missing", old: "one"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			mustSet(t, db, "a", "one")
+
+			swapped, err := db.CompareAndSwap(tt.key, tt.old, "two")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if swapped != tt.wantSwapped {
+				t.Fatalf("CompareAndSwap() = %v, want %v", swapped, tt.wantSwapped)
+			}
+			if tt.want == "" {
+				wantMissing(t, db, tt.key)
+			} else {
+				wantValue(t, db, tt.key, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareAndSwapConcurrent(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	mustSet(t, db, "lock", "")
+
+	// Only one of the racing callers may take the lock
+	const callers = 20
+	won := make(chan bool, callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			swapped, err := db.CompareAndSwap("lock", "", "held")
+			won <- swapped && err == nil
+		}()
+	}
+	winners := 0
+	for i := 0; i < callers; i++ {
+		if <-won {
+			winners++
+		}
+	}
+	if winners != 1 {
+		t.Fatalf("%d callers took the lock, want 1", winners)
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial string // "" leaves the key missing
+		delta   int64
+		want    int64
+		wantErr error
+	}{
+		{name: "missing key", delta: 5, want: 5},
+		{name: "existing", initial: "10", delta: 3, want: 13},
+		{name: "negative", initial: "10", delta: -15, want: -5},
+		{name: "zero delta", initial: "7", want: 7},
+		{name: "not an integer", initial: "ten", delta: 1, wantErr: ErrNotInteger},
+		{name: "float", initial: "1.5", delta: 1, wantErr: ErrNotInteger},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			if tt.initial != "" {
+				mustSet(t, db, "n", tt.initial)
+			}
+
+			got, err := db.Increment("n", tt.delta)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Increment() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				wantValue(t, db, "n", tt.initial)
+				return
+			}
+			if got != tt.want {
+				t.Fatalf("Increment() = %d, want %d", got, tt.want)
+			}
+			wantValue(t, db, "n", strconv.FormatInt(tt.want, 10))
+		})
+	}
+}
+
+func TestIncrementConcurrent(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+
+	const callers, each = 10, 50
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				if _, err := db.Increment("n", 1); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	wantValue(t, db, "n", strconv.Itoa(callers*each))
+}
+
+func TestSetNX(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, db *SimpleDB)
+		wantSet bool
+		want    string
+	}{
+		{name: "missing", setup: func(t *testing.T, db *SimpleDB) {}, wantSet: true, want: "new"},
+		{name: "present", setup: func(t *testing.T, db *SimpleDB) { mustSet(t, db, "a", "old") }, want: "old"},
+		{name: "present but empty", setup: func(t *testing.T, db *SimpleDB) { mustSet(t, db, "a", "") }, want: ""},
+		{
+			name: "deleted",
+			setup: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "a", "old")
+				if err := db.Delete("a"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantSet: true,
+			want:    "new",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			tt.setup(t, db)
+
+			set, err := db.SetNX("a", "new")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if set != tt.wantSet {
+				t.Fatalf("SetNX() = %v, want %v", set, tt.wantSet)
+			}
+			wantValue(t, db, "a", tt.want)
+		})
+	}
+}
+
+func TestSetIfExists(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, db *SimpleDB)
+		wantSet bool
+		want    string // "" means the key must stay missing
+	}{
+		{name: "missing", setup: func(t *testing.T, db *SimpleDB) {}},
+		{name: "present", setup: func(t *testing.T, db *SimpleDB) { mustSet(t, db, "a", "old") }, wantSet: true, want: "new"},
+		{
+			name: "deleted",
+			setup: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "a", "old")
+				if err := db.Delete("a"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "expired",
+			setup: func(t *testing.T, db *SimpleDB) {
+				if err := db.SetWithTTL("a", "old", time.Millisecond); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(5 * time.Millisecond)
+			},
+		},
+		{
+			name: "with TTL",
+			setup: func(t *testing.T, db *SimpleDB) {
+				if err := db.SetWithTTL("a", "old", time.Hour); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantSet: true,
+			want:    "new",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			tt.setup(t, db)
+
+			set, err := db.SetIfExists("a", "new")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if set != tt.wantSet {
+				t.Fatalf("SetIfExists() = %v, want %v", set, tt.wantSet)
+			}
+			if tt.want == "" {
+				wantMissing(t, db, "a")
+				return
+			}
+			wantValue(t, db, "a", tt.want)
+			if _, ttl, err := db.GetWithTTL("a"); err != nil || ttl != 0 {
+				t.Fatalf("GetWithTTL(a) = %v, %v, want the TTL cleared", ttl, err)
+			}
+		})
+	}
+}
+
+func TestSetNXConcurrent(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+
+	const callers = 20
+	won := make(chan string, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(value string) {
+			defer wg.Done()
+			set, err := db.SetNX("lock", value)
+			if err != nil {
+				t.Error(err)
+			}
+			if set {
+				won <- value
+			}
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+	close(won)
+
+	var winners []string
+	for value := range won {
+		winners = append(winners, value)
+	}
+	if len(winners) != 1 {
+		t.Fatalf("%d callers set the key, want 1", len(winners))
+	}
+	wantValue(t, db, "lock", winners[0])
+}
+
+func TestGetOrSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, db *SimpleDB)
+		want    string
+		wantSet bool
+	}{
+		{name: "missing", setup: func(t *testing.T, db *SimpleDB) {}, want: "default", wantSet: true},
+		{name: "present", setup: func(t *testing.T, db *SimpleDB) { mustSet(t, db, "a", "old") }, want: "old"},
+		{name: "present but empty", setup: func(t *testing.T, db *SimpleDB) { mustSet(t, db, "a", "") }, want: ""},
+		{
+			name: "deleted",
+			setup: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "a", "old")
+				if err := db.Delete("a"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want:    "default",
+			wantSet: true,
+		},
+		{
+			name: "expired",
+			setup: func(t *testing.T, db *SimpleDB) {
+				if err := db.SetWithTTL("a", "old", time.Millisecond); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(5 * time.Millisecond)
+			},
+			want:    "default",
+			wantSet: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			tt.setup(t, db)
+
+			got, set, err := db.GetOrSet("a", "default")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || set != tt.wantSet {
+				t.Fatalf("GetOrSet() = %q, %v, want %q, %v", got, set, tt.want, tt.wantSet)
+			}
+
+			db.Close()
+			wantValue(t, reopenTestDB(t, path, Options{}), "a", tt.want)
+		})
+	}
+}
+
+func TestGetOrSetConcurrent(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+
+	const callers = 20
+	type result struct {
+		value string
+		set   bool
+	}
+	results := make(chan result, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(value string) {
+			defer wg.Done()
+			got, set, err := db.GetOrSet("lazy", value)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- result{got, set}
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+	close(results)
+
+	// Everyone sees the one value written
+	writes := 0
+	var values []string
+	for r := range results {
+		if r.set {
+			writes++
+		}
+		values = append(values, r.value)
+	}
+	if writes != 1 {
+		t.Fatalf("%d callers wrote the key, want 1", writes)
+	}
+	for _, value := range values {
+		if value != values[0] {
+			t.Fatalf("callers saw %q, want all the same", values)
+		}
+	}
+	wantValue(t, db, "lazy", values[0])
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Writes != 1 || stats.DeadBytes != 0 {
+		t.Fatalf("%d records written and %d dead bytes, want a single write", stats.Writes, stats.DeadBytes)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	errAbort := errors.New("abort")
+	tests := []struct {
+		name       string
+		initial    string // "" leaves the key missing
+		fn         func(old string, exists bool) (string, error)
+		wantErr    error
+		wantOld    string
+		wantExists bool
+		want       string // "" for missing
+	}{
+		{
+			name: "missing key",
+			fn:   func(old string, exists bool) (string, error) { return "new", nil },
+			want: "new",
+		},
+		{
+			name:       "transform",
+			initial:    "abc",
+			fn:         func(old string, exists bool) (string, error) { return strings.ToUpper(old), nil },
+			wantOld:    "abc",
+			wantExists: true,
+			want:       "ABC",
+		},
+		{
+			name:       "delete",
+			initial:    "abc",
+			fn:         func(old string, exists bool) (string, error) { return "", ErrDeleteKey },
+			wantOld:    "abc",
+			wantExists: true,
+		},
+		{
+			name: "delete a missing key",
+			fn:   func(old string, exists bool) (string, error) { return "", ErrDeleteKey },
+		},
+		{
+			name:       "abort",
+			initial:    "abc",
+			fn:         func(old string, exists bool) (string, error) { return "ignored", errAbort },
+			wantErr:    errAbort,
+			wantOld:    "abc",
+			wantExists: true,
+			want:       "abc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			if tt.initial != "" {
+				mustSet(t, db, "a", tt.initial)
+			}
+
+			var gotOld string
+			var gotExists bool
+			err := db.Update("a", func(old string, exists bool) (string, error) {
+				gotOld, gotExists = old, exists
+				return tt.fn(old, exists)
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Update() error = %v, want %v", err, tt.wantErr)
+			}
+			if gotOld != tt.wantOld || gotExists != tt.wantExists {
+				t.Fatalf("fn got %q, %v, want %q, %v", gotOld, gotExists, tt.wantOld, tt.wantExists)
+			}
+			if tt.want == "" {
+				wantMissing(t, db, "a")
+			} else {
+				wantValue(t, db, "a", tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+
+	// Read-modify-write from many goroutines loses no update
+	const callers, each = 10, 20
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				err := db.Update("n", func(old string, exists bool) (string, error) {
+					n, _ := strconv.Atoi(old)
+					return strconv.Itoa(n + 1), nil
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	wantValue(t, db, "n", strconv.Itoa(callers*each))
+}
+
+func TestAppend(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial string // "" leaves the key missing
+		suffix  string
+		want    string
+	}{
+		{name: "missing key", suffix: "a", want: "a"},
+		{name: "existing", initial: "ab", suffix: "c", want: "abc"},
+		{name: "empty suffix", initial: "ab", want: "ab"},
+		{name: "bytes", initial: "\x00", suffix: "\xff\n", want: "\x00\xff\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			if tt.initial != "" {
+				mustSet(t, db, "a", tt.initial)
+			}
+
+			got, err := db.Append("a", tt.suffix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("Append() = %q, want %q", got, tt.want)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			db = reopenTestDB(t, path, Options{})
+			wantValue(t, db, "a", tt.want)
+		})
+	}
+}
+
+func TestAppendConcurrent(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+
+	// Every goroutine appends its own letter; none may be lost or torn
+	const callers, each = 8, 25
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(letter string) {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				if _, err := db.Append("log", letter); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(string(rune('a' + i)))
+	}
+	wg.Wait()
+
+	value, err := db.Get("log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(value) != callers*each {
+		t.Fatalf("log is %d bytes, want %d", len(value), callers*each)
+	}
+	for i := 0; i < callers; i++ {
+		letter := string(rune('a' + i))
+		if n := strings.Count(value, letter); n != each {
+			t.Fatalf("%q appears %d times, want %d", letter, n, each)
+		}
+	}
+}
+
+func TestCopyAndRename(t *testing.T) {
+	tests := []struct {
+		name     string
+		move     bool
+		src, dst string // "a" holds "one" and "b" holds "two"
+		wantErr  error
+		want     map[string]string // Values afterwards; "" means missing
+	}{
+		{name: "copy to new key", src: "a", dst: "c", want: map[string]string{"a": "one", "b": "two", "c": "one"}},
+		{name: "copy onto existing", src: "a", dst: "b", want: map[string]string{"a": "one", "b": "one"}},
+		{name: "copy onto itself", src: "a", dst: "a", want: map[string]string{"a": "one", "b": "two"}},
+		{name: "copy missing", src: "missing", dst: "b", wantErr: ErrKeyNotFound, want: map[string]string{"b": "two", "missing": ""}},
+		{name: "rename to new key", move: true, src: "a", dst: "c", want: map[string]string{"a": "", "b": "two", "c": "one"}},
+		{name: "rename onto existing", move: true, src: "a", dst: "b", want: map[string]string{"a": "", "b": "one"}},
+		{name: "rename onto itself", move: true, src: "a", dst: "a", want: map[string]string{"a": "one", "b": "two"}},
+		{name: "rename missing", move: true, src: "missing", dst: "b", wantErr: ErrKeyNotFound, want: map[string]string{"b": "two", "missing": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			mustSet(t, db, "a", "one")
+			mustSet(t, db, "b", "two")
+
+			op := db.Copy
+			if tt.move {
+				op = db.Rename
+			}
+			if err := op(tt.src, tt.dst); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("(%q, %q) = %v, want %v", tt.src, tt.dst, err, tt.wantErr)
+			}
+
+			check := func(db *SimpleDB) {
+				t.Helper()
+				for key, want := range tt.want {
+					if want == "" {
+						wantMissing(t, db, key)
+					} else {
+						wantValue(t, db, key, want)
+					}
+				}
+			}
+			check(db)
+			db.Close()
+			check(reopenTestDB(t, path, Options{}))
+		})
+	}
+}
+
+func TestCopyKeepsTTL(t *testing.T) {
+	tests := []struct {
+		name string
+		move bool
+	}{
+		{name: "copy"},
+		{name: "rename", move: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			if err := db.SetWithTTL("a", "one", time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			mustSet(t, db, "b", "two")
+
+			op := db.Copy
+			if tt.move {
+				op = db.Rename
+			}
+			if err := op("a", "b"); err != nil {
+				t.Fatal(err)
+			}
+			value, ttl, err := db.GetWithTTL("b")
+			if err != nil || value != "one" || ttl <= 0 || ttl > time.Hour {
+				t.Fatalf("GetWithTTL(b) = %q, %v, %v, want one with the TTL of a", value, ttl, err)
+			}
+		})
+	}
+}
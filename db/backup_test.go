@@ -0,0 +1,227 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// contents returns every key and value in db
+func contents(t *testing.T, db *SimpleDB) map[string]string {
+	t.Helper()
+	all, err := db.ScanPrefix("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return all
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	tests := []struct {
+		name string
+		from Options
+		to   Options
+	}{
+		{name: "default"},
+		{name: "binary codec", from: Options{Codec: BinaryCodec{}}, to: Options{Codec: BinaryCodec{}}},
+		{name: "compressed into plain", from: Options{Compression: CompressionZstd}},
+		{name: "plain into compressed", to: Options{Compression: CompressionGzip}},
+		{name: "encrypted", from: Options{EncryptionKey: key}, to: Options{EncryptionKey: key}},
+		{name: "segments", from: Options{SegmentSize: 256}, to: Options{SegmentSize: 256}},
+	}
+
+	want := map[string]string{"a": "one", "b": strings.Repeat("two", 100), "c": "", "bytes": "\x00\xff"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, _ := openTestDB(t, tt.from)
+			for key, value := range want {
+				mustSet(t, src, key, value)
+			}
+			mustSet(t, src, "gone", "v")
+			if err := src.Delete("gone"); err != nil {
+				t.Fatal(err)
+			}
+			if err := src.SetWithTTL("expiring", "v", time.Hour); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := src.Backup(&buf); err != nil {
+				t.Fatal(err)
+			}
+			dst, _ := openTestDB(t, tt.to)
+			imported, err := dst.Restore(&buf, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if imported != len(want)+1 {
+				t.Fatalf("Restore() = %d, want %d", imported, len(want)+1)
+			}
+
+			got := contents(t, dst)
+			delete(got, "expiring")
+			if !maps.Equal(got, want) {
+				t.Fatalf("restored %v, want %v", got, want)
+			}
+			if _, left, err := dst.GetWithTTL("expiring"); err != nil || left <= 0 || left > time.Hour {
+				t.Fatalf("GetWithTTL(expiring) = %v, %v, want its TTL kept", left, err)
+			}
+		})
+	}
+}
+
+func TestBackupPointInTime(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	mustSet(t, db, "a", "one")
+
+	// Backup buffers its output, so these writes land after the snapshot
+	// was taken but before anything reaches the writer
+	var buf bytes.Buffer
+	w := writerFunc(func(p []byte) (int, error) {
+		if !db.Exists("b") {
+			mustSet(t, db, "a", "changed")
+			mustSet(t, db, "b", "new")
+		}
+		return buf.Write(p)
+	})
+	if err := db.Backup(w); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, _ := openTestDB(t, Options{})
+	if _, err := dst.Restore(&buf, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(t, dst); !maps.Equal(got, map[string]string{"a": "one"}) {
+		t.Fatalf("backup holds %v, want only what was there when it started", got)
+	}
+}
+
+// writerFunc is an io.Writer backed by a function
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func TestBackupOpensAsDatabase(t *testing.T) {
+	src, _ := openTestDB(t, Options{})
+	mustSet(t, src, "a", "one")
+	mustSet(t, src, "b", "two")
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Backup(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db := reopenTestDB(t, path, Options{ReadOnly: true})
+	if got := contents(t, db); !maps.Equal(got, map[string]string{"a": "one", "b": "two"}) {
+		t.Fatalf("backup opened as %v", got)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	dump := func(t *testing.T) []byte {
+		return dumpOf(t, map[string]string{"a": "new", "b": "two", "c": "three"}).Bytes()
+	}
+	tests := []struct {
+		name      string
+		dump      func(t *testing.T) []byte
+		overwrite bool
+		want      map[string]string
+		imported  int
+		wantErr   error
+	}{
+		{
+			name:     "keep existing",
+			dump:     dump,
+			want:     map[string]string{"a": "old", "b": "two", "c": "three", "z": "mine"},
+			imported: 2,
+		},
+		{
+			name:      "overwrite",
+			dump:      dump,
+			overwrite: true,
+			want:      map[string]string{"a": "new", "b": "two", "c": "three", "z": "mine"},
+			imported:  3,
+		},
+		{
+			name:     "empty",
+			dump:     func(t *testing.T) []byte { return nil },
+			want:     map[string]string{"a": "old", "z": "mine"},
+			imported: 0,
+		},
+		{
+			name: "truncated",
+			dump: func(t *testing.T) []byte {
+				raw := dump(t)
+				return raw[:len(raw)-1]
+			},
+			overwrite: true,
+			want:      map[string]string{"a": "new", "b": "two", "z": "mine"},
+			imported:  2,
+			wantErr:   io.ErrUnexpectedEOF,
+		},
+		{
+			name: "corrupt",
+			dump: func(t *testing.T) []byte {
+				raw := dump(t)
+				raw[len(raw)-2] ^= 0x01
+				return raw
+			},
+			overwrite: true,
+			want:      map[string]string{"a": "new", "b": "two", "z": "mine"},
+			imported:  2,
+			wantErr:   ErrCorrupt,
+		},
+		{
+			name: "expired keys",
+			dump: func(t *testing.T) []byte {
+				src, _ := openTestDB(t, Options{})
+				mustSet(t, src, "b", "two")
+				if err := src.SetWithTTL("c", "three", time.Millisecond); err != nil {
+					t.Fatal(err)
+				}
+				var buf bytes.Buffer
+				if err := src.Backup(&buf); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(5 * time.Millisecond)
+				return buf.Bytes()
+			},
+			want:     map[string]string{"a": "old", "b": "two", "z": "mine"},
+			imported: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			mustSet(t, db, "a", "old")
+			mustSet(t, db, "z", "mine")
+
+			imported, err := db.Restore(bytes.NewReader(tt.dump(t)), tt.overwrite)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Restore() error = %v, want %v", err, tt.wantErr)
+			}
+			if imported != tt.imported {
+				t.Fatalf("Restore() = %d, want %d", imported, tt.imported)
+			}
+			if got := contents(t, db); !maps.Equal(got, tt.want) {
+				t.Fatalf("restored %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
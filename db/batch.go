@@ -0,0 +1,58 @@
+package db
+
+import "errors"
+
+// WriteBatch collects puts and deletes to apply together with Commit. Nothing
+// is visible to readers, or written to disk, until then. A WriteBatch is not
+// safe for concurrent use.
+type WriteBatch struct {
+	db  *SimpleDB
+	ops []Record
+}
+
+// NewBatch returns an empty batch for the database
+func (db *SimpleDB) NewBatch() *WriteBatch {
+	return &WriteBatch{db: db}
+}
+
+// Put queues setting key to value
+func (b *WriteBatch) Put(key, value string) {
+	b.ops = append(b.ops, Record{Key: key, Value: []byte(value)})
+}
+
+// Delete queues deleting key. Deleting a key that doesn't exist when the
+// batch is committed does nothing.
+func (b *WriteBatch) Delete(key string) {
+	b.ops = append(b.ops, Record{Key: key, Deleted: true})
+}
+
+// Len returns the number of queued operations
+func (b *WriteBatch) Len() int {
+	return len(b.ops)
+}
+
+// Commit applies the queued operations in order with a single append to
+// the log, then empties the batch so it can be reused. Either all of them
+// take effect or, if Commit fails or the process crashes while it writes,
+// none do. Size limits are checked before anything is written.
+func (b *WriteBatch) Commit() error {
+	err := b.db.UpdateTx(func(tx *WriteTx) error {
+		for _, op := range b.ops {
+			if !op.Deleted {
+				if err := tx.Set(op.Key, string(op.Value)); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Delete(op.Key); err != nil && !errors.Is(err, ErrKeyNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b.ops = nil
+	return nil
+}
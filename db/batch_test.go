@@ -0,0 +1,181 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWriteBatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(b *WriteBatch) // Runs against a database holding a=one and b=two
+		want  map[string]string
+	}{
+		{
+			name:  "empty",
+			build: func(b *WriteBatch) {},
+			want:  map[string]string{"a": "one", "b": "two"},
+		},
+		{
+			name:  "puts",
+			build: func(b *WriteBatch) { b.Put("a", "1"); b.Put("c", "3") },
+			want:  map[string]string{"a": "1", "b": "two", "c": "3"},
+		},
+		{
+			name:  "puts and deletes",
+			build: func(b *WriteBatch) { b.Delete("a"); b.Put("c", "3"); b.Delete("b") },
+			want:  map[string]string{"c": "3"},
+		},
+		{
+			name:  "delete missing",
+			build: func(b *WriteBatch) { b.Delete("missing"); b.Put("c", "3") },
+			want:  map[string]string{"a": "one", "b": "two", "c": "3"},
+		},
+		{
+			name:  "put then delete",
+			build: func(b *WriteBatch) { b.Put("c", "3"); b.Delete("c") },
+			want:  map[string]string{"a": "one", "b": "two"},
+		},
+		{
+			name:  "delete then put",
+			build: func(b *WriteBatch) { b.Delete("a"); b.Put("a", "again") },
+			want:  map[string]string{"a": "again", "b": "two"},
+		},
+		{
+			name:  "last put wins",
+			build: func(b *WriteBatch) { b.Put("a", "1"); b.Put("a", "2") },
+			want:  map[string]string{"a": "2", "b": "two"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			mustSet(t, db, "a", "one")
+			mustSet(t, db, "b", "two")
+
+			b := db.NewBatch()
+			tt.build(b)
+			if err := b.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if n := b.Len(); n != 0 {
+				t.Fatalf("Len() = %d after Commit, want 0", n)
+			}
+
+			check := func(db *SimpleDB) {
+				t.Helper()
+				for key, want := range tt.want {
+					wantValue(t, db, key, want)
+				}
+				if n := db.Len(); n != len(tt.want) {
+					t.Fatalf("Len() = %d, want %d", n, len(tt.want))
+				}
+			}
+			check(db)
+			db.Close()
+			check(reopenTestDB(t, path, Options{}))
+		})
+	}
+}
+
+func TestWriteBatchDropped(t *testing.T) {
+	db, path := openTestDB(t, Options{})
+	mustSet(t, db, "a", "one")
+	before := fileSize(t, db)
+
+	b := db.NewBatch()
+	b.Put("b", "two")
+	b.Delete("a")
+	if n := b.Len(); n != 2 {
+		t.Fatalf("Len() = %d, want 2", n)
+	}
+	// Queued operations aren't visible before Commit
+	wantMissing(t, db, "b")
+	wantValue(t, db, "a", "one")
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != before {
+		t.Fatalf("file grew from %d to %d bytes for a batch never committed", before, info.Size())
+	}
+	db = reopenTestDB(t, path, Options{})
+	wantValue(t, db, "a", "one")
+	wantMissing(t, db, "b")
+}
+
+func TestWriteBatchInvalid(t *testing.T) {
+	db, _ := openTestDB(t, Options{MaxValueSize: 10})
+	mustSet(t, db, "a", "one")
+	before := fileSize(t, db)
+
+	b := db.NewBatch()
+	b.Delete("a")
+	b.Put("b", strings.Repeat("x", 11))
+	if err := b.Commit(); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("Commit() = %v, want ErrValueTooLarge", err)
+	}
+	wantValue(t, db, "a", "one")
+	if size := fileSize(t, db); size != before {
+		t.Fatalf("file grew from %d to %d bytes for a failed batch", before, size)
+	}
+	// The batch is kept, so nothing is lost if the caller wants to retry
+	if n := b.Len(); n != 2 {
+		t.Fatalf("Len() = %d after a failed Commit, want 2", n)
+	}
+}
+
+func TestWriteBatchTorn(t *testing.T) {
+	tests := []struct {
+		name string
+		cut  int64 // Bytes cut off the end of the log before reopening
+		want map[string]string
+	}{
+		{name: "whole batch", want: map[string]string{"b": "two", "c": "three"}},
+		{name: "torn last record", cut: 3, want: map[string]string{"a": "one", "b": "two"}},
+		{name: "torn header", cut: 30, want: map[string]string{"a": "one", "b": "two"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			mustSet(t, db, "a", "one")
+			mustSet(t, db, "b", "two")
+			b := db.NewBatch()
+			b.Delete("a")
+			b.Put("c", "three")
+			if err := b.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.cut > 0 {
+				os.Remove(path + indexSuffix)
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Truncate(path, info.Size()-tt.cut); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// A batch cut short by a crash takes no effect at all
+			db = reopenTestDB(t, path, Options{})
+			for key, value := range tt.want {
+				wantValue(t, db, key, value)
+			}
+			if n := db.Len(); n != len(tt.want) {
+				t.Fatalf("Len() = %d, want %d", n, len(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package db
+
+import "math"
+
+// defaultFilterFalsePositiveRate is used when
+// Options.FilterFalsePositiveRate is zero
+const defaultFilterFalsePositiveRate = 0.01
+
+// bloomFilter is a bloom filter over key hashes. It never reports a hash it
+// was given as absent, and reports one it wasn't given as present at about
+// the rate it was sized for, as long as it holds no more than that many
+// hashes. Hashes can't be taken out again, so a filter is replaced rather
+// than updated when its keys go away.
+type bloomFilter struct {
+	bits   []uint64
+	m      uint64 // Number of bits
+	probes uint64 // Bits set per hash
+}
+
+// newBloomFilter returns an empty filter for n hashes with false positives
+// at rate
+func newBloomFilter(n int64, rate float64) *bloomFilter {
+	n = max(n, 1)
+	m := uint64(math.Ceil(-float64(n) * math.Log(rate) / (math.Ln2 * math.Ln2)))
+	m = max(m, 64)
+	probes := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	return &bloomFilter{
+		bits:   make([]uint64, (m+63)/64),
+		m:      m,
+		probes: max(probes, 1),
+	}
+}
+
+// add records hash in the filter
+func (f *bloomFilter) add(hash uint64) {
+	h1, h2 := f.split(hash)
+	for i := uint64(0); i < f.probes; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// mayContain reports whether hash may have been added; false means it
+// certainly wasn't
+func (f *bloomFilter) mayContain(hash uint64) bool {
+	h1, h2 := f.split(hash)
+	for i := uint64(0); i < f.probes; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// split derives the two hashes that probe positions are combined from; the
+// second is never zero, so the probes don't all land on one bit
+func (f *bloomFilter) split(hash uint64) (uint64, uint64) {
+	return hash, hash>>32 | 1
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"fmt"
+	"hash/maphash"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int64 // Hashes added, which is also what the filter is sized for
+		rate float64
+	}{
+		{name: "default rate", n: 1000, rate: defaultFilterFalsePositiveRate},
+		{name: "tight", n: 1000, rate: 0.0001},
+		{name: "loose", n: 1000, rate: 0.3},
+		{name: "one", n: 1, rate: defaultFilterFalsePositiveRate},
+		{name: "many", n: 100000, rate: defaultFilterFalsePositiveRate},
+	}
+
+	seed := maphash.MakeSeed()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newBloomFilter(tt.n, tt.rate)
+			for i := int64(0); i < tt.n; i++ {
+				f.add(maphash.String(seed, fmt.Sprintf("in-%d", i)))
+			}
+
+			// Never a false negative
+			for i := int64(0); i < tt.n; i++ {
+				if !f.mayContain(maphash.String(seed, fmt.Sprintf("in-%d", i))) {
+					t.Fatalf("in-%d added but reported absent", i)
+				}
+			}
+
+			const probes = 20000
+			positives := 0
+			for i := 0; i < probes; i++ {
+				if f.mayContain(maphash.String(seed, fmt.Sprintf("out-%d", i))) {
+					positives++
+				}
+			}
+			if got := float64(positives) / probes; got > 2*tt.rate+0.002 {
+				t.Fatalf("false-positive rate %.4f, want about %.4f", got, tt.rate)
+			}
+		})
+	}
+}
+
+func TestSpillFilterNoFalseNegatives(t *testing.T) {
+	tests := []struct {
+		name string
+		rate float64
+	}{
+		{name: "default"},
+		{name: "loose", rate: 0.5},
+		{name: "tight", rate: 1e-9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{IndexBudget: 1, FilterFalsePositiveRate: tt.rate}
+			db, path := openTestDB(t, opts)
+			// Enough keys to grow the table, and so rebuild the filter, a few
+			// times, with deletes and overwrites between
+			want := make(map[string]string)
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("key-%d", i)
+				mustSet(t, db, key, fmt.Sprint(i))
+				want[key] = fmt.Sprint(i)
+				if i%5 == 4 {
+					old := fmt.Sprintf("key-%d", i-2)
+					if err := db.Delete(old); err != nil {
+						t.Fatal(err)
+					}
+					delete(want, old)
+				}
+			}
+
+			check := func(db *SimpleDB) {
+				t.Helper()
+				for key, value := range want {
+					wantValue(t, db, key, value)
+				}
+				for i := 1000; i < 1100; i++ {
+					wantMissing(t, db, fmt.Sprintf("key-%d", i))
+				}
+			}
+			check(db)
+			if err := db.Compact(); err != nil {
+				t.Fatal(err)
+			}
+			check(db)
+			db.Close()
+			check(reopenTestDB(t, path, opts))
+		})
+	}
+}
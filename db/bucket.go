@@ -0,0 +1,100 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// bucketSeparator joins a bucket name to the keys stored in it. Bucket
+// names containing it are rejected, so two buckets can never produce the
+// same underlying key.
+const bucketSeparator = "\x00"
+
+// ErrInvalidBucket is returned for bucket names containing a NUL byte
+var ErrInvalidBucket = fmt.Errorf("%w: bucket name contains a NUL byte", ErrInvalidKey)
+
+// Bucket is a namespace of keys inside a database. Keys in different
+// buckets never collide even if they share a name; they are stored in the
+// same log and index as every other key, under a bucket-specific prefix.
+type Bucket struct {
+	db     *SimpleDB
+	prefix string
+}
+
+// Bucket returns a handle for the named bucket. Buckets don't need to be
+// created; one exists as long as it holds keys.
+func (db *SimpleDB) Bucket(name string) (*Bucket, error) {
+	prefix, err := db.bucketPrefix(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Bucket{db: db, prefix: prefix}, nil
+}
+
+// bucketPrefix returns the key prefix used by the named bucket
+func (db *SimpleDB) bucketPrefix(name string) (string, error) {
+	if strings.Contains(name, bucketSeparator) {
+		return "", ErrInvalidBucket
+	}
+	return db.normalize(name + bucketSeparator), nil
+}
+
+// Set adds or updates a key in the bucket
+func (b *Bucket) Set(key, value string) error {
+	return b.db.Set(b.prefix+key, value)
+}
+
+// Get retrieves the value for a key in the bucket
+func (b *Bucket) Get(key string) (string, error) {
+	return b.db.Get(b.prefix + key)
+}
+
+// Delete removes a key from the bucket
+func (b *Bucket) Delete(key string) error {
+	return b.db.Delete(b.prefix + key)
+}
+
+// Keys returns the keys in the bucket, without the bucket prefix, in
+// ascending order
+func (b *Bucket) Keys() []string {
+	var keys []string
+	for _, key := range b.db.Keys() {
+		if strings.HasPrefix(key, b.prefix) {
+			keys = append(keys, strings.TrimPrefix(key, b.prefix))
+		}
+	}
+	return keys
+}
+
+// DeleteBucket deletes every key in the named bucket and returns how many
+// were removed
+func (db *SimpleDB) DeleteBucket(name string) (int, error) {
+	prefix, err := db.bucketPrefix(name)
+	if err != nil {
+		return 0, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return 0, ErrClosed
+	}
+
+	all, err := db.indexed()
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for key := range all {
+		if !strings.HasPrefix(key, prefix) || db.expired(key) {
+			continue
+		}
+		if err := db.del(key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
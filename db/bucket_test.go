@@ -0,0 +1,141 @@
+package db
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestBucket(t *testing.T) {
+	tests := []struct {
+		name   string
+		bucket string
+		want   map[string]string // "" for missing
+	}{
+		{name: "users", bucket: "users", want: map[string]string{"1": "ann", "2": "bob", "3": ""}},
+		{name: "sessions", bucket: "sessions", want: map[string]string{"1": "s1", "2": "", "3": "s3"}},
+		{name: "prefix of another bucket", bucket: "user", want: map[string]string{"1": "", "2": ""}},
+		{name: "unused", bucket: "orders", want: map[string]string{"1": ""}},
+	}
+
+	db, _ := openTestDB(t, Options{})
+	users, sessions := mustBucket(t, db, "users"), mustBucket(t, db, "sessions")
+	for _, set := range []struct {
+		bucket     *Bucket
+		key, value string
+	}{
+		{users, "1", "ann"}, {users, "2", "bob"}, {sessions, "1", "s1"}, {sessions, "3", "s3"},
+	} {
+		if err := set.bucket.Set(set.key, set.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Plain keys with the same names don't show up in either
+	mustSet(t, db, "1", "plain")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := mustBucket(t, db, tt.bucket)
+			var keys []string
+			for key, want := range tt.want {
+				got, err := b.Get(key)
+				if want == "" {
+					if !errors.Is(err, ErrKeyNotFound) {
+						t.Fatalf("Get(%q) = %q, %v, want not found", key, got, err)
+					}
+					continue
+				}
+				if err != nil || got != want {
+					t.Fatalf("Get(%q) = %q, %v, want %q", key, got, err, want)
+				}
+				keys = append(keys, key)
+			}
+			slices.Sort(keys)
+			if got := b.Keys(); !slices.Equal(got, keys) {
+				t.Fatalf("Keys() = %v, want %v", got, keys)
+			}
+		})
+	}
+	wantValue(t, db, "1", "plain")
+}
+
+func TestDeleteBucket(t *testing.T) {
+	tests := []struct {
+		name   string
+		bucket string
+		want   int
+		left   []string // Keys in the users bucket afterwards
+	}{
+		{name: "users", bucket: "users", want: 2},
+		{name: "other bucket", bucket: "sessions", want: 1, left: []string{"1", "2"}},
+		{name: "missing", bucket: "orders", left: []string{"1", "2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			users := mustBucket(t, db, "users")
+			for _, key := range []string{"1", "2"} {
+				if err := users.Set(key, "v"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := mustBucket(t, db, "sessions").Set("1", "v"); err != nil {
+				t.Fatal(err)
+			}
+			mustSet(t, db, "users", "plain")
+
+			deleted, err := db.DeleteBucket(tt.bucket)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deleted != tt.want {
+				t.Fatalf("DeleteBucket(%q) = %d, want %d", tt.bucket, deleted, tt.want)
+			}
+			if got := users.Keys(); !slices.Equal(got, tt.left) {
+				t.Fatalf("users holds %v, want %v", got, tt.left)
+			}
+			wantValue(t, db, "users", "plain")
+		})
+	}
+}
+
+func TestBucketInvalidName(t *testing.T) {
+	tests := []struct {
+		name   string
+		bucket string
+	}{
+		{name: "embedded NUL", bucket: "a\x00b"},
+		{name: "only NUL", bucket: "\x00"},
+		{name: "trailing NUL", bucket: "ab\x00"},
+	}
+
+	db, _ := openTestDB(t, Options{})
+	if err := mustBucket(t, db, "ab").Set("1", "v"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if b, err := db.Bucket(tt.bucket); !errors.Is(err, ErrInvalidBucket) || !errors.Is(err, ErrInvalidKey) {
+				t.Fatalf("Bucket(%q) = %v, %v, want ErrInvalidBucket", tt.bucket, b, err)
+			}
+			if deleted, err := db.DeleteBucket(tt.bucket); !errors.Is(err, ErrInvalidBucket) || deleted != 0 {
+				t.Fatalf("DeleteBucket(%q) = %d, %v, want ErrInvalidBucket", tt.bucket, deleted, err)
+			}
+		})
+	}
+	if got := mustBucket(t, db, "ab").Keys(); !slices.Equal(got, []string{"1"}) {
+		t.Fatalf("ab holds %v, want [1]", got)
+	}
+}
+
+// mustBucket returns the named bucket, failing the test if it's invalid
+func mustBucket(t *testing.T, db *SimpleDB, name string) *Bucket {
+	t.Helper()
+	b, err := db.Bucket(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"container/list"
+	"sync"
+)
+
+// valueCache is a fixed-size LRU cache of recently read values. It has its
+// own lock because Get fills it while holding only the database read lock.
+// A nil cache is valid and caches nothing.
+type valueCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List               // Most recently used at the front
+	items    map[string]*list.Element // Elements hold *cacheEntry
+}
+
+type cacheEntry struct {
+	key   string
+	value []byte
+}
+
+// newValueCache returns a cache holding up to capacity values, or nil when
+// capacity is zero
+func newValueCache(capacity int) *valueCache {
+	if capacity == 0 {
+		return nil
+	}
+	return &valueCache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// get returns a copy of the cached value for key
+func (c *valueCache) get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return append([]byte(nil), elem.Value.(*cacheEntry).value...), true
+}
+
+// put stores a copy of value, evicting the least recently used entry if full
+func (c *valueCache) put(key string, value []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value = append([]byte(nil), value...)
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*cacheEntry).value = value
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&cacheEntry{key: key, value: value})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// remove drops key from the cache
+func (c *valueCache) remove(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.order.Remove(elem)
+		delete(c.items, key)
+	}
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestValueCache(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		ops      func(c *valueCache)
+		want     map[string]string // Keys expected in the cache, "" for absent
+	}{
+		{
+			name: "disabled",
+			ops:  func(c *valueCache) { c.put("a", []byte("one")) },
+			want: map[string]string{"a": ""},
+		},
+		{
+			name:     "evicts least recently used",
+			capacity: 2,
+			ops: func(c *valueCache) {
+				c.put("a", []byte("one"))
+				c.put("b", []byte("two"))
+				c.get("a")
+				c.put("c", []byte("three"))
+			},
+			want: map[string]string{"a": "one", "b": "", "c": "three"},
+		},
+		{
+			name:     "replace",
+			capacity: 2,
+			ops: func(c *valueCache) {
+				c.put("a", []byte("one"))
+				c.put("a", []byte("two"))
+			},
+			want: map[string]string{"a": "two"},
+		},
+		{
+			name:     "remove",
+			capacity: 2,
+			ops: func(c *valueCache) {
+				c.put("a", []byte("one"))
+				c.remove("a")
+			},
+			want: map[string]string{"a": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newValueCache(tt.capacity)
+			tt.ops(c)
+			for key, want := range tt.want {
+				value, ok := c.get(key)
+				if ok != (want != "") || string(value) != want {
+					t.Fatalf("get(%q) = %q, %v, want %q", key, value, ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValueCacheCopies(t *testing.T) {
+	c := newValueCache(1)
+	value := []byte("one")
+	c.put("a", value)
+	value[0] = 'X'
+	got, _ := c.get("a")
+	got[1] = 'X'
+	if got, _ := c.get("a"); string(got) != "one" {
+		t.Fatalf("cached value changed to %q through a caller's slice", got)
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(t *testing.T, db *SimpleDB)
+		want  string // "" for missing
+	}{
+		{name: "set", write: func(t *testing.T, db *SimpleDB) { mustSet(t, db, "a", "two") }, want: "two"},
+		{
+			name: "delete",
+			write: func(t *testing.T, db *SimpleDB) {
+				if err := db.Delete("a"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "compare and swap",
+			write: func(t *testing.T, db *SimpleDB) {
+				if _, err := db.CompareAndSwap("a", "1", "two"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "two",
+		},
+		{
+			name: "increment",
+			write: func(t *testing.T, db *SimpleDB) {
+				if _, err := db.Increment("a", 1); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "2",
+		},
+		{
+			name: "append",
+			write: func(t *testing.T, db *SimpleDB) {
+				if _, err := db.Append("a", "0"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "10",
+		},
+		{
+			name: "batch",
+			write: func(t *testing.T, db *SimpleDB) {
+				if err := db.BatchSet([]KVPair{{Key: "a", Value: "two"}}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "two",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{CacheSize: 10})
+			mustSet(t, db, "a", "1")
+			// Fills the cache
+			wantValue(t, db, "a", "1")
+
+			tt.write(t, db)
+			if tt.want == "" {
+				wantMissing(t, db, "a")
+			} else {
+				wantValue(t, db, "a", tt.want)
+			}
+		})
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for _, size := range []int{0, 1000} {
+		b.Run(fmt.Sprintf("cache=%d", size), func(b *testing.B) {
+			db, err := OpenDBWithOptions(filepath.Join(b.TempDir(), "bench.db"), Options{CacheSize: size})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer db.Close()
+			for i := 0; i < 100; i++ {
+				if err := db.Set(fmt.Sprintf("key-%d", i), "value"); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := db.Get(fmt.Sprintf("key-%d", i%100)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
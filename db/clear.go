@@ -0,0 +1,164 @@
+package db
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// clearSuffix is appended to the database path for the empty file Clear
+// swaps in for the current segment
+const clearSuffix = ".clear"
+
+// Clear deletes every key by emptying the log rather than writing a
+// tombstone per key, and resets the index to empty. Segments other than the
+// one being appended to are removed oldest first; if the process dies or a
+// removal fails partway through, keys from segments not yet removed may
+// come back, but never a key deleted before the Clear. The current segment
+// is replaced by an empty file rather than truncated, so readers with their
+// own handles on it, such as View, keep seeing what they started with.
+func (db *SimpleDB) Clear() error {
+	if db.opts.ReadOnly {
+		return ErrReadOnly
+	}
+
+	// A running compaction would otherwise swap the old contents back in
+	db.compactMu.Lock()
+	defer db.compactMu.Unlock()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	// Every key is reported deleted, spilled ones included
+	all, err := db.indexed()
+	if err != nil {
+		return err
+	}
+	var spill *spillIndex
+	if db.spill != nil {
+		if spill, err = newSpillIndex(db.spill.dir, db.spill.rate); err != nil {
+			return err
+		}
+	}
+	// It only replaces the old one once the log is gone
+	swapped := false
+	defer func() {
+		if !swapped {
+			spill.close()
+		}
+	}()
+
+	if err := db.removeSnapshot(); err != nil {
+		return err
+	}
+	// Oldest first, so that if this stops partway the segments left are all
+	// newer than the ones removed, and no tombstone goes missing while a
+	// record it deleted survives
+	removed := make(map[int]bool)
+	for _, id := range db.segmentIDs() {
+		if id == db.segment {
+			continue
+		}
+		if err := db.removeSegment(id); err != nil {
+			if forgetErr := db.forgetSegments(all, removed); forgetErr != nil {
+				return errors.Join(err, forgetErr)
+			}
+			return err
+		}
+		removed[id] = true
+	}
+	// The old segments must be gone for good before the current one, which
+	// may hold tombstones for their records, is emptied
+	if err := syncDir(filepath.Dir(db.path)); err != nil {
+		return errors.Join(err, db.forgetSegments(all, removed))
+	}
+	tmpPath := db.path + clearSuffix
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR|os.O_APPEND, db.opts.FileMode)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, segmentPath(db.path, db.segment)); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	syncErr := syncDir(filepath.Dir(db.path))
+	// Whatever is still buffered was about to be cleared anyway
+	db.file.Close()
+	db.segments[db.segment] = file
+	db.file = file
+	db.resetWriter(file)
+
+	db.mapSegments()
+	db.rewritten()
+
+	for key := range all {
+		db.publish(Event{Type: EventDelete, Key: key})
+	}
+	db.spill.close()
+	db.spill, swapped = spill, true
+	db.data = make(map[string]location)
+	db.indexSize = 0
+	db.expires = make(map[string]int64)
+	db.cache = newValueCache(db.opts.CacheSize)
+	db.lru = newKeyOrder(db.opts, nil)
+	db.dead, db.corrupt = 0, 0
+	db.size, db.segmentSize = 0, 0
+	for _, idx := range db.indexes {
+		idx.keys = make(map[string]map[string]struct{})
+		idx.field = make(map[string]string)
+	}
+	return syncErr
+}
+
+// removeSegment closes segment id and removes its file. A file that can't
+// be removed is opened again, so its records stay readable. Callers must
+// hold the write lock.
+func (db *SimpleDB) removeSegment(id int) error {
+	path := segmentPath(db.path, id)
+	info, err := db.segments[id].Stat()
+	if err != nil {
+		return err
+	}
+	db.segments[id].Close()
+	if err := removeFile(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		file, openErr := os.OpenFile(path, os.O_RDWR, db.opts.FileMode)
+		if openErr != nil {
+			return errors.Join(err, openErr)
+		}
+		db.segments[id] = file
+		return err
+	}
+	delete(db.segments, id)
+	db.size -= info.Size()
+	return nil
+}
+
+// forgetSegments drops the keys in all whose records were in the removed
+// segments, for a Clear that stopped partway, so the index only points at
+// records still on disk. Callers must hold the write lock.
+func (db *SimpleDB) forgetSegments(all map[string]location, removed map[int]bool) error {
+	if len(removed) == 0 {
+		return nil
+	}
+	for key, loc := range all {
+		if !removed[loc.Segment] {
+			continue
+		}
+		if err := db.promote(key); err != nil {
+			return err
+		}
+		db.unindexKey(key)
+		db.cache.remove(key)
+		delete(db.expires, key)
+		db.publish(Event{Type: EventDelete, Key: key})
+	}
+	db.mapSegments()
+	db.rewritten()
+	return nil
+}
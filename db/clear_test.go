@@ -0,0 +1,196 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestClear(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "default"},
+		{name: "segments", opts: Options{SegmentSize: 256}},
+		{name: "index budget", opts: Options{IndexBudget: 1}},
+		{name: "cache", opts: Options{CacheSize: 10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, tt.opts)
+			for i := 0; i < 20; i++ {
+				mustSet(t, db, fmt.Sprintf("key-%d", i), "old")
+				wantValue(t, db, fmt.Sprintf("key-%d", i), "old")
+			}
+			if err := db.SetWithTTL("ttl", "old", time.Hour); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := db.Clear(); err != nil {
+				t.Fatal(err)
+			}
+			if got := db.Len(); got != 0 {
+				t.Fatalf("Len() after Clear = %d, want 0", got)
+			}
+			wantMissing(t, db, "key-0")
+			wantMissing(t, db, "ttl")
+			if size := fileSize(t, db); size != 0 {
+				t.Fatalf("file size after Clear = %d, want 0", size)
+			}
+
+			// Still takes writes, and nothing cleared comes back on reopen
+			mustSet(t, db, "key-1", "new")
+			mustSet(t, db, "fresh", "new")
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			db = reopenTestDB(t, path, tt.opts)
+			if got := db.Len(); got != 2 {
+				t.Fatalf("Len() after reopening = %d, want 2", got)
+			}
+			wantValue(t, db, "key-1", "new")
+			wantValue(t, db, "fresh", "new")
+			wantMissing(t, db, "key-0")
+		})
+	}
+}
+
+func TestClearNotifiesWatchers(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	mustSet(t, db, "a", "one")
+	events, cancel := db.Watch("a")
+	defer cancel()
+
+	if err := db.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, events); event.Type != EventDelete || event.Key != "a" {
+		t.Fatalf("got %+v, want a delete of a", event)
+	}
+}
+
+func TestClearInterruptedRemoval(t *testing.T) {
+	opts := Options{SegmentSize: 512}
+	db, path := openTestDB(t, opts)
+	writeSegmented(t, db)
+
+	ids := db.segmentIDs()
+	old := ids[:len(ids)-1]
+	saved := t.TempDir()
+	for _, id := range ids {
+		copyFile(t, segmentPath(path, id), filepath.Join(saved, fmt.Sprint(id)))
+	}
+	var removed []string
+	removeFile = func(name string) error {
+		removed = append(removed, name)
+		return os.Remove(name)
+	}
+	defer func() { removeFile = os.Remove }()
+	if err := db.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != len(old) {
+		t.Fatalf("removed %v, want all of %v", removed, old)
+	}
+	for i, id := range old {
+		if removed[i] != segmentPath(path, id) {
+			t.Fatalf("removed %v, want segments %v in order", removed, old)
+		}
+	}
+
+	// A crash before the current segment is emptied leaves the newest old
+	// segments behind, and with them every tombstone for the ones removed
+	for gone := 0; gone <= len(old); gone++ {
+		t.Run(fmt.Sprintf("removed=%d", gone), func(t *testing.T) {
+			crashed := filepath.Join(t.TempDir(), "test.db")
+			for _, id := range ids[gone:] {
+				copyFile(t, filepath.Join(saved, fmt.Sprint(id)), segmentPath(crashed, id))
+			}
+			wantMissing(t, reopenTestDB(t, crashed, opts), "k")
+		})
+	}
+}
+
+func TestClearRemoveFailure(t *testing.T) {
+	opts := Options{SegmentSize: 512}
+	db, path := openTestDB(t, opts)
+	// Lands in the oldest segment, which goes before the failure
+	mustSet(t, db, "first", "v")
+	writeSegmented(t, db)
+	ids := db.segmentIDs()
+
+	errRemove := errors.New("remove failed")
+	removeFile = func(name string) error {
+		if name == segmentPath(path, ids[1]) {
+			return errRemove
+		}
+		return os.Remove(name)
+	}
+	defer func() { removeFile = os.Remove }()
+	if err := db.Clear(); !errors.Is(err, errRemove) {
+		t.Fatalf("Clear() = %v, want the removal error", err)
+	}
+	if _, err := os.Stat(segmentPath(path, ids[0])); !os.IsNotExist(err) {
+		t.Fatalf("oldest segment left behind: %v", err)
+	}
+	for _, id := range ids[1:] {
+		if _, err := os.Stat(segmentPath(path, id)); err != nil {
+			t.Fatalf("segment %d removed after the failure: %v", id, err)
+		}
+	}
+
+	// Every key left is still readable, and is what a reopen finds
+	want := make(map[string]string)
+	for _, key := range db.Keys() {
+		value, err := db.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%q) = %v after the failed Clear", key, err)
+		}
+		want[key] = value
+	}
+	wantMissing(t, db, "first")
+	wantMissing(t, db, "k")
+	db.Close()
+	db = reopenTestDB(t, path, opts)
+	wantMissing(t, db, "first")
+	for key, value := range want {
+		wantValue(t, db, key, value)
+	}
+	if n := db.Len(); n != len(want) {
+		t.Fatalf("Len() = %d after reopening, want %d", n, len(want))
+	}
+}
+
+func TestClearSecondaryIndexes(t *testing.T) {
+	db, path := openTestDB(t, Options{})
+	if err := db.CreateIndex("by-team", "team"); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "a", `{"team":"red"}`)
+	mustSet(t, db, "b", `{"team":"red"}`)
+
+	if err := db.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "c", `{"team":"red"}`)
+
+	check := func(db *SimpleDB) {
+		t.Helper()
+		keys, err := db.QueryIndex("by-team", "red")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(keys, []string{"c"}) {
+			t.Fatalf("QueryIndex() = %v, want [c]", keys)
+		}
+	}
+	check(db)
+	db.Close()
+	check(reopenTestDB(t, path, Options{}))
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+)
+
+// Codec serializes records to and from the payload stored in each log frame.
+// Framing and checksums are handled separately, so a codec only has to
+// round-trip a single Record. A file must always be opened with the codec it
+// was written with.
+type Codec interface {
+	Encode(Record) ([]byte, error)
+	Decode([]byte) (Record, error)
+}
+
+// JSONCodec stores records as JSON objects. It is the default and keeps data
+// files readable with ordinary tools; binary values are base64 encoded.
+type JSONCodec struct{}
+
+// Encode implements Codec
+func (JSONCodec) Encode(entry Record) ([]byte, error) {
+	return json.Marshal(entry)
+}
+
+// Decode implements Codec
+func (JSONCodec) Decode(data []byte) (Record, error) {
+	var entry Record
+	err := json.Unmarshal(data, &entry)
+	return entry, err
+}
+
+// BinaryCodec stores records in a compact binary layout: a flags byte,
+// varint metadata fields, then the length-prefixed key, value and nonce,
+// and for records in a batch a trailing uvarint batch count. It is smaller
+// and faster than JSON, especially for binary values.
+type BinaryCodec struct{}
+
+// Flag bits in the first byte of a binary record. The compression
+// algorithm is stored in the bits between binaryDeleted and binaryTouched.
+const (
+	binaryDeleted          = 1 << 0
+	binaryCompressionShift = 1
+	binaryTouched          = 1 << 7
+)
+
+var errMalformedBinary = errors.New("malformed binary record")
+
+// Encode implements Codec
+func (BinaryCodec) Encode(entry Record) ([]byte, error) {
+	buf := make([]byte, 0, 1+4*binary.MaxVarintLen64+3*binary.MaxVarintLen32+len(entry.Key)+len(entry.Value)+len(entry.Nonce))
+
+	var flags byte
+	if entry.Deleted {
+		flags |= binaryDeleted
+	}
+	if entry.Touched {
+		flags |= binaryTouched
+	}
+	flags |= byte(entry.Compression) << binaryCompressionShift
+	buf = append(buf, flags)
+	buf = binary.AppendVarint(buf, entry.ExpiresAt)
+	buf = binary.AppendVarint(buf, entry.Version)
+	buf = binary.AppendVarint(buf, entry.CreatedAt)
+	buf = binary.AppendVarint(buf, entry.UpdatedAt)
+	buf = binary.AppendUvarint(buf, uint64(len(entry.Key)))
+	buf = append(buf, entry.Key...)
+	buf = binary.AppendUvarint(buf, uint64(len(entry.Value)))
+	buf = append(buf, entry.Value...)
+	buf = binary.AppendUvarint(buf, uint64(len(entry.Nonce)))
+	buf = append(buf, entry.Nonce...)
+	if entry.Batch != 0 {
+		buf = binary.AppendUvarint(buf, uint64(entry.Batch))
+	}
+	return buf, nil
+}
+
+// Decode implements Codec
+func (BinaryCodec) Decode(data []byte) (Record, error) {
+	if len(data) == 0 {
+		return Record{}, errMalformedBinary
+	}
+
+	entry := Record{
+		Deleted:     data[0]&binaryDeleted != 0,
+		Touched:     data[0]&binaryTouched != 0,
+		Compression: Compression((data[0] &^ binaryTouched) >> binaryCompressionShift),
+	}
+	data = data[1:]
+
+	for _, field := range []*int64{&entry.ExpiresAt, &entry.Version, &entry.CreatedAt, &entry.UpdatedAt} {
+		v, n := binary.Varint(data)
+		if n <= 0 {
+			return Record{}, errMalformedBinary
+		}
+		*field = v
+		data = data[n:]
+	}
+
+	key, data, ok := readBytes(data)
+	if !ok {
+		return Record{}, errMalformedBinary
+	}
+	value, data, ok := readBytes(data)
+	if !ok {
+		return Record{}, errMalformedBinary
+	}
+	nonce, data, ok := readBytes(data)
+	if !ok {
+		return Record{}, errMalformedBinary
+	}
+	// Older records, and those written on their own, stop here
+	if len(data) != 0 {
+		batch, n := binary.Uvarint(data)
+		if n != len(data) {
+			return Record{}, errMalformedBinary
+		}
+		entry.Batch = int(batch)
+	}
+
+	entry.Key = string(key)
+	if len(value) > 0 {
+		entry.Value = value
+	}
+	if len(nonce) > 0 {
+		entry.Nonce = nonce
+	}
+	return entry, nil
+}
+
+// readBytes splits a uvarint length-prefixed byte string off the front of data
+func readBytes(data []byte) ([]byte, []byte, bool) {
+	n, size := binary.Uvarint(data)
+	if size <= 0 || uint64(len(data)-size) < n {
+		return nil, nil, false
+	}
+	data = data[size:]
+	return data[:n], data[n:], true
+}
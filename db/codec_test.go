@@ -0,0 +1,106 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	codecs := []struct {
+		name  string
+		codec Codec
+	}{
+		{name: "json", codec: JSONCodec{}},
+		{name: "binary", codec: BinaryCodec{}},
+	}
+	tests := []struct {
+		name  string
+		entry Record
+	}{
+		{name: "set", entry: Record{Key: "a", Value: []byte("one"), Version: 3, CreatedAt: 1, UpdatedAt: 2}},
+		{name: "empty key and value", entry: Record{}},
+		{name: "binary value", entry: Record{Key: "b", Value: []byte{0, 0xff, '\n', '"'}}},
+		{name: "tombstone", entry: Record{Key: "a", Deleted: true, Version: 4}},
+		{name: "touch", entry: Record{Key: "a", Touched: true, ExpiresAt: 1 << 62}},
+		{name: "negative times", entry: Record{Key: "a", Value: []byte("v"), CreatedAt: -5, UpdatedAt: -1}},
+		{name: "compressed and encrypted", entry: Record{Key: "a", Value: []byte("v"), Compression: CompressionZstd, Nonce: []byte("123456789012")}},
+		{name: "compressed touch", entry: Record{Key: "a", Touched: true, Deleted: true, Compression: CompressionGzip}},
+		{name: "batch", entry: Record{Key: "a", Value: []byte("v"), Batch: 300}},
+	}
+
+	for _, codec := range codecs {
+		for _, tt := range tests {
+			t.Run(codec.name+"/"+tt.name, func(t *testing.T) {
+				data, err := codec.codec.Encode(tt.entry)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := codec.codec.Decode(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, tt.entry) {
+					t.Fatalf("Decode(Encode()) = %+v, want %+v", got, tt.entry)
+				}
+			})
+		}
+	}
+}
+
+func TestBinaryCodecMalformed(t *testing.T) {
+	valid, err := BinaryCodec{}.Encode(Record{Key: "key", Value: []byte("value"), Version: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	longer := append(append([]byte(nil), valid...), 0x80)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "flags only", data: valid[:1]},
+		{name: "cut in the key", data: valid[:8]},
+		{name: "cut in the value", data: valid[:len(valid)-3]},
+		{name: "bad batch count", data: longer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := (BinaryCodec{}).Decode(tt.data); !errors.Is(err, errMalformedBinary) {
+				t.Fatalf("Decode() error = %v, want %v", err, errMalformedBinary)
+			}
+		})
+	}
+}
+
+func TestOpenWithCodec(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec Codec
+	}{
+		{name: "default"},
+		{name: "json", codec: JSONCodec{}},
+		{name: "binary", codec: BinaryCodec{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{Codec: tt.codec}
+			db, path := openTestDB(t, opts)
+			mustSet(t, db, "a", "one")
+			mustSet(t, db, "b", "two")
+			if err := db.Delete("b"); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			db = reopenTestDB(t, path, opts)
+			wantValue(t, db, "a", "one")
+			wantMissing(t, db, "b")
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package db
+
+// commitRequest is a Set waiting for the group committer
+type commitRequest struct {
+	entry Record
+	done  chan error
+}
+
+// commitQueue holds the Sets waiting for the group committer. Writers add
+// to it and the committer takes everything queued at once, so all the
+// writers that arrived while the previous group was on its way to disk
+// share the next write and fsync.
+type commitQueue struct {
+	pending []commitRequest
+	closed  bool          // Set once the committer has exited
+	ready   chan struct{} // Signalled when pending goes from empty to not
+}
+
+// enqueue hands entry to the group committer and waits until it is written,
+// synced if SyncWrites is set, and indexed
+func (db *SimpleDB) enqueue(entry Record) error {
+	if db.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if err := db.checkKey(entry.Key, len(entry.Value)); err != nil {
+		return err
+	}
+
+	req := commitRequest{entry: entry, done: make(chan error, 1)}
+	db.queueMu.Lock()
+	if db.queue.closed {
+		db.queueMu.Unlock()
+		return ErrClosed
+	}
+	db.queue.pending = append(db.queue.pending, req)
+	if len(db.queue.pending) == 1 {
+		db.queue.ready <- struct{}{}
+	}
+	db.queueMu.Unlock()
+
+	return <-req.done
+}
+
+// commitLoop writes queued Sets in groups until the database closes. Sets
+// still queued at that point are written before it exits.
+func (db *SimpleDB) commitLoop() {
+	defer db.background.Done()
+
+	for {
+		select {
+		case <-db.stop:
+			db.queueMu.Lock()
+			batch := db.queue.pending
+			db.queue.pending = nil
+			db.queue.closed = true
+			db.queueMu.Unlock()
+			if len(batch) > 0 {
+				db.commitGroup(batch)
+			}
+			return
+		case <-db.queue.ready:
+			db.queueMu.Lock()
+			batch := db.queue.pending
+			db.queue.pending = nil
+			db.queueMu.Unlock()
+			db.commitGroup(batch)
+		}
+	}
+}
+
+// commitGroup writes a group of queued Sets with one write and at most one
+// fsync, then tells each writer how it went. A record that can't be
+// prepared fails on its own; a failed write fails the whole group.
+func (db *SimpleDB) commitGroup(batch []commitRequest) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	entries := make([]Record, 0, len(batch))
+	values := make([][]byte, 0, len(batch))
+	waiting := make([]chan error, 0, len(batch))
+	// Keys written earlier in this group, so repeats get increasing versions
+	written := make(map[string]Record)
+	for _, req := range batch {
+		if err := db.promote(req.entry.Key); err != nil {
+			req.done <- err
+			continue
+		}
+		var prev *Record
+		if entry, ok := written[req.entry.Key]; ok {
+			prev = &entry
+		}
+		entry := db.stamp(req.entry, prev)
+		value := entry.Value
+		prepared, err := db.prepareValue(entry)
+		if err != nil {
+			req.done <- err
+			continue
+		}
+		written[entry.Key] = entry
+
+		entries = append(entries, prepared)
+		values = append(values, value)
+		waiting = append(waiting, req.done)
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	locs, writeErr := db.appendEntries(entries, db.opts.SyncWrites)
+	for i, entry := range entries {
+		err := writeErr
+		if err == nil {
+			err = db.setIndex(entry.Key, locs[i], entry.ExpiresAt)
+		}
+		if err == nil {
+			db.publish(Event{Type: EventSet, Key: entry.Key, Value: string(values[i])})
+		}
+		waiting[i] <- err
+	}
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGroupCommit(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		ttl  time.Duration
+	}{
+		{name: "buffered", opts: Options{GroupCommit: true}},
+		{name: "synced", opts: Options{GroupCommit: true, SyncWrites: true}},
+		{name: "with ttl", opts: Options{GroupCommit: true, SyncWrites: true}, ttl: time.Hour},
+		{name: "segments", opts: Options{GroupCommit: true, SegmentSize: 256}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, tt.opts)
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					key, value := fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d", i)
+					var err error
+					if tt.ttl > 0 {
+						err = db.SetWithTTL(key, value, tt.ttl)
+					} else {
+						err = db.Set(key, value)
+					}
+					if err != nil {
+						t.Error(err)
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			// Every Set is indexed by the time it returns, and on disk
+			check := func(db *SimpleDB) {
+				t.Helper()
+				for i := 0; i < 50; i++ {
+					wantValue(t, db, fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d", i))
+				}
+			}
+			check(db)
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			check(reopenTestDB(t, path, tt.opts))
+		})
+	}
+}
+
+func TestGroupCommitFailsAlone(t *testing.T) {
+	db, _ := openTestDB(t, Options{GroupCommit: true, MaxValueSize: 8})
+
+	errs := make(chan error, 2)
+	go func() { errs <- db.Set("big", "far too long a value") }()
+	go func() { errs <- db.Set("small", "fits") }()
+	var tooLarge int
+	for i := 0; i < 2; i++ {
+		if err := <-errs; errors.Is(err, ErrValueTooLarge) {
+			tooLarge++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tooLarge != 1 {
+		t.Fatalf("%d writes failed as too large, want 1", tooLarge)
+	}
+	wantValue(t, db, "small", "fits")
+	wantMissing(t, db, "big")
+}
+
+func TestGroupCommitAfterClose(t *testing.T) {
+	db, _ := openTestDB(t, Options{GroupCommit: true})
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set("a", "one"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Set() after Close = %v, want %v", err, ErrClosed)
+	}
+}
+
+// BenchmarkConcurrentSet has 100 writers per CPU setting keys with every write
+// synced, with and without group commit
+func BenchmarkConcurrentSet(b *testing.B) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "per call", opts: Options{SyncWrites: true}},
+		{name: "group commit", opts: Options{SyncWrites: true, GroupCommit: true}},
+	}
+
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			db, err := OpenDBWithOptions(filepath.Join(b.TempDir(), "bench.db"), tt.opts)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer db.Close()
+
+			b.SetParallelism(100)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if err := db.Set(fmt.Sprintf("key-%d", i%1000), "value"); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// compactSuffix is appended to the database path for the temporary compaction file
+const compactSuffix = ".compact"
+
+// EstimateCompaction reports how the files would split up if Compact ran
+// now: liveBytes is what the rewritten log would take and deadBytes what it
+// would reclaim. Nothing is read or rewritten; the index knows the size of
+// every live record.
+func (db *SimpleDB) EstimateCompaction() (liveBytes, deadBytes int64, err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return 0, 0, ErrClosed
+	}
+
+	all, err := db.indexed()
+	if err != nil {
+		return 0, 0, err
+	}
+	for key, loc := range all {
+		if !db.expired(key) {
+			liveBytes += loc.Size
+		}
+	}
+	return liveBytes, db.size - liveBytes, nil
+}
+
+// Compact rewrites the log so it only holds the latest live entry for each
+// key, dropping overwritten values and tombstones. All segments are merged
+// into a single new one.
+//
+// The bulk of the copy runs against a snapshot of the index without holding
+// the write lock, so reads and writes keep going. Entries appended while the
+// copy was in progress are replayed under the write lock just before the new
+// file is renamed into place. If the process dies before the rename, the
+// live files are left untouched and the leftover file is removed on open.
+// With several segments the new one is numbered after all of them and the
+// old ones are removed oldest first after the rename. Should that be cut
+// short, what survives is a run of the newest old segments: the new segment
+// is still read last on open and wins, and a record left in a surviving
+// segment is still shadowed by any tombstone in the ones after it.
+func (db *SimpleDB) Compact() (err error) {
+	if db.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	defer db.observe(OpCompact, db.start(OpCompact), &err)
+	span := db.startSpan(context.Background(), OpCompact, "")
+	defer func() { span.End(0, err) }()
+
+	db.compactMu.Lock()
+	defer db.compactMu.Unlock()
+
+	db.mu.RLock()
+	if db.closed {
+		db.mu.RUnlock()
+		return ErrClosed
+	}
+	all, err := db.indexed()
+	if err != nil {
+		db.mu.RUnlock()
+		return err
+	}
+	snapshot := make(map[string]location, len(all))
+	expires := make(map[string]int64, len(db.expires))
+	for key, loc := range all {
+		if !db.expired(key) {
+			snapshot[key] = loc
+		}
+	}
+	for key, expiresAt := range db.expires {
+		expires[key] = expiresAt
+	}
+	end := location{Segment: db.segment, Offset: db.segmentSize}
+	before := db.size
+	src, err := db.openSegments()
+	db.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer closeSegments(src)
+
+	started := time.Now()
+	db.opts.Logger.Info("compaction started", "path", db.path, "keys", len(snapshot), "bytes", before)
+
+	tmpPath := db.path + compactSuffix
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, db.opts.FileMode)
+	if err != nil {
+		return err
+	}
+	// Clean up the temporary file on any failure before the swap
+	swapped := false
+	defer func() {
+		if !swapped {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	w := bufio.NewWriter(tmp)
+	index := make(map[string]location, len(snapshot))
+	written := int64(0)
+
+	writeEntry := func(entry Record) error {
+		// The new file is swapped in whole, so batches needn't hold together
+		entry.Batch = 0
+		data, err := encodeRecord(db.opts.Codec, entry)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		if !entry.Touched {
+			index[entry.Key] = location{Offset: written, Size: int64(len(data)), Version: entry.Version, Created: entry.CreatedAt}
+		}
+		written += int64(len(data))
+		return nil
+	}
+
+	for key, loc := range snapshot {
+		entry, err := readEntryAt(db.opts.Codec, src[loc.Segment], loc)
+		if err != nil {
+			return err
+		}
+		if entry.Key != key {
+			return errors.New("index points to wrong entry for key " + key)
+		}
+		// Fold in any expiry set by Touch since the value was written
+		entry.ExpiresAt = expires[key]
+		if err := writeEntry(entry); err != nil {
+			return err
+		}
+		if err := db.throttle(started, written); err != nil {
+			return err
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// The files may have gone away while the copy ran
+	if db.closed {
+		return ErrClosed
+	}
+
+	if err := db.flushWrites(); err != nil {
+		return err
+	}
+
+	// Replay anything appended since the snapshot was taken, including into
+	// segments started since. Tombstones are kept so they still shadow the
+	// copies made above if the index is ever rebuilt from the new file.
+	ids := db.segmentIDs()
+	for _, id := range ids {
+		if id < end.Segment {
+			continue
+		}
+		from := int64(0)
+		if id == end.Segment {
+			from = end.Offset
+		}
+		info, err := db.segments[id].Stat()
+		if err != nil {
+			return err
+		}
+		_, err = scanEntries(db.opts.Codec, db.segments[id], from, info.Size(), nil, func(entry Record, _, _ int64) error {
+			if strings.HasPrefix(entry.Key, reservedPrefix) {
+				return nil
+			}
+			if err := writeEntry(entry); err != nil {
+				return err
+			}
+			if entry.Deleted || (entry.ExpiresAt != 0 && entry.ExpiresAt <= time.Now().UnixNano()) {
+				delete(index, entry.Key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// A lone segment is replaced atomically; otherwise the new one goes
+	// after all the others so it wins if the old ones aren't all removed
+	target := ids[0]
+	if len(ids) > 1 {
+		target = ids[len(ids)-1] + 1
+	}
+
+	// Spilled keys stay spilled, in a table pointing into the new segment
+	var spill *spillIndex
+	if db.spill != nil {
+		if spill, err = newSpillIndex(db.spill.dir, db.spill.rate); err != nil {
+			return err
+		}
+		defer func() {
+			if spill != db.spill {
+				spill.close()
+			}
+		}()
+		for key, loc := range index {
+			if _, hot := db.data[key]; hot {
+				continue
+			}
+			loc.Segment = target
+			if err := spill.put(key, loc); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The persisted index describes the old files and must not outlive them
+	if err := db.removeSnapshot(); err != nil {
+		return err
+	}
+	targetPath := segmentPath(db.path, target)
+	if err := os.Rename(tmpPath, targetPath); err != nil {
+		return err
+	}
+	swapped = true
+	if err := syncDir(filepath.Dir(db.path)); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(targetPath, os.O_RDWR|os.O_APPEND, db.opts.FileMode)
+	if err != nil {
+		return err
+	}
+	segments, leftover, removeErr := db.removeSegments(ids, target)
+	segments[target] = file
+
+	db.segments = segments
+	db.segment = target
+	db.file = file
+	db.resetWriter(file)
+	db.mapSegments()
+	db.rewritten()
+	hot := db.data
+	db.data = make(map[string]location, len(hot))
+	// Keys rewritten from the tail left their snapshot copy behind, and
+	// segments that couldn't be removed are dead through and through
+	db.dead = written + leftover
+	for key, loc := range index {
+		loc.Segment = target
+		db.dead -= loc.Size
+		if _, ok := hot[key]; ok || spill == nil {
+			db.data[key] = loc
+		}
+	}
+	db.spill.close()
+	db.spill = spill
+	db.countIndex()
+	db.size = written + leftover
+	db.segmentSize = written
+	db.corrupt = 0
+	// Expired keys were dropped from the new file without tombstones, so
+	// nothing told the secondary indexes either
+	for key := range db.expires {
+		if _, exists := index[key]; !exists {
+			delete(db.expires, key)
+			db.unindex(key)
+		}
+	}
+
+	if removeErr != nil {
+		db.opts.Logger.Error("removing compacted segments failed", "path", db.path, "err", removeErr)
+		return removeErr
+	}
+	db.opts.Logger.Info("compaction finished", "path", db.path, "keys", len(index),
+		"bytes_before", before, "bytes_after", written, "took", time.Since(started))
+	return nil
+}
+
+// removeSegments closes the segments in ids, which a compaction has just
+// replaced with segment target, and removes their files oldest first. The
+// first failure stops it, leaving that segment and all newer ones in place
+// so none of their tombstones go missing; those stay open and are returned
+// with their combined size and the error, for the next compaction to pick
+// up. The directory is synced once the files are gone. Callers must hold
+// the write lock.
+func (db *SimpleDB) removeSegments(ids []int, target int) (map[int]*os.File, int64, error) {
+	kept := make(map[int]*os.File)
+	var leftover int64
+	var removeErr error
+	for _, id := range ids {
+		old := db.segments[id]
+		if id == target {
+			// A lone segment, already replaced by the rename
+			old.Close()
+			continue
+		}
+
+		if removeErr == nil {
+			old.Close()
+			path := segmentPath(db.path, id)
+			err := removeFile(path)
+			if err == nil || errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			removeErr = err
+			if old, err = os.OpenFile(path, os.O_RDWR, db.opts.FileMode); err != nil {
+				// Still on disk, so the next open finds it
+				continue
+			}
+		}
+
+		info, err := old.Stat()
+		if err != nil {
+			old.Close()
+			continue
+		}
+		kept[id] = old
+		leftover += info.Size()
+	}
+
+	if err := syncDir(filepath.Dir(db.path)); err != nil && removeErr == nil {
+		removeErr = err
+	}
+	return kept, leftover, removeErr
+}
+
+// removeFile removes a segment file; a variable so tests can make it fail
+var removeFile = os.Remove
+
+// throttle sleeps for as long as a compaction that began at started and has
+// copied written bytes is ahead of CompactRate. It gives up with ErrClosed
+// once the database starts closing.
+func (db *SimpleDB) throttle(started time.Time, written int64) error {
+	if db.opts.CompactRate == 0 {
+		return nil
+	}
+	due := started.Add(time.Duration(float64(written) / float64(db.opts.CompactRate) * float64(time.Second)))
+	wait := time.Until(due)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-db.stop:
+		return ErrClosed
+	}
+}
+
+// syncDir fsyncs a directory so a rename or removal inside it is durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
@@ -0,0 +1,516 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeSegmented fills a database with small segments: k is written first
+// and deleted in a later segment, and keep-* keys survive
+func writeSegmented(t *testing.T, db *SimpleDB) {
+	t.Helper()
+	mustSet(t, db, "k", "deleted value")
+	for i := 0; i < 10; i++ {
+		mustSet(t, db, fmt.Sprintf("keep-%d", i), fmt.Sprintf("old-%d", i))
+	}
+	if err := db.Delete("k"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		mustSet(t, db, fmt.Sprintf("keep-%d", i), fmt.Sprintf("new-%d", i))
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if ids := db.segmentIDs(); db.opts.SegmentSize != 0 && len(ids) < 3 {
+		t.Fatalf("wrote %d segments, want at least 3", len(ids))
+	}
+}
+
+// checkSegmented checks the state writeSegmented leaves
+func checkSegmented(t *testing.T, db *SimpleDB) {
+	t.Helper()
+	wantMissing(t, db, "k")
+	for i := 0; i < 10; i++ {
+		wantValue(t, db, fmt.Sprintf("keep-%d", i), fmt.Sprintf("new-%d", i))
+	}
+}
+
+func TestCompactInterruptedRemoval(t *testing.T) {
+	opts := Options{SegmentSize: 512}
+	db, path := openTestDB(t, opts)
+	writeSegmented(t, db)
+
+	old := db.segmentIDs()
+	saved := t.TempDir()
+	for _, id := range old {
+		copyFile(t, segmentPath(path, id), filepath.Join(saved, fmt.Sprint(id)))
+	}
+	var removed []string
+	removeFile = func(name string) error {
+		removed = append(removed, name)
+		return os.Remove(name)
+	}
+	defer func() { removeFile = os.Remove }()
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	target := db.segment
+
+	// Removal goes oldest first, so the crashes below are the only ones
+	if len(removed) != len(old) {
+		t.Fatalf("removed %v, want all of %v", removed, old)
+	}
+	for i, id := range old {
+		if removed[i] != segmentPath(path, id) {
+			t.Fatalf("removed %v, want segments %v in order", removed, old)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash while removing the old segments leaves the newest of them
+	// behind, however many of the oldest were already gone
+	for gone := 0; gone <= len(old); gone++ {
+		t.Run(fmt.Sprintf("removed=%d", gone), func(t *testing.T) {
+			dir := t.TempDir()
+			crashed := filepath.Join(dir, "test.db")
+			copyFile(t, segmentPath(path, target), segmentPath(crashed, target))
+			for _, id := range old[gone:] {
+				copyFile(t, filepath.Join(saved, fmt.Sprint(id)), segmentPath(crashed, id))
+			}
+
+			db := reopenTestDB(t, crashed, opts)
+			checkSegmented(t, db)
+		})
+	}
+}
+
+func TestCompactRemoveFailure(t *testing.T) {
+	opts := Options{SegmentSize: 512}
+	db, path := openTestDB(t, opts)
+	writeSegmented(t, db)
+	old := db.segmentIDs()
+
+	failing := segmentPath(path, old[1])
+	errRemove := errors.New("remove failed")
+	removeFile = func(name string) error {
+		if name == failing {
+			return errRemove
+		}
+		return os.Remove(name)
+	}
+	defer func() { removeFile = os.Remove }()
+
+	if err := db.Compact(); !errors.Is(err, errRemove) {
+		t.Fatalf("Compact() = %v, want %v", err, errRemove)
+	}
+	checkSegmented(t, db)
+
+	// Only the oldest segment went; the rest stay so their tombstones do
+	if _, err := os.Stat(segmentPath(path, old[0])); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("oldest segment still there: %v", err)
+	}
+	for _, id := range old[1:] {
+		if _, err := os.Stat(segmentPath(path, id)); err != nil {
+			t.Errorf("segment %d: %v", id, err)
+		}
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db = reopenTestDB(t, path, opts)
+	checkSegmented(t, db)
+
+	// The next compaction clears up the leftovers
+	removeFile = os.Remove
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if ids := db.segmentIDs(); len(ids) != 1 {
+		t.Fatalf("segments after compaction = %v, want one", ids)
+	}
+	checkSegmented(t, db)
+}
+
+func TestCompact(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"single segment", Options{}},
+		{"segments", Options{SegmentSize: 512}},
+		{"binary codec", Options{Codec: BinaryCodec{}, SegmentSize: 256}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, tt.opts)
+			writeSegmented(t, db)
+			before := fileSize(t, db)
+
+			if err := db.Compact(); err != nil {
+				t.Fatal(err)
+			}
+			checkSegmented(t, db)
+			if after := fileSize(t, db); after >= before {
+				t.Errorf("size after compaction = %d, want less than %d", after, before)
+			}
+
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			checkSegmented(t, reopenTestDB(t, path, tt.opts))
+		})
+	}
+}
+
+// fileSize returns the size of the log as Stats reports it
+func fileSize(t *testing.T, db *SimpleDB) int64 {
+	t.Helper()
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stats.FileSize
+}
+
+func TestAutoCompact(t *testing.T) {
+	tests := []struct {
+		name    string
+		ratio   float64
+		minSize int64
+		want    bool // Whether overwriting should trigger a compaction
+	}{
+		{"disabled", 0, 0, false},
+		{"over ratio", 0.5, 0, true},
+		{"under minimum size", 0.5, 1 << 30, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{CompactRatio: tt.ratio, CompactMinSize: tt.minSize})
+			for i := 0; i < 50; i++ {
+				mustSet(t, db, "k", fmt.Sprint(i))
+			}
+
+			// The compaction runs in the background; Close waits for it
+			generation := db.generation
+			deadline := time.Now().Add(5 * time.Second)
+			for tt.want && time.Now().Before(deadline) {
+				db.mu.RLock()
+				done := db.generation != generation && !db.compacting
+				db.mu.RUnlock()
+				if done {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			db.mu.RLock()
+			compacted := db.generation != generation
+			db.mu.RUnlock()
+			if compacted != tt.want {
+				t.Fatalf("compacted = %v, want %v", compacted, tt.want)
+			}
+			wantValue(t, db, "k", "49")
+		})
+	}
+}
+
+func TestCloseDuringAutoCompact(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		db, err := OpenDBWithOptions(filepath.Join(t.TempDir(), "test.db"), Options{CompactRatio: 0.1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Writers keep triggering compactions while Close runs
+		var wg sync.WaitGroup
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := 0; ; n++ {
+					if err := db.Set("k", fmt.Sprint(n)); errors.Is(err, ErrClosed) {
+						return
+					}
+				}
+			}()
+		}
+		time.Sleep(time.Millisecond)
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		wg.Wait()
+
+		db.mu.RLock()
+		compacting := db.compacting
+		db.mu.RUnlock()
+		if compacting {
+			t.Fatal("a compaction started after Close returned")
+		}
+	}
+}
+
+func TestCompactDuringWrites(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"single segment", Options{}},
+		{"segments", Options{SegmentSize: 1024}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, tt.opts)
+			for i := 0; i < 100; i++ {
+				mustSet(t, db, fmt.Sprintf("key-%d", i), "old")
+			}
+
+			// Overwrites and deletes racing the copy are replayed onto it
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					key := fmt.Sprintf("key-%d", i)
+					var err error
+					if i%3 == 0 {
+						err = db.Delete(key)
+					} else {
+						err = db.Set(key, "new")
+					}
+					if err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+			for i := 0; i < 3; i++ {
+				if err := db.Compact(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			wg.Wait()
+
+			check := func(db *SimpleDB) {
+				t.Helper()
+				for i := 0; i < 100; i++ {
+					key := fmt.Sprintf("key-%d", i)
+					if i%3 == 0 {
+						wantMissing(t, db, key)
+					} else {
+						wantValue(t, db, key, "new")
+					}
+				}
+			}
+			check(db)
+			if err := db.Compact(); err != nil {
+				t.Fatal(err)
+			}
+			check(db)
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			check(reopenTestDB(t, path, tt.opts))
+		})
+	}
+}
+
+func TestEstimateCompaction(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		write    func(t *testing.T, db *SimpleDB)
+		wantDead bool
+	}{
+		{
+			name:  "no overwrites",
+			write: func(*testing.T, *SimpleDB) {},
+		},
+		{
+			name: "overwrites",
+			write: func(t *testing.T, db *SimpleDB) {
+				for i := 0; i < 20; i++ {
+					mustSet(t, db, "key-0", fmt.Sprintf("overwritten-%d", i))
+				}
+			},
+			wantDead: true,
+		},
+		{
+			name: "deletes",
+			write: func(t *testing.T, db *SimpleDB) {
+				for i := 0; i < 5; i++ {
+					if err := db.Delete(fmt.Sprintf("key-%d", i)); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+			wantDead: true,
+		},
+		{
+			name: "expired",
+			write: func(t *testing.T, db *SimpleDB) {
+				if err := db.SetWithTTL("short", "lived", time.Millisecond); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(5 * time.Millisecond)
+			},
+			wantDead: true,
+		},
+		{
+			name: "segments",
+			opts: Options{SegmentSize: 128},
+			write: func(t *testing.T, db *SimpleDB) {
+				for i := 0; i < 10; i++ {
+					mustSet(t, db, fmt.Sprintf("key-%d", i), "overwritten")
+				}
+			},
+			wantDead: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, tt.opts)
+			for i := 0; i < 10; i++ {
+				mustSet(t, db, fmt.Sprintf("key-%d", i), "value")
+			}
+			tt.write(t, db)
+
+			live, dead, err := db.EstimateCompaction()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := dead > 0; got != tt.wantDead {
+				t.Fatalf("EstimateCompaction() dead = %d, want reclaimable bytes: %v", dead, tt.wantDead)
+			}
+			if size := fileSize(t, db); live+dead != size {
+				t.Fatalf("live %d + dead %d != file size %d", live, dead, size)
+			}
+
+			// The estimate is exactly what compaction leaves behind
+			if err := db.Compact(); err != nil {
+				t.Fatal(err)
+			}
+			if size := fileSize(t, db); size != live {
+				t.Fatalf("file size after Compact = %d, estimated %d", size, live)
+			}
+			if _, dead, err := db.EstimateCompaction(); err != nil || dead != 0 {
+				t.Fatalf("EstimateCompaction() after Compact dead = %d, %v", dead, err)
+			}
+		})
+	}
+}
+
+func TestCompactRate(t *testing.T) {
+	tests := []struct {
+		name string
+		rate int64 // Bytes per second
+	}{
+		{name: "unlimited"},
+		{name: "slow", rate: 40 << 10},
+		{name: "slower", rate: 20 << 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{CompactRate: tt.rate})
+			value := strings.Repeat("v", 200)
+			for i := 0; i < 50; i++ {
+				mustSet(t, db, fmt.Sprintf("key%d", i), value)
+				mustSet(t, db, fmt.Sprintf("key%d", i), value)
+			}
+			live, _, err := db.EstimateCompaction()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			started := time.Now()
+			if err := db.Compact(); err != nil {
+				t.Fatal(err)
+			}
+			took := time.Since(started)
+
+			// The copy can't finish before the rate allows, and shouldn't
+			// take much longer
+			if tt.rate == 0 {
+				if took > time.Second {
+					t.Fatalf("unthrottled compaction of %d bytes took %v", live, took)
+				}
+				return
+			}
+			want := time.Duration(float64(live) / float64(tt.rate) * float64(time.Second))
+			if took < want || took > 2*want+200*time.Millisecond {
+				t.Fatalf("compacting %d bytes at %d bytes/s took %v, want about %v", live, tt.rate, took, want)
+			}
+		})
+	}
+}
+
+func TestCompactRateAllowsTraffic(t *testing.T) {
+	db, _ := openTestDB(t, Options{CompactRate: 20 << 10})
+	value := strings.Repeat("v", 200)
+	for i := 0; i < 50; i++ {
+		mustSet(t, db, fmt.Sprintf("key%d", i), value)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- db.Compact() }()
+	time.Sleep(50 * time.Millisecond)
+
+	// Reads and writes aren't held up by the slow copy
+	started := time.Now()
+	for i := 0; i < 50; i++ {
+		wantValue(t, db, fmt.Sprintf("key%d", i), value)
+		mustSet(t, db, fmt.Sprintf("new%d", i), "during")
+	}
+	if took := time.Since(started); took > 200*time.Millisecond {
+		t.Fatalf("traffic during compaction took %v", took)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("compaction finished early: %v", err)
+	default:
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		wantValue(t, db, fmt.Sprintf("new%d", i), "during")
+	}
+}
+
+func TestCloseDuringThrottledCompact(t *testing.T) {
+	db, err := OpenDBWithOptions(filepath.Join(t.TempDir(), "test.db"), Options{CompactRate: 1 << 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		mustSet(t, db, fmt.Sprintf("key%d", i), strings.Repeat("v", 200))
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- db.Compact() }()
+	time.Sleep(50 * time.Millisecond)
+
+	// At 1KB/s the copy would take ten seconds; Close cuts it short
+	started := time.Now()
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; !errors.Is(err, ErrClosed) {
+		t.Fatalf("Compact() = %v, want ErrClosed", err)
+	}
+	if took := time.Since(started); took > time.Second {
+		t.Fatalf("Close waited %v for the compaction", took)
+	}
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression selects how large values are compressed on disk
+type Compression byte
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZstd
+)
+
+// defaultCompressMinSize is used when Options.CompressMinSize is zero
+const defaultCompressMinSize = 1024
+
+// zstd encoders and decoders are expensive to build but safe to share for
+// EncodeAll/DecodeAll, so each is created once on first use
+var (
+	zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+		enc, _ := zstd.NewWriter(nil)
+		return enc
+	})
+	zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+		dec, _ := zstd.NewReader(nil)
+		return dec
+	})
+)
+
+// compressEntry compresses entry.Value with the configured algorithm if it
+// is at least the minimum size and compressing actually makes it smaller
+func (db *SimpleDB) compressEntry(entry Record) (Record, error) {
+	minSize := db.opts.CompressMinSize
+	if minSize == 0 {
+		minSize = defaultCompressMinSize
+	}
+	if db.opts.Compression == CompressionNone || len(entry.Value) < minSize {
+		return entry, nil
+	}
+
+	var compressed []byte
+	switch db.opts.Compression {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(entry.Value); err != nil {
+			return Record{}, err
+		}
+		if err := zw.Close(); err != nil {
+			return Record{}, err
+		}
+		compressed = buf.Bytes()
+	case CompressionZstd:
+		compressed = zstdEncoder().EncodeAll(entry.Value, nil)
+	default:
+		return Record{}, fmt.Errorf("unknown compression %d", db.opts.Compression)
+	}
+
+	if len(compressed) < len(entry.Value) {
+		entry.Value = compressed
+		entry.Compression = db.opts.Compression
+	}
+	return entry, nil
+}
+
+// decompressValue returns the uncompressed value of entry according to the
+// algorithm recorded alongside it
+func decompressValue(entry Record) ([]byte, error) {
+	switch entry.Compression {
+	case CompressionNone:
+		return entry.Value, nil
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(entry.Value))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(zr)
+	case CompressionZstd:
+		return zstdDecoder().DecodeAll(entry.Value, nil)
+	default:
+		return nil, errors.New("record uses an unknown compression")
+	}
+}
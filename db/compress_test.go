@@ -0,0 +1,56 @@
+package db
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	random := make([]byte, 4096)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		opts           Options
+		value          string
+		wantCompressed Compression
+	}{
+		{name: "off", value: strings.Repeat("a", 4096), wantCompressed: CompressionNone},
+		{name: "gzip", opts: Options{Compression: CompressionGzip}, value: strings.Repeat("a", 4096), wantCompressed: CompressionGzip},
+		{name: "zstd", opts: Options{Compression: CompressionZstd}, value: strings.Repeat("a", 4096), wantCompressed: CompressionZstd},
+		{name: "below the default threshold", opts: Options{Compression: CompressionZstd}, value: strings.Repeat("a", 1023), wantCompressed: CompressionNone},
+		{name: "at the default threshold", opts: Options{Compression: CompressionZstd}, value: strings.Repeat("a", 1024), wantCompressed: CompressionZstd},
+		{name: "custom threshold", opts: Options{Compression: CompressionGzip, CompressMinSize: 100}, value: strings.Repeat("a", 100), wantCompressed: CompressionGzip},
+		{name: "incompressible", opts: Options{Compression: CompressionZstd}, value: string(random), wantCompressed: CompressionNone},
+		{name: "empty", opts: Options{Compression: CompressionGzip, CompressMinSize: 1}, wantCompressed: CompressionNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, tt.opts)
+			mustSet(t, db, "a", tt.value)
+			wantValue(t, db, "a", tt.value)
+
+			entry, err := readEntryAt(db.opts.Codec, db.segments[db.data["a"].Segment], db.data["a"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Compression != tt.wantCompressed {
+				t.Fatalf("stored with compression %d, want %d", entry.Compression, tt.wantCompressed)
+			}
+			if tt.wantCompressed != CompressionNone && len(entry.Value) >= len(tt.value) {
+				t.Fatalf("stored %d bytes for a %d byte value", len(entry.Value), len(tt.value))
+			}
+
+			// Reads decompress whatever the database is reopened with
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			db = reopenTestDB(t, path, Options{})
+			wantValue(t, db, "a", tt.value)
+		})
+	}
+}
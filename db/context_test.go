@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestContextCancelled(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func(ctx context.Context, db *SimpleDB) error
+	}{
+		{
+			name: "get",
+			op: func(ctx context.Context, db *SimpleDB) error {
+				_, err := db.GetContext(ctx, "a")
+				return err
+			},
+		},
+		{
+			name: "get with meta",
+			op: func(ctx context.Context, db *SimpleDB) error {
+				_, _, err := db.GetWithMetaContext(ctx, "a")
+				return err
+			},
+		},
+		{
+			name: "set",
+			op:   func(ctx context.Context, db *SimpleDB) error { return db.SetContext(ctx, "a", "two") },
+		},
+		{
+			name: "delete",
+			op:   func(ctx context.Context, db *SimpleDB) error { return db.DeleteContext(ctx, "a") },
+		},
+		{
+			name: "scan prefix",
+			op: func(ctx context.Context, db *SimpleDB) error {
+				_, err := db.ScanPrefixContext(ctx, "")
+				return err
+			},
+		},
+		{
+			name: "scan range",
+			op: func(ctx context.Context, db *SimpleDB) error {
+				_, err := db.ScanRangeContext(ctx, "", "")
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			mustSet(t, db, "a", "one")
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			if err := tt.op(ctx, db); !errors.Is(err, context.Canceled) {
+				t.Fatalf("error = %v, want %v", err, context.Canceled)
+			}
+			// Nothing was written
+			wantValue(t, db, "a", "one")
+
+			// The same call goes through with a live context
+			if err := tt.op(context.Background(), db); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+// ErrDecrypt is returned when an encrypted value can't be decrypted, which
+// means the database was opened with the wrong key or with no key at all
+var ErrDecrypt = errors.New("cannot decrypt value: wrong or missing encryption key")
+
+// newAEAD builds the AES-GCM cipher for an encryption key, or returns nil
+// when encryption is disabled
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if key == nil {
+		return nil, nil
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// prepareValue compresses and then encrypts entry.Value as configured.
+// Compression has to come first; encrypted data doesn't compress.
+func (db *SimpleDB) prepareValue(entry Record) (Record, error) {
+	entry, err := db.compressEntry(entry)
+	if err != nil {
+		return Record{}, err
+	}
+	if db.aead == nil {
+		return entry, nil
+	}
+
+	nonce := make([]byte, db.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return Record{}, err
+	}
+	// The key is authenticated too, so a value can't be moved to another key
+	entry.Value = db.aead.Seal(nil, nonce, entry.Value, []byte(entry.Key))
+	entry.Nonce = nonce
+	return entry, nil
+}
+
+// openValue returns the plain value of entry, reversing prepareValue
+func openValue(aead cipher.AEAD, entry Record) ([]byte, error) {
+	if entry.Nonce != nil {
+		if aead == nil || len(entry.Nonce) != aead.NonceSize() {
+			return nil, ErrDecrypt
+		}
+		plain, err := aead.Open(nil, entry.Nonce, entry.Value, []byte(entry.Key))
+		if err != nil {
+			return nil, ErrDecrypt
+		}
+		entry.Value = plain
+	}
+	return decompressValue(entry)
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	other := bytes.Repeat([]byte{2}, 32)
+
+	tests := []struct {
+		name    string
+		write   Options
+		read    Options
+		value   string
+		wantErr error
+	}{
+		{name: "same key", write: Options{EncryptionKey: key}, read: Options{EncryptionKey: key}, value: "secret"},
+		{name: "compressed", write: Options{EncryptionKey: key, Compression: CompressionZstd}, read: Options{EncryptionKey: key}, value: strings.Repeat("secret", 500)},
+		{name: "wrong key", write: Options{EncryptionKey: key}, read: Options{EncryptionKey: other}, value: "secret", wantErr: ErrDecrypt},
+		{name: "no key", write: Options{EncryptionKey: key}, read: Options{}, value: "secret", wantErr: ErrDecrypt},
+		{name: "plain values read with a key", write: Options{}, read: Options{EncryptionKey: key}, value: "secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, tt.write)
+			mustSet(t, db, "a", tt.value)
+			loc := db.data["a"]
+			entry, err := readEntryAt(db.opts.Codec, db.segments[loc.Segment], loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encrypted := tt.write.EncryptionKey != nil
+			if clear := bytes.Contains(entry.Value, []byte("secret")); clear == encrypted {
+				t.Fatalf("value stored in the clear: %v, want %v", clear, !encrypted)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			db = reopenTestDB(t, path, tt.read)
+			got, err := db.Get("a")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.value {
+				t.Fatalf("Get() = %q, want %q", got, tt.value)
+			}
+		})
+	}
+}
+
+func TestEncryptionBindsKey(t *testing.T) {
+	db, _ := openTestDB(t, Options{EncryptionKey: bytes.Repeat([]byte{1}, 32)})
+	mustSet(t, db, "a", "secret")
+	loc := db.data["a"]
+	entry, err := readEntryAt(db.opts.Codec, db.segments[loc.Segment], loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same ciphertext under another key must not decrypt
+	entry.Key = "b"
+	if _, err := openValue(db.aead, entry); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("openValue() with a moved key = %v, want %v", err, ErrDecrypt)
+	}
+}
@@ -2,131 +2,1058 @@ package db
 
 import (
 	"bufio"
-	"encoding/json"
+	"context"
+	"crypto/cipher"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ErrKeyNotFound is returned when a key doesn't exist or has expired
+var ErrKeyNotFound = errors.New("key not found")
+
+// ErrClosed is returned by any operation on a database after Close
+var ErrClosed = errors.New("database is closed")
+
+// ErrInvalidKey is returned when writing a key that can't be stored, such
+// as an empty one. ErrReservedKey wraps it.
+var ErrInvalidKey = errors.New("invalid key")
+
+// ErrReservedKey is returned when writing a key in the namespace the
+// database keeps for its own records, or under one of
+// Options.ReservedPrefixes
+var ErrReservedKey = fmt.Errorf("%w: key is reserved", ErrInvalidKey)
+
+// reservedPrefix starts the keys of internal records such as Ping's. They
+// are never indexed, and user keys with this prefix are rejected.
+const reservedPrefix = "\x00owndb/"
+
+// ErrReadOnly is returned by writes to a database opened with Options.ReadOnly
+var ErrReadOnly = errors.New("database is read-only")
+
+// ErrKeyTooLarge and ErrValueTooLarge are returned by writes whose key or
+// value exceeds Options.MaxKeySize or Options.MaxValueSize
+var (
+	ErrKeyTooLarge   = errors.New("key exceeds maximum size")
+	ErrValueTooLarge = errors.New("value exceeds maximum size")
+)
+
+// SimpleDB is an append-only key-value store. It is safe for concurrent use:
+// writes are serialized, while reads share a read lock and use positional
+// reads (ReadAt) on the segment files, which never touch the shared file
+// offset, so any number of them run in parallel without needing a
+// descriptor each.
+//
+// Every live key is held in a single in-memory index covering all
+// segments, so a lookup of a missing key is answered from memory without
+// touching any file, however many segments there are.
+//
+// The flip side is that the index has to fit in memory: about
+// indexEntryOverhead bytes per key plus the key itself, which Stats reports
+// as IndexBytes. Options.IndexBudget caps it by moving the least recently
+// used keys to an on-disk hash table, at the cost of disk reads for lookups
+// that miss in memory. A bloom filter over the keys moved there keeps most
+// lookups of missing keys off the disk even so, with the false-positive
+// rate set by Options.FilterFalsePositiveRate.
 type SimpleDB struct {
-	mu   sync.RWMutex     // Mutex for safe concurrent access
-	data map[string]int64 // In-memory index
-	file *os.File         // File for persistent storage
-	path string           // File path for the database
+	mu             sync.RWMutex               // Mutex for safe concurrent access
+	compactMu      sync.Mutex                 // Serializes compaction runs
+	data           map[string]location        // In-memory index
+	spill          *spillIndex                // Keys pushed out of data by IndexBudget; nil without one
+	indexSize      int64                      // Estimated memory held by data; see keyCost
+	expires        map[string]int64           // Expiry times for keys set with a TTL
+	cache          *valueCache                // Recently read values; nil when disabled
+	lru            *keyOrder                  // Key usage order for MaxKeys; nil when unlimited
+	evicted        int64                      // Keys evicted for MaxKeys since open
+	aead           cipher.AEAD                // Value cipher; nil when encryption is off
+	segments       map[int]*os.File           // Open segment files by ID
+	maps           map[int]*mmapRegion        // Mapped segments by ID; nil unless Options.MMap
+	segment        int                        // ID of the segment being appended to
+	file           *os.File                   // Segment being appended to
+	writer         *bufio.Writer              // Buffers appends to file; nil unless Options.FlushInterval
+	flushMu        sync.Mutex                 // Guards writer, which readers may flush
+	path           string                     // File path for the database
+	lock           *os.File                   // Held lock file; nil when read-only
+	tempDir        string                     // Removed by Close; set by OpenMemory and OpenTemp
+	opts           Options                    // Options the database was opened with
+	size           int64                      // Combined length of all segments
+	segmentSize    int64                      // Length of the segment being appended to
+	dead           int64                      // Bytes of overwritten and deleted records a compaction would drop
+	corrupt        int                        // Corrupt records skipped while indexing
+	writeErr       error                      // Last failed write to disk, until one succeeds
+	backgroundErr  error                      // Last failed background job, until one succeeds
+	reads          atomic.Int64               // Values read since open
+	writes         atomic.Int64               // Records written since open
+	compacting     bool                       // Whether a background compaction is running
+	background     sync.WaitGroup             // Tracks background goroutines for Close
+	stop           chan struct{}              // Closed to stop background goroutines
+	stopOnce       sync.Once                  // Guards closing stop
+	closed         bool                       // Set by Close; everything after fails with ErrClosed
+	stopping       bool                       // Set by Close before it waits for background work, which must not start more
+	maxVersion     int64                      // Highest version written or seen in the log; see newVersion
+	queueMu        sync.Mutex                 // Guards queue
+	queue          commitQueue                // Sets waiting for the group committer
+	watchers       map[string]watchSet        // Watch subscriptions by key
+	prefixWatchers map[string]watchSet        // WatchPrefix subscriptions by prefix
+	indexes        map[string]*secondaryIndex // Secondary indexes by name
+	generation     int64                      // Changes whenever the files are rewritten; see Position
+	appended       chan struct{}              // Closed and replaced whenever the log changes, to wake ReadLog
 }
 
-// OpenDB initializes or loads the database
+// OpenDB initializes or loads the database with default options
 func OpenDB(path string) (*SimpleDB, error) {
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	return OpenDBWithOptions(path, Options{})
+}
+
+// OpenReadOnly loads an existing database for inspection. The file is never
+// written to, so it is safe to open one another process is writing; changes
+// made after the open are not seen. All writes fail with ErrReadOnly.
+func OpenReadOnly(path string) (*SimpleDB, error) {
+	return OpenDBWithOptions(path, Options{ReadOnly: true})
+}
+
+// OpenDBWithOptions initializes or loads the database with the given options
+func OpenDBWithOptions(path string, opts Options) (*SimpleDB, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if opts.Codec == nil {
+		opts.Codec = JSONCodec{}
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.New(discardHandler{})
+	}
+	if opts.FileMode == 0 {
+		opts.FileMode = defaultFileMode
+	}
+	if opts.FilterFalsePositiveRate == 0 {
+		opts.FilterFalsePositiveRate = defaultFilterFalsePositiveRate
+	}
+	opened := time.Now()
+	aead, err := newAEAD(opts.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only writers lock; readers never modify the files
+	var lock *os.File
+	legacy := false
+	if opts.ReadOnly {
+		// Migrating a file in the original format means writing to it
+		if _, err := os.Stat(path + legacySuffix); err == nil {
+			return nil, errLegacyReadOnly
+		}
+		if legacy, err = isLegacy(path); err != nil || legacy {
+			if err == nil {
+				err = errLegacyReadOnly
+			}
+			return nil, err
+		}
+	} else {
+		if opts.CreateDirs {
+			if err := os.MkdirAll(filepath.Dir(path), dirMode(opts.FileMode)); err != nil {
+				return nil, err
+			}
+		}
+		lock, err = lockPath(path, opts.FileMode)
+		if err != nil {
+			return nil, err
+		}
+
+		// A leftover compaction file means a previous Compact was interrupted
+		// before the swap; the live file is untouched, so just discard it.
+		if err := os.Remove(path + compactSuffix); err != nil && !os.IsNotExist(err) {
+			unlock(lock)
+			return nil, err
+		}
+
+		legacy, err = prepareLegacy(path)
+		if err != nil {
+			unlock(lock)
+			return nil, err
+		}
+	}
+
+	ids, err := listSegments(path)
 	if err != nil {
+		unlock(lock)
 		return nil, err
 	}
+	if len(ids) == 0 {
+		ids = []int{0}
+	}
 
 	db := &SimpleDB{
-		data: make(map[string]int64),
-		file: file,
-		path: path,
+		data:     make(map[string]location),
+		expires:  make(map[string]int64),
+		segments: make(map[int]*os.File, len(ids)),
+		path:     path,
+		opts:     opts,
+		cache:    newValueCache(opts.CacheSize),
+		aead:     aead,
+		stop:     make(chan struct{}),
+		lock:     lock,
+		queue:    commitQueue{ready: make(chan struct{}, 1)},
+		// Positions don't survive a reopen, which may truncate a torn tail
+		generation: time.Now().UnixNano(),
+		appended:   make(chan struct{}),
+	}
+	if opts.MMap {
+		db.maps = make(map[int]*mmapRegion)
+	}
+
+	// Only the last segment is ever appended to
+	for i, id := range ids {
+		flag := os.O_RDONLY
+		if i == len(ids)-1 && !opts.ReadOnly {
+			flag = os.O_CREATE | os.O_RDWR | os.O_APPEND
+		}
+		file, err := os.OpenFile(segmentPath(path, id), flag, opts.FileMode)
+		if err != nil {
+			closeSegments(db.segments)
+			unlock(lock)
+			return nil, err
+		}
+		db.segments[id] = file
+	}
+	db.segment = ids[len(ids)-1]
+	db.file = db.segments[db.segment]
+	if opts.FlushInterval > 0 && !opts.ReadOnly {
+		db.writer = bufio.NewWriterSize(db.file, flushBufferSize)
 	}
 
+	if opts.IndexBudget > 0 {
+		if db.spill, err = newSpillIndex(spillDir(path, opts), opts.FilterFalsePositiveRate); err != nil {
+			closeSegments(db.segments)
+			unlock(lock)
+			return nil, err
+		}
+	}
 	if err := db.loadIndex(); err != nil {
+		db.spill.close()
+		closeSegments(db.segments)
+		unlock(lock)
+		return nil, err
+	}
+	if err := db.loadIndexes(); err != nil {
+		db.spill.close()
+		closeSegments(db.segments)
+		unlock(lock)
 		return nil, err
 	}
+	db.mapSegments()
 
+	if !opts.ReadOnly {
+		db.background.Add(1)
+		go db.sweepLoop()
+	}
+	if opts.GroupCommit && !opts.ReadOnly {
+		db.background.Add(1)
+		go db.commitLoop()
+	}
+	if db.writer != nil {
+		db.background.Add(1)
+		go db.flushLoop()
+	}
+
+	if legacy {
+		if err := db.importLegacy(path + legacySuffix); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	opts.Logger.Info("opened database", "path", path, "keys", db.indexLen(), "segments", len(db.segments),
+		"bytes", db.size, "read_only", opts.ReadOnly, "took", time.Since(opened))
 	return db, nil
 }
 
-// LoadIndex scans the file to build the in-memory index
+// Options returns the options the database was opened with
+func (db *SimpleDB) Options() Options {
+	return db.opts
+}
+
+// LoadIndex builds the in-memory index from the persisted snapshot, if
+// there is a valid one, and then scans the rest of the segments in order
 func (db *SimpleDB) loadIndex() error {
-	scanner := bufio.NewScanner(db.file)
-	offset := int64(0)
+	start := db.loadSnapshot()
+	db.lru = newKeyOrder(db.opts, db.data)
+	db.countIndex()
+	return db.scanLog(start)
+}
+
+// RebuildIndex throws away the in-memory index and the persisted snapshot
+// and rebuilds both by scanning every segment from the start, for when the
+// snapshot is lost or suspected to be stale. Corrupt records are skipped and
+// counted in Stats only if the database was opened with SkipCorrupt. If the
+// scan fails, the previous index is kept.
+func (db *SimpleDB) RebuildIndex() error {
+	// A running compaction replays its tail against the index it started from
+	db.compactMu.Lock()
+	defer db.compactMu.Unlock()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		var entry KVPair
-		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+	if db.closed {
+		return ErrClosed
+	}
+
+	if err := db.flushWrites(); err != nil {
+		return err
+	}
+
+	data, expires, dead, corrupt := db.data, db.expires, db.dead, db.corrupt
+	size, segmentSize := db.size, db.segmentSize
+	spill, lru, indexSize := db.spill, db.lru, db.indexSize
+
+	db.data = make(map[string]location)
+	db.expires = make(map[string]int64)
+	db.dead, db.corrupt = 0, 0
+	db.size, db.segmentSize = 0, 0
+	db.lru, db.indexSize = newKeyOrder(db.opts, nil), 0
+	if spill != nil {
+		var err error
+		if db.spill, err = newSpillIndex(spill.dir, spill.rate); err != nil {
+			db.spill = spill
 			return err
 		}
+	}
+	if err := db.scanLog(location{}); err != nil {
+		db.spill.close()
+		db.data, db.expires, db.dead, db.corrupt = data, expires, dead, corrupt
+		db.size, db.segmentSize = size, segmentSize
+		db.spill, db.lru, db.indexSize = spill, lru, indexSize
+		return err
+	}
+	spill.close()
+
+	// Cached values came from the old index
+	db.cache = newValueCache(db.opts.CacheSize)
+	if err := db.rebuildIndexes(); err != nil {
+		return err
+	}
+	if db.opts.ReadOnly {
+		return nil
+	}
+	return db.saveSnapshot()
+}
+
+// scanLog indexes every record from start onwards, on top of whatever the
+// index already holds for the log before start
+func (db *SimpleDB) scanLog(start location) error {
+	ids := db.segmentIDs()
+	for i, id := range ids {
+		file := db.segments[id]
+		if id < start.Segment {
+			// Already covered by the snapshot
+			info, err := file.Stat()
+			if err != nil {
+				return err
+			}
+			db.size += info.Size()
+			continue
+		}
+
+		from := int64(0)
+		if id == start.Segment {
+			from = start.Offset
+		}
+		end, err := db.scanSegment(file, id, from)
+		db.size += end
+		if id == db.segment {
+			db.segmentSize = end
+		}
+		if err == nil {
+			continue
+		}
+		// Only the segment being appended to can end in a torn record
+		if i == len(ids)-1 && db.tornTail(end, err) {
+			return db.truncateTail(end)
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// Only the last segment can be cut short by a crash
+			return fmt.Errorf("%w: %s ends partway through a record at offset %d", ErrCorrupt, segmentPath(db.path, id), end)
+		}
+		return err
+	}
+	return nil
+}
+
+// scanSegment indexes the records of one segment from offset from onwards
+// and returns the offset just past the last record it read
+func (db *SimpleDB) scanSegment(file *os.File, id int, from int64) (int64, error) {
+	var onCorrupt func(int64)
+	if db.opts.SkipCorrupt {
+		onCorrupt = func(offset int64) {
+			db.corrupt++
+			db.opts.Logger.Warn("skipped corrupt record", "segment", segmentPath(db.path, id), "offset", offset)
+		}
+	}
+
+	// Records of a batch are held back until its last one has been read
+	var batch []scannedRecord
+
+	info, err := file.Stat()
+	if err != nil {
+		return from, err
+	}
+	end, err := scanEntries(db.opts.Codec, file, from, info.Size(), onCorrupt, func(entry Record, offset, size int64) error {
+		if len(batch) > 0 && entry.Batch != batch[len(batch)-1].entry.Batch-1 {
+			// A record in the middle was skipped as corrupt
+			db.opts.Logger.Warn("dropped incomplete batch", "segment", segmentPath(db.path, id), "offset", batch[0].offset)
+			for _, r := range batch {
+				db.dead += r.size
+			}
+			batch = batch[:0]
+		}
+		batch = append(batch, scannedRecord{entry: entry, offset: offset, size: size})
+		if entry.Batch > 0 {
+			return nil
+		}
+		for _, r := range batch {
+			if err := db.indexEntry(r.entry, id, r.offset, r.size); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	})
+	if len(batch) > 0 && (err == nil || db.tornTail(end, err)) {
+		return batch[0].offset, errIncompleteBatch
+	}
+	return end, err
+}
+
+// scannedRecord is a record read by scanSegment along with where it lies
+type scannedRecord struct {
+	entry  Record
+	offset int64
+	size   int64
+}
+
+// errIncompleteBatch reports a log that ends partway through a batch
+var errIncompleteBatch = errors.New("log ends partway through a batch")
+
+// indexEntry applies the record at offset in segment id to the index while
+// scanning the log
+func (db *SimpleDB) indexEntry(entry Record, id int, offset, size int64) error {
+	if strings.HasPrefix(entry.Key, reservedPrefix) {
+		db.dead += size
+		return nil
+	}
+	if err := db.promote(entry.Key); err != nil {
+		return err
+	}
+	prev, exists := db.data[entry.Key]
+	db.maxVersion = max(db.maxVersion, entry.Version)
+	if entry.Touched {
+		// Only needed until the next compaction rewrites the value
+		db.dead += size
+		if exists {
+			db.expires[entry.Key] = entry.ExpiresAt
+		}
+		return nil
+	}
+	// An older version of a key never shadows a newer one, wherever it
+	// sits in the log
+	if !entry.Deleted && exists && entry.Version < prev.Version {
+		db.dead += size
+		return nil
+	}
+
+	if entry.Deleted {
+		db.dead += size
+		if exists {
+			db.dead += prev.Size
+		}
+		db.unindexKey(entry.Key)
+		delete(db.expires, entry.Key)
+	} else {
+		if exists {
+			db.dead += prev.Size
+		}
+		db.indexKey(entry.Key, location{Segment: id, Offset: offset, Size: size, Version: entry.Version, Created: entry.CreatedAt})
+		if entry.ExpiresAt != 0 {
+			db.expires[entry.Key] = entry.ExpiresAt
+		} else {
+			delete(db.expires, entry.Key)
+		}
+	}
+	return db.spillCold()
+}
+
+// tornTail reports whether a scan that failed at offset did so because the
+// final record or batch was only partially written, as happens after a crash
+// mid-write
+func (db *SimpleDB) tornTail(offset int64, err error) bool {
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, errIncompleteBatch) {
+		return true
+	}
+	if !errors.Is(err, ErrCorrupt) {
+		return false
+	}
 
-		db.data[entry.Key] = offset
-		offset += int64(len(line) + 1)
+	// A checksum failure only counts if it is the last record in the file
+	info, err := db.file.Stat()
+	if err != nil {
+		return false
+	}
+	_, size, _ := readRecord(db.opts.Codec, io.NewSectionReader(db.file, offset, info.Size()-offset), info.Size()-offset)
+	return offset+size == info.Size()
+}
+
+// truncateTail discards everything from offset onwards so new writes don't
+// land behind a torn record. Read-only databases just ignore the tail.
+func (db *SimpleDB) truncateTail(offset int64) error {
+	info, err := db.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if db.opts.ReadOnly {
+		db.opts.Logger.Warn("ignoring partially written record", "segment", db.file.Name(), "bytes", info.Size()-offset)
+		return nil
 	}
 
-	return scanner.Err()
+	db.opts.Logger.Warn("discarding partially written record", "segment", db.file.Name(), "bytes", info.Size()-offset)
+	return db.file.Truncate(offset)
 }
 
 // Set adds or updates a key-value pair in the database
 func (db *SimpleDB) Set(key, value string) error {
+	return db.SetBytes(key, []byte(value))
+}
+
+// SetContext is like Set but gives up if ctx is done before the write starts
+func (db *SimpleDB) SetContext(ctx context.Context, key, value string) error {
+	return db.SetBytesContext(ctx, key, []byte(value))
+}
+
+// SetBytes adds or updates a key with an arbitrary byte value
+func (db *SimpleDB) SetBytes(key string, value []byte) error {
+	return db.SetBytesContext(context.Background(), key, value)
+}
+
+// SetBytesContext is like SetBytes but gives up if ctx is done before the
+// write starts. Once the record is being written it runs to completion.
+func (db *SimpleDB) SetBytesContext(ctx context.Context, key string, value []byte) (err error) {
+	key = db.normalize(key)
+	defer db.observe(OpSet, db.start(OpSet), &err)
+	span := db.startSpan(ctx, OpSet, key)
+	defer func() { span.End(len(value), err) }()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if db.opts.GroupCommit {
+		return db.enqueue(Record{Key: key, Value: value})
+	}
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	entry := KVPair{
-		Key:   key,
-		Value: value,
+	if db.closed {
+		return ErrClosed
 	}
 
-	data, err := json.Marshal(entry)
+	// The context may have ended while waiting for the lock
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return db.set(key, value)
+}
+
+// set writes a value with no expiry. Callers must hold the write lock.
+func (db *SimpleDB) set(key string, value []byte) error {
+	return db.write(Record{Key: key, Value: value})
+}
+
+// write appends a value record and updates the index. Callers must hold
+// the write lock.
+func (db *SimpleDB) write(entry Record) error {
+	if err := db.checkKey(entry.Key, len(entry.Value)); err != nil {
+		return err
+	}
+
+	if err := db.promote(entry.Key); err != nil {
+		return err
+	}
+	entry = db.stamp(entry, nil)
+	value := entry.Value
+	entry, err := db.prepareValue(entry)
 	if err != nil {
 		return err
 	}
 
-	offset, err := db.file.Seek(0, os.SEEK_END)
+	loc, err := db.appendEntry(entry)
 	if err != nil {
 		return err
 	}
-	if _, err := db.file.Write(append(data, '\n')); err != nil {
+
+	if err := db.setIndex(entry.Key, loc, entry.ExpiresAt); err != nil {
 		return err
 	}
+	db.publish(Event{Type: EventSet, Key: entry.Key, Value: string(value)})
+	return nil
+}
+
+// checkKey rejects empty and reserved keys and enforces MaxKeySize and
+// MaxValueSize
+func (db *SimpleDB) checkKey(key string, valueLen int) error {
+	if key == "" {
+		return fmt.Errorf("%w: key is empty", ErrInvalidKey)
+	}
+	if strings.HasPrefix(key, reservedPrefix) {
+		return ErrReservedKey
+	}
+	for _, prefix := range db.opts.ReservedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return fmt.Errorf("%w: prefix %q", ErrReservedKey, prefix)
+		}
+	}
+	if db.opts.MaxKeySize > 0 && len(key) > db.opts.MaxKeySize {
+		return ErrKeyTooLarge
+	}
+	if db.opts.MaxValueSize > 0 && valueLen > db.opts.MaxValueSize {
+		return ErrValueTooLarge
+	}
+	return nil
+}
+
+// BatchSet writes several key-value pairs with a single write and sync.
+// The index is only updated once the whole batch is on disk, so a failed
+// write leaves no keys from the batch visible, and a crash partway through
+// the write leaves none of them after reopening.
+func (db *SimpleDB) BatchSet(pairs []KVPair) (err error) {
+	if len(pairs) == 0 {
+		return nil
+	}
+	defer db.observe(OpBatchSet, db.start(OpBatchSet), &err)
+	span := db.startSpan(context.Background(), OpBatchSet, "")
+	defer func() {
+		bytes := 0
+		for _, pair := range pairs {
+			bytes += len(pair.Value)
+		}
+		span.End(bytes, err)
+	}()
+
+	if db.opts.ReadOnly {
+		return ErrReadOnly
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	entries := make([]Record, len(pairs))
+	keys := make([]string, len(pairs))
+	// Keys written earlier in this batch, so repeats get increasing versions
+	written := make(map[string]Record)
+	for i, pair := range pairs {
+		key := db.normalize(pair.Key)
+		keys[i] = key
+		if err := db.checkKey(key, len(pair.Value)); err != nil {
+			return err
+		}
+		if err := db.promote(key); err != nil {
+			return err
+		}
+		var prev *Record
+		if entry, ok := written[key]; ok {
+			prev = &entry
+		}
+		entry := db.stamp(Record{Key: key, Value: []byte(pair.Value)}, prev)
+		written[key] = entry
+
+		var err error
+		entries[i], err = db.prepareValue(entry)
+		if err != nil {
+			return err
+		}
+	}
 
-	db.data[key] = offset
+	locs, err := db.appendEntries(entries, true)
+	if err != nil {
+		return err
+	}
+	for i, pair := range pairs {
+		if err := db.setIndex(keys[i], locs[i], 0); err != nil {
+			return err
+		}
+		db.publish(Event{Type: EventSet, Key: keys[i], Value: pair.Value})
+	}
 	return nil
 }
 
+// appendEntry writes an entry to the end of the log and returns where it
+// landed
+func (db *SimpleDB) appendEntry(entry Record) (location, error) {
+	locs, err := db.appendEntries([]Record{entry}, db.opts.SyncWrites)
+	if err != nil {
+		return location{}, err
+	}
+	return locs[0], nil
+}
+
+// appendEntries writes entries to the end of the log with a single write,
+// followed by an fsync if sync is set, and returns where each one landed.
+// Each record carries the number of records after it in the same write, so
+// if a crash leaves only some of them on disk, opening the database drops
+// the rest as well and the write takes effect entirely or not at all.
+// Callers must hold the write lock.
+func (db *SimpleDB) appendEntries(entries []Record, sync bool) ([]location, error) {
+	if db.opts.ReadOnly {
+		return nil, ErrReadOnly
+	}
+
+	var buf []byte
+	sizes := make([]int64, len(entries))
+	for i, entry := range entries {
+		entry.Batch = len(entries) - 1 - i
+		data, err := encodeRecord(db.opts.Codec, entry)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, data...)
+		sizes[i] = int64(len(data))
+	}
+
+	if err := db.maybeRoll(int64(len(buf))); err != nil {
+		return nil, db.writeFailed(err)
+	}
+	offset := db.segmentSize
+	if db.writer != nil {
+		if err := db.writeBuffered(buf, sync); err != nil {
+			return nil, db.writeFailed(err)
+		}
+	} else {
+		var err error
+		offset, err = db.file.Seek(0, os.SEEK_END)
+		if err != nil {
+			return nil, db.writeFailed(err)
+		}
+		if _, err := db.file.Write(buf); err != nil {
+			return nil, db.writeFailed(err)
+		}
+		if sync {
+			if err := db.file.Sync(); err != nil {
+				return nil, db.writeFailed(err)
+			}
+		}
+	}
+	db.writeErr = nil
+
+	db.size += int64(len(buf))
+	db.segmentSize = offset + int64(len(buf))
+	db.mapSegment(db.segment, db.segmentSize)
+	db.writes.Add(int64(len(entries)))
+	db.logChanged()
+
+	locs := make([]location, len(entries))
+	for i := range entries {
+		locs[i] = location{Segment: db.segment, Offset: offset, Size: sizes[i], Version: entries[i].Version, Created: entries[i].CreatedAt}
+		offset += sizes[i]
+	}
+	return locs, nil
+}
+
 // Get retrieves the value for a given key
 func (db *SimpleDB) Get(key string) (string, error) {
+	return db.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get but gives up if ctx is done before the read starts
+func (db *SimpleDB) GetContext(ctx context.Context, key string) (string, error) {
+	value, err := db.GetBytesContext(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// GetBytes retrieves the raw byte value for a given key
+func (db *SimpleDB) GetBytes(key string) ([]byte, error) {
+	return db.GetBytesContext(context.Background(), key)
+}
+
+// GetBytesContext is like GetBytes but gives up if ctx is done before the
+// read starts
+func (db *SimpleDB) GetBytesContext(ctx context.Context, key string) (value []byte, err error) {
+	key = db.normalize(key)
+	defer db.observe(OpGet, db.start(OpGet), &err)
+	span := db.startSpan(ctx, OpGet, key)
+	defer func() { span.End(len(value), err) }()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
-	offset, exists := db.data[key]
-	if !exists {
-		return "", errors.New("key not found")
+	if db.closed {
+		return nil, ErrClosed
 	}
 
-	if _, err := db.file.Seek(offset, os.SEEK_SET); err != nil {
-		return "", err
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	reader := bufio.NewReader(db.file)
-	line, err := reader.ReadString('\n')
+	loc, exists, err := db.locate(key)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if !exists || db.expired(key) {
+		return nil, ErrKeyNotFound
 	}
 
-	var entry KVPair
-	if err := json.Unmarshal([]byte(line), &entry); err != nil {
-		return "", err
+	db.reads.Add(1)
+	db.lru.use(key)
+	if value, ok := db.cache.get(key); ok {
+		return value, nil
+	}
+
+	// Read at an explicit offset rather than seeking, since concurrent
+	// readers share the file descriptor and its position
+	value, err = db.readValue(loc)
+	if err != nil {
+		return nil, err
+	}
+
+	db.cache.put(key, value)
+	return value, nil
+}
+
+// lookup reads the current value of key, reporting whether it exists.
+// Callers must hold at least the read lock.
+func (db *SimpleDB) lookup(key string) ([]byte, bool, error) {
+	loc, exists, err := db.locate(key)
+	if err != nil || !exists || db.expired(key) {
+		return nil, false, err
 	}
 
-	return entry.Value, nil
+	db.reads.Add(1)
+	db.lru.use(key)
+	value, err := db.readValue(loc)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
 }
 
-// Delete removes a key from the database
+// Exists reports whether a key is present without reading its value. A
+// closed database has no keys.
+func (db *SimpleDB) Exists(key string) bool {
+	key = db.normalize(key)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return false
+	}
+	exists, err := db.exists(key)
+	if err != nil {
+		db.opts.Logger.Error("looking up key failed", "path", db.path, "key", key, "err", err)
+	}
+	return exists
+}
+
+// Delete removes a key from the database by appending a tombstone
 func (db *SimpleDB) Delete(key string) error {
+	return db.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext is like Delete but gives up if ctx is done before the
+// tombstone is written
+func (db *SimpleDB) DeleteContext(ctx context.Context, key string) (err error) {
+	key = db.normalize(key)
+	defer db.observe(OpDelete, db.start(OpDelete), &err)
+	span := db.startSpan(ctx, OpDelete, key)
+	defer func() { span.End(0, err) }()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	_, exists := db.data[key]
+	if db.closed {
+		return ErrClosed
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	exists, err := db.exists(key)
+	if err != nil {
+		return err
+	}
 	if !exists {
-		return errors.New("key not found")
+		return ErrKeyNotFound
+	}
+
+	return db.del(key)
+}
+
+// del writes a tombstone for key and drops it from the index. Callers must
+// hold the write lock.
+func (db *SimpleDB) del(key string) error {
+	if err := db.promote(key); err != nil {
+		return err
+	}
+	// The tombstone keeps the last version, so versions carry on past the
+	// delete when the log is scanned again
+	loc, err := db.appendEntry(Record{Key: key, Deleted: true, Version: db.data[key].Version})
+	if err != nil {
+		return err
+	}
+
+	if err := db.removeIndex(key, loc); err != nil {
+		return err
 	}
+	db.publish(Event{Type: EventDelete, Key: key})
+	return nil
+}
 
-	delete(db.data, key)
+// setIndex points key at a newly written record, counting any value it
+// replaces as dead. Callers must hold the write lock.
+func (db *SimpleDB) setIndex(key string, loc location, expiresAt int64) error {
+	// A key written earlier in the same batch may have been spilled since
+	if err := db.promote(key); err != nil {
+		return err
+	}
+	if prev, exists := db.data[key]; exists {
+		db.dead += prev.Size
+	}
+	db.indexKey(key, loc)
+	db.cache.remove(key)
+	if expiresAt != 0 {
+		db.expires[key] = expiresAt
+	} else {
+		delete(db.expires, key)
+	}
+	db.evict()
+	db.trimIndex()
+	db.maybeCompact()
 	return nil
 }
 
-// Close ensures the file is properly closed
+// removeIndex drops a key after its tombstone was written at tombstone;
+// both the old value and the tombstone are dead. Callers must hold the
+// write lock.
+func (db *SimpleDB) removeIndex(key string, tombstone location) error {
+	if err := db.promote(key); err != nil {
+		return err
+	}
+	db.dead += db.data[key].Size + tombstone.Size
+	db.unindexKey(key)
+	delete(db.expires, key)
+	db.cache.remove(key)
+	db.maybeCompact()
+	return nil
+}
+
+// maybeCompact starts a background compaction once dead bytes make up more
+// than the configured share of a large enough file. Only one runs at a time;
+// writes made while it copies are replayed before the swap. Callers must
+// hold the write lock.
+func (db *SimpleDB) maybeCompact() {
+	// Close may already be waiting for the background goroutines
+	if db.opts.CompactRatio == 0 || db.compacting || db.stopping || db.size < db.opts.CompactMinSize {
+		return
+	}
+	if float64(db.dead) <= db.opts.CompactRatio*float64(db.size) {
+		return
+	}
+
+	db.compacting = true
+	db.background.Add(1)
+	go func() {
+		defer db.background.Done()
+		err := db.Compact()
+		if err != nil {
+			db.opts.Logger.Error("background compaction failed", "path", db.path, "err", err)
+		}
+
+		db.mu.Lock()
+		db.compacting = false
+		db.backgroundErr = err
+		db.mu.Unlock()
+	}()
+}
+
+// Flush forces all written data to stable storage
+func (db *SimpleDB) Flush() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	if err := db.flushWrites(); err != nil {
+		return err
+	}
+	return db.file.Sync()
+}
+
+// Close ensures the file is properly closed. Closing an already closed
+// database returns ErrClosed. A database opened with OpenMemory or OpenTemp
+// is deleted.
 func (db *SimpleDB) Close() error {
+	// Keep writes from starting another background compaction, then stop
+	// the expiry sweeper and let a running one finish before the file goes
+	// away
+	db.mu.Lock()
+	db.stopping = true
+	db.mu.Unlock()
+	db.stopOnce.Do(func() { close(db.stop) })
+	db.background.Wait()
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	return db.file.Close()
+	if db.closed {
+		return ErrClosed
+	}
+	db.closed = true
+	db.logChanged()
+	db.closeWatchers()
+
+	// The snapshot records the file size, so it has to come after the flush
+	snapErr := db.flushWrites()
+	if !db.opts.ReadOnly && db.tempDir == "" && snapErr == nil {
+		snapErr = db.saveSnapshot()
+	}
+	db.unmapSegments()
+	db.spill.close()
+	err := closeSegments(db.segments)
+	// Only let another writer in once everything is on disk
+	if unlockErr := unlock(db.lock); err == nil {
+		err = unlockErr
+	}
+	if db.tempDir != "" {
+		if removeErr := os.RemoveAll(db.tempDir); err == nil {
+			err = removeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return snapErr
 }
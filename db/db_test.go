@@ -0,0 +1,1053 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openTestDB opens a database at a fresh path in a temporary directory,
+// closing it when the test ends
+func openTestDB(t *testing.T, opts Options) (*SimpleDB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	return reopenTestDB(t, path, opts), path
+}
+
+// reopenTestDB opens the database at path, closing it when the test ends
+func reopenTestDB(t *testing.T, path string, opts Options) *SimpleDB {
+	t.Helper()
+	db, err := OpenDBWithOptions(path, opts)
+	if err != nil {
+		t.Fatalf("opening %s: %v", path, err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// mustSet sets key to value, failing the test on error
+func mustSet(t *testing.T, db *SimpleDB, key, value string) {
+	t.Helper()
+	if err := db.Set(key, value); err != nil {
+		t.Fatalf("Set(%q): %v", key, err)
+	}
+}
+
+// wantValue checks that key holds want
+func wantValue(t *testing.T, db *SimpleDB, key, want string) {
+	t.Helper()
+	got, err := db.Get(key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	if got != want {
+		t.Fatalf("Get(%q) = %q, want %q", key, got, want)
+	}
+}
+
+// wantMissing checks that key doesn't exist
+func wantMissing(t *testing.T, db *SimpleDB, key string) {
+	t.Helper()
+	if got, err := db.Get(key); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get(%q) = %q, %v, want ErrKeyNotFound", key, got, err)
+	}
+}
+
+// copyFile copies the file at src to dst
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLargeValueReopen(t *testing.T) {
+	// Well past bufio.Scanner's 64 KB default line limit
+	large := strings.Repeat("0123456789abcdef", 1<<16)
+
+	tests := []struct {
+		name   string
+		opts   Options
+		rescan bool // Drop the index snapshot so the log is scanned on open
+		legacy bool // Start from a file in the original line-based format
+	}{
+		{name: "snapshot"},
+		{name: "scan", rescan: true},
+		{name: "segments", opts: Options{SegmentSize: 4096}, rescan: true},
+		{name: "mmap", opts: Options{MMap: true}, rescan: true},
+		{name: "compressed", opts: Options{Compression: CompressionZstd}, rescan: true},
+		{name: "legacy", legacy: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.db")
+			if tt.legacy {
+				line, err := json.Marshal(legacyRecord{Key: "large", Value: large})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, append(line, '\n'), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			db := reopenTestDB(t, path, tt.opts)
+			if !tt.legacy {
+				mustSet(t, db, "large", large)
+			}
+			mustSet(t, db, "after", "small")
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.rescan {
+				if err := os.Remove(path + indexSuffix); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			db = reopenTestDB(t, path, tt.opts)
+			wantValue(t, db, "large", large)
+			wantValue(t, db, "after", "small")
+		})
+	}
+}
+
+func TestDeleteSurvivesReopen(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  func(t *testing.T, db *SimpleDB)
+		want map[string]string
+	}{
+		{
+			name: "delete",
+			ops: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "a", "one")
+				mustSet(t, db, "b", "two")
+				if err := db.Delete("a"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: map[string]string{"b": "two"},
+		},
+		{
+			name: "set again after delete",
+			ops: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "a", "one")
+				if err := db.Delete("a"); err != nil {
+					t.Fatal(err)
+				}
+				mustSet(t, db, "a", "again")
+			},
+			want: map[string]string{"a": "again"},
+		},
+		{
+			name: "delete after set again",
+			ops: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "a", "one")
+				if err := db.Delete("a"); err != nil {
+					t.Fatal(err)
+				}
+				mustSet(t, db, "a", "again")
+				if err := db.Delete("a"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: map[string]string{},
+		},
+		{
+			name: "delete of a missing key",
+			ops: func(t *testing.T, db *SimpleDB) {
+				if err := db.Delete("a"); !errors.Is(err, ErrKeyNotFound) {
+					t.Fatalf("Delete(missing) = %v, want ErrKeyNotFound", err)
+				}
+			},
+			want: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, rescan := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/rescan=%v", tt.name, rescan), func(t *testing.T) {
+				db, path := openTestDB(t, Options{})
+				tt.ops(t, db)
+				if err := db.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if rescan {
+					if err := os.Remove(path + indexSuffix); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				db = reopenTestDB(t, path, Options{})
+				for key, value := range tt.want {
+					wantValue(t, db, key, value)
+				}
+				if _, ok := tt.want["a"]; !ok {
+					wantMissing(t, db, "a")
+				}
+				if got := db.Len(); got != len(tt.want) {
+					t.Fatalf("Len() = %d, want %d", got, len(tt.want))
+				}
+			})
+		}
+	}
+}
+
+func TestBytesValues(t *testing.T) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	values := []struct {
+		name  string
+		value []byte
+	}{
+		{"empty", []byte{}},
+		{"every byte", all},
+		{"invalid UTF-8", []byte{0xff, 0xfe, 0xfd}},
+		{"newlines", []byte("line one\nline two\r\n")},
+		{"JSON text", []byte(`{"key":"x","value":"y"}`)},
+	}
+	codecs := []struct {
+		name  string
+		codec Codec
+	}{
+		{"json", JSONCodec{}},
+		{"binary", BinaryCodec{}},
+	}
+
+	for _, c := range codecs {
+		t.Run(c.name, func(t *testing.T) {
+			opts := Options{Codec: c.codec}
+			db, path := openTestDB(t, opts)
+			for _, v := range values {
+				if err := db.SetBytes(v.name, v.value); err != nil {
+					t.Fatalf("SetBytes(%s): %v", v.name, err)
+				}
+			}
+			check := func(db *SimpleDB) {
+				t.Helper()
+				for _, v := range values {
+					got, err := db.GetBytes(v.name)
+					if err != nil {
+						t.Fatalf("GetBytes(%s): %v", v.name, err)
+					}
+					if !bytes.Equal(got, v.value) {
+						t.Fatalf("GetBytes(%s) = %q, want %q", v.name, got, v.value)
+					}
+				}
+			}
+			check(db)
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			check(reopenTestDB(t, path, opts))
+		})
+	}
+}
+
+func TestBatchSet(t *testing.T) {
+	pairs := []KVPair{{Key: "a", Value: "one"}, {Key: "b", Value: "two"}, {Key: "a", Value: "three"}}
+
+	tests := []struct {
+		name string
+		cut  int64 // Bytes cut off the end of the log before reopening
+		want map[string]string
+	}{
+		{name: "whole batch", want: map[string]string{"before": "x", "a": "three", "b": "two"}},
+		{name: "torn last record", cut: 3, want: map[string]string{"before": "x"}},
+		{name: "torn header", cut: 30, want: map[string]string{"before": "x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			mustSet(t, db, "before", "x")
+			if err := db.BatchSet(pairs); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.cut > 0 {
+				os.Remove(path + indexSuffix)
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Truncate(path, info.Size()-tt.cut); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			db = reopenTestDB(t, path, Options{})
+			for key, value := range tt.want {
+				wantValue(t, db, key, value)
+			}
+			if got := db.Len(); got != len(tt.want) {
+				t.Fatalf("Len() = %d, want %d", got, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestBatchSetInvalid(t *testing.T) {
+	db, _ := openTestDB(t, Options{MaxValueSize: 10})
+	err := db.BatchSet([]KVPair{{Key: "a", Value: "ok"}, {Key: "b", Value: strings.Repeat("x", 11)}})
+	if !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("BatchSet() = %v, want ErrValueTooLarge", err)
+	}
+	wantMissing(t, db, "a")
+	if err := db.BatchSet(nil); err != nil {
+		t.Fatalf("BatchSet(nil) = %v", err)
+	}
+}
+
+func TestWritesReachFile(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"default", Options{}},
+		{"sync writes", Options{SyncWrites: true}},
+		{"sync writes with group commit", Options{SyncWrites: true, GroupCommit: true}},
+		{"sync writes with a flush interval", Options{SyncWrites: true, FlushInterval: time.Hour}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, tt.opts)
+			mustSet(t, db, "a", "one")
+			mustSet(t, db, "b", "two")
+			if err := db.Delete("b"); err != nil {
+				t.Fatal(err)
+			}
+
+			// As if the process died here: nothing was closed or flushed
+			after := reopenTestDB(t, path, Options{ReadOnly: true})
+			wantValue(t, after, "a", "one")
+			wantMissing(t, after, "b")
+		})
+	}
+}
+
+func TestExists(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want bool
+	}{
+		{name: "present", key: "a", want: true},
+		{name: "deleted", key: "b"},
+		{name: "expired", key: "c"},
+		{name: "never set", key: "d"},
+		{name: "empty value", key: "e", want: true},
+	}
+
+	db, _ := openTestDB(t, Options{})
+	mustSet(t, db, "a", "one")
+	mustSet(t, db, "b", "two")
+	if err := db.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetWithTTL("c", "three", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "e", "")
+	time.Sleep(5 * time.Millisecond)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := db.Exists(tt.key); got != tt.want {
+				t.Fatalf("Exists(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTornTail(t *testing.T) {
+	record, err := encodeRecord(JSONCodec{}, Record{Key: "c", Value: []byte("three")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	badChecksum := append([]byte(nil), record...)
+	badChecksum[len(badChecksum)-2] ^= 0x01
+
+	tests := []struct {
+		name     string
+		garbage  []byte
+		readOnly bool
+	}{
+		{name: "partial header", garbage: record[:3]},
+		{name: "partial payload", garbage: record[:len(record)-4]},
+		{name: "length past the end", garbage: []byte{0xff, 0xff, 0, 0, 1, 2, 3, 4, '{'}},
+		{name: "bad checksum", garbage: badChecksum},
+		{name: "read-only", garbage: record[:len(record)-4], readOnly: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			mustSet(t, db, "a", "one")
+			mustSet(t, db, "b", "two")
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			os.Remove(path + indexSuffix)
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Write(tt.garbage); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			db = reopenTestDB(t, path, Options{ReadOnly: tt.readOnly})
+			wantValue(t, db, "a", "one")
+			wantValue(t, db, "b", "two")
+			wantMissing(t, db, "c")
+
+			want := info.Size()
+			if tt.readOnly {
+				want += int64(len(tt.garbage))
+			}
+			if got := fileSize(t, db); got != want {
+				t.Fatalf("file is %d bytes, want %d", got, want)
+			}
+			if tt.readOnly {
+				return
+			}
+
+			// Writes after the truncation must be readable on the next open
+			mustSet(t, db, "c", "three")
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			os.Remove(path + indexSuffix)
+			db = reopenTestDB(t, path, Options{})
+			wantValue(t, db, "c", "three")
+		})
+	}
+}
+
+func TestConcurrentGet(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "default"},
+		{name: "mmap", opts: Options{MMap: true}},
+		{name: "cache", opts: Options{CacheSize: 10}},
+		{name: "segments", opts: Options{SegmentSize: 1024}},
+		{name: "buffered writes", opts: Options{FlushInterval: time.Hour}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, tt.opts)
+			const keys = 50
+			for i := 0; i < keys; i++ {
+				mustSet(t, db, fmt.Sprintf("key-%d", i), strings.Repeat(fmt.Sprint(i), 20))
+			}
+
+			// Readers of different keys interleave with a writer appending
+			// more, and each must see exactly its own value
+			var wg sync.WaitGroup
+			stop := make(chan struct{})
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; ; i++ {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					if err := db.Set(fmt.Sprintf("other-%d", i), "x"); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+			var readers sync.WaitGroup
+			for r := 0; r < 8; r++ {
+				readers.Add(1)
+				go func(r int) {
+					defer readers.Done()
+					for n := 0; n < 200; n++ {
+						i := (r*31 + n) % keys
+						value, err := db.Get(fmt.Sprintf("key-%d", i))
+						if want := strings.Repeat(fmt.Sprint(i), 20); err != nil || value != want {
+							t.Errorf("Get(key-%d) = %q, %v, want %q", i, value, err, want)
+							return
+						}
+					}
+				}(r)
+			}
+			readers.Wait()
+			close(stop)
+			wg.Wait()
+		})
+	}
+}
+
+func TestSizeLimits(t *testing.T) {
+	const maxKey, maxValue = 8, 16
+	tests := []struct {
+		name    string
+		initial string // Value of a before the write
+		write   func(db *SimpleDB) error
+		wantErr error
+	}{
+		{name: "key at the limit", write: func(db *SimpleDB) error { return db.Set(strings.Repeat("k", maxKey), "v") }},
+		{name: "key over the limit", write: func(db *SimpleDB) error { return db.Set(strings.Repeat("k", maxKey+1), "v") }, wantErr: ErrKeyTooLarge},
+		{name: "value at the limit", write: func(db *SimpleDB) error { return db.Set("k", strings.Repeat("v", maxValue)) }},
+		{name: "value over the limit", write: func(db *SimpleDB) error { return db.Set("k", strings.Repeat("v", maxValue+1)) }, wantErr: ErrValueTooLarge},
+		{
+			name:    "with a ttl",
+			write:   func(db *SimpleDB) error { return db.SetWithTTL("k", strings.Repeat("v", maxValue+1), time.Hour) },
+			wantErr: ErrValueTooLarge,
+		},
+		{
+			name:    "append past the limit",
+			initial: strings.Repeat("v", maxValue),
+			write: func(db *SimpleDB) error {
+				_, err := db.Append("a", "v")
+				return err
+			},
+			wantErr: ErrValueTooLarge,
+		},
+		{
+			name: "batch",
+			write: func(db *SimpleDB) error {
+				return db.BatchSet([]KVPair{{Key: strings.Repeat("k", maxKey+1), Value: "v"}})
+			},
+			wantErr: ErrKeyTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{MaxKeySize: maxKey, MaxValueSize: maxValue})
+			if tt.initial != "" {
+				mustSet(t, db, "a", tt.initial)
+			}
+			before := fileSize(t, db)
+
+			err := tt.write(db)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("write error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				return
+			}
+			// Rejected before anything was written
+			if after := fileSize(t, db); after != before {
+				t.Fatalf("file grew from %d to %d bytes", before, after)
+			}
+		})
+	}
+}
+
+func TestInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		write   func(db *SimpleDB) error
+		wantErr error
+	}{
+		{name: "empty", write: func(db *SimpleDB) error { return db.Set("", "v") }, wantErr: ErrInvalidKey},
+		{name: "internal prefix", write: func(db *SimpleDB) error { return db.Set(reservedPrefix+"x", "v") }, wantErr: ErrReservedKey},
+		{
+			name:    "reserved prefix",
+			opts:    Options{ReservedPrefixes: []string{"bucket:", "meta:"}},
+			write:   func(db *SimpleDB) error { return db.Set("meta:x", "v") },
+			wantErr: ErrReservedKey,
+		},
+		{
+			name:    "exactly the reserved prefix",
+			opts:    Options{ReservedPrefixes: []string{"bucket:"}},
+			write:   func(db *SimpleDB) error { return db.Set("bucket:", "v") },
+			wantErr: ErrReservedKey,
+		},
+		{
+			name:  "prefix inside the key",
+			opts:  Options{ReservedPrefixes: []string{"bucket:"}},
+			write: func(db *SimpleDB) error { return db.Set("my-bucket:x", "v") },
+		},
+		{
+			name:  "prefix without its separator",
+			opts:  Options{ReservedPrefixes: []string{"bucket:"}},
+			write: func(db *SimpleDB) error { return db.Set("bucket", "v") },
+		},
+		{
+			name:    "with a ttl",
+			write:   func(db *SimpleDB) error { return db.SetWithTTL("", "v", time.Hour) },
+			wantErr: ErrInvalidKey,
+		},
+		{
+			name: "batch",
+			opts: Options{ReservedPrefixes: []string{"bucket:"}},
+			write: func(db *SimpleDB) error {
+				return db.BatchSet([]KVPair{{Key: "ok", Value: "v"}, {Key: "bucket:x", Value: "v"}})
+			},
+			wantErr: ErrReservedKey,
+		},
+		{
+			name: "write batch",
+			write: func(db *SimpleDB) error {
+				b := db.NewBatch()
+				b.Put("ok", "v")
+				b.Put("", "v")
+				return b.Commit()
+			},
+			wantErr: ErrInvalidKey,
+		},
+		{
+			name:    "transaction",
+			write:   func(db *SimpleDB) error { return db.UpdateTx(func(tx *WriteTx) error { return tx.Set("", "v") }) },
+			wantErr: ErrInvalidKey,
+		},
+		{
+			name:    "copy",
+			opts:    Options{ReservedPrefixes: []string{"bucket:"}},
+			write:   func(db *SimpleDB) error { return db.Copy("a", "bucket:a") },
+			wantErr: ErrReservedKey,
+		},
+		{
+			name:    "group commit",
+			opts:    Options{GroupCommit: true},
+			write:   func(db *SimpleDB) error { return db.Set("", "v") },
+			wantErr: ErrInvalidKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, tt.opts)
+			mustSet(t, db, "a", "one")
+			before := fileSize(t, db)
+
+			err := tt.write(db)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("write error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				return
+			}
+			if after := fileSize(t, db); after != before {
+				t.Fatalf("file grew from %d to %d bytes", before, after)
+			}
+			if n := db.Len(); n != 1 {
+				t.Fatalf("Len() = %d after a rejected write, want 1", n)
+			}
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(db *SimpleDB) error
+	}{
+		{name: "set", write: func(db *SimpleDB) error { return db.Set("a", "two") }},
+		{name: "set with ttl", write: func(db *SimpleDB) error { return db.SetWithTTL("a", "two", time.Hour) }},
+		{name: "delete", write: func(db *SimpleDB) error { return db.Delete("a") }},
+		{name: "batch", write: func(db *SimpleDB) error { return db.BatchSet([]KVPair{{Key: "a", Value: "two"}}) }},
+		{name: "append", write: func(db *SimpleDB) error { _, err := db.Append("a", "x"); return err }},
+		{name: "increment", write: func(db *SimpleDB) error { _, err := db.Increment("n", 1); return err }},
+		{name: "compare and swap", write: func(db *SimpleDB) error { _, err := db.CompareAndSwap("a", "one", "two"); return err }},
+		{name: "compact", write: func(db *SimpleDB) error { return db.Compact() }},
+		{name: "clear", write: func(db *SimpleDB) error { return db.Clear() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			mustSet(t, db, "a", "one")
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			before, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ro, err := OpenReadOnly(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.write(ro); !errors.Is(err, ErrReadOnly) {
+				t.Fatalf("write error = %v, want %v", err, ErrReadOnly)
+			}
+			wantValue(t, ro, "a", "one")
+			if err := ro.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			after, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(before, after) {
+				t.Fatal("the file changed")
+			}
+		})
+	}
+}
+
+func TestReadOnlyAlongsideWriter(t *testing.T) {
+	db, path := openTestDB(t, Options{})
+	mustSet(t, db, "a", "one")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	ro, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatalf("opening read-only while a writer has it open: %v", err)
+	}
+	defer ro.Close()
+	wantValue(t, ro, "a", "one")
+
+	// Later writes aren't seen, but don't disturb the reader either
+	mustSet(t, db, "b", "two")
+	wantMissing(t, ro, "b")
+	wantValue(t, ro, "a", "one")
+}
+
+func TestRebuildIndex(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   Options
+		damage func(db *SimpleDB) // Damages the in-memory index before the rebuild
+	}{
+		{name: "in sync", damage: func(*SimpleDB) {}},
+		{name: "lost entry", damage: func(db *SimpleDB) { delete(db.data, "a") }},
+		{name: "stale entry", damage: func(db *SimpleDB) { db.data["b"] = db.data["a"] }},
+		{name: "stale expiry", damage: func(db *SimpleDB) { delete(db.expires, "t") }},
+		{name: "segments", opts: Options{SegmentSize: 64}, damage: func(db *SimpleDB) { delete(db.data, "a") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, tt.opts)
+			mustSet(t, db, "a", "one")
+			mustSet(t, db, "b", "old")
+			mustSet(t, db, "b", "two")
+			mustSet(t, db, "gone", "x")
+			if err := db.Delete("gone"); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.SetWithTTL("t", "soon", time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			before, beforeStats := indexState(t, db)
+
+			tt.damage(db)
+			if err := db.RebuildIndex(); err != nil {
+				t.Fatal(err)
+			}
+			after, afterStats := indexState(t, db)
+			if !maps.Equal(after, before) {
+				t.Fatalf("rebuilt index = %v, want %v", after, before)
+			}
+			if len(db.expires) != 1 || db.expires["t"] == 0 {
+				t.Fatalf("rebuilt expiries = %v, want just t", db.expires)
+			}
+			if afterStats.Keys != beforeStats.Keys || afterStats.DeadBytes != beforeStats.DeadBytes || afterStats.FileSize != beforeStats.FileSize {
+				t.Fatalf("Stats() after = %+v, want %+v", afterStats, beforeStats)
+			}
+			wantValue(t, db, "a", "one")
+			wantValue(t, db, "b", "two")
+			wantMissing(t, db, "gone")
+		})
+	}
+}
+
+// indexState copies the index of db along with its stats
+func indexState(t *testing.T, db *SimpleDB) (map[string]location, Stats) {
+	t.Helper()
+	all, err := db.indexed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return maps.Clone(all), stats
+}
+
+func TestRebuildIndexSkipsCorrupt(t *testing.T) {
+	db, path := openTestDB(t, Options{SkipCorrupt: true})
+	mustSet(t, db, "a", "one")
+	mustSet(t, db, "b", "old")
+	mustSet(t, db, "b", "two")
+	mustSet(t, db, "c", "three")
+	flipLastByte(t, path, db.data["b"])
+
+	if err := db.RebuildIndex(); err != nil {
+		t.Fatal(err)
+	}
+	wantValue(t, db, "b", "old")
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Corrupt != 1 {
+		t.Fatalf("Stats().Corrupt = %d, want 1", stats.Corrupt)
+	}
+}
+
+// BenchmarkGetParallel compares reads from many goroutines at once with the
+// same reads taken one at a time; run it with -cpu 1,2,4,8 to see parallel
+// reads scale
+func BenchmarkGetParallel(b *testing.B) {
+	tests := []struct {
+		name      string
+		serialize bool
+	}{
+		{name: "parallel"},
+		{name: "serialized", serialize: true},
+	}
+
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			db, err := OpenDBWithOptions(filepath.Join(b.TempDir(), "bench.db"), Options{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer db.Close()
+			for i := 0; i < 1000; i++ {
+				if err := db.Set(fmt.Sprintf("key-%d", i), strings.Repeat("v", 256)); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := db.Flush(); err != nil {
+				b.Fatal(err)
+			}
+
+			var mu sync.Mutex
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if tt.serialize {
+						mu.Lock()
+					}
+					_, err := db.Get(fmt.Sprintf("key-%d", i%1000))
+					if tt.serialize {
+						mu.Unlock()
+					}
+					if err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func(db *SimpleDB) error
+		want error
+	}{
+		{name: "get missing", op: func(db *SimpleDB) error { _, err := db.Get("missing"); return err }, want: ErrKeyNotFound},
+		{name: "empty key", op: func(db *SimpleDB) error { return db.Set("", "v") }, want: ErrInvalidKey},
+		{name: "reserved key", op: func(db *SimpleDB) error { return db.Set(reservedPrefix+"x", "v") }, want: ErrReservedKey},
+		{name: "reserved key is invalid", op: func(db *SimpleDB) error { return db.Set(reservedPrefix+"x", "v") }, want: ErrInvalidKey},
+		{name: "not an integer", op: func(db *SimpleDB) error { _, err := db.Increment("text", 1); return err }, want: ErrNotInteger},
+		{name: "version mismatch", op: func(db *SimpleDB) error { _, err := db.SetIfVersion("text", "v", 1000); return err }, want: ErrVersionMismatch},
+		{name: "not an object", op: func(db *SimpleDB) error { _, err := db.GetField("text", "a"); return err }, want: ErrNotObject},
+		{name: "not a list", op: func(db *SimpleDB) error { _, err := db.LPush("text", "v"); return err }, want: ErrNotList},
+		{name: "not a set", op: func(db *SimpleDB) error { _, err := db.SAdd("text", "v"); return err }, want: ErrNotSet},
+		{name: "no index", op: func(db *SimpleDB) error { _, err := db.QueryIndex("missing", "v"); return err }, want: ErrNoIndex},
+		{name: "closed", op: func(db *SimpleDB) error { db.Close(); _, err := db.Get("text"); return err }, want: ErrClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			mustSet(t, db, "text", "not a number")
+			if err := tt.op(db); !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorsOnOpen(t *testing.T) {
+	tests := []struct {
+		name     string
+		keepOpen bool // Whether the first handle stays open
+		op       func(path string) error
+		want     error
+	}{
+		{
+			name:     "locked",
+			keepOpen: true,
+			op: func(path string) error {
+				db, err := OpenDB(path)
+				if err == nil {
+					db.Close()
+				}
+				return err
+			},
+			want: ErrAlreadyLocked,
+		},
+		{
+			name: "wrong encryption key",
+			op: func(path string) error {
+				db, err := OpenDBWithOptions(path, Options{EncryptionKey: bytes.Repeat([]byte{1}, 32)})
+				if err != nil {
+					return err
+				}
+				defer db.Close()
+				_, err = db.Get("a")
+				return err
+			},
+			want: ErrDecrypt,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.keepOpen && !locksWork {
+				t.Skip("no file locks on this platform")
+			}
+			db, path := openTestDB(t, Options{EncryptionKey: make([]byte, 32)})
+			mustSet(t, db, "a", "one")
+			if !tt.keepOpen {
+				if err := db.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := tt.op(path); !errors.Is(err, tt.want) {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestClosed(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func(db *SimpleDB) error
+	}{
+		{name: "close", op: func(db *SimpleDB) error { return db.Close() }},
+		{name: "get", op: func(db *SimpleDB) error { _, err := db.Get("a"); return err }},
+		{name: "get with ttl", op: func(db *SimpleDB) error { _, _, err := db.GetWithTTL("a"); return err }},
+		{name: "get multi", op: func(db *SimpleDB) error { _, err := db.GetMulti([]string{"a"}); return err }},
+		{name: "set", op: func(db *SimpleDB) error { return db.Set("a", "two") }},
+		{name: "set with ttl", op: func(db *SimpleDB) error { return db.SetWithTTL("a", "two", time.Hour) }},
+		{name: "batch", op: func(db *SimpleDB) error { return db.BatchSet([]KVPair{{Key: "a", Value: "two"}}) }},
+		{name: "delete", op: func(db *SimpleDB) error { return db.Delete("a") }},
+		{name: "delete multi", op: func(db *SimpleDB) error { _, err := db.DeleteMulti([]string{"a"}); return err }},
+		{name: "delete range", op: func(db *SimpleDB) error { _, err := db.DeleteRange("a", "b"); return err }},
+		{name: "increment", op: func(db *SimpleDB) error { _, err := db.Increment("n", 1); return err }},
+		{name: "compare and swap", op: func(db *SimpleDB) error { _, err := db.CompareAndSwap("a", "one", "two"); return err }},
+		{name: "touch", op: func(db *SimpleDB) error { return db.Touch("a", time.Hour) }},
+		{name: "scan prefix", op: func(db *SimpleDB) error { _, err := db.ScanPrefix(""); return err }},
+		{name: "scan range", op: func(db *SimpleDB) error { _, err := db.ScanRange("", ""); return err }},
+		{name: "iterator", op: func(db *SimpleDB) error { _, err := db.NewIterator(); return err }},
+		{name: "backup", op: func(db *SimpleDB) error { return db.Backup(io.Discard) }},
+		{name: "stats", op: func(db *SimpleDB) error { _, err := db.Stats(); return err }},
+		{name: "flush", op: func(db *SimpleDB) error { return db.Flush() }},
+		{name: "compact", op: func(db *SimpleDB) error { return db.Compact() }},
+		{name: "clear", op: func(db *SimpleDB) error { return db.Clear() }},
+		{name: "rebuild index", op: func(db *SimpleDB) error { return db.RebuildIndex() }},
+		{name: "verify", op: func(db *SimpleDB) error { _, err := db.Verify(); return err }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			mustSet(t, db, "a", "one")
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.op(db); !errors.Is(err, ErrClosed) {
+				t.Fatalf("error = %v, want %v", err, ErrClosed)
+			}
+			// The calls that can't report an error see an empty database
+			if db.Exists("a") || db.Len() != 0 || len(db.Keys()) != 0 {
+				t.Fatalf("after Close Exists() = %v, Len() = %d, Keys() = %v", db.Exists("a"), db.Len(), db.Keys())
+			}
+		})
+	}
+}
+
+func TestLookupWithoutFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "one segment"},
+		{name: "many segments", opts: Options{SegmentSize: 128}},
+		// Nearly every key is spilled, and the filter in front of the table
+		// is tight enough that no miss here gets past it
+		{name: "index budget", opts: Options{IndexBudget: 1, FilterFalsePositiveRate: 1e-9}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, tt.opts)
+			for i := 0; i < 50; i++ {
+				mustSet(t, db, fmt.Sprintf("key-%d", i), "value")
+			}
+			if err := db.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			// Every present key is known without reading a file
+			for i := 0; i < 50; i++ {
+				if !db.Exists(fmt.Sprintf("key-%d", i)) {
+					t.Fatalf("key-%d is missing", i)
+				}
+			}
+
+			// With every file closed underneath, the spill table's included,
+			// missing keys are still answered from memory alone
+			for _, file := range db.segments {
+				file.Close()
+			}
+			if db.spill != nil {
+				db.spill.slots.Close()
+				db.spill.keys.Close()
+			}
+			for i := 50; i < 100; i++ {
+				if _, err := db.Get(fmt.Sprintf("key-%d", i)); !errors.Is(err, ErrKeyNotFound) {
+					t.Fatalf("Get(key-%d) = %v, want %v", i, err, ErrKeyNotFound)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+)
+
+// keyOrder tracks how recently each key was used so the least recently used
+// can be evicted once MaxKeys is exceeded, or spilled once IndexBudget is.
+// It has its own lock because reads update it while holding only the
+// database read lock. A nil keyOrder is valid and tracks nothing.
+type keyOrder struct {
+	mu    sync.Mutex
+	order *list.List // Most recently used at the front; elements hold keys
+	items map[string]*list.Element
+}
+
+// keyOrderOverhead approximates what a keyOrder costs per key: a list
+// element and an entry in its map, which shares the key's bytes with the
+// index
+const keyOrderOverhead = 96
+
+// newKeyOrder returns a keyOrder holding the keys of data, or nil when opts
+// neither limit the keys nor budget the index. Nothing records reads across
+// restarts, so keys start out ordered by where they were last written,
+// oldest first out.
+func newKeyOrder(opts Options, data map[string]location) *keyOrder {
+	if opts.MaxKeys == 0 && opts.IndexBudget == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := data[keys[i]], data[keys[j]]
+		if a.Segment != b.Segment {
+			return a.Segment < b.Segment
+		}
+		return a.Offset < b.Offset
+	})
+
+	o := &keyOrder{order: list.New(), items: make(map[string]*list.Element, len(keys))}
+	for _, key := range keys {
+		o.items[key] = o.order.PushFront(key)
+	}
+	return o
+}
+
+// use marks key as the most recently used if it is tracked. Keys spilled
+// out of memory aren't, so reading one doesn't bring it back.
+func (o *keyOrder) use(key string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if elem, ok := o.items[key]; ok {
+		o.order.MoveToFront(elem)
+	}
+}
+
+// add marks key as the most recently used, tracking it if it wasn't
+func (o *keyOrder) add(key string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if elem, ok := o.items[key]; ok {
+		o.order.MoveToFront(elem)
+		return
+	}
+	o.items[key] = o.order.PushFront(key)
+}
+
+// remove stops tracking key
+func (o *keyOrder) remove(key string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if elem, ok := o.items[key]; ok {
+		o.order.Remove(elem)
+		delete(o.items, key)
+	}
+}
+
+// oldest returns the least recently used key
+func (o *keyOrder) oldest() (string, bool) {
+	if o == nil {
+		return "", false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	elem := o.order.Back()
+	if elem == nil {
+		return "", false
+	}
+	return elem.Value.(string), true
+}
+
+// evict deletes least recently used keys with tombstones until no more than
+// MaxKeys are indexed. A failure is logged and reported by Health, since the
+// write that triggered it has already succeeded. Callers must hold the
+// write lock.
+func (db *SimpleDB) evict() {
+	for db.opts.MaxKeys > 0 && len(db.data) > db.opts.MaxKeys {
+		key, ok := db.lru.oldest()
+		if !ok {
+			return
+		}
+		// Compaction drops expired keys without telling the order
+		if _, exists := db.data[key]; !exists {
+			db.lru.remove(key)
+			continue
+		}
+		if err := db.del(key); err != nil {
+			db.opts.Logger.Error("eviction failed", "path", db.path, "key", key, "err", err)
+			db.backgroundErr = err
+			return
+		}
+		db.evicted++
+	}
+}
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMaxKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		ops         func(t *testing.T, db *SimpleDB) // Runs with MaxKeys of 3 and a, b and c written in order
+		want        []string                         // Keys left
+		wantEvicted int64
+	}{
+		{
+			name: "under the cap",
+			ops:  func(t *testing.T, db *SimpleDB) {},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name:        "oldest written goes",
+			ops:         func(t *testing.T, db *SimpleDB) { mustSet(t, db, "d", "v") },
+			want:        []string{"b", "c", "d"},
+			wantEvicted: 1,
+		},
+		{
+			name: "read keeps a key",
+			ops: func(t *testing.T, db *SimpleDB) {
+				wantValue(t, db, "a", "v")
+				mustSet(t, db, "d", "v")
+			},
+			want:        []string{"a", "c", "d"},
+			wantEvicted: 1,
+		},
+		{
+			name: "overwrite keeps a key",
+			ops: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "a", "w")
+				mustSet(t, db, "d", "v")
+			},
+			want:        []string{"a", "c", "d"},
+			wantEvicted: 1,
+		},
+		{
+			name: "scan is not use",
+			ops: func(t *testing.T, db *SimpleDB) {
+				if _, err := db.ScanPrefix(""); err != nil {
+					t.Fatal(err)
+				}
+				mustSet(t, db, "d", "v")
+			},
+			want:        []string{"b", "c", "d"},
+			wantEvicted: 1,
+		},
+		{
+			name: "delete frees a slot",
+			ops: func(t *testing.T, db *SimpleDB) {
+				if err := db.Delete("b"); err != nil {
+					t.Fatal(err)
+				}
+				mustSet(t, db, "d", "v")
+			},
+			want: []string{"a", "c", "d"},
+		},
+		{
+			name: "several over",
+			ops: func(t *testing.T, db *SimpleDB) {
+				wantValue(t, db, "b", "v")
+				if err := db.BatchSet([]KVPair{{Key: "d", Value: "v"}, {Key: "e", Value: "v"}}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want:        []string{"b", "d", "e"},
+			wantEvicted: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{MaxKeys: 3})
+			for _, key := range []string{"a", "b", "c"} {
+				mustSet(t, db, key, "v")
+			}
+
+			tt.ops(t, db)
+			if got := db.Keys(); !slices.Equal(got, tt.want) {
+				t.Fatalf("Keys() = %v, want %v", got, tt.want)
+			}
+			stats, err := db.Stats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Evicted != tt.wantEvicted {
+				t.Fatalf("Evicted = %d, want %d", stats.Evicted, tt.wantEvicted)
+			}
+
+			// Evictions are tombstoned, so they stay gone
+			db.Close()
+			db = reopenTestDB(t, path, Options{})
+			if got := db.Keys(); !slices.Equal(got, tt.want) {
+				t.Fatalf("Keys() = %v after reopening, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxKeysAfterReopen(t *testing.T) {
+	db, path := openTestDB(t, Options{MaxKeys: 3})
+	for _, key := range []string{"c", "a", "b"} {
+		mustSet(t, db, key, "v")
+	}
+	// Use doesn't survive a reopen, so this doesn't save c
+	wantValue(t, db, "c", "v")
+	db.Close()
+
+	db = reopenTestDB(t, path, Options{MaxKeys: 3})
+	mustSet(t, db, "d", "v")
+	if got := db.Keys(); !slices.Equal(got, []string{"a", "b", "d"}) {
+		t.Fatalf("Keys() = %v, want the oldest written evicted", got)
+	}
+}
+
+func TestMaxKeysNotifiesWatchers(t *testing.T) {
+	db, _ := openTestDB(t, Options{MaxKeys: 1})
+	mustSet(t, db, "a", "v")
+	events, cancel := db.Watch("a")
+	defer cancel()
+
+	mustSet(t, db, "b", "v")
+	if event := nextEvent(t, events); event.Type != EventDelete || event.Key != "a" {
+		t.Fatalf("event %+v, want a deleted", event)
+	}
+}
+
+func TestKeyOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		ops        func(o *keyOrder)
+		wantOldest string // Empty when nothing is tracked
+	}{
+		{name: "empty", ops: func(o *keyOrder) {}},
+		{name: "first added", ops: func(o *keyOrder) { o.add("a"); o.add("b") }, wantOldest: "a"},
+		{name: "used", ops: func(o *keyOrder) { o.add("a"); o.add("b"); o.use("a") }, wantOldest: "b"},
+		{name: "added again", ops: func(o *keyOrder) { o.add("a"); o.add("b"); o.add("a") }, wantOldest: "b"},
+		{name: "removed", ops: func(o *keyOrder) { o.add("a"); o.add("b"); o.remove("a") }, wantOldest: "b"},
+		{name: "untracked use", ops: func(o *keyOrder) { o.use("a") }},
+		{name: "all removed", ops: func(o *keyOrder) { o.add("a"); o.remove("a") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newKeyOrder(Options{MaxKeys: 10}, nil)
+			tt.ops(o)
+			oldest, ok := o.oldest()
+			if oldest != tt.wantOldest || ok != (tt.wantOldest != "") {
+				t.Fatalf("oldest() = %q, %v, want %q", oldest, ok, tt.wantOldest)
+			}
+		})
+	}
+}
+
+func TestNilKeyOrder(t *testing.T) {
+	o := newKeyOrder(Options{}, map[string]location{"a": {}})
+	if o != nil {
+		t.Fatal("keyOrder made without MaxKeys or IndexBudget")
+	}
+	o.add("a")
+	o.use("a")
+	o.remove("a")
+	if key, ok := o.oldest(); ok {
+		t.Fatalf("oldest() = %q on a nil keyOrder", key)
+	}
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// importBatchSize is how many imported pairs are written per BatchSet call
+const importBatchSize = 1000
+
+// ExportJSON writes every live pair to w as a JSON array of {"key", "value"}
+// objects, in ascending key order
+func (db *SimpleDB) ExportJSON(w io.Writer) error {
+	it, err := db.NewIterator()
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for first := true; it.Next(); first = false {
+		value, err := it.Value()
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(KVPair{Key: it.Key(), Value: value})
+		if err != nil {
+			return err
+		}
+		if !first {
+			data = append([]byte(","), data...)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, "]\n")
+	return err
+}
+
+// ExportCSV writes every live pair to w as CSV with a key,value header row,
+// in ascending key order. Fields containing commas, quotes or newlines are
+// quoted. CSV readers, ImportCSV included, read a \r\n inside a field back
+// as \n, so use ExportJSON for values that must round-trip exactly.
+func (db *SimpleDB) ExportCSV(w io.Writer) error {
+	it, err := db.NewIterator()
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"key", "value"}); err != nil {
+		return err
+	}
+	for it.Next() {
+		value, err := it.Value()
+		if err != nil {
+			return err
+		}
+		if err := cw.Write([]string{it.Key(), value}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ImportJSON reads a JSON array in the format written by ExportJSON and sets
+// every pair, returning how many were imported
+func (db *SimpleDB) ImportJSON(r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil {
+		return 0, err
+	} else if tok != json.Delim('[') {
+		return 0, errors.New("expected a JSON array")
+	}
+
+	imported := 0
+	batch := make([]KVPair, 0, importBatchSize)
+	for dec.More() {
+		var pair KVPair
+		if err := dec.Decode(&pair); err != nil {
+			return imported, err
+		}
+		batch = append(batch, pair)
+		if len(batch) == importBatchSize {
+			if err := db.BatchSet(batch); err != nil {
+				return imported, err
+			}
+			imported += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return imported, err
+	}
+
+	if err := db.BatchSet(batch); err != nil {
+		return imported, err
+	}
+	return imported + len(batch), nil
+}
+
+// ImportCSV reads CSV in the format written by ExportCSV and sets every
+// pair, returning how many were imported. The key,value header row is
+// optional.
+func (db *SimpleDB) ImportCSV(r io.Reader) (int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+
+	imported := 0
+	batch := make([]KVPair, 0, importBatchSize)
+	for first := true; ; first = false {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return imported, err
+		}
+		if first && row[0] == "key" && row[1] == "value" {
+			continue
+		}
+
+		batch = append(batch, KVPair{Key: row[0], Value: row[1]})
+		if len(batch) == importBatchSize {
+			if err := db.BatchSet(batch); err != nil {
+				return imported, err
+			}
+			imported += len(batch)
+			batch = batch[:0]
+		}
+	}
+
+	if err := db.BatchSet(batch); err != nil {
+		return imported, err
+	}
+	return imported + len(batch), nil
+}
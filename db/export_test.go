@@ -0,0 +1,105 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	formats := []struct {
+		name       string
+		exportFunc func(db *SimpleDB, w io.Writer) error
+		importFunc func(db *SimpleDB, r io.Reader) (int, error)
+	}{
+		{name: "json", exportFunc: (*SimpleDB).ExportJSON, importFunc: (*SimpleDB).ImportJSON},
+		{name: "csv", exportFunc: (*SimpleDB).ExportCSV, importFunc: (*SimpleDB).ImportCSV},
+	}
+	tests := []struct {
+		name string
+		data map[string]string
+	}{
+		{name: "empty", data: map[string]string{}},
+		{name: "plain", data: map[string]string{"a": "one", "b": "two"}},
+		{name: "commas", data: map[string]string{"a,b": "1,2,3"}},
+		{name: "quotes and newlines", data: map[string]string{`say "hi"`: "line one\nline two\n", "x": `"`}},
+		{name: "empty value and unicode", data: map[string]string{"empty": "", "ключ": "значение ✓"}},
+		{name: "more than a batch", data: manyPairs(importBatchSize + 5)},
+	}
+
+	for _, format := range formats {
+		for _, tt := range tests {
+			t.Run(format.name+"/"+tt.name, func(t *testing.T) {
+				src, _ := openTestDB(t, Options{})
+				for key, value := range tt.data {
+					mustSet(t, src, key, value)
+				}
+				var buf bytes.Buffer
+				if err := format.exportFunc(src, &buf); err != nil {
+					t.Fatal(err)
+				}
+
+				dst, _ := openTestDB(t, Options{})
+				imported, err := format.importFunc(dst, &buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if imported != len(tt.data) {
+					t.Fatalf("imported %d, want %d", imported, len(tt.data))
+				}
+				if got := contents(t, dst); !maps.Equal(got, tt.data) {
+					t.Fatalf("imported %v, want %v", got, tt.data)
+				}
+			})
+		}
+	}
+}
+
+// manyPairs returns n distinct pairs
+func manyPairs(n int) map[string]string {
+	pairs := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		pairs[fmt.Sprintf("key-%04d", i)] = fmt.Sprint(i)
+	}
+	return pairs
+}
+
+func TestExportCSVQuoting(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	mustSet(t, db, "a", "1,2")
+	mustSet(t, db, "b", "plain")
+
+	var buf bytes.Buffer
+	if err := db.ExportCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := "key,value\na,\"1,2\"\nb,plain\n"; buf.String() != want {
+		t.Fatalf("ExportCSV() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		importFunc func(db *SimpleDB, r io.Reader) (int, error)
+		input      string
+	}{
+		{name: "json object", importFunc: (*SimpleDB).ImportJSON, input: `{"key":"a","value":"b"}`},
+		{name: "json cut short", importFunc: (*SimpleDB).ImportJSON, input: `[{"key":"a","value":"b"},`},
+		{name: "json wrong types", importFunc: (*SimpleDB).ImportJSON, input: `[{"key":1}]`},
+		{name: "csv wrong field count", importFunc: (*SimpleDB).ImportCSV, input: "key,value\na,b,c\n"},
+		{name: "csv bad quoting", importFunc: (*SimpleDB).ImportCSV, input: "a,\"b\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			if _, err := tt.importFunc(db, strings.NewReader(tt.input)); err == nil {
+				t.Fatal("import succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotObject is returned by SetField and GetField when the value, or a
+// field on the way to the one asked for, isn't a JSON object
+var ErrNotObject = errors.New("value is not a JSON object")
+
+// ErrInvalidJSON is returned by SetField when the new field value isn't
+// valid JSON
+var ErrInvalidJSON = errors.New("invalid JSON")
+
+// GetField returns the JSON text of the field at jsonPath, a dot-separated
+// path such as "user.email", within the JSON object stored at key. A
+// missing key or field is reported as ErrKeyNotFound.
+func (db *SimpleDB) GetField(key, jsonPath string) (string, error) {
+	key = db.normalize(key)
+	if jsonPath == "" {
+		return "", errors.New("field path must not be empty")
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return "", ErrClosed
+	}
+
+	current, exists, err := db.lookup(key)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", ErrKeyNotFound
+	}
+	object, err := decodeObject(current)
+	if err != nil {
+		return "", err
+	}
+
+	names := strings.Split(jsonPath, ".")
+	for _, name := range names[:len(names)-1] {
+		object, err = childObject(object, name, false)
+		if err != nil {
+			return "", err
+		}
+	}
+	field, ok := object[names[len(names)-1]]
+	if !ok {
+		return "", fmt.Errorf("%w: no field %q", ErrKeyNotFound, jsonPath)
+	}
+
+	raw, err := json.Marshal(field)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// SetField atomically sets the field at jsonPath within the JSON object
+// stored at key to value, which must be JSON text such as `"bob"` or `42`.
+// A missing key starts out as an empty object, and missing objects along
+// the path are created. As with Update, the key is rewritten without a TTL.
+func (db *SimpleDB) SetField(key, jsonPath, value string) error {
+	key = db.normalize(key)
+	if jsonPath == "" {
+		return errors.New("field path must not be empty")
+	}
+	var field any
+	if err := decodeJSON([]byte(value), &field); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	current, exists, err := db.lookup(key)
+	if err != nil {
+		return err
+	}
+	root := map[string]any{}
+	if exists {
+		root, err = decodeObject(current)
+		if err != nil {
+			return err
+		}
+	}
+
+	object := root
+	names := strings.Split(jsonPath, ".")
+	for _, name := range names[:len(names)-1] {
+		object, err = childObject(object, name, true)
+		if err != nil {
+			return err
+		}
+	}
+	object[names[len(names)-1]] = field
+
+	updated, err := json.Marshal(root)
+	if err != nil {
+		return err
+	}
+	return db.set(key, updated)
+}
+
+// decodeJSON decodes data into v, keeping numbers as json.Number so they
+// are written back exactly as they were
+func decodeJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("trailing data after JSON value")
+	}
+	return nil
+}
+
+// decodeObject decodes a stored value that must be a JSON object
+func decodeObject(value []byte) (map[string]any, error) {
+	var object map[string]any
+	if err := decodeJSON(value, &object); err != nil || object == nil {
+		return nil, ErrNotObject
+	}
+	return object, nil
+}
+
+// childObject returns the object in field name of object. A missing field
+// is ErrKeyNotFound, or with create set becomes a new empty object.
+func childObject(object map[string]any, name string, create bool) (map[string]any, error) {
+	field, ok := object[name]
+	if !ok {
+		if !create {
+			return nil, fmt.Errorf("%w: no field %q", ErrKeyNotFound, name)
+		}
+		child := map[string]any{}
+		object[name] = child
+		return child, nil
+	}
+
+	child, ok := field.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: field %q", ErrNotObject, name)
+	}
+	return child, nil
+}
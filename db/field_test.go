@@ -0,0 +1,121 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSetField(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial string // Value stored at the key first, none if empty
+		path    string
+		value   string
+		want    string // The stored value afterwards
+		wantErr error
+	}{
+		{name: "absent key", path: "email", value: `"bob@example.com"`, want: `{"email":"bob@example.com"}`},
+		{name: "absent key nested", path: "user.email", value: `"bob@example.com"`, want: `{"user":{"email":"bob@example.com"}}`},
+		{name: "new field", initial: `{"name":"bob"}`, path: "age", value: `42`, want: `{"age":42,"name":"bob"}`},
+		{name: "overwrite", initial: `{"name":"bob"}`, path: "name", value: `"alice"`, want: `{"name":"alice"}`},
+		{name: "nested overwrite", initial: `{"user":{"email":"a@x","name":"bob"}}`, path: "user.email", value: `"b@x"`, want: `{"user":{"email":"b@x","name":"bob"}}`},
+		{name: "creates objects on the way", initial: `{"a":{}}`, path: "a.b.c", value: `true`, want: `{"a":{"b":{"c":true}}}`},
+		{name: "object value", initial: `{}`, path: "tags", value: `{"x":[1,2]}`, want: `{"tags":{"x":[1,2]}}`},
+		{name: "number kept exactly", initial: `{"big":12345678901234567890}`, path: "small", value: `1.50`, want: `{"big":12345678901234567890,"small":1.50}`},
+		{name: "invalid value", initial: `{}`, path: "a", value: `{`, want: `{}`, wantErr: ErrInvalidJSON},
+		{name: "trailing data", initial: `{}`, path: "a", value: `1 2`, want: `{}`, wantErr: ErrInvalidJSON},
+		{name: "value not an object", initial: `[1]`, path: "a", value: `1`, want: `[1]`, wantErr: ErrNotObject},
+		{name: "value not JSON", initial: `text`, path: "a", value: `1`, want: `text`, wantErr: ErrNotObject},
+		{name: "field on the way not an object", initial: `{"a":1}`, path: "a.b", value: `1`, want: `{"a":1}`, wantErr: ErrNotObject},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			if tt.initial != "" {
+				mustSet(t, db, "k", tt.initial)
+			}
+
+			err := db.SetField("k", tt.path, tt.value)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SetField(%q, %q) = %v, want %v", tt.path, tt.value, err, tt.wantErr)
+			}
+			if tt.initial == "" && tt.wantErr != nil {
+				wantMissing(t, db, "k")
+				return
+			}
+			wantValue(t, db, "k", tt.want)
+
+			db.Close()
+			wantValue(t, reopenTestDB(t, path, Options{}), "k", tt.want)
+		})
+	}
+}
+
+func TestSetFieldEmptyPath(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	if err := db.SetField("k", "", `1`); err == nil {
+		t.Fatal("SetField with an empty path succeeded")
+	}
+	wantMissing(t, db, "k")
+}
+
+func TestSetFieldClearsTTL(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	if err := db.SetWithTTL("k", `{}`, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetField("k", "a", `1`); err != nil {
+		t.Fatal(err)
+	}
+	if _, ttl, err := db.GetWithTTL("k"); err != nil || ttl != 0 {
+		t.Fatalf("GetWithTTL = %v, %v, want no TTL", ttl, err)
+	}
+}
+
+func TestGetField(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial string // Value stored at the key, none if empty
+		path    string
+		want    string
+		wantErr error
+	}{
+		{name: "string", initial: `{"name":"bob"}`, path: "name", want: `"bob"`},
+		{name: "nested", initial: `{"user":{"email":"b@x"}}`, path: "user.email", want: `"b@x"`},
+		{name: "object", initial: `{"user":{"age":42}}`, path: "user", want: `{"age":42}`},
+		{name: "number kept exactly", initial: `{"n":1.50}`, path: "n", want: `1.50`},
+		{name: "null", initial: `{"n":null}`, path: "n", want: `null`},
+		{name: "missing key", path: "a", wantErr: ErrKeyNotFound},
+		{name: "missing field", initial: `{}`, path: "a", wantErr: ErrKeyNotFound},
+		{name: "missing field on the way", initial: `{}`, path: "a.b", wantErr: ErrKeyNotFound},
+		{name: "value not an object", initial: `"text"`, path: "a", wantErr: ErrNotObject},
+		{name: "field on the way not an object", initial: `{"a":[1]}`, path: "a.b", wantErr: ErrNotObject},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			if tt.initial != "" {
+				mustSet(t, db, "k", tt.initial)
+			}
+
+			got, err := db.GetField("k", tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetField(%q) = %q, %v, want %v", tt.path, got, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("GetField(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetFieldEmptyPath(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	mustSet(t, db, "k", `{}`)
+	if _, err := db.GetField("k", ""); err == nil {
+		t.Fatal("GetField with an empty path succeeded")
+	}
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"os"
+	"time"
+)
+
+// flushBufferSize is how many bytes Options.FlushInterval lets pile up in
+// memory before writing them out regardless of the interval
+const flushBufferSize = 64 << 10
+
+// writeBuffered adds buf to the write buffer, which writes it out by itself
+// once full, and flushes and fsyncs if sync is set. Callers must hold the
+// write lock.
+func (db *SimpleDB) writeBuffered(buf []byte, sync bool) error {
+	db.flushMu.Lock()
+	defer db.flushMu.Unlock()
+
+	if _, err := db.writer.Write(buf); err != nil {
+		return err
+	}
+	if !sync {
+		return nil
+	}
+	if err := db.writer.Flush(); err != nil {
+		return err
+	}
+	return db.file.Sync()
+}
+
+// flushWrites writes out everything buffered by Options.FlushInterval. Only
+// writers holding the write lock add to the buffer, so holding the read lock
+// or no lock at all is enough to call it.
+func (db *SimpleDB) flushWrites() error {
+	if db.writer == nil {
+		return nil
+	}
+
+	db.flushMu.Lock()
+	defer db.flushMu.Unlock()
+
+	return db.writer.Flush()
+}
+
+// flushFor writes out the buffer if the record at loc is still in it, so it
+// can be read back from the file. Callers must hold at least the read lock.
+func (db *SimpleDB) flushFor(loc location) error {
+	if db.writer == nil || loc.Segment != db.segment {
+		return nil
+	}
+
+	db.flushMu.Lock()
+	defer db.flushMu.Unlock()
+
+	if loc.Offset+loc.Size <= db.segmentSize-int64(db.writer.Buffered()) {
+		return nil
+	}
+	return db.writer.Flush()
+}
+
+// resetWriter points the write buffer at file, dropping anything still in
+// it. Callers must hold the write lock.
+func (db *SimpleDB) resetWriter(file *os.File) {
+	if db.writer == nil {
+		return
+	}
+
+	db.flushMu.Lock()
+	defer db.flushMu.Unlock()
+
+	db.writer.Reset(file)
+}
+
+// buffered returns how many bytes are waiting in the write buffer
+func (db *SimpleDB) buffered() int64 {
+	if db.writer == nil {
+		return 0
+	}
+
+	db.flushMu.Lock()
+	defer db.flushMu.Unlock()
+
+	return int64(db.writer.Buffered())
+}
+
+// flushLoop writes out the write buffer every Options.FlushInterval until
+// the database closes; Close flushes whatever is left
+func (db *SimpleDB) flushLoop() {
+	defer db.background.Done()
+
+	ticker := time.NewTicker(db.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.stop:
+			return
+		case <-ticker.C:
+			err := db.flushWrites()
+			if err != nil {
+				db.opts.Logger.Error("flushing buffered writes failed", "path", db.path, "err", err)
+			}
+			db.mu.Lock()
+			db.backgroundErr = err
+			db.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// onDisk returns the size of the file at path
+func onDisk(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestFlushInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		value    string
+		flush    func(t *testing.T, db *SimpleDB) // Gets the buffer written out
+	}{
+		{
+			name:     "interval passes",
+			interval: 20 * time.Millisecond,
+			value:    "small",
+			flush:    func(*testing.T, *SimpleDB) {},
+		},
+		{
+			name:     "flush",
+			interval: time.Hour,
+			value:    "small",
+			flush: func(t *testing.T, db *SimpleDB) {
+				if err := db.Flush(); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name:     "close",
+			interval: time.Hour,
+			value:    "small",
+			flush: func(t *testing.T, db *SimpleDB) {
+				if err := db.Close(); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name:     "buffer fills",
+			interval: time.Hour,
+			value:    strings.Repeat("v", flushBufferSize),
+			flush:    func(*testing.T, *SimpleDB) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{FlushInterval: tt.interval})
+			mustSet(t, db, "small", "value")
+			stats, err := db.Stats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Buffered == 0 || onDisk(t, path) != 0 {
+				t.Fatalf("Buffered = %d with %d bytes on disk, want it all buffered", stats.Buffered, onDisk(t, path))
+			}
+			// Buffered writes can be read back straight away, which writes
+			// them out
+			wantValue(t, db, "small", "value")
+			if onDisk(t, path) == 0 {
+				t.Fatal("reading a buffered record left it buffered")
+			}
+
+			mustSet(t, db, "k", tt.value)
+			stats, err = db.Stats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			size := stats.FileSize + stats.Buffered
+			tt.flush(t, db)
+
+			deadline := time.Now().Add(5 * time.Second)
+			for onDisk(t, path) != size {
+				if time.Now().After(deadline) {
+					t.Fatalf("%d of %d bytes on disk", onDisk(t, path), size)
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	errDisk := errors.New("disk full")
+	tests := []struct {
+		name    string
+		fail    func(db *SimpleDB) // Records a failure under the write lock
+		recover func(t *testing.T, db *SimpleDB)
+		wantErr error
+	}{
+		{name: "healthy", fail: func(*SimpleDB) {}},
+		{
+			name:    "write failed",
+			fail:    func(db *SimpleDB) { db.writeFailed(errDisk) },
+			wantErr: errDisk,
+		},
+		{
+			name: "write failed then succeeded",
+			fail: func(db *SimpleDB) { db.writeFailed(errDisk) },
+			recover: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "b", "two")
+			},
+		},
+		{
+			name:    "background job failed",
+			fail:    func(db *SimpleDB) { db.backgroundErr = errDisk },
+			wantErr: errDisk,
+		},
+		{
+			name: "closed",
+			fail: func(*SimpleDB) {},
+			recover: func(t *testing.T, db *SimpleDB) {
+				if err := db.Close(); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: ErrClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			mustSet(t, db, "a", "one")
+			db.mu.Lock()
+			tt.fail(db)
+			db.mu.Unlock()
+			if tt.recover != nil {
+				tt.recover(t, db)
+			}
+
+			err := db.Health()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Health() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		close   bool
+		wantErr error
+	}{
+		{name: "default"},
+		{name: "encrypted", opts: Options{EncryptionKey: make([]byte, 32)}},
+		{name: "compressed", opts: Options{Compression: CompressionGzip, CompressMinSize: 1}},
+		{name: "closed", close: true, wantErr: ErrClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, tt.opts)
+			mustSet(t, db, "a", "one")
+			if tt.close {
+				if err := db.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := db.Ping(); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Ping() = %v, want %v", err, tt.wantErr)
+			}
+			if tt.close {
+				return
+			}
+			// The ping record is never a key
+			if got := db.Len(); got != 1 {
+				t.Fatalf("Len() = %d, want 1", got)
+			}
+			if db.Exists(pingKey) {
+				t.Fatal("the ping key exists")
+			}
+		})
+	}
+}
+
+func TestPingUnwritable(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "direct writes"},
+		{name: "buffered writes", opts: Options{FlushInterval: time.Hour}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, tt.opts)
+			mustSet(t, db, "a", "one")
+
+			// Swap in a handle that can't be written, as if the file had
+			// been made read-only
+			readOnly, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			db.mu.Lock()
+			writable := db.file
+			db.file = readOnly
+			db.resetWriter(readOnly)
+			db.mu.Unlock()
+			defer func() {
+				db.mu.Lock()
+				db.file = writable
+				db.resetWriter(writable)
+				db.mu.Unlock()
+				readOnly.Close()
+			}()
+
+			if err := db.Ping(); err == nil {
+				t.Fatal("Ping() succeeded on an unwritable file")
+			}
+			if err := db.Health(); err == nil {
+				t.Fatal("Health() doesn't report the failed write")
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"crypto/cipher"
+	"os"
+	"sort"
+)
+
+// Iterator walks the keys of a database in sorted order, reading values
+// lazily. It sees the database as it was when the iterator was created;
+// later writes, deletes and compactions do not affect it.
+type Iterator struct {
+	keys     []string
+	locs     map[string]location
+	expires  map[string]int64
+	files    map[int]*os.File // Own handles so a compaction swapping files can't invalidate locations
+	codec    Codec
+	aead     cipher.AEAD
+	pos      int
+	position Position // Where the log ended when the iterator was created
+}
+
+// NewIterator returns an iterator over a snapshot of all live keys.
+// The caller must Close it when done.
+func (db *SimpleDB) NewIterator() (*Iterator, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	all, err := db.indexed()
+	if err != nil {
+		return nil, err
+	}
+	files, err := db.openSegments()
+	if err != nil {
+		return nil, err
+	}
+
+	it := &Iterator{
+		keys:     make([]string, 0, len(all)),
+		locs:     make(map[string]location, len(all)),
+		expires:  make(map[string]int64),
+		files:    files,
+		codec:    db.opts.Codec,
+		aead:     db.aead,
+		pos:      -1,
+		position: Position{Generation: db.generation, Segment: db.segment, Offset: db.segmentSize},
+	}
+	for key, loc := range all {
+		if db.expired(key) {
+			continue
+		}
+		it.keys = append(it.keys, key)
+		it.locs[key] = loc
+		if expiresAt, ok := db.expires[key]; ok {
+			it.expires[key] = expiresAt
+		}
+	}
+	sort.Strings(it.keys)
+
+	return it, nil
+}
+
+// Next advances to the next key, returning false once all keys are consumed
+func (it *Iterator) Next() bool {
+	if it.pos < len(it.keys) {
+		it.pos++
+	}
+	return it.pos < len(it.keys)
+}
+
+// Key returns the current key
+func (it *Iterator) Key() string {
+	return it.keys[it.pos]
+}
+
+// Value reads the value of the current key from disk
+func (it *Iterator) Value() (string, error) {
+	loc := it.locs[it.Key()]
+	value, err := readValueAt(it.codec, it.aead, it.files[loc.Segment], loc)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// entry reads the raw entry of the current key, with the expiry it had when
+// the iterator was created
+func (it *Iterator) entry() (Record, error) {
+	loc := it.locs[it.Key()]
+	entry, err := readEntryAt(it.codec, it.files[loc.Segment], loc)
+	if err != nil {
+		return Record{}, err
+	}
+	entry.ExpiresAt = it.expires[it.Key()]
+	return entry, nil
+}
+
+// Close releases the iterator's file handles
+func (it *Iterator) Close() error {
+	return closeSegments(it.files)
+}
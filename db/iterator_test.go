@@ -0,0 +1,86 @@
+package db
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestIterator(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, db *SimpleDB) // Runs after the iterator is created
+	}{
+		{name: "unchanged", change: func(t *testing.T, db *SimpleDB) {}},
+		{name: "new key", change: func(t *testing.T, db *SimpleDB) { mustSet(t, db, "aa", "new") }},
+		{name: "overwrite", change: func(t *testing.T, db *SimpleDB) { mustSet(t, db, "b", "changed") }},
+		{
+			name: "delete",
+			change: func(t *testing.T, db *SimpleDB) {
+				if err := db.Delete("c"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "compaction",
+			change: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "b", "changed")
+				if err := db.Delete("a"); err != nil {
+					t.Fatal(err)
+				}
+				if err := db.Compact(); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	want := map[string]string{"a": "one", "b": "two", "c": "three"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			for _, key := range []string{"c", "a", "b"} {
+				mustSet(t, db, key, want[key])
+			}
+			it, err := db.NewIterator()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer it.Close()
+			tt.change(t, db)
+
+			got := make(map[string]string)
+			var keys []string
+			for it.Next() {
+				value, err := it.Value()
+				if err != nil {
+					t.Fatal(err)
+				}
+				keys = append(keys, it.Key())
+				got[it.Key()] = value
+			}
+			if !slices.IsSorted(keys) {
+				t.Fatalf("keys out of order: %v", keys)
+			}
+			if !maps.Equal(got, want) {
+				t.Fatalf("iterated %v, want %v", got, want)
+			}
+			if it.Next() {
+				t.Fatal("Next() after the end returned true")
+			}
+		})
+	}
+}
+
+func TestIteratorEmpty(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	it, err := db.NewIterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	if it.Next() {
+		t.Fatalf("Next() on an empty database returned key %q", it.Key())
+	}
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// legacySuffix is appended to the database path for a file in the original
+// line-based format while its keys are moved into a new log
+const legacySuffix = ".legacy"
+
+// errLegacyReadOnly is returned when a read-only open finds a file in the
+// original format, which only a writable open can migrate
+var errLegacyReadOnly = errors.New("database is in the original line-based format; open it writable once to migrate it")
+
+// legacyRecord is one line of the original format, which held a JSON
+// object per line with the value as a plain string
+type legacyRecord struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// isLegacy reports whether the file at path is in the original line-based
+// format. A framed log starts with '{' too when its first record happens to
+// be that long, but what follows is then no JSON object with a key.
+func isLegacy(path string) (bool, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if first, err := r.Peek(1); err != nil || first[0] != '{' {
+		return false, nil
+	}
+	var entry legacyRecord
+	return json.NewDecoder(r).Decode(&entry) == nil && entry.Key != "", nil
+}
+
+// prepareLegacy moves a database file still in the original format aside,
+// for importLegacy to load once the new log is open, and reports whether
+// there is one to load. A file left aside by an interrupted migration is
+// picked up again and whatever that migration wrote is discarded; nothing
+// else can have written to it, since the open never finished.
+func prepareLegacy(path string) (bool, error) {
+	legacyPath := path + legacySuffix
+	if _, err := os.Stat(legacyPath); err == nil {
+		ids, err := listSegments(path)
+		if err != nil {
+			return false, err
+		}
+		for _, id := range ids {
+			if err := os.Remove(segmentPath(path, id)); err != nil {
+				return false, err
+			}
+		}
+		if err := os.Remove(path + indexSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+		return true, nil
+	}
+
+	legacy, err := isLegacy(path)
+	if err != nil || !legacy {
+		return false, err
+	}
+	if err := os.Rename(path, legacyPath); err != nil {
+		return false, err
+	}
+	return true, syncDir(filepath.Dir(path))
+}
+
+// importLegacy writes the live keys of a file in the original format to the
+// log in one batch, then removes the file
+func (db *SimpleDB) importLegacy(legacyPath string) error {
+	f, err := os.Open(legacyPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var entry legacyRecord
+		err := dec.Decode(&entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: migrating %s: %v", ErrCorrupt, legacyPath, err)
+		}
+		if entry.Deleted {
+			delete(values, entry.Key)
+		} else {
+			values[entry.Key] = entry.Value
+		}
+	}
+
+	pairs := make([]KVPair, 0, len(values))
+	for key, value := range values {
+		pairs = append(pairs, KVPair{Key: key, Value: value})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+	if len(pairs) > 0 {
+		if err := db.BatchSet(pairs); err != nil {
+			return err
+		}
+	}
+	if err := db.Flush(); err != nil {
+		return err
+	}
+
+	if err := os.Remove(legacyPath); err != nil {
+		return err
+	}
+	db.opts.Logger.Info("migrated database from the line-based format", "path", db.path, "keys", len(pairs))
+	return syncDir(filepath.Dir(db.path))
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// legacyData is a file in the original line-based format
+const legacyData = `{"key":"name","value":"Sandeep Singh"}
+{"key":"name","value":"Sandeep Singh"}
+{"key":"gone","value":"x"}
+{"key":"name","value":"Sandeep Singh (Updated)"}
+{"key":"gone","deleted":true}
+{"key":"city","value":"{\"not\": \"json\"}"}
+`
+
+func TestLegacyMigration(t *testing.T) {
+	tests := []struct {
+		name        string
+		interrupted bool // A previous migration stopped partway
+	}{
+		{"fresh", false},
+		{"interrupted", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir() + "/mydb.data"
+			if tt.interrupted {
+				if err := os.WriteFile(path+legacySuffix, []byte(legacyData), 0644); err != nil {
+					t.Fatal(err)
+				}
+				partial, err := encodeRecord(JSONCodec{}, Record{Key: "name", Value: []byte("half done")})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, partial, 0644); err != nil {
+					t.Fatal(err)
+				}
+			} else if err := os.WriteFile(path, []byte(legacyData), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			db := reopenTestDB(t, path, Options{})
+			check := func(db *SimpleDB) {
+				t.Helper()
+				wantValue(t, db, "name", "Sandeep Singh (Updated)")
+				wantValue(t, db, "city", `{"not": "json"}`)
+				wantMissing(t, db, "gone")
+				if n := db.Len(); n != 2 {
+					t.Fatalf("Len() = %d, want 2", n)
+				}
+			}
+			check(db)
+			if _, err := os.Stat(path + legacySuffix); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("legacy file left behind: %v", err)
+			}
+			if legacy, err := isLegacy(path); err != nil || legacy {
+				t.Fatalf("isLegacy after migration = %v, %v", legacy, err)
+			}
+
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			check(reopenTestDB(t, path, Options{}))
+		})
+	}
+}
+
+func TestLegacyReadOnly(t *testing.T) {
+	path := t.TempDir() + "/mydb.data"
+	if err := os.WriteFile(path, []byte(legacyData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenReadOnly(path); !errors.Is(err, errLegacyReadOnly) {
+		t.Fatalf("OpenReadOnly = %v, want errLegacyReadOnly", err)
+	}
+	// Nothing was touched
+	if data, err := os.ReadFile(path); err != nil || string(data) != legacyData {
+		t.Fatalf("file changed: %v", err)
+	}
+}
+
+func TestIsLegacy(t *testing.T) {
+	// A framed log whose first record is 123 bytes starts with '{'
+	var framed []byte
+	for n := 1; len(framed)-headerSize != '{'; n++ {
+		var err error
+		framed, err = encodeRecord(JSONCodec{}, Record{Key: strings.Repeat("k", n)})
+		if err != nil || len(framed)-headerSize > '{' {
+			t.Fatalf("no record of the right length: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want bool
+	}{
+		{"legacy", legacyData, true},
+		{"framed", string(framed), false},
+		{"empty", "", false},
+		{"braces", "{}\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir() + "/db"
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := isLegacy(path); err != nil || got != tt.want {
+				t.Fatalf("isLegacy = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ErrNotList is returned by the list operations when the value stored at
+// the key isn't a list, that is a JSON array of strings
+var ErrNotList = errors.New("value is not a list")
+
+// The list operations treat the value of a key as a list of strings, stored
+// as a JSON array, so a key can serve as a small queue or stack. Every
+// operation decodes the whole list and writes it back, which is fine for
+// lists of a few thousand short items but makes long lists expensive; each
+// is atomic, since it runs under the write lock. A missing key is an empty
+// list, popping the last item deletes the key, and like Update every write
+// clears any TTL.
+
+// LPush adds values to the head of the list at key, one after the other so
+// the last ends up first, and returns the new length
+func (db *SimpleDB) LPush(key string, values ...string) (int, error) {
+	return db.push(key, values, true)
+}
+
+// RPush adds values to the tail of the list at key, in order, and returns
+// the new length
+func (db *SimpleDB) RPush(key string, values ...string) (int, error) {
+	return db.push(key, values, false)
+}
+
+// LPop removes and returns the first item of the list at key, reporting
+// false if the list is empty
+func (db *SimpleDB) LPop(key string) (string, bool, error) {
+	return db.pop(key, true)
+}
+
+// RPop removes and returns the last item of the list at key, reporting
+// false if the list is empty
+func (db *SimpleDB) RPop(key string) (string, bool, error) {
+	return db.pop(key, false)
+}
+
+// LRange returns the items of the list at key from index start to stop,
+// both included. Negative indexes count from the end, so -1 is the last
+// item, and indexes past either end are clamped; a range with nothing in
+// it returns an empty slice.
+func (db *SimpleDB) LRange(key string, start, stop int) ([]string, error) {
+	key = db.normalize(key)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	list, err := db.lookupList(key)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(list)
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop += n
+	}
+	stop = min(stop, n-1)
+	if start > stop {
+		return []string{}, nil
+	}
+	return list[start : stop+1], nil
+}
+
+// push adds values to the head or tail of the list at key
+func (db *SimpleDB) push(key string, values []string, front bool) (int, error) {
+	key = db.normalize(key)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return 0, ErrClosed
+	}
+
+	list, err := db.lookupList(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(values) == 0 {
+		return len(list), nil
+	}
+
+	if front {
+		head := make([]string, 0, len(list)+len(values))
+		for i := len(values) - 1; i >= 0; i-- {
+			head = append(head, values[i])
+		}
+		list = append(head, list...)
+	} else {
+		list = append(list, values...)
+	}
+
+	if err := db.setList(key, list); err != nil {
+		return 0, err
+	}
+	return len(list), nil
+}
+
+// pop removes the first or last item of the list at key
+func (db *SimpleDB) pop(key string, front bool) (string, bool, error) {
+	key = db.normalize(key)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return "", false, ErrClosed
+	}
+
+	list, err := db.lookupList(key)
+	if err != nil {
+		return "", false, err
+	}
+	if len(list) == 0 {
+		return "", false, nil
+	}
+
+	var item string
+	if front {
+		item, list = list[0], list[1:]
+	} else {
+		item, list = list[len(list)-1], list[:len(list)-1]
+	}
+
+	if len(list) == 0 {
+		err = db.del(key)
+	} else {
+		err = db.setList(key, list)
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return item, true, nil
+}
+
+// lookupList returns the list stored at key, empty if the key is missing.
+// Callers must hold at least the read lock.
+func (db *SimpleDB) lookupList(key string) ([]string, error) {
+	value, exists, err := db.lookup(key)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	var list []string
+	if err := decodeJSON(value, &list); err != nil || list == nil {
+		return nil, ErrNotList
+	}
+	return list, nil
+}
+
+// setList stores list at key. Callers must hold the write lock.
+func (db *SimpleDB) setList(key string, list []string) error {
+	value, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return db.set(key, value)
+}
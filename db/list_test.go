@@ -0,0 +1,319 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mustPush pushes values onto the list at key, at the head if front
+func mustPush(t *testing.T, db *SimpleDB, key string, front bool, values ...string) {
+	t.Helper()
+	push := db.RPush
+	if front {
+		push = db.LPush
+	}
+	if _, err := push(key, values...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mustPop pops n items off the list at key, from the head if front
+func mustPop(t *testing.T, db *SimpleDB, key string, front bool, n int) []string {
+	t.Helper()
+	pop := db.RPop
+	if front {
+		pop = db.LPop
+	}
+	var items []string
+	for i := 0; i < n; i++ {
+		item, ok, err := pop(key)
+		if err != nil || !ok {
+			t.Fatalf("pop = %v, %v", ok, err)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func TestPushPop(t *testing.T) {
+	tests := []struct {
+		name       string
+		ops        func(t *testing.T, db *SimpleDB) []string // Runs against an empty database, returning what it popped
+		want       []string                                  // The list left at q; empty when the key should be gone
+		wantPopped []string
+	}{
+		{
+			name: "rpush keeps order",
+			ops: func(t *testing.T, db *SimpleDB) []string {
+				mustPush(t, db, "q", false, "a", "b")
+				mustPush(t, db, "q", false, "c")
+				return nil
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "lpush reverses",
+			ops: func(t *testing.T, db *SimpleDB) []string {
+				mustPush(t, db, "q", true, "a", "b")
+				mustPush(t, db, "q", true, "c")
+				return nil
+			},
+			want: []string{"c", "b", "a"},
+		},
+		{
+			name: "both ends",
+			ops: func(t *testing.T, db *SimpleDB) []string {
+				mustPush(t, db, "q", false, "b")
+				mustPush(t, db, "q", true, "a")
+				mustPush(t, db, "q", false, "c")
+				return nil
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "queue",
+			ops: func(t *testing.T, db *SimpleDB) []string {
+				mustPush(t, db, "q", false, "a", "b", "c")
+				return mustPop(t, db, "q", true, 2)
+			},
+			want:       []string{"c"},
+			wantPopped: []string{"a", "b"},
+		},
+		{
+			name: "stack",
+			ops: func(t *testing.T, db *SimpleDB) []string {
+				mustPush(t, db, "q", false, "a", "b", "c")
+				return mustPop(t, db, "q", false, 2)
+			},
+			want:       []string{"a"},
+			wantPopped: []string{"c", "b"},
+		},
+		{
+			name: "popping the last item deletes the key",
+			ops: func(t *testing.T, db *SimpleDB) []string {
+				mustPush(t, db, "q", false, "a")
+				return mustPop(t, db, "q", true, 1)
+			},
+			wantPopped: []string{"a"},
+		},
+		{
+			name: "push nothing",
+			ops: func(t *testing.T, db *SimpleDB) []string {
+				mustPush(t, db, "q", false)
+				return nil
+			},
+		},
+		{
+			name: "empty items",
+			ops: func(t *testing.T, db *SimpleDB) []string {
+				mustPush(t, db, "q", false, "", "")
+				return nil
+			},
+			want: []string{"", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			if popped := tt.ops(t, db); !slices.Equal(popped, tt.wantPopped) {
+				t.Fatalf("popped %q, want %q", popped, tt.wantPopped)
+			}
+
+			check := func(db *SimpleDB) {
+				t.Helper()
+				got, err := db.LRange("q", 0, -1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !slices.Equal(got, tt.want) && len(got)+len(tt.want) > 0 {
+					t.Fatalf("list %q, want %q", got, tt.want)
+				}
+				if exists := db.Exists("q"); exists != (len(tt.want) > 0) {
+					t.Fatalf("Exists() = %v, want %v", exists, len(tt.want) > 0)
+				}
+			}
+			check(db)
+			db.Close()
+			check(reopenTestDB(t, path, Options{}))
+		})
+	}
+}
+
+func TestPushLength(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	for i, push := range []func(string, ...string) (int, error){db.RPush, db.LPush, db.RPush} {
+		n, err := push("q", "a", "b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := 2 * (i + 1); n != want {
+			t.Fatalf("push %d returned length %d, want %d", i, n, want)
+		}
+	}
+}
+
+func TestPopEmpty(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	for _, pop := range []func(string) (string, bool, error){db.LPop, db.RPop} {
+		if item, ok, err := pop("missing"); err != nil || ok {
+			t.Fatalf("pop = %q, %v, %v, want nothing", item, ok, err)
+		}
+	}
+	wantMissing(t, db, "missing")
+}
+
+func TestLRange(t *testing.T) {
+	tests := []struct {
+		name        string
+		start, stop int
+		want        []string
+	}{
+		{name: "all", start: 0, stop: -1, want: []string{"a", "b", "c", "d", "e"}},
+		{name: "first", start: 0, stop: 0, want: []string{"a"}},
+		{name: "last", start: -1, stop: -1, want: []string{"e"}},
+		{name: "middle", start: 1, stop: 3, want: []string{"b", "c", "d"}},
+		{name: "from the end", start: -3, stop: -2, want: []string{"c", "d"}},
+		{name: "mixed signs", start: 1, stop: -2, want: []string{"b", "c", "d"}},
+		{name: "stop past the end", start: 3, stop: 100, want: []string{"d", "e"}},
+		{name: "start before the start", start: -100, stop: 1, want: []string{"a", "b"}},
+		{name: "both past the ends", start: -100, stop: 100, want: []string{"a", "b", "c", "d", "e"}},
+		{name: "start past the end", start: 5, stop: 10, want: []string{}},
+		{name: "stop before the start", start: 3, stop: 1, want: []string{}},
+		{name: "stop before the list", start: 0, stop: -6, want: []string{}},
+	}
+
+	db, _ := openTestDB(t, Options{})
+	mustPush(t, db, "q", false, "a", "b", "c", "d", "e")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.LRange("q", tt.start, tt.stop)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got == nil || !slices.Equal(got, tt.want) {
+				t.Fatalf("LRange(%d, %d) = %q, want %q", tt.start, tt.stop, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("missing key", func(t *testing.T) {
+		got, err := db.LRange("missing", 0, -1)
+		if err != nil || got == nil || len(got) != 0 {
+			t.Fatalf("LRange() = %q, %v, want an empty list", got, err)
+		}
+	})
+}
+
+func TestListNotAList(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "text", value: "plain"},
+		{name: "object", value: `{"a":1}`},
+		{name: "numbers", value: `[1,2]`},
+		{name: "null", value: `null`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			mustSet(t, db, "k", tt.value)
+			ops := map[string]func() error{
+				"LPush":  func() error { _, err := db.LPush("k", "v"); return err },
+				"RPush":  func() error { _, err := db.RPush("k", "v"); return err },
+				"LPop":   func() error { _, _, err := db.LPop("k"); return err },
+				"RPop":   func() error { _, _, err := db.RPop("k"); return err },
+				"LRange": func() error { _, err := db.LRange("k", 0, -1); return err },
+			}
+			for op, run := range ops {
+				if err := run(); !errors.Is(err, ErrNotList) {
+					t.Fatalf("%s() = %v, want ErrNotList", op, err)
+				}
+			}
+			wantValue(t, db, "k", tt.value)
+		})
+	}
+}
+
+func TestPushClearsTTL(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	if err := db.SetWithTTL("q", `["a"]`, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	mustPush(t, db, "q", false, "b")
+	time.Sleep(40 * time.Millisecond)
+	if got, err := db.LRange("q", 0, -1); err != nil || !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("LRange() = %q, %v, want the list kept", got, err)
+	}
+}
+
+func TestPushPopConcurrent(t *testing.T) {
+	const workers, each = 8, 50
+	db, _ := openTestDB(t, Options{})
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < each; i++ {
+				if _, err := db.RPush("q", fmt.Sprintf("%d-%d", w, i)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	all, err := db.LRange("q", 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != workers*each {
+		t.Fatalf("%d items after concurrent pushes, want %d", len(all), workers*each)
+	}
+
+	// Every item comes off exactly once, however the pops interleave
+	seen := make(chan string, workers*each)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(front bool) {
+			defer wg.Done()
+			pop := db.RPop
+			if front {
+				pop = db.LPop
+			}
+			for {
+				item, ok, err := pop("q")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !ok {
+					return
+				}
+				seen <- item
+			}
+		}(w%2 == 0)
+	}
+	wg.Wait()
+	close(seen)
+
+	got := make(map[string]bool)
+	for item := range seen {
+		if got[item] {
+			t.Fatalf("%s popped twice", item)
+		}
+		got[item] = true
+	}
+	if len(got) != workers*each {
+		t.Fatalf("%d items popped, want %d", len(got), workers*each)
+	}
+}
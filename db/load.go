@@ -0,0 +1,182 @@
+package db
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// loadSuffix is appended to the database path for the directory Load
+// restores a dump into before swapping it in
+const loadSuffix = ".load"
+
+// Load replaces the contents of the database with a dump written by Backup
+// or Checkpoint and returns how many keys it holds. Unlike Clear followed
+// by Restore, the dump is restored into a temporary database next to this
+// one first and then swapped in whole, so readers see either the old
+// contents or the new ones, never an empty or partly loaded database. A
+// dump that fails to load leaves the database as it was. Watchers get a
+// delete for every key the dump doesn't have and a set for every key it
+// does. As with Clear, if the process dies while the old files are being
+// removed, keys from those not yet removed may come back on the next open.
+func (db *SimpleDB) Load(r io.Reader) (int, error) {
+	if db.opts.ReadOnly {
+		return 0, ErrReadOnly
+	}
+
+	// Also clears out whatever an interrupted load left behind
+	dir := db.path + loadSuffix
+	if err := os.RemoveAll(dir); err != nil {
+		return 0, err
+	}
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	// Records are copied over as they are, so they must be written the way
+	// this database writes them
+	tmpPath := filepath.Join(dir, filepath.Base(db.path))
+	tmp, err := OpenDBWithOptions(tmpPath, Options{
+		MaxKeySize:       db.opts.MaxKeySize,
+		MaxValueSize:     db.opts.MaxValueSize,
+		ReservedPrefixes: db.opts.ReservedPrefixes,
+		Codec:            db.opts.Codec,
+		Compression:      db.opts.Compression,
+		CompressMinSize:  db.opts.CompressMinSize,
+		EncryptionKey:    db.opts.EncryptionKey,
+		FileMode:         db.opts.FileMode,
+		KeyNormalizer:    db.opts.KeyNormalizer,
+	})
+	if err != nil {
+		return 0, err
+	}
+	imported, err := tmp.Restore(r, true)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return imported, db.swapIn(tmpPath)
+}
+
+// swapIn replaces every segment with the single segment file at path,
+// written by another database with the same settings, and indexes it
+func (db *SimpleDB) swapIn(path string) error {
+	// A running compaction would otherwise swap the old contents back in
+	db.compactMu.Lock()
+	defer db.compactMu.Unlock()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	if err := db.flushWrites(); err != nil {
+		return err
+	}
+
+	// Every key is reported deleted or set, spilled ones included
+	before, err := db.indexed()
+	if err != nil {
+		return err
+	}
+	var spill *spillIndex
+	if db.spill != nil {
+		if spill, err = newSpillIndex(db.spill.dir, db.spill.rate); err != nil {
+			return err
+		}
+	}
+	swapped := false
+	defer func() {
+		if !swapped {
+			spill.close()
+		}
+	}()
+
+	// The new segment goes after all the others so it wins if the old ones
+	// aren't all removed
+	ids := db.segmentIDs()
+	target := ids[len(ids)-1] + 1
+	if err := db.removeSnapshot(); err != nil {
+		return err
+	}
+	targetPath := segmentPath(db.path, target)
+	if err := os.Rename(path, targetPath); err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(db.path)); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(targetPath, os.O_RDWR|os.O_APPEND, db.opts.FileMode)
+	if err != nil {
+		return err
+	}
+	segments, leftover, removeErr := db.removeSegments(ids, target)
+	segments[target] = file
+
+	db.segments = segments
+	db.segment = target
+	db.file = file
+	db.resetWriter(file)
+	db.mapSegments()
+	db.rewritten()
+	db.spill.close()
+	db.spill, swapped = spill, true
+	db.data = make(map[string]location)
+	db.indexSize = 0
+	db.expires = make(map[string]int64)
+	db.cache = newValueCache(db.opts.CacheSize)
+	db.lru = newKeyOrder(db.opts, nil)
+	db.dead, db.corrupt = leftover, 0
+	db.size, db.segmentSize = leftover, 0
+
+	end, err := db.scanSegment(file, target, 0)
+	db.size += end
+	db.segmentSize = end
+	if err != nil {
+		return err
+	}
+	if err := db.rebuildIndexes(); err != nil {
+		return err
+	}
+
+	if err := db.publishLoad(before); err != nil {
+		return err
+	}
+	db.evict()
+	if removeErr != nil {
+		db.opts.Logger.Error("removing replaced segments failed", "path", db.path, "err", removeErr)
+	}
+	return removeErr
+}
+
+// publishLoad tells watchers about a swap from the keys in before to the
+// current ones. Callers must hold the write lock.
+func (db *SimpleDB) publishLoad(before map[string]location) error {
+	if len(db.watchers) == 0 && len(db.prefixWatchers) == 0 {
+		return nil
+	}
+	after, err := db.indexed()
+	if err != nil {
+		return err
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			db.publish(Event{Type: EventDelete, Key: key})
+		}
+	}
+	for key := range after {
+		value, exists, err := db.lookup(key)
+		if err != nil {
+			return err
+		}
+		if exists {
+			db.publish(Event{Type: EventSet, Key: key, Value: string(value)})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// dumpOf returns a Backup of a fresh database holding want
+func dumpOf(t *testing.T, want map[string]string) *bytes.Buffer {
+	t.Helper()
+	src, _ := openTestDB(t, Options{})
+	for key, value := range want {
+		mustSet(t, src, key, value)
+	}
+	var buf bytes.Buffer
+	if err := src.Backup(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "default"},
+		{name: "segments", opts: Options{SegmentSize: 256}},
+		{name: "index budget", opts: Options{IndexBudget: 1}},
+		{name: "compressed", opts: Options{Compression: CompressionGzip}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, tt.opts)
+			for i := 0; i < 20; i++ {
+				mustSet(t, db, fmt.Sprintf("old-%d", i), "old")
+			}
+			mustSet(t, db, "shared", "old")
+
+			want := map[string]string{"shared": "new"}
+			for i := 0; i < 20; i++ {
+				want[fmt.Sprintf("new-%d", i)] = fmt.Sprintf("value-%d", i)
+			}
+
+			// A key in both the old and new contents never goes missing
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					if _, err := db.Get("shared"); err != nil {
+						t.Errorf("Get(shared) during Load: %v", err)
+						return
+					}
+				}
+			}()
+			loaded, err := db.Load(dumpOf(t, want))
+			close(stop)
+			wg.Wait()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded != len(want) {
+				t.Fatalf("Load() = %d, want %d", loaded, len(want))
+			}
+
+			check := func(db *SimpleDB) {
+				t.Helper()
+				for key, value := range want {
+					wantValue(t, db, key, value)
+				}
+				wantMissing(t, db, "old-0")
+				if got := db.Len(); got != len(want) {
+					t.Fatalf("Len() = %d, want %d", got, len(want))
+				}
+			}
+			check(db)
+			if _, err := os.Stat(path + loadSuffix); !os.IsNotExist(err) {
+				t.Fatalf("temporary database left behind: %v", err)
+			}
+
+			mustSet(t, db, "after", "x")
+			want["after"] = "x"
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			check(reopenTestDB(t, path, tt.opts))
+		})
+	}
+}
+
+func TestLoadFailure(t *testing.T) {
+	db, path := openTestDB(t, Options{})
+	mustSet(t, db, "a", "one")
+
+	dump := dumpOf(t, map[string]string{"b": "two", "c": "three"})
+	truncated := bytes.NewReader(dump.Bytes()[:dump.Len()-3])
+	if _, err := db.Load(truncated); err == nil {
+		t.Fatal("Load of a truncated dump succeeded")
+	}
+	wantValue(t, db, "a", "one")
+	wantMissing(t, db, "b")
+	if _, err := os.Stat(path + loadSuffix); !os.IsNotExist(err) {
+		t.Fatalf("temporary database left behind: %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 2 {
+		t.Fatalf("directory holds %d files, want the database and its lock", len(entries))
+	}
+}
+
+func TestLoadWatch(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	mustSet(t, db, "gone", "x")
+	events, cancel := db.WatchPrefix("")
+	defer cancel()
+
+	if _, err := db.Load(dumpOf(t, map[string]string{"kept": "y"})); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]Event{}
+	for i := 0; i < 2; i++ {
+		event := nextEvent(t, events)
+		got[event.Key] = event
+	}
+	if event := got["gone"]; event.Type != EventDelete {
+		t.Fatalf("event for gone = %+v, want a delete", event)
+	}
+	if event := got["kept"]; event.Type != EventSet || event.Value != "y" {
+		t.Fatalf("event for kept = %+v, want a set to y", event)
+	}
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"errors"
+	"os"
+)
+
+// lockSuffix is appended to the database path for the lock file
+const lockSuffix = ".lock"
+
+// ErrAlreadyLocked is returned when opening a database another writer,
+// in this process or another, already has open. Read-only opens take no
+// lock and are always allowed.
+var ErrAlreadyLocked = errors.New("database is locked by another writer")
+
+// lockPath takes an exclusive lock on the lock file next to path. The lock
+// lives as long as the returned file stays open. A separate file is used
+// because compaction replaces the segment files.
+func lockPath(path string, mode os.FileMode) (*os.File, error) {
+	file, err := os.OpenFile(path+lockSuffix, os.O_CREATE|os.O_RDWR, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// unlock releases a lock taken by lockPath; a nil file is ignored
+func unlock(file *os.File) error {
+	if file == nil {
+		return nil
+	}
+	return file.Close()
+}
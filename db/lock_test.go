@@ -0,0 +1,82 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestLock(t *testing.T) {
+	if !locksWork {
+		t.Skip("no file locks on this platform")
+	}
+
+	tests := []struct {
+		name    string
+		closed  bool // Whether the first writer has closed
+		opts    Options
+		wantErr error
+	}{
+		{name: "second writer", wantErr: ErrAlreadyLocked},
+		{name: "reader", opts: Options{ReadOnly: true}},
+		{name: "writer after close", closed: true},
+		{name: "reader after close", closed: true, opts: Options{ReadOnly: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			mustSet(t, db, "a", "one")
+			if err := db.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.closed {
+				if err := db.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			other, err := OpenDBWithOptions(path, tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				if err == nil {
+					other.Close()
+				}
+				t.Fatalf("second open error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				// The first writer is unaffected
+				mustSet(t, db, "a", "two")
+				wantValue(t, db, "a", "two")
+				return
+			}
+			defer other.Close()
+			wantValue(t, other, "a", "one")
+		})
+	}
+}
+
+func TestLockReleasedOnFailedOpen(t *testing.T) {
+	if !locksWork {
+		t.Skip("no file locks on this platform")
+	}
+	db, path := openTestDB(t, Options{})
+	mustSet(t, db, "a", "one")
+	mustSet(t, db, "b", "two")
+	loc := db.data["a"]
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	flipLastByte(t, path, loc)
+	if err := os.Remove(path + indexSuffix); err != nil {
+		t.Fatal(err)
+	}
+
+	// An open that fails partway doesn't leave the lock held
+	if bad, err := OpenDB(path); !errors.Is(err, ErrCorrupt) {
+		if err == nil {
+			bad.Close()
+		}
+		t.Fatalf("OpenDB() error = %v, want %v", err, ErrCorrupt)
+	}
+	reopenTestDB(t, path, Options{SkipCorrupt: true})
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package db
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// locksWork reports whether lockFile keeps a second writer out
+const locksWork = true
+
+// lockFile takes a non-blocking exclusive flock on file. Locks belong to
+// the open file, so a second open in the same process conflicts too.
+func lockFile(file *os.File) error {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrAlreadyLocked
+	}
+	return err
+}
@@ -0,0 +1,15 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+)
+
+// discardHandler is the slog handler behind the default logger, which drops
+// everything
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// recordingHandler is a slog handler that keeps the messages of every record
+type recordingHandler struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.messages = append(h.messages, r.Level.String()+" "+r.Message)
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recordingHandler) WithGroup(string) slog.Handler      { return h }
+
+func (h *recordingHandler) logged() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.messages)
+}
+
+func TestLogging(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, path string, opts Options, b location) // b locates the latest record of b
+		want []string
+	}{
+		{
+			name: "open",
+			run: func(t *testing.T, path string, opts Options, _ location) {
+				reopenTestDB(t, path, opts)
+			},
+			want: []string{"INFO opened database"},
+		},
+		{
+			name: "compaction",
+			run: func(t *testing.T, path string, opts Options, _ location) {
+				db := reopenTestDB(t, path, opts)
+				if err := db.Compact(); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"INFO opened database", "INFO compaction started", "INFO compaction finished"},
+		},
+		{
+			name: "corrupt record",
+			run: func(t *testing.T, path string, opts Options, b location) {
+				flipLastByte(t, path, b)
+				// Only a rebuild from the log reads every record
+				if err := os.Remove(path + indexSuffix); err != nil {
+					t.Fatal(err)
+				}
+				opts.SkipCorrupt = true
+				reopenTestDB(t, path, opts)
+			},
+			want: []string{"WARN skipped corrupt record", "INFO opened database"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			mustSet(t, db, "a", "one")
+			mustSet(t, db, "b", "old")
+			mustSet(t, db, "b", "two")
+			b := db.data["b"]
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			h := &recordingHandler{}
+			tt.run(t, path, Options{Logger: slog.New(h)}, b)
+			if got := h.logged(); !slices.Equal(got, tt.want) {
+				t.Fatalf("logged %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package db
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrOffsetOutOfRange is returned by ReadFrom, ReadRange and ReadLog for
+	// a position past the end of the log or in a segment it doesn't have
+	ErrOffsetOutOfRange = errors.New("log position is past the end of the log")
+
+	// ErrNotBoundary is returned by ReadFrom, ReadRange and ReadLog for a
+	// position in the middle of a record
+	ErrNotBoundary = errors.New("log position is not at a record boundary")
+)
+
+// LogReader reads the raw records of the log in the order they were
+// appended, between two positions fixed when it was created
+type LogReader struct {
+	segments []logSegment
+	codec    Codec
+	aead     cipher.AEAD
+	current  int           // Index in segments of the segment being read
+	r        *bufio.Reader // Reads the current segment, nil until it is started
+	pos      Position
+	entry    Record
+	err      error
+}
+
+// logSegment is one segment file as seen by a LogReader
+type logSegment struct {
+	id   int
+	file *os.File
+	size int64 // Bytes of the segment to read
+}
+
+// ReadFrom returns a reader over the records from position from onwards,
+// up to where the log ended when ReadFrom was called; records appended after
+// that are left for a later reader. from is either the zero Position, for
+// the start of the log, or one handed out by LogReader.Position, ReadLog,
+// Checkpoint or SnapshotAt. A position from before the files were last
+// rewritten fails with ErrStalePosition. Values are handed over decompressed
+// and decrypted. The caller must Close the reader when done.
+func (db *SimpleDB) ReadFrom(from Position) (*LogReader, error) {
+	return db.openLog(from, nil, true)
+}
+
+// ReadRange is like ReadFrom but stops at position to, such as one returned
+// by SnapshotAt
+func (db *SimpleDB) ReadRange(from, to Position) (*LogReader, error) {
+	return db.openLog(from, &to, true)
+}
+
+// SnapshotAt returns the position where the log currently ends and the
+// position of every live key's record at that moment. Reading the log up to
+// there with ReadRange replays a point-in-time image, however many writes
+// land after it meanwhile; a later ReadFrom from the same position picks up
+// from there for an incremental backup.
+func (db *SimpleDB) SnapshotAt() (Position, map[string]Position, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return Position{}, nil, ErrClosed
+	}
+
+	all, err := db.indexed()
+	if err != nil {
+		return Position{}, nil, err
+	}
+	keys := make(map[string]Position, len(all))
+	for key, loc := range all {
+		if !db.expired(key) {
+			keys[key] = Position{Generation: db.generation, Segment: loc.Segment, Offset: loc.Offset}
+		}
+	}
+	return db.endPosition(), keys, nil
+}
+
+// endPosition returns the position where the log ends. Callers must hold at
+// least the read lock.
+func (db *SimpleDB) endPosition() Position {
+	return Position{Generation: db.generation, Segment: db.segment, Offset: db.segmentSize}
+}
+
+// openLog returns a reader over the records from position from up to to,
+// or to the end of the log if to is nil. Positions taken from the caller
+// are checked to be record boundaries unless they came from a reader.
+func (db *SimpleDB) openLog(from Position, to *Position, check bool) (*LogReader, error) {
+	db.mu.RLock()
+	if db.closed {
+		db.mu.RUnlock()
+		return nil, ErrClosed
+	}
+	generation, end := db.generation, db.endPosition()
+	files, err := db.openSegments()
+	lr := &LogReader{codec: db.opts.Codec, aead: db.aead}
+	db.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(files))
+	for id := range files {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	if from == (Position{}) {
+		from = Position{Generation: generation, Segment: ids[0]}
+	}
+	if to == nil {
+		to = &end
+	}
+	if err := checkRange(files, from, *to, end, check); err != nil {
+		closeSegments(files)
+		return nil, err
+	}
+
+	lr.pos = from
+	for _, id := range ids {
+		if id < from.Segment || id > to.Segment {
+			files[id].Close()
+			continue
+		}
+		size := to.Offset
+		if id != to.Segment {
+			// Only the last segment is ever appended to, so the others'
+			// sizes are settled
+			info, err := files[id].Stat()
+			if err != nil {
+				lr.Close()
+				files[id].Close()
+				return nil, err
+			}
+			size = info.Size()
+		}
+		lr.segments = append(lr.segments, logSegment{id: id, file: files[id], size: size})
+	}
+	return lr, nil
+}
+
+// checkRange checks that from and to are positions in the current log, in
+// order and no further than end. With check set it also walks the segments
+// to make sure they fall on record boundaries.
+func checkRange(files map[int]*os.File, from, to, end Position, check bool) error {
+	for _, pos := range []Position{from, to} {
+		if pos.Generation != end.Generation {
+			return ErrStalePosition
+		}
+		if _, ok := files[pos.Segment]; !ok || end.before(pos) {
+			return fmt.Errorf("%w: %s", ErrOffsetOutOfRange, pos)
+		}
+	}
+	if to.before(from) {
+		return fmt.Errorf("%w: %s is before %s", ErrOffsetOutOfRange, to, from)
+	}
+	if !check {
+		return nil
+	}
+
+	for _, pos := range []Position{from, to} {
+		ok, err := atBoundary(files[pos.Segment], pos.Offset)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrNotBoundary, pos)
+		}
+	}
+	return nil
+}
+
+// atBoundary reports whether a record starts at offset in a segment, or the
+// segment ends there, by walking the record headers from its start. Offsets
+// past the end of the segment are reported as not on a boundary.
+func atBoundary(file io.ReaderAt, offset int64) (bool, error) {
+	r := bufio.NewReader(io.NewSectionReader(file, 0, offset))
+	var header [headerSize]byte
+	for at := int64(0); at < offset; {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return false, nil
+			}
+			return false, err
+		}
+		length := int64(binary.LittleEndian.Uint32(header[:]))
+		at += headerSize + length
+		if at > offset {
+			return false, nil
+		}
+		if _, err := r.Discard(int(length)); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// before reports whether p comes before q in the log
+func (p Position) before(q Position) bool {
+	if p.Segment != q.Segment {
+		return p.Segment < q.Segment
+	}
+	return p.Offset < q.Offset
+}
+
+// Next reads the next record, returning false once the end of the log is
+// reached or reading fails; check Err to tell which
+func (lr *LogReader) Next() bool {
+	for lr.err == nil && lr.current < len(lr.segments) {
+		seg := lr.segments[lr.current]
+		if lr.r == nil {
+			if seg.id > lr.pos.Segment {
+				lr.pos = Position{Generation: lr.pos.Generation, Segment: seg.id}
+			}
+			lr.r = bufio.NewReader(io.NewSectionReader(seg.file, lr.pos.Offset, seg.size-lr.pos.Offset))
+		}
+
+		entry, size, err := readRecord(lr.codec, lr.r, seg.size-lr.pos.Offset)
+		if err == io.EOF {
+			lr.current++
+			lr.r = nil
+			continue
+		}
+		if err == nil && strings.HasPrefix(entry.Key, reservedPrefix) {
+			lr.pos.Offset += size
+			continue
+		}
+		if err == nil {
+			entry, err = plainRecord(lr.aead, entry)
+		}
+		if err != nil {
+			lr.err = fmt.Errorf("reading log at %s: %w", lr.pos, err)
+			return false
+		}
+
+		lr.entry = entry
+		lr.pos.Offset += size
+		return true
+	}
+	return false
+}
+
+// Record returns the record Next read
+func (lr *LogReader) Record() Record {
+	return lr.entry
+}
+
+// Position returns the position just past the record Next read, where a
+// later ReadFrom should start to carry on after it
+func (lr *LogReader) Position() Position {
+	return lr.pos
+}
+
+// Err returns the error that stopped Next, if any
+func (lr *LogReader) Err() error {
+	return lr.err
+}
+
+// Close releases the reader's file handles
+func (lr *LogReader) Close() error {
+	var errs []error
+	for _, seg := range lr.segments {
+		errs = append(errs, seg.file.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,299 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readAll reads every record lr has, returning their keys and the position
+// it ended at
+func readAll(t *testing.T, lr *LogReader) ([]string, Position) {
+	t.Helper()
+	defer lr.Close()
+	var keys []string
+	for lr.Next() {
+		keys = append(keys, lr.Record().Key)
+	}
+	if err := lr.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return keys, lr.Position()
+}
+
+func TestReadFrom(t *testing.T) {
+	for _, opts := range []Options{{}, {SegmentSize: 256}} {
+		t.Run(fmt.Sprintf("segment size %d", opts.SegmentSize), func(t *testing.T) {
+			db, _ := openTestDB(t, opts)
+			var want []string
+			for i := 0; i < 20; i++ {
+				key := fmt.Sprintf("key-%02d", i)
+				mustSet(t, db, key, "value")
+				want = append(want, key)
+			}
+
+			lr, err := db.ReadFrom(Position{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, end := readAll(t, lr)
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("read %v, want %v", got, want)
+			}
+
+			// Picking up from the end sees only what came after
+			mustSet(t, db, "later", "value")
+			lr, err = db.ReadFrom(end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := readAll(t, lr); fmt.Sprint(got) != "[later]" {
+				t.Fatalf("read %v after %s, want [later]", got, end)
+			}
+		})
+	}
+}
+
+func TestReadFromInvalidPosition(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	mustSet(t, db, "a", "first value")
+	mustSet(t, db, "b", "second value")
+	_, snapshot, err := db.SnapshotAt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := snapshot["b"]
+	end := db.endPosition()
+
+	tests := []struct {
+		name string
+		from Position
+		want error
+	}{
+		{"inside a record", Position{Generation: end.Generation, Offset: 3}, ErrNotBoundary},
+		{"inside the header", Position{Generation: end.Generation, Offset: second.Offset + 2}, ErrNotBoundary},
+		{"past the end", Position{Generation: end.Generation, Offset: end.Offset + 1}, ErrOffsetOutOfRange},
+		{"missing segment", Position{Generation: end.Generation, Segment: 7}, ErrOffsetOutOfRange},
+		{"other generation", Position{Generation: end.Generation + 1}, ErrStalePosition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if lr, err := db.ReadFrom(tt.from); !errors.Is(err, tt.want) {
+				if err == nil {
+					lr.Close()
+				}
+				t.Fatalf("ReadFrom(%s) = %v, want %v", tt.from, err, tt.want)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			err := db.ReadLog(ctx, tt.from, func(Record, Position) error { return nil })
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ReadLog(%s) = %v, want %v", tt.from, err, tt.want)
+			}
+		})
+	}
+
+	// Both ends of a range are checked
+	if _, err := db.ReadRange(Position{}, Position{Generation: end.Generation, Offset: 3}); !errors.Is(err, ErrNotBoundary) {
+		t.Fatalf("ReadRange to inside a record = %v, want ErrNotBoundary", err)
+	}
+	if _, err := db.ReadRange(second, Position{Generation: end.Generation}); !errors.Is(err, ErrOffsetOutOfRange) {
+		t.Fatalf("ReadRange ending before it starts = %v, want ErrOffsetOutOfRange", err)
+	}
+}
+
+func TestSnapshotAt(t *testing.T) {
+	db, _ := openTestDB(t, Options{SegmentSize: 256})
+	for i := 0; i < 10; i++ {
+		mustSet(t, db, fmt.Sprintf("key-%d", i), "before")
+	}
+	end, keys, err := db.SnapshotAt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 10 {
+		t.Fatalf("snapshot has %d keys, want 10", len(keys))
+	}
+
+	for i := 0; i < 10; i++ {
+		mustSet(t, db, fmt.Sprintf("key-%d", i), "after")
+	}
+	mustSet(t, db, "new", "after")
+
+	lr, err := db.ReadRange(Position{}, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for lr.Next() {
+		if r := lr.Record(); string(r.Value) != "before" {
+			t.Errorf("snapshot read %s = %q, written after the snapshot", r.Key, r.Value)
+		}
+		n++
+	}
+	lr.Close()
+	if err := lr.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 || lr.Position() != end {
+		t.Fatalf("read %d records up to %s, want 10 up to %s", n, lr.Position(), end)
+	}
+
+	// Every key's position is where its record starts
+	for key, pos := range keys {
+		lr, err := db.ReadRange(pos, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !lr.Next() || lr.Record().Key != key {
+			t.Errorf("record at %s isn't %s", pos, key)
+		}
+		lr.Close()
+	}
+
+	// An incremental read from the snapshot sees the rest
+	lr, err = db.ReadFrom(end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := readAll(t, lr); len(got) != 11 {
+		t.Fatalf("read %d records after the snapshot, want 11", len(got))
+	}
+
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ReadFrom(end); !errors.Is(err, ErrStalePosition) {
+		t.Fatalf("ReadFrom after compaction = %v, want ErrStalePosition", err)
+	}
+}
+
+// replay applies the records lr reads to an empty map, as restoring a
+// backup of them would
+func replay(t *testing.T, lr *LogReader) map[string]string {
+	t.Helper()
+	defer lr.Close()
+	state := make(map[string]string)
+	for lr.Next() {
+		r := lr.Record()
+		switch {
+		case r.Deleted, r.ExpiresAt != 0 && r.ExpiresAt <= time.Now().UnixNano():
+			delete(state, r.Key)
+		case !r.Touched:
+			state[r.Key] = string(r.Value)
+		}
+	}
+	if err := lr.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestSnapshotAtImage(t *testing.T) {
+	key := make([]byte, 32)
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "single file"},
+		{name: "segments", opts: Options{SegmentSize: 200}},
+		{name: "compressed", opts: Options{Compression: CompressionGzip, CompressMinSize: 1}},
+		{name: "encrypted", opts: Options{EncryptionKey: key}},
+		{name: "buffered", opts: Options{FlushInterval: time.Hour}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, tt.opts)
+			for i := 0; i < 10; i++ {
+				mustSet(t, db, fmt.Sprintf("key-%d", i), "first")
+				mustSet(t, db, fmt.Sprintf("key-%d", i), fmt.Sprintf("before-%d", i))
+			}
+			if err := db.Delete("key-3"); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.SetWithTTL("gone", "v", time.Millisecond); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(5 * time.Millisecond)
+			want, err := db.ScanPrefix("")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			end, keys, err := db.SnapshotAt()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keys) != len(want) {
+				t.Fatalf("snapshot has %d keys, want %d", len(keys), len(want))
+			}
+			for key := range want {
+				if _, ok := keys[key]; !ok {
+					t.Fatalf("snapshot is missing %s", key)
+				}
+			}
+
+			// Writes keep landing while the image is read
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			defer wg.Wait()
+			defer close(stop)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; ; i++ {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					db.Set(fmt.Sprintf("key-%d", i%10), "after")
+					db.Delete(fmt.Sprintf("key-%d", (i+5)%10))
+					db.Set(fmt.Sprintf("new-%d", i), "after")
+				}
+			}()
+			time.Sleep(5 * time.Millisecond)
+
+			lr, err := db.ReadRange(Position{}, end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := replay(t, lr); !maps.Equal(got, want) {
+				t.Fatalf("image %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestReadLog(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	mustSet(t, db, "a", "1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	got := make(chan string)
+	done := make(chan error)
+	go func() {
+		done <- db.ReadLog(ctx, Position{}, func(entry Record, _ Position) error {
+			got <- entry.Key
+			return nil
+		})
+	}()
+
+	if key := <-got; key != "a" {
+		t.Fatalf("first record %q, want a", key)
+	}
+	mustSet(t, db, "b", "2")
+	if key := <-got; key != "b" {
+		t.Fatalf("record written while waiting %q, want b", key)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("ReadLog = %v, want context.Canceled", err)
+	}
+}
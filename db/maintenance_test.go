@@ -0,0 +1,140 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMaintenance(t *testing.T) {
+	tests := []struct {
+		name        string
+		live        int // Keys that stay
+		expiring    int // Keys with a TTL that has passed
+		overwrites  int // Times each live key is overwritten
+		wantShrink  bool
+		wantExpired int
+	}{
+		{name: "nothing to reclaim", live: 10},
+		{name: "expired", live: 10, expiring: 20, wantShrink: true, wantExpired: 20},
+		{name: "overwritten", live: 10, overwrites: 5, wantShrink: true},
+		{name: "expired and overwritten", live: 10, expiring: 20, overwrites: 5, wantShrink: true, wantExpired: 20},
+		{name: "empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			value := strings.Repeat("v", 100)
+			for i := 0; i < tt.expiring; i++ {
+				if err := db.SetWithTTL(fmt.Sprintf("exp%d", i), value, time.Millisecond); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for round := 0; round <= tt.overwrites; round++ {
+				for i := 0; i < tt.live; i++ {
+					mustSet(t, db, fmt.Sprintf("key%d", i), fmt.Sprintf("%s%d", value, round))
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			report, err := db.Maintenance()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Expired != tt.wantExpired {
+				t.Errorf("Expired = %d, want %d", report.Expired, tt.wantExpired)
+			}
+			if report.KeysBefore != tt.live+tt.expiring || report.KeysAfter != tt.live {
+				t.Errorf("keys %d before and %d after, want %d and %d", report.KeysBefore, report.KeysAfter, tt.live+tt.expiring, tt.live)
+			}
+			if shrank := report.SizeAfter < report.SizeBefore; shrank != tt.wantShrink {
+				t.Errorf("size %d before and %d after, want shrinking %v", report.SizeBefore, report.SizeAfter, tt.wantShrink)
+			}
+			if report.SizeAfter > report.SizeBefore {
+				t.Errorf("size grew from %d to %d", report.SizeBefore, report.SizeAfter)
+			}
+			if size := fileSize(t, db); size != report.SizeAfter {
+				t.Errorf("file is %d bytes, report says %d", size, report.SizeAfter)
+			}
+			if report.Took <= 0 {
+				t.Errorf("Took = %v", report.Took)
+			}
+
+			db.Close()
+			db = reopenTestDB(t, path, Options{})
+			for i := 0; i < tt.live; i++ {
+				wantValue(t, db, fmt.Sprintf("key%d", i), fmt.Sprintf("%s%d", value, tt.overwrites))
+			}
+			for i := 0; i < tt.expiring; i++ {
+				wantMissing(t, db, fmt.Sprintf("exp%d", i))
+			}
+			if n := db.Len(); n != tt.live {
+				t.Fatalf("Len() = %d after reopening, want %d", n, tt.live)
+			}
+		})
+	}
+}
+
+func TestMaintenanceReadOnly(t *testing.T) {
+	_, path := openTestDB(t, Options{})
+	db := reopenTestDB(t, path, Options{ReadOnly: true})
+	if _, err := db.Maintenance(); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("Maintenance() = %v, want ErrReadOnly", err)
+	}
+}
+
+func TestMaintenanceWhileInUse(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	for i := 0; i < 100; i++ {
+		if err := db.SetWithTTL(fmt.Sprintf("exp%d", i), "v", time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		mustSet(t, db, fmt.Sprintf("key%d", i), "v")
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := fmt.Sprintf("key%d", i%100)
+				if w%2 == 0 {
+					if err := db.Set(key, fmt.Sprintf("w%d", i)); err != nil {
+						t.Error(err)
+						return
+					}
+				} else if _, err := db.Get(key); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := db.Maintenance(); err != nil {
+			t.Error(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if n := db.Len(); n != 100 {
+		t.Fatalf("Len() = %d, want 100", n)
+	}
+	for i := 0; i < 100; i++ {
+		wantMissing(t, db, fmt.Sprintf("exp%d", i))
+	}
+}
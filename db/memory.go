@@ -0,0 +1,127 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// memoryDir is where OpenMemory keeps its files: a tmpfs on Linux, so they
+// live in RAM. A variable so tests can point it elsewhere.
+var memoryDir = "/dev/shm"
+
+// memoryPrefix starts the name of every directory OpenMemory and OpenTemp
+// create
+const memoryPrefix = "owndb-"
+
+// memoryMarker is the file OpenMemory and OpenTemp put in every directory
+// they create, so removeStale never takes a directory that merely has a
+// similar name
+const memoryMarker = ".owndb-throwaway"
+
+// staleAge is how long a directory of OpenMemory's has to have gone
+// unchanged before removeStale may take it, so one whose database is still
+// being opened is left alone
+const staleAge = time.Minute
+
+// ErrNoMemoryFS is returned by OpenMemory where there is no /dev/shm to
+// keep the data in memory. OpenTemp works anywhere, on disk.
+var ErrNoMemoryFS = errors.New("no in-memory file system available")
+
+// OpenMemory opens an empty, throwaway database with default options, for
+// tests and ephemeral caches. See OpenMemoryWithOptions.
+func OpenMemory() (*SimpleDB, error) {
+	return OpenMemoryWithOptions(Options{})
+}
+
+// OpenMemoryWithOptions opens an empty, throwaway database whose files live
+// in memory. It is an ordinary database in a fresh private directory under
+// /dev/shm, so every operation behaves exactly as it does on disk; Close
+// deletes the directory and everything in it. The data counts against the
+// size of /dev/shm, which containers often cap at 64 MB, and writes past it
+// fail as they would on a full disk. Where there is no /dev/shm it fails
+// with ErrNoMemoryFS rather than write to disk; OpenTempWithOptions is the
+// same on disk.
+//
+// A process that dies without calling Close leaves its directory behind.
+// Every OpenMemory removes such directories from earlier runs, once their
+// database is no longer open anywhere; where file locks aren't available
+// there is no telling, and they are left for the system to clean up.
+func OpenMemoryWithOptions(opts Options) (*SimpleDB, error) {
+	if info, err := os.Stat(memoryDir); err != nil || !info.IsDir() {
+		return nil, ErrNoMemoryFS
+	}
+	return openThrowaway(memoryDir, opts)
+}
+
+// OpenTemp opens an empty, throwaway database in the system temporary
+// directory with default options. See OpenTempWithOptions.
+func OpenTemp() (*SimpleDB, error) {
+	return OpenTempWithOptions(Options{})
+}
+
+// OpenTempWithOptions is OpenMemoryWithOptions for systems without
+// /dev/shm, or data too large for it: the directory is made in the system
+// temporary directory, which is usually on disk, so the data is written out
+// like any other database's and only deleted on Close.
+func OpenTempWithOptions(opts Options) (*SimpleDB, error) {
+	return openThrowaway(os.TempDir(), opts)
+}
+
+// openThrowaway opens an empty database in a fresh marked directory under
+// parent that Close deletes, first removing any such directories left by
+// earlier runs
+func openThrowaway(parent string, opts Options) (*SimpleDB, error) {
+	if opts.ReadOnly {
+		return nil, errors.New("a read-only throwaway database would always be empty")
+	}
+
+	removeStale(parent)
+	dir, err := os.MkdirTemp(parent, memoryPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, memoryMarker), nil, 0o600); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	db, err := OpenDBWithOptions(filepath.Join(dir, "data"), opts)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	db.tempDir = dir
+	return db, nil
+}
+
+// removeStale removes the directories OpenMemory and OpenTemp left under
+// parent for databases nothing has open any more. Only directories holding
+// memoryMarker are candidates, and an open database holds the lock in its
+// directory. Failures are ignored: the directory is just tried again next
+// time.
+func removeStale(parent string) {
+	if !locksWork {
+		return
+	}
+	dirs, err := filepath.Glob(filepath.Join(parent, memoryPrefix+"*"))
+	if err != nil {
+		return
+	}
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() || time.Since(info.ModTime()) < staleAge {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, memoryMarker)); err != nil {
+			continue
+		}
+		lock, err := lockPath(filepath.Join(dir, "data"), defaultFileMode)
+		if err != nil {
+			continue
+		}
+		os.RemoveAll(dir)
+		unlock(lock)
+	}
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRemoveStale(t *testing.T) {
+	if !locksWork {
+		t.Skip("stale directories can't be told apart without file locks")
+	}
+	old := time.Now().Add(-2 * staleAge)
+
+	tests := []struct {
+		name     string
+		dir      string
+		marked   bool // Whether the directory holds memoryMarker
+		open     bool // Whether a database is open in the directory
+		modified time.Time
+		want     bool // Whether the directory survives
+	}{
+		{name: "stale", dir: memoryPrefix + "1", marked: true, modified: old},
+		{name: "still open", dir: memoryPrefix + "2", marked: true, open: true, modified: old, want: true},
+		{name: "just created", dir: memoryPrefix + "3", marked: true, modified: time.Now(), want: true},
+		{name: "someone else's", dir: "other-4", marked: true, modified: old, want: true},
+		{name: "unmarked database", dir: memoryPrefix + "prod", modified: old, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dir := filepath.Join(parent, tt.dir)
+			if err := os.Mkdir(dir, 0o700); err != nil {
+				t.Fatal(err)
+			}
+			if tt.marked {
+				if err := os.WriteFile(filepath.Join(dir, memoryMarker), nil, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			db := reopenTestDB(t, filepath.Join(dir, "data"), Options{})
+			if !tt.open {
+				if err := db.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.Chtimes(dir, tt.modified, tt.modified); err != nil {
+				t.Fatal(err)
+			}
+
+			removeStale(parent)
+			_, err := os.Stat(dir)
+			if got := err == nil; got != tt.want {
+				t.Fatalf("directory survives: %v, want %v", got, tt.want)
+			}
+			if tt.want && !tt.open {
+				if _, err := os.Stat(filepath.Join(dir, "data")); err != nil {
+					t.Fatalf("data of a surviving directory is gone: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenThrowaway(t *testing.T) {
+	tests := []struct {
+		name   string
+		open   func() (*SimpleDB, error)
+		parent func() string // Where the directory should be made
+	}{
+		{name: "memory", open: OpenMemory, parent: func() string { return memoryDir }},
+		{name: "temp", open: OpenTemp, parent: os.TempDir},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := os.Stat(tt.parent()); err != nil {
+				t.Skipf("no %s here", tt.parent())
+			}
+			db, err := tt.open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			mustSet(t, db, "a", "one")
+			wantValue(t, db, "a", "one")
+			if err := db.Delete("a"); err != nil {
+				t.Fatal(err)
+			}
+			wantMissing(t, db, "a")
+
+			dir := db.tempDir
+			if filepath.Dir(dir) != filepath.Clean(tt.parent()) {
+				t.Fatalf("database in %s, want it under %s", dir, tt.parent())
+			}
+			if _, err := os.Stat(filepath.Join(dir, memoryMarker)); err != nil {
+				t.Fatalf("directory isn't marked: %v", err)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(dir); !os.IsNotExist(err) {
+				t.Fatalf("Close left %s behind: %v", dir, err)
+			}
+		})
+	}
+}
+
+func TestOpenMemoryWithoutMemoryFS(t *testing.T) {
+	old := memoryDir
+	memoryDir = filepath.Join(t.TempDir(), "missing")
+	defer func() { memoryDir = old }()
+
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	if db, err := OpenMemory(); !errors.Is(err, ErrNoMemoryFS) {
+		if err == nil {
+			db.Close()
+		}
+		t.Fatalf("OpenMemory() = %v, want ErrNoMemoryFS", err)
+	}
+	// Nothing falls back to the disk
+	if entries, err := os.ReadDir(tmp); err != nil || len(entries) != 0 {
+		t.Fatalf("temporary directory holds %v, %v", entries, err)
+	}
+}
+
+func TestOpenThrowawayReadOnly(t *testing.T) {
+	if _, err := OpenTempWithOptions(Options{ReadOnly: true}); err == nil {
+		t.Fatal("opened a read-only throwaway database")
+	}
+}
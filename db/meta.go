@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// GetMeta returns the version, size, timestamps and expiry of a key's
+// current value without handing back the value itself
+func (db *SimpleDB) GetMeta(key string) (Meta, error) {
+	key = db.normalize(key)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return Meta{}, ErrClosed
+	}
+
+	_, meta, err := db.lookupMeta(key)
+	return meta, err
+}
+
+// GetWithMeta returns the value of key together with its metadata, read
+// under one lock so the two always match
+func (db *SimpleDB) GetWithMeta(key string) (string, Meta, error) {
+	return db.GetWithMetaContext(context.Background(), key)
+}
+
+// GetWithMetaContext is like GetWithMeta but gives up if ctx is done before
+// the read starts
+func (db *SimpleDB) GetWithMetaContext(ctx context.Context, key string) (value string, _ Meta, err error) {
+	key = db.normalize(key)
+	defer db.observe(OpGet, db.start(OpGet), &err)
+	span := db.startSpan(ctx, OpGet, key)
+	defer func() { span.End(len(value), err) }()
+
+	if err := ctx.Err(); err != nil {
+		return "", Meta{}, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return "", Meta{}, ErrClosed
+	}
+
+	data, meta, err := db.lookupMeta(key)
+	if err != nil {
+		return "", Meta{}, err
+	}
+	db.reads.Add(1)
+	return string(data), meta, nil
+}
+
+// GetVersioned returns the value of key together with its version. Pass the
+// version to SetIfVersion for an optimistic read-modify-write.
+func (db *SimpleDB) GetVersioned(key string) (string, int64, error) {
+	value, meta, err := db.GetWithMeta(key)
+	return value, meta.Version, err
+}
+
+// lookupMeta reads the current value of key and its metadata. Callers must
+// hold at least the read lock.
+func (db *SimpleDB) lookupMeta(key string) ([]byte, Meta, error) {
+	loc, exists, err := db.locate(key)
+	if err != nil {
+		return nil, Meta{}, err
+	}
+	if !exists || db.expired(key) {
+		return nil, Meta{}, ErrKeyNotFound
+	}
+	db.lru.use(key)
+
+	entry, err := db.readEntry(loc)
+	if err != nil {
+		return nil, Meta{}, err
+	}
+	value, err := openValue(db.aead, entry)
+	if err != nil {
+		return nil, Meta{}, err
+	}
+
+	meta := Meta{
+		Version:   entry.Version,
+		Size:      len(value),
+		CreatedAt: time.Unix(0, entry.CreatedAt),
+		UpdatedAt: time.Unix(0, entry.UpdatedAt),
+	}
+	// Touch may have moved the expiry since the value was written
+	if expiresAt, ok := db.expires[key]; ok {
+		meta.ExpiresAt = time.Unix(0, expiresAt)
+	}
+	return value, meta, nil
+}
+
+// version returns the version of key's live record, or zero if it doesn't
+// exist. Callers must hold the write lock and have promoted key.
+func (db *SimpleDB) version(key string) int64 {
+	loc, exists := db.data[key]
+	if !exists || db.expired(key) {
+		return 0
+	}
+	return loc.Version
+}
+
+// stamp fills in the version and timestamps for a new value of entry.Key,
+// continuing from prev if given or from the live record otherwise. Both
+// come from the index, so nothing is read from disk. Callers must hold the
+// write lock and have promoted entry.Key.
+func (db *SimpleDB) stamp(entry Record, prev *Record) Record {
+	now := time.Now().UnixNano()
+	entry.CreatedAt = now
+	entry.UpdatedAt = now
+
+	if prev == nil {
+		if loc, exists := db.data[entry.Key]; exists && !db.expired(entry.Key) {
+			prev = &Record{Version: loc.Version, CreatedAt: loc.Created}
+		}
+	}
+	// Records from before versions were kept count as new keys
+	if prev == nil || prev.Version == 0 {
+		entry.Version = db.newVersion(now)
+		return entry
+	}
+
+	entry.Version = prev.Version + 1
+	db.maxVersion = max(db.maxVersion, entry.Version)
+	if prev.CreatedAt != 0 {
+		entry.CreatedAt = prev.CreatedAt
+	}
+	return entry
+}
+
+// newVersion returns the first version of a key being created: the clock
+// in nanoseconds, or one past the highest version seen so far if that is
+// further along. Starting from the clock rather than from 1 means a key
+// that is deleted and created again never repeats a version it had before,
+// which a stale ETag could otherwise match. Callers must hold the write
+// lock.
+func (db *SimpleDB) newVersion(now int64) int64 {
+	db.maxVersion = max(now, db.maxVersion+1)
+	return db.maxVersion
+}
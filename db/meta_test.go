@@ -0,0 +1,152 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// mustVersion returns the version of key, failing the test on error
+func mustVersion(t *testing.T, db *SimpleDB, key string) int64 {
+	t.Helper()
+	_, version, err := db.GetVersioned(key)
+	if err != nil {
+		t.Fatalf("GetVersioned(%q): %v", key, err)
+	}
+	return version
+}
+
+func TestVersionAfterDelete(t *testing.T) {
+	tests := []struct {
+		name    string
+		compact bool
+		reopen  bool
+	}{
+		{name: "open"},
+		{name: "reopen", reopen: true},
+		{name: "compact", compact: true},
+		{name: "compact and reopen", compact: true, reopen: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			mustSet(t, db, "a", "one")
+			first := mustVersion(t, db, "a")
+			mustSet(t, db, "a", "two")
+			stale := mustVersion(t, db, "a")
+			if stale <= first {
+				t.Fatalf("overwrite gave version %d, want more than %d", stale, first)
+			}
+
+			if err := db.Delete("a"); err != nil {
+				t.Fatal(err)
+			}
+			if tt.compact {
+				if err := db.Compact(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.reopen {
+				if err := db.Close(); err != nil {
+					t.Fatal(err)
+				}
+				db = reopenTestDB(t, path, Options{})
+			}
+
+			mustSet(t, db, "a", "one")
+			if got := mustVersion(t, db, "a"); got <= stale {
+				t.Fatalf("recreated key has version %d, want more than %d", got, stale)
+			}
+			if _, err := db.SetIfVersion("a", "three", stale); !errors.Is(err, ErrVersionMismatch) {
+				t.Fatalf("SetIfVersion with the version from before the delete: %v, want ErrVersionMismatch", err)
+			}
+		})
+	}
+}
+
+func TestSetIfVersion(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	mustSet(t, db, "a", "one")
+
+	version := mustVersion(t, db, "a")
+	for i := 0; i < 3; i++ {
+		next, err := db.SetIfVersion("a", "again", version)
+		if err != nil {
+			t.Fatalf("SetIfVersion(%d): %v", version, err)
+		}
+		if got := mustVersion(t, db, "a"); got != next {
+			t.Fatalf("SetIfVersion returned %d, GetVersioned says %d", next, got)
+		}
+		version = next
+	}
+
+	if _, err := db.SetIfVersion("a", "stale", version-1); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("SetIfVersion with an old version: %v, want ErrVersionMismatch", err)
+	}
+	if _, err := db.SetIfVersion("missing", "new", 0); err != nil {
+		t.Fatalf("SetIfVersion(0) on a missing key: %v", err)
+	}
+}
+
+func TestSetIfVersionAny(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr error
+	}{
+		{name: "existing key", key: "a"},
+		{name: "missing key", key: "missing", wantErr: ErrVersionMismatch},
+		{name: "expired key", key: "expired", wantErr: ErrVersionMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			mustSet(t, db, "a", "one")
+			if err := db.SetWithTTL("expired", "gone", time.Millisecond); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			version, err := db.SetIfVersion(tt.key, "new", AnyVersion)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SetIfVersion(AnyVersion) = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				wantMissing(t, db, tt.key)
+				return
+			}
+			wantValue(t, db, tt.key, "new")
+			if got := mustVersion(t, db, tt.key); got != version {
+				t.Fatalf("SetIfVersion returned %d, GetVersioned says %d", version, got)
+			}
+		})
+	}
+}
+
+func TestSetOverUnreadableRecord(t *testing.T) {
+	db, path := openTestDB(t, Options{})
+	mustSet(t, db, "a", "one")
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	version := mustVersion(t, db, "a")
+
+	loc := db.data["a"]
+	f, err := os.OpenFile(segmentPath(path, loc.Segment), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("garbage"), loc.Offset+headerSize); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	mustSet(t, db, "a", "two")
+	wantValue(t, db, "a", "two")
+	if got := mustVersion(t, db, "a"); got != version+1 {
+		t.Fatalf("version after overwrite = %d, want %d", got, version+1)
+	}
+}
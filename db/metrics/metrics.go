@@ -0,0 +1,107 @@
+// Package metrics exposes Prometheus metrics for a SimpleDB. It lives in its
+// own package so programs that don't scrape metrics don't pull in the
+// Prometheus client.
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"saaster.tech/own-db/db"
+)
+
+const namespace = "owndb"
+
+// Collector counts operations and their errors, records operation latency
+// and reports the key count and data file size of a tracked database.
+// Pass it as db.Options.Observer, then call Track once the database is open.
+type Collector struct {
+	ops     *prometheus.CounterVec
+	errors  *prometheus.CounterVec
+	latency *prometheus.HistogramVec
+
+	keys     *prometheus.Desc
+	fileSize *prometheus.Desc
+
+	mu sync.RWMutex
+	db *db.SimpleDB
+}
+
+// New returns a Collector with no database tracked yet
+func New() *Collector {
+	return &Collector{
+		ops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "operations_total",
+			Help:      "Number of operations performed, by operation.",
+		}, []string{"op"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "operation_errors_total",
+			Help:      "Number of operations that returned an error, by operation.",
+		}, []string{"op"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of operations, by operation.",
+			Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10),
+		}, []string{"op"}),
+		keys: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "keys"),
+			"Number of live keys.", nil, nil,
+		),
+		fileSize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "file_size_bytes"),
+			"Size of the data file in bytes.", nil, nil,
+		),
+	}
+}
+
+// Track sets the database the key count and file size gauges are read from.
+// Until it is called those gauges are not reported.
+func (c *Collector) Track(d *db.SimpleDB) {
+	c.mu.Lock()
+	c.db = d
+	c.mu.Unlock()
+}
+
+// ObserveOp implements db.Observer
+func (c *Collector) ObserveOp(op string, duration time.Duration, err error) {
+	c.ops.WithLabelValues(op).Inc()
+	if err != nil {
+		c.errors.WithLabelValues(op).Inc()
+	}
+	c.latency.WithLabelValues(op).Observe(duration.Seconds())
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.ops.Describe(ch)
+	c.errors.Describe(ch)
+	c.latency.Describe(ch)
+	ch <- c.keys
+	ch <- c.fileSize
+}
+
+// Collect implements prometheus.Collector. The gauges are read from the
+// tracked database's Stats at scrape time.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.ops.Collect(ch)
+	c.errors.Collect(ch)
+	c.latency.Collect(ch)
+
+	c.mu.RLock()
+	d := c.db
+	c.mu.RUnlock()
+	if d == nil {
+		return
+	}
+
+	stats, err := d.Stats()
+	if err != nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.keys, prometheus.GaugeValue, float64(stats.Keys))
+	ch <- prometheus.MustNewConstMetric(c.fileSize, prometheus.GaugeValue, float64(stats.FileSize))
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"saaster.tech/own-db/db"
+)
+
+func TestCollector(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  func(t *testing.T, d *db.SimpleDB)
+		want string
+	}{
+		{
+			name: "sets and gets",
+			ops: func(t *testing.T, d *db.SimpleDB) {
+				for _, key := range []string{"a", "b"} {
+					if err := d.Set(key, "v"); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if _, err := d.Get("a"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: `
+# HELP owndb_keys Number of live keys.
+# TYPE owndb_keys gauge
+owndb_keys 2
+# HELP owndb_operations_total Number of operations performed, by operation.
+# TYPE owndb_operations_total counter
+owndb_operations_total{op="get"} 1
+owndb_operations_total{op="set"} 2
+`,
+		},
+		{
+			name: "errors",
+			ops: func(t *testing.T, d *db.SimpleDB) {
+				if _, err := d.Get("missing"); !errors.Is(err, db.ErrKeyNotFound) {
+					t.Fatalf("Get(missing) = %v", err)
+				}
+			},
+			want: `
+# HELP owndb_keys Number of live keys.
+# TYPE owndb_keys gauge
+owndb_keys 0
+# HELP owndb_operation_errors_total Number of operations that returned an error, by operation.
+# TYPE owndb_operation_errors_total counter
+owndb_operation_errors_total{op="get"} 1
+# HELP owndb_operations_total Number of operations performed, by operation.
+# TYPE owndb_operations_total counter
+owndb_operations_total{op="get"} 1
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			d, err := db.OpenDBWithOptions(filepath.Join(t.TempDir(), "test.db"), db.Options{Observer: c})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+			c.Track(d)
+
+			tt.ops(t, d)
+			err = testutil.CollectAndCompare(c, strings.NewReader(tt.want),
+				"owndb_keys", "owndb_operations_total", "owndb_operation_errors_total")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := testutil.CollectAndCount(c, "owndb_operation_duration_seconds"); n == 0 {
+				t.Fatal("no latency recorded")
+			}
+		})
+	}
+}
+
+func TestCollectorUntracked(t *testing.T) {
+	tests := []struct {
+		name  string
+		track func(c *Collector, d *db.SimpleDB)
+	}{
+		{name: "not tracked", track: func(*Collector, *db.SimpleDB) {}},
+		{name: "closed", track: func(c *Collector, d *db.SimpleDB) { c.Track(d); d.Close() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			d, err := db.OpenDB(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+			tt.track(c, d)
+
+			// The gauges are left out rather than failing the scrape
+			if n := testutil.CollectAndCount(c, "owndb_keys", "owndb_file_size_bytes"); n != 0 {
+				t.Fatalf("%d gauges reported, want none", n)
+			}
+		})
+	}
+}
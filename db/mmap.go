@@ -0,0 +1,96 @@
+package db
+
+import "io"
+
+// mmapMinSize is the smallest mapping made for a segment. Mappings are
+// sized in powers of two past the end of the file, so appends only need a
+// remap each time the segment doubles.
+const mmapMinSize = 1 << 20
+
+// mmapRegion is a read-only mapping of a segment file
+type mmapRegion struct {
+	data []byte // The mapping, which usually runs past the end of the file
+	size int64  // How much of data is backed by the file
+}
+
+// ReadAt implements io.ReaderAt, never touching the mapping past the end of
+// the file, where the pages aren't backed
+func (r *mmapRegion) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[off:r.size])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readerAt returns what reads of a segment should go through: its mapping
+// with Options.MMap, or the file itself. Callers must hold at least the
+// read lock.
+func (db *SimpleDB) readerAt(id int) io.ReaderAt {
+	if region, ok := db.maps[id]; ok {
+		return region
+	}
+	return db.segments[id]
+}
+
+// mapSegments replaces every mapping with a fresh one of each open
+// segment, for after the set of segments changed. It does nothing unless
+// Options.MMap is set. Callers must hold the write lock.
+func (db *SimpleDB) mapSegments() {
+	if db.maps == nil {
+		return
+	}
+	db.unmapSegments()
+	for id, file := range db.segments {
+		info, err := file.Stat()
+		if err != nil {
+			db.opts.Logger.Warn("cannot map segment, reading it from the file", "segment", segmentPath(db.path, id), "err", err)
+			continue
+		}
+		db.mapSegment(id, info.Size())
+	}
+}
+
+// mapSegment makes sure the mapping of a segment covers its first size
+// bytes, mapping it afresh if it has outgrown the old mapping. A segment
+// that can't be mapped is read from the file instead. Callers must hold the
+// write lock.
+func (db *SimpleDB) mapSegment(id int, size int64) {
+	if db.maps == nil {
+		return
+	}
+	region, ok := db.maps[id]
+	if ok && size <= int64(len(region.data)) {
+		region.size = size
+		return
+	}
+
+	length := mmapMinSize
+	for int64(length) < size {
+		length *= 2
+	}
+	data, err := mmap(db.segments[id], length)
+	if err != nil {
+		db.opts.Logger.Warn("cannot map segment, reading it from the file", "segment", segmentPath(db.path, id), "err", err)
+		if ok {
+			munmap(region.data)
+			delete(db.maps, id)
+		}
+		return
+	}
+	if ok {
+		munmap(region.data)
+	}
+	db.maps[id] = &mmapRegion{data: data, size: size}
+}
+
+// unmapSegments drops every mapping. Callers must hold the write lock.
+func (db *SimpleDB) unmapSegments() {
+	for id, region := range db.maps {
+		munmap(region.data)
+		delete(db.maps, id)
+	}
+}
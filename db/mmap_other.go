@@ -0,0 +1,17 @@
+//go:build !unix
+
+package db
+
+import (
+	"errors"
+	"os"
+)
+
+// mmap is unsupported here, so Options.MMap falls back to file reads
+func mmap(*os.File, int) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func munmap([]byte) error {
+	return nil
+}
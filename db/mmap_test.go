@@ -0,0 +1,127 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMMapRegion(t *testing.T) {
+	region := &mmapRegion{data: []byte("hello world, and more past the end"), size: 11}
+	tests := []struct {
+		name    string
+		off     int64
+		n       int
+		want    string
+		wantErr error
+	}{
+		{name: "inside", off: 0, n: 5, want: "hello"},
+		{name: "up to the end", off: 6, n: 5, want: "world"},
+		{name: "past the end", off: 6, n: 10, want: "world", wantErr: io.EOF},
+		{name: "at the end", off: 11, n: 1, wantErr: io.EOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := make([]byte, tt.n)
+			n, err := region.ReadAt(p, tt.off)
+			if err != tt.wantErr || string(p[:n]) != tt.want {
+				t.Fatalf("ReadAt() = %q, %v, want %q, %v", p[:n], err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMMap(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		after func(t *testing.T, db *SimpleDB) // Changes the files after the writes
+	}{
+		{name: "growing past the first mapping", after: func(*testing.T, *SimpleDB) {}},
+		{name: "segments", opts: Options{SegmentSize: 256 << 10}, after: func(*testing.T, *SimpleDB) {}},
+		{
+			name: "compaction",
+			after: func(t *testing.T, db *SimpleDB) {
+				if err := db.Compact(); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name:  "buffered writes",
+			opts:  Options{FlushInterval: time.Hour},
+			after: func(*testing.T, *SimpleDB) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.MMap = true
+			db, path := openTestDB(t, tt.opts)
+
+			// Enough to outgrow the smallest mapping a couple of times
+			value := strings.Repeat("v", 4096)
+			n := 3 * mmapMinSize / len(value)
+			for i := 0; i < n; i++ {
+				mustSet(t, db, fmt.Sprintf("key-%d", i), fmt.Sprintf("%d-%s", i, value))
+				// Reads right after a write see it
+				if i%100 == 0 {
+					wantValue(t, db, fmt.Sprintf("key-%d", i), fmt.Sprintf("%d-%s", i, value))
+				}
+			}
+			tt.after(t, db)
+
+			check := func(db *SimpleDB) {
+				t.Helper()
+				for i := 0; i < n; i += 97 {
+					wantValue(t, db, fmt.Sprintf("key-%d", i), fmt.Sprintf("%d-%s", i, value))
+				}
+			}
+			check(db)
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			check(reopenTestDB(t, path, tt.opts))
+		})
+	}
+}
+
+// BenchmarkRandomGet reads random keys with and without Options.MMap
+func BenchmarkRandomGet(b *testing.B) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "file"},
+		{name: "mmap", opts: Options{MMap: true}},
+	}
+
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			db, err := OpenDBWithOptions(filepath.Join(b.TempDir(), "bench.db"), tt.opts)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer db.Close()
+			const keys = 10000
+			for i := 0; i < keys; i++ {
+				if err := db.Set(fmt.Sprintf("key-%d", i), strings.Repeat("v", 256)); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			rng := rand.New(rand.NewSource(1))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := db.Get(fmt.Sprintf("key-%d", rng.Intn(keys))); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
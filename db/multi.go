@@ -0,0 +1,80 @@
+package db
+
+// GetMulti reads several keys under a single read lock. Keys that don't
+// exist are left out of the result rather than failing the call.
+func (db *SimpleDB) GetMulti(keys []string) (map[string]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	result := make(map[string]string, len(keys))
+	for _, key := range keys {
+		value, exists, err := db.lookup(db.normalize(key))
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			result[key] = string(value)
+		}
+	}
+
+	return result, nil
+}
+
+// GetMultiOrdered is like GetMulti but returns the values in the order of
+// keys, with nil for keys that don't exist, so results can be matched to
+// keys by position even when keys repeat
+func (db *SimpleDB) GetMultiOrdered(keys []string) ([]*string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	result := make([]*string, len(keys))
+	for i, key := range keys {
+		value, exists, err := db.lookup(db.normalize(key))
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			s := string(value)
+			result[i] = &s
+		}
+	}
+
+	return result, nil
+}
+
+// DeleteMulti deletes several keys under a single write lock and returns
+// how many of them existed
+func (db *SimpleDB) DeleteMulti(keys []string) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return 0, ErrClosed
+	}
+
+	deleted := 0
+	for _, key := range keys {
+		key = db.normalize(key)
+		exists, err := db.exists(key)
+		if err != nil {
+			return deleted, err
+		}
+		if !exists {
+			continue
+		}
+		if err := db.del(key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGetMulti(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		want map[string]string
+	}{
+		{name: "none", want: map[string]string{}},
+		{name: "all present", keys: []string{"a", "b"}, want: map[string]string{"a": "one", "b": "two"}},
+		{name: "some missing", keys: []string{"a", "x", "c"}, want: map[string]string{"a": "one"}},
+		{name: "repeated", keys: []string{"b", "b"}, want: map[string]string{"b": "two"}},
+	}
+
+	db, _ := openTestDB(t, Options{})
+	mustSet(t, db, "a", "one")
+	mustSet(t, db, "b", "two")
+	mustSet(t, db, "c", "three")
+	if err := db.Delete("c"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.GetMulti(tt.keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Fatalf("GetMulti(%v) = %v, want %v", tt.keys, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMultiOrdered(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		want []string // "-" stands for a nil entry
+	}{
+		{name: "none", want: []string{}},
+		{name: "all present", keys: []string{"b", "a"}, want: []string{"two", "one"}},
+		{name: "present and absent", keys: []string{"x", "a", "c", "b", "y"}, want: []string{"-", "one", "-", "two", "-"}},
+		{name: "repeated", keys: []string{"a", "x", "a"}, want: []string{"one", "-", "one"}},
+		{name: "empty value", keys: []string{"empty", "x"}, want: []string{"", "-"}},
+		{name: "expired", keys: []string{"gone", "a"}, want: []string{"-", "one"}},
+	}
+
+	db, _ := openTestDB(t, Options{})
+	mustSet(t, db, "a", "one")
+	mustSet(t, db, "b", "two")
+	mustSet(t, db, "c", "three")
+	mustSet(t, db, "empty", "")
+	if err := db.Delete("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetWithTTL("gone", "v", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.GetMultiOrdered(tt.keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			values := make([]string, len(got))
+			for i, value := range got {
+				values[i] = "-"
+				if value != nil {
+					values[i] = *value
+				}
+			}
+			if !slices.Equal(values, tt.want) {
+				t.Fatalf("GetMultiOrdered(%v) = %q, want %q", tt.keys, values, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteMulti(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		want int
+		left []string // Keys still there afterwards
+	}{
+		{name: "none", left: []string{"a", "b", "c"}},
+		{name: "all", keys: []string{"a", "b", "c"}, want: 3},
+		{name: "some missing", keys: []string{"a", "x"}, want: 1, left: []string{"b", "c"}},
+		{name: "repeated", keys: []string{"b", "b"}, want: 1, left: []string{"a", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			for _, key := range []string{"a", "b", "c"} {
+				mustSet(t, db, key, "v")
+			}
+
+			deleted, err := db.DeleteMulti(tt.keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deleted != tt.want {
+				t.Fatalf("DeleteMulti(%v) = %d, want %d", tt.keys, deleted, tt.want)
+			}
+
+			// The deletes are durable
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			db = reopenTestDB(t, path, Options{})
+			if got := db.Keys(); !slices.Equal(got, tt.left) {
+				t.Fatalf("Keys() = %v, want %v", got, tt.left)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package db
+
+import "time"
+
+// Operation names passed to an Observer
+const (
+	OpGet      = "get"
+	OpSet      = "set"
+	OpDelete   = "delete"
+	OpBatchSet = "batch_set"
+	OpScan     = "scan"
+	OpCompact  = "compact"
+)
+
+// Observer is told about every Get, Set, Delete, BatchSet, prefix or range
+// scan and Compact once it finishes, with how long it took and the error it
+// returned, if any. It is the hook metrics
+// collectors plug into, so this package doesn't depend on any of them.
+// Implementations must be safe for concurrent use and should return quickly.
+type Observer interface {
+	ObserveOp(op string, duration time.Duration, err error)
+}
+
+// StartObserver is an Observer that also wants to know when each operation
+// begins, for tracing or counting operations in flight. StartOp is called
+// before the operation does any work, and ObserveOp once it is done.
+type StartObserver interface {
+	Observer
+	StartOp(op string)
+}
+
+// start tells the Observer that op is beginning, if it is a StartObserver,
+// and returns the start time to pass to observe
+func (db *SimpleDB) start(op string) time.Time {
+	if s, ok := db.opts.Observer.(StartObserver); ok {
+		s.StartOp(op)
+	}
+	return time.Now()
+}
+
+// observe reports an operation that began at start to the configured
+// Observer. It is meant to be deferred with a pointer to the named error
+// result so it sees the final outcome.
+func (db *SimpleDB) observe(op string, start time.Time, err *error) {
+	if db.opts.Observer == nil {
+		return
+	}
+	db.opts.Observer.ObserveOp(op, time.Since(start), *err)
+}
@@ -0,0 +1,206 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingObserver remembers every operation it is told about
+type recordingObserver struct {
+	mu      sync.Mutex
+	started []string
+	ops     []string
+	failed  []string
+}
+
+func (o *recordingObserver) StartOp(op string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.started = append(o.started, op)
+}
+
+func (o *recordingObserver) ObserveOp(op string, duration time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.ops = append(o.ops, op)
+	if err != nil {
+		o.failed = append(o.failed, op)
+	}
+}
+
+func TestObserver(t *testing.T) {
+	tests := []struct {
+		name       string
+		op         func(db *SimpleDB) error
+		wantOps    []string
+		wantFailed []string
+	}{
+		{name: "set", op: func(db *SimpleDB) error { return db.Set("b", "v") }, wantOps: []string{OpSet}},
+		{
+			name:    "get",
+			op:      func(db *SimpleDB) error { _, err := db.Get("a"); return err },
+			wantOps: []string{OpGet},
+		},
+		{
+			name: "get missing",
+			op: func(db *SimpleDB) error {
+				if _, err := db.Get("missing"); !errors.Is(err, ErrKeyNotFound) {
+					return err
+				}
+				return nil
+			},
+			wantOps:    []string{OpGet},
+			wantFailed: []string{OpGet},
+		},
+		{name: "delete", op: func(db *SimpleDB) error { return db.Delete("a") }, wantOps: []string{OpDelete}},
+		{
+			name:    "batch",
+			op:      func(db *SimpleDB) error { return db.BatchSet([]KVPair{{Key: "b", Value: "v"}}) },
+			wantOps: []string{OpBatchSet},
+		},
+		{
+			name:    "scan",
+			op:      func(db *SimpleDB) error { _, err := db.ScanPrefix(""); return err },
+			wantOps: []string{OpScan},
+		},
+		{
+			name:    "range",
+			op:      func(db *SimpleDB) error { _, err := db.ScanRange("a", "z"); return err },
+			wantOps: []string{OpScan},
+		},
+		{name: "compact", op: func(db *SimpleDB) error { return db.Compact() }, wantOps: []string{OpCompact}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			observer := &recordingObserver{}
+			db, _ := openTestDB(t, Options{Observer: observer})
+			mustSet(t, db, "a", "v")
+			observer.ops, observer.started = nil, nil
+
+			if err := tt.op(db); err != nil {
+				t.Fatal(err)
+			}
+			observer.mu.Lock()
+			defer observer.mu.Unlock()
+			if !slices.Equal(observer.ops, tt.wantOps) || !slices.Equal(observer.started, tt.wantOps) {
+				t.Fatalf("observed %v, started %v, want %v", observer.ops, observer.started, tt.wantOps)
+			}
+			if !slices.Equal(observer.failed, tt.wantFailed) {
+				t.Fatalf("failed %v, want %v", observer.failed, tt.wantFailed)
+			}
+		})
+	}
+}
+
+// timingObserver is a plain Observer remembering the durations it is given
+type timingObserver struct {
+	mu        sync.Mutex
+	durations map[string]time.Duration
+}
+
+func (o *timingObserver) ObserveOp(op string, duration time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.durations[op] = duration
+}
+
+// orderObserver logs starts and finishes in the order they happen
+type orderObserver struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (o *orderObserver) StartOp(op string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, "start "+op)
+}
+
+func (o *orderObserver) ObserveOp(op string, duration time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, "end "+op)
+}
+
+func TestObserverDuration(t *testing.T) {
+	tests := []struct {
+		name string
+		op   string
+		run  func(db *SimpleDB) error
+	}{
+		{name: "set", op: OpSet, run: func(db *SimpleDB) error { return db.Set("a", "v") }},
+		{name: "get", op: OpGet, run: func(db *SimpleDB) error { _, err := db.Get("a"); return err }},
+		{name: "compact", op: OpCompact, run: func(db *SimpleDB) error { return db.Compact() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			observer := &timingObserver{durations: make(map[string]time.Duration)}
+			db, _ := openTestDB(t, Options{Observer: observer, SyncWrites: true})
+			mustSet(t, db, "a", "v")
+			delete(observer.durations, OpSet)
+
+			if err := tt.run(db); err != nil {
+				t.Fatal(err)
+			}
+			observer.mu.Lock()
+			defer observer.mu.Unlock()
+			if d, ok := observer.durations[tt.op]; !ok || d <= 0 {
+				t.Fatalf("%s observed with duration %v, %v, want a positive one", tt.op, d, ok)
+			}
+		})
+	}
+}
+
+func TestStartObserverOrder(t *testing.T) {
+	observer := &orderObserver{}
+	db, _ := openTestDB(t, Options{Observer: observer})
+	mustSet(t, db, "a", "v")
+	if _, err := db.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"start set", "end set", "start get", "end get"}
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	if !slices.Equal(observer.events, want) {
+		t.Fatalf("events %v, want %v", observer.events, want)
+	}
+}
+
+// BenchmarkObserver shows what observing costs a Get, and that a nil
+// Observer costs nothing
+func BenchmarkObserver(b *testing.B) {
+	tests := []struct {
+		name     string
+		observer Observer
+	}{
+		{name: "none"},
+		{name: "observer", observer: &timingObserver{durations: make(map[string]time.Duration)}},
+	}
+
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			db, err := OpenDBWithOptions(filepath.Join(b.TempDir(), "bench.db"), Options{Observer: tt.observer})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer db.Close()
+			if err := db.Set("a", "v"); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := db.Get("a"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package db
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Options configures how a database is opened
+type Options struct {
+	// SyncWrites makes every Set and Delete fsync the file before returning,
+	// so an acknowledged write survives a power loss. This costs one disk
+	// flush per write and can be orders of magnitude slower than leaving it
+	// off; callers that can tolerate losing the last few writes should keep
+	// it disabled and call Flush at their own checkpoints instead.
+	SyncWrites bool
+
+	// FlushInterval buffers appends in memory and writes them to the file
+	// once 64KB have piled up or this much time has passed, whichever comes
+	// first, so bursts of small writes share one write syscall. Up to an
+	// interval's worth of acknowledged writes is lost if the process dies.
+	// Flush, Close and SyncWrites write out whatever is buffered. Zero
+	// writes every record straight to the file.
+	FlushInterval time.Duration
+
+	// GroupCommit routes Set and SetWithTTL through a single committer that
+	// appends everything queued while the previous write was in flight with
+	// one write and, with SyncWrites, one fsync. Each call still returns
+	// only once its own record is written, so this mainly pays off with
+	// SyncWrites and many concurrent writers.
+	GroupCommit bool
+
+	// ReadOnly opens the file without write access; all writes fail with
+	// ErrReadOnly.
+	ReadOnly bool
+
+	// MaxKeySize caps the length of a key in bytes. Zero means no limit.
+	MaxKeySize int
+
+	// MaxValueSize caps the size of a single value in bytes. Zero means no limit.
+	MaxValueSize int
+
+	// ReservedPrefixes rejects writes of keys starting with any of these
+	// with ErrReservedKey, keeping a namespace that other code manages,
+	// such as a bucket's, out of reach of plain writes. Empty keys and the
+	// database's own internal prefix are always rejected.
+	ReservedPrefixes []string
+
+	// Codec serializes records on disk. It defaults to JSONCodec; a file
+	// must always be opened with the codec it was written with.
+	Codec Codec
+
+	// Compression compresses values of at least CompressMinSize bytes
+	// before they are written. Reads always decompress transparently, so
+	// this can be changed between opens.
+	Compression Compression
+
+	// CompressMinSize is the smallest value worth compressing; tiny values
+	// would only grow. Zero means 1 KiB.
+	CompressMinSize int
+
+	// EncryptionKey turns on AES-256-GCM encryption of values when set.
+	// It must be exactly 32 bytes, and the same key must be supplied on
+	// every open; reading with the wrong key fails with ErrDecrypt. Keys
+	// themselves are stored in plaintext.
+	EncryptionKey []byte
+
+	// CacheSize is the number of recently read values kept in memory so
+	// repeated reads of hot keys skip the disk. Zero disables the cache.
+	CacheSize int
+
+	// Logger receives logs about opening, compaction, recovery from corrupt
+	// or torn records and background failures. Nothing is logged if it is nil.
+	Logger *slog.Logger
+
+	// Observer, if set, is told the duration and outcome of every Get, Set,
+	// Delete, BatchSet, scan and Compact, and also when each one starts if it
+	// implements StartObserver. See the metrics package for a Prometheus
+	// implementation.
+	Observer Observer
+
+	// Tracer, if set, starts a span for each operation the Observer sees.
+	// See the tracing package for an OpenTelemetry implementation.
+	Tracer Tracer
+
+	// SkipCorrupt makes open pass over records that fail their checksum
+	// instead of refusing to load the file. Keys whose latest record is
+	// corrupt fall back to their previous value, if any.
+	SkipCorrupt bool
+
+	// MaxKeys turns the database into a bounded cache: once a write leaves
+	// more than this many keys indexed, the least recently used ones are
+	// deleted with tombstones, as Delete would, and watchers see them go.
+	// Reads of a key through Get and the single-key methods count as use;
+	// scans and iterators don't. Usage isn't persisted, so after reopening
+	// keys are evicted oldest-written first until they are used again.
+	// Expired keys still count until they are swept. Zero means no limit.
+	MaxKeys int
+
+	// IndexBudget caps the memory the in-memory index may take, in bytes as
+	// estimated by Stats.IndexBytes, for data sets with more keys than fit
+	// in memory. Once a write or the scan at open takes the index over the
+	// budget, the least recently used keys move to an on-disk hash table in
+	// scratch files next to the database, which is rebuilt from the log on
+	// every open, so the persisted index snapshot isn't used. Keys stay
+	// there until they are written again; reads count as use only while a
+	// key is in memory and don't bring a spilled one back. The tradeoff is
+	// latency: a lookup of a spilled key reads the table from disk, as do
+	// the few lookups of other keys FilterFalsePositiveRate lets by, and
+	// Keys, the scans, iterators, View, compaction and secondary index
+	// builds read all spilled keys back into memory for as long as they
+	// run. Cannot be combined with MaxKeys. Zero means no budget.
+	IndexBudget int64
+
+	// FilterFalsePositiveRate is the share of lookups of keys not in the
+	// on-disk table of IndexBudget that still read it. A bloom filter in
+	// memory over the keys in the table answers the rest, including most
+	// lookups of keys that don't exist, without touching the disk. Lower
+	// rates take more memory: about 1.44 * log2(1/rate) bits per key the
+	// table can hold before it next grows, which is 10 bits at the default
+	// of 0.01. It has no effect without IndexBudget. Zero means 0.01.
+	FilterFalsePositiveRate float64
+
+	// CompactRatio triggers a background Compact once the estimated share
+	// of dead bytes in the file (overwritten values, deleted keys and
+	// tombstones) exceeds this fraction, e.g. 0.5. Zero disables automatic
+	// compaction.
+	CompactRatio float64
+
+	// CompactMinSize is the file size in bytes below which automatic
+	// compaction never runs, so small databases aren't rewritten constantly.
+	CompactMinSize int64
+
+	// CompactRate caps how fast Compact copies live records, in bytes per
+	// second, so rewriting a large file doesn't starve other disk I/O. The
+	// copy already runs without the write lock; only the final replay of
+	// writes made meanwhile, which holds it, runs at full speed. Zero means
+	// no limit.
+	CompactRate int64
+
+	// MMap serves reads from memory-mapped segment files instead of a read
+	// syscall per Get. Mappings are sized ahead of the file and redone as it
+	// outgrows them. Where mmap isn't available, reads use the file as usual.
+	MMap bool
+
+	// FileMode sets the permissions of the files the database creates: the
+	// segments, the lock file and the sidecar files next to them. Zero means
+	// 0644.
+	FileMode os.FileMode
+
+	// CreateDirs creates any missing parent directories of the database path
+	// when opening it for writing. They get FileMode plus search permission
+	// wherever it grants read permission, so 0644 gives 0755 directories.
+	CreateDirs bool
+
+	// SegmentSize splits the log into segment files of about this many bytes.
+	// Once the current segment is full, writes roll over to a new file named
+	// after the database path with a numeric suffix (path.000001, ...). Zero
+	// keeps everything in a single file.
+	SegmentSize int64
+
+	// KeyNormalizer maps every key passed to the database before it is
+	// looked up or stored, so keys it maps to the same string are the same
+	// key. Keys are stored, listed and watched in normalized form. Prefixes
+	// and range bounds are normalized too, so it should work character by
+	// character, as LowercaseKeys does. Reopening a database with a
+	// different normalizer doesn't rewrite keys already stored. Nil leaves
+	// keys as they are.
+	KeyNormalizer func(key string) string
+}
+
+// LowercaseKeys is a KeyNormalizer that makes keys case-insensitive
+func LowercaseKeys(key string) string {
+	return strings.ToLower(key)
+}
+
+// normalize applies the KeyNormalizer, if any, to key
+func (db *SimpleDB) normalize(key string) string {
+	if db.opts.KeyNormalizer == nil {
+		return key
+	}
+	return db.opts.KeyNormalizer(key)
+}
+
+// defaultFileMode is used when Options.FileMode is zero
+const defaultFileMode = 0644
+
+// dirMode returns the permissions for directories holding files created
+// with mode: search permission is added for whoever may read them
+func dirMode(mode os.FileMode) os.FileMode {
+	return mode | (mode&0444)>>2
+}
+
+// validate rejects option values that make no sense
+func (o Options) validate() error {
+	if o.MaxKeySize < 0 {
+		return errors.New("MaxKeySize must not be negative")
+	}
+	if o.MaxValueSize < 0 {
+		return errors.New("MaxValueSize must not be negative")
+	}
+	if o.Compression > CompressionZstd {
+		return errors.New("unknown Compression")
+	}
+	if o.CompressMinSize < 0 {
+		return errors.New("CompressMinSize must not be negative")
+	}
+	if o.EncryptionKey != nil && len(o.EncryptionKey) != 32 {
+		return errors.New("EncryptionKey must be 32 bytes")
+	}
+	for _, prefix := range o.ReservedPrefixes {
+		if prefix == "" {
+			return errors.New("ReservedPrefixes must not hold an empty prefix")
+		}
+	}
+	if o.MaxKeys < 0 {
+		return errors.New("MaxKeys must not be negative")
+	}
+	if o.IndexBudget < 0 {
+		return errors.New("IndexBudget must not be negative")
+	}
+	if o.IndexBudget > 0 && o.MaxKeys > 0 {
+		return errors.New("IndexBudget and MaxKeys cannot be combined")
+	}
+	if o.FilterFalsePositiveRate < 0 || o.FilterFalsePositiveRate >= 1 {
+		return errors.New("FilterFalsePositiveRate must be in the range [0, 1)")
+	}
+	if o.CacheSize < 0 {
+		return errors.New("CacheSize must not be negative")
+	}
+	if o.CompactRatio < 0 || o.CompactRatio >= 1 {
+		return errors.New("CompactRatio must be in the range [0, 1)")
+	}
+	if o.CompactMinSize < 0 {
+		return errors.New("CompactMinSize must not be negative")
+	}
+	if o.CompactRate < 0 {
+		return errors.New("CompactRate must not be negative")
+	}
+	if o.FlushInterval < 0 {
+		return errors.New("FlushInterval must not be negative")
+	}
+	if o.FileMode&^os.ModePerm != 0 {
+		return errors.New("FileMode must only hold permission bits")
+	}
+	if o.SegmentSize < 0 {
+		return errors.New("SegmentSize must not be negative")
+	}
+	return nil
+}
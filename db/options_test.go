@@ -0,0 +1,290 @@
+package db
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{name: "zero value", opts: Options{}},
+		{name: "everything set", opts: Options{
+			SyncWrites: true, MaxKeySize: 64, MaxValueSize: 1024, Compression: CompressionGzip,
+			EncryptionKey: make([]byte, 32), CacheSize: 10, MaxKeys: 100, CompactRatio: 0.5,
+			FileMode: 0o600, SegmentSize: 1 << 20, KeyNormalizer: LowercaseKeys,
+		}},
+		{name: "negative MaxKeySize", opts: Options{MaxKeySize: -1}, wantErr: true},
+		{name: "negative MaxValueSize", opts: Options{MaxValueSize: -1}, wantErr: true},
+		{name: "unknown Compression", opts: Options{Compression: CompressionZstd + 1}, wantErr: true},
+		{name: "negative CompressMinSize", opts: Options{CompressMinSize: -1}, wantErr: true},
+		{name: "short EncryptionKey", opts: Options{EncryptionKey: make([]byte, 16)}, wantErr: true},
+		{name: "empty reserved prefix", opts: Options{ReservedPrefixes: []string{""}}, wantErr: true},
+		{name: "negative MaxKeys", opts: Options{MaxKeys: -1}, wantErr: true},
+		{name: "negative CacheSize", opts: Options{CacheSize: -1}, wantErr: true},
+		{name: "CompactRatio of 1", opts: Options{CompactRatio: 1}, wantErr: true},
+		{name: "negative CompactMinSize", opts: Options{CompactMinSize: -1}, wantErr: true},
+		{name: "negative CompactRate", opts: Options{CompactRate: -1}, wantErr: true},
+		{name: "negative FlushInterval", opts: Options{FlushInterval: -1}, wantErr: true},
+		{name: "FileMode with type bits", opts: Options{FileMode: 0o644 | 1<<31}, wantErr: true},
+		{name: "negative SegmentSize", opts: Options{SegmentSize: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("validate() = %v, want error %v", err, tt.wantErr)
+			}
+
+			// Opening checks the same way
+			db, err := OpenDBWithOptions(filepath.Join(t.TempDir(), "test.db"), tt.opts)
+			if err == nil {
+				db.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("OpenDBWithOptions() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOpenDBDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, ok := db.opts.Codec.(JSONCodec); !ok {
+		t.Fatalf("default codec is %T, want JSONCodec", db.opts.Codec)
+	}
+	if db.opts.Logger == nil {
+		t.Fatal("no default logger")
+	}
+	mustSet(t, db, "a", "one")
+	wantValue(t, db, "a", "one")
+}
+
+func TestCreateDirs(t *testing.T) {
+	tests := []struct {
+		name       string
+		createDirs bool
+		readOnly   bool
+		wantErr    bool
+	}{
+		{name: "on", createDirs: true},
+		{name: "off", wantErr: true},
+		{name: "read-only", createDirs: true, readOnly: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "a", "b")
+			path := filepath.Join(dir, "test.db")
+			db, err := OpenDBWithOptions(path, Options{CreateDirs: tt.createDirs, ReadOnly: tt.readOnly})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("OpenDBWithOptions() = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if _, statErr := os.Stat(dir); !os.IsNotExist(statErr) {
+					t.Fatalf("failed open left %s behind: %v", dir, statErr)
+				}
+				return
+			}
+			defer db.Close()
+			mustSet(t, db, "a", "one")
+			wantValue(t, db, "a", "one")
+		})
+	}
+}
+
+// umasked returns mode as the process umask lets files be created with it
+func umasked(t *testing.T, mode os.FileMode) os.FileMode {
+	t.Helper()
+	probe := filepath.Join(t.TempDir(), "probe")
+	if err := os.WriteFile(probe, nil, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(probe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mode & info.Mode().Perm()
+}
+
+func TestFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no Unix permissions on this platform")
+	}
+	tests := []struct {
+		name     string
+		mode     os.FileMode
+		wantFile os.FileMode
+		wantDir  os.FileMode
+	}{
+		{name: "default", wantFile: 0o644, wantDir: 0o755},
+		{name: "private", mode: 0o600, wantFile: 0o600, wantDir: 0o700},
+		{name: "group", mode: 0o640, wantFile: 0o640, wantDir: 0o750},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "data")
+			path := filepath.Join(dir, "test.db")
+			db, err := OpenDBWithOptions(path, Options{FileMode: tt.mode, CreateDirs: true, SegmentSize: 64})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 5; i++ {
+				mustSet(t, db, fmt.Sprintf("key%d", i), strings.Repeat("v", 32))
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) < 3 {
+				t.Fatalf("only %d files in %s", len(entries), dir)
+			}
+			for _, entry := range entries {
+				info, err := entry.Info()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := info.Mode().Perm(), umasked(t, tt.wantFile); got != want {
+					t.Errorf("%s has mode %v, want %v", entry.Name(), got, want)
+				}
+			}
+			info, err := os.Stat(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := info.Mode().Perm(), umasked(t, tt.wantDir); got != want {
+				t.Errorf("directory has mode %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestKeyNormalizer(t *testing.T) {
+	tests := []struct {
+		name  string
+		check func(t *testing.T, db *SimpleDB) // Runs with "Foo" set to "one"
+	}{
+		{name: "get", check: func(t *testing.T, db *SimpleDB) {
+			wantValue(t, db, "foo", "one")
+			wantValue(t, db, "FOO", "one")
+		}},
+		{name: "overwrite", check: func(t *testing.T, db *SimpleDB) {
+			mustSet(t, db, "fOO", "two")
+			wantValue(t, db, "foo", "two")
+			if n := db.Len(); n != 1 {
+				t.Fatalf("Len() = %d, want 1", n)
+			}
+		}},
+		{name: "exists", check: func(t *testing.T, db *SimpleDB) {
+			if !db.Exists("FOO") {
+				t.Fatal("Exists(FOO) = false")
+			}
+		}},
+		{name: "delete", check: func(t *testing.T, db *SimpleDB) {
+			if err := db.Delete("FOO"); err != nil {
+				t.Fatal(err)
+			}
+			wantMissing(t, db, "foo")
+		}},
+		{name: "keys", check: func(t *testing.T, db *SimpleDB) {
+			mustSet(t, db, "BAR", "two")
+			if got := db.Keys(); !slices.Equal(got, []string{"bar", "foo"}) {
+				t.Fatalf("Keys() = %v, want [bar foo]", got)
+			}
+		}},
+		{name: "scan prefix", check: func(t *testing.T, db *SimpleDB) {
+			got, err := db.ScanPrefix("FO")
+			if err != nil || !maps.Equal(got, map[string]string{"foo": "one"}) {
+				t.Fatalf("ScanPrefix(FO) = %v, %v", got, err)
+			}
+		}},
+		{name: "scan range", check: func(t *testing.T, db *SimpleDB) {
+			got, err := db.ScanRange("F", "G")
+			if err != nil || !slices.Equal(got, []KVPair{{Key: "foo", Value: "one"}}) {
+				t.Fatalf("ScanRange(F, G) = %v, %v", got, err)
+			}
+		}},
+		{name: "watch", check: func(t *testing.T, db *SimpleDB) {
+			events, cancel := db.Watch("FOO")
+			defer cancel()
+			mustSet(t, db, "Foo", "two")
+			if event := nextEvent(t, events); event.Key != "foo" || event.Value != "two" {
+				t.Fatalf("event %+v, want foo set to two", event)
+			}
+		}},
+		{name: "increment", check: func(t *testing.T, db *SimpleDB) {
+			if _, err := db.Increment("N", 2); err != nil {
+				t.Fatal(err)
+			}
+			if n, err := db.Increment("n", 3); err != nil || n != 5 {
+				t.Fatalf("Increment(n) = %d, %v, want 5", n, err)
+			}
+		}},
+		{name: "reopen", check: func(t *testing.T, db *SimpleDB) {
+			path := db.path
+			db.Close()
+			db = reopenTestDB(t, path, Options{KeyNormalizer: LowercaseKeys})
+			wantValue(t, db, "FOO", "one")
+		}},
+		{name: "batch set", check: func(t *testing.T, db *SimpleDB) {
+			events, cancel := db.Watch("bar")
+			defer cancel()
+			if err := db.BatchSet([]KVPair{{Key: "FOO", Value: "two"}, {Key: "Bar", Value: "three"}}); err != nil {
+				t.Fatal(err)
+			}
+			if event := nextEvent(t, events); event.Key != "bar" || event.Value != "three" {
+				t.Fatalf("event %+v, want bar set to three", event)
+			}
+			check := func(db *SimpleDB) {
+				t.Helper()
+				for _, key := range []string{"foo", "FOO"} {
+					wantValue(t, db, key, "two")
+				}
+				for _, key := range []string{"bar", "BAR"} {
+					wantValue(t, db, key, "three")
+				}
+				if got := db.Keys(); !slices.Equal(got, []string{"bar", "foo"}) {
+					t.Fatalf("Keys() = %v, want [bar foo]", got)
+				}
+			}
+			check(db)
+			path := db.path
+			db.Close()
+			check(reopenTestDB(t, path, Options{KeyNormalizer: LowercaseKeys}))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{KeyNormalizer: LowercaseKeys})
+			mustSet(t, db, "Foo", "one")
+			tt.check(t, db)
+		})
+	}
+}
+
+func TestWithoutKeyNormalizer(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	mustSet(t, db, "Foo", "one")
+	wantMissing(t, db, "foo")
+	wantValue(t, db, "Foo", "one")
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"slices"
+)
+
+// ErrCorrupt is returned when a record fails its checksum or can't be decoded
+var ErrCorrupt = errors.New("corrupt record")
+
+// headerSize is the length of the header written before every record: the
+// little-endian payload length, so readers never depend on delimiters in the
+// payload, followed by the CRC32 of the payload.
+const headerSize = 8
+
+// encodeRecord serializes an entry into its framed on-disk form
+func encodeRecord(codec Codec, entry Record) ([]byte, error) {
+	payload, err := codec.Encode(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, headerSize+len(payload))
+	binary.LittleEndian.PutUint32(buf, uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(payload))
+	copy(buf[headerSize:], payload)
+	return buf, nil
+}
+
+// unknownSize is passed to readRecord for streams of unknown length
+const unknownSize = math.MaxInt64
+
+// payloadChunk is the most readRecord allocates for a payload ahead of
+// reading it, so a garbled length in a stream of unknown size costs no more
+// memory than the bytes actually there
+const payloadChunk = 1 << 20
+
+// readRecord reads one framed entry from r and returns it with its total
+// size on disk, header included. A record whose payload fails the checksum
+// returns ErrCorrupt along with its size so callers can skip past it.
+// remaining is the most bytes r can still yield; a header claiming more
+// than that is reported as io.ErrUnexpectedEOF, like a record cut short,
+// before anything is allocated for the payload.
+func readRecord(codec Codec, r io.Reader, remaining int64) (Record, int64, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Record{}, 0, err
+	}
+
+	length := int64(binary.LittleEndian.Uint32(header[:]))
+	if length > remaining-headerSize {
+		return Record{}, 0, io.ErrUnexpectedEOF
+	}
+	payload, err := readPayload(r, length)
+	if err != nil {
+		return Record{}, 0, err
+	}
+	size := headerSize + length
+
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+		return Record{}, size, ErrCorrupt
+	}
+
+	entry, err := codec.Decode(payload)
+	if err != nil {
+		return Record{}, size, ErrCorrupt
+	}
+	return entry, size, nil
+}
+
+// readPayload reads a payload of length bytes from r, growing the buffer as
+// the bytes arrive rather than trusting length up front
+func readPayload(r io.Reader, length int64) ([]byte, error) {
+	payload := make([]byte, 0, min(length, payloadChunk))
+	for int64(len(payload)) < length {
+		if len(payload) == cap(payload) {
+			payload = slices.Grow(payload, int(min(length-int64(len(payload)), int64(len(payload)))))
+		}
+		n, err := io.ReadFull(r, payload[len(payload):min(int64(cap(payload)), length)])
+		payload = payload[:len(payload)+n]
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+// scanEntries reads the entries of f between offsets start and end,
+// calling fn with each entry, its offset and its framed size. With
+// onCorrupt set, records failing their checksum are reported to it and
+// passed over instead of aborting the scan. It returns the offset just past
+// the last record it consumed, which on error is the start of the record that
+// could not be read.
+func scanEntries(codec Codec, f io.ReaderAt, start, end int64, onCorrupt func(offset int64), fn func(entry Record, offset, size int64) error) (int64, error) {
+	reader := bufio.NewReader(io.NewSectionReader(f, start, end-start))
+	offset := start
+
+	for {
+		entry, size, err := readRecord(codec, reader, end-offset)
+		if err == io.EOF {
+			return offset, nil
+		}
+		if errors.Is(err, ErrCorrupt) && onCorrupt != nil {
+			onCorrupt(offset)
+			offset += size
+			continue
+		}
+		if errors.Is(err, ErrCorrupt) {
+			return offset, fmt.Errorf("%w at offset %d", err, offset)
+		}
+		if err != nil {
+			return offset, err
+		}
+
+		if err := fn(entry, offset, size); err != nil {
+			return offset, err
+		}
+		offset += size
+	}
+}
+
+// readEntryAt decodes the entry at loc with a single read of exactly its
+// length, without moving the file offset
+func readEntryAt(codec Codec, f io.ReaderAt, loc location) (Record, error) {
+	buf := make([]byte, loc.Size)
+	if _, err := io.ReadFull(io.NewSectionReader(f, loc.Offset, loc.Size), buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Record{}, err
+	}
+
+	entry, size, err := readRecord(codec, bytes.NewReader(buf), loc.Size)
+	if err == nil && size != loc.Size {
+		err = ErrCorrupt
+	}
+	if errors.Is(err, ErrCorrupt) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return Record{}, fmt.Errorf("%w at offset %d", ErrCorrupt, loc.Offset)
+	}
+	return entry, err
+}
+
+// readValueAt reads the entry at loc and returns its plain value,
+// decrypted with aead if the value is encrypted
+func readValueAt(codec Codec, aead cipher.AEAD, f io.ReaderAt, loc location) ([]byte, error) {
+	entry, err := readEntryAt(codec, f, loc)
+	if err != nil {
+		return nil, err
+	}
+	return openValue(aead, entry)
+}
@@ -0,0 +1,258 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestReadRecordLength(t *testing.T) {
+	valid, err := encodeRecord(JSONCodec{}, Record{Key: "k", Value: []byte("value")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	huge := append([]byte(nil), valid...)
+	binary.LittleEndian.PutUint32(huge, 1<<31)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		remaining int64
+		want      error
+	}{
+		{"valid", valid, int64(len(valid)), nil},
+		{"valid in a stream", valid, unknownSize, nil},
+		{"cut short", valid[:len(valid)-1], int64(len(valid) - 1), io.ErrUnexpectedEOF},
+		{"length past the end", huge, int64(len(huge)), io.ErrUnexpectedEOF},
+		{"length past the end of a stream", huge, unknownSize, io.ErrUnexpectedEOF},
+		{"empty", nil, 0, io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			entry, size, err := readRecord(JSONCodec{}, bytes.NewReader(tt.data), tt.remaining)
+			runtime.ReadMemStats(&after)
+
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("readRecord = %v, want %v", err, tt.want)
+			}
+			if err == nil && (entry.Key != "k" || size != int64(len(valid))) {
+				t.Fatalf("readRecord = %+v, %d", entry, size)
+			}
+			// A garbled length must not be allocated up front
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 4<<20 {
+				t.Fatalf("readRecord allocated %d bytes", allocated)
+			}
+		})
+	}
+}
+
+func TestOpenCorruptLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		segment func(ids []int) int // Which segment to garble the first record of
+		wantErr error
+	}{
+		{"sealed segment", func(ids []int) int { return ids[0] }, ErrCorrupt},
+		{"last segment is treated as torn", func(ids []int) int { return ids[len(ids)-1] }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{SegmentSize: 256}
+			db, path := openTestDB(t, opts)
+			for i := 0; i < 20; i++ {
+				mustSet(t, db, fmt.Sprintf("key-%02d", i), "value")
+			}
+			ids := db.segmentIDs()
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			os.Remove(path + indexSuffix)
+
+			f, err := os.OpenFile(segmentPath(path, tt.segment(ids)), os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.WriteAt([]byte{0xff, 0xff, 0xff, 0x7f}, 0); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			db, err = OpenDBWithOptions(path, opts)
+			runtime.ReadMemStats(&after)
+			if err == nil {
+				db.Close()
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("OpenDBWithOptions = %v, want %v", err, tt.wantErr)
+			}
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<20 {
+				t.Fatalf("open allocated %d bytes", allocated)
+			}
+		})
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string // Whose latest record gets a byte flipped
+		reopen  bool
+		opts    Options
+		wantErr error // From Get while open, or from reopening
+		want    map[string]string
+		corrupt int // Records skipped on open
+	}{
+		{name: "read", key: "b", wantErr: ErrCorrupt, want: map[string]string{"a": "one", "c": "three"}},
+		{name: "open", key: "b", reopen: true, wantErr: ErrCorrupt},
+		{
+			name:    "open skipping corrupt records",
+			key:     "b",
+			reopen:  true,
+			opts:    Options{SkipCorrupt: true},
+			want:    map[string]string{"a": "one", "b": "old", "c": "three"},
+			corrupt: 1,
+		},
+		{
+			name:   "torn last record",
+			key:    "c",
+			reopen: true,
+			want:   map[string]string{"a": "one", "b": "two", "c": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, tt.opts)
+			mustSet(t, db, "a", "one")
+			mustSet(t, db, "b", "old")
+			mustSet(t, db, "b", "two")
+			mustSet(t, db, "c", "three")
+			loc := db.data[tt.key]
+			if tt.reopen {
+				if err := db.Close(); err != nil {
+					t.Fatal(err)
+				}
+				os.Remove(path + indexSuffix)
+			}
+
+			flipLastByte(t, path, loc)
+			if !tt.reopen {
+				if _, err := db.Get(tt.key); !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Get(%q) error = %v, want %v", tt.key, err, tt.wantErr)
+				}
+			} else {
+				var err error
+				db, err = OpenDBWithOptions(path, tt.opts)
+				if !errors.Is(err, tt.wantErr) {
+					if err == nil {
+						db.Close()
+					}
+					t.Fatalf("OpenDBWithOptions() = %v, want %v", err, tt.wantErr)
+				}
+				if err != nil {
+					return
+				}
+				defer db.Close()
+			}
+
+			for key, value := range tt.want {
+				if value == "" {
+					wantMissing(t, db, key)
+				} else {
+					wantValue(t, db, key, value)
+				}
+			}
+			stats, err := db.Stats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Corrupt != tt.corrupt {
+				t.Fatalf("Stats().Corrupt = %d, want %d", stats.Corrupt, tt.corrupt)
+			}
+		})
+	}
+}
+
+// flipLastByte corrupts the record at loc in the database at path. The last
+// byte of a record belongs to its payload, so the record keeps its framing
+// but fails its checksum.
+func flipLastByte(t *testing.T, path string, loc location) {
+	t.Helper()
+	f, err := os.OpenFile(segmentPath(path, loc.Segment), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, loc.Offset+loc.Size-1); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 0x01
+	if _, err := f.WriteAt(b, loc.Offset+loc.Size-1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countingReaderAt records every ReadAt made through it
+type countingReaderAt struct {
+	r     io.ReaderAt
+	reads [][2]int64 // Offset and length of each read
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	c.reads = append(c.reads, [2]int64{off, int64(len(p))})
+	return c.r.ReadAt(p, off)
+}
+
+func TestReadEntryAt(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		resize  int64 // Added to the indexed size before reading
+		wantErr error
+	}{
+		{name: "plain", value: "value"},
+		{name: "empty", value: ""},
+		{name: "newlines", value: "line one\nline two\n"},
+		{name: "binary", value: "\x00\xff\n\r\x01"},
+		{name: "large", value: string(bytes.Repeat([]byte("v"), 1<<20))},
+		{name: "size too small", value: "value", resize: -1, wantErr: ErrCorrupt},
+		{name: "size too large", value: "value", resize: 1, wantErr: ErrCorrupt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			mustSet(t, db, "before", "x")
+			mustSet(t, db, "k", tt.value)
+			mustSet(t, db, "after", "y")
+			if err := db.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			loc := db.data["k"]
+			loc.Size += tt.resize
+
+			// The index holds the record's length, so it takes one read
+			r := &countingReaderAt{r: db.segments[loc.Segment]}
+			entry, err := readEntryAt(db.opts.Codec, r, loc)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("readEntryAt() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(r.reads) != 1 || r.reads[0] != [2]int64{loc.Offset, loc.Size} {
+				t.Fatalf("reads %v, want one of %d bytes at %d", r.reads, loc.Size, loc.Offset)
+			}
+			if err == nil && (entry.Key != "k" || string(entry.Value) != tt.value) {
+				t.Fatalf("readEntryAt() = %q: %q", entry.Key, entry.Value)
+			}
+		})
+	}
+}
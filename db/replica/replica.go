@@ -0,0 +1,248 @@
+// Package replica keeps a database in sync with a primary server by
+// following its /replication/snapshot and /replication/log endpoints.
+package replica
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"saaster.tech/own-db/db"
+)
+
+// positionSaveInterval bounds how often a follower saves its position.
+// Records applied since the last save are applied again after a restart,
+// which is harmless.
+const positionSaveInterval = time.Second
+
+// maxRetryDelay caps the back-off between attempts to reach the primary
+const maxRetryDelay = 30 * time.Second
+
+// LogRecord is one line of the /replication/log stream
+type LogRecord struct {
+	Position string    `json:"position"` // Where to resume after this record
+	Record   db.Record `json:"record"`
+}
+
+// errResync means the follower's position is gone and it must reload a
+// snapshot
+var errResync = errors.New("primary no longer has the log from our position")
+
+// Follower applies everything written to a primary to a local database
+type Follower struct {
+	// DB is the database kept in sync
+	DB *db.SimpleDB
+
+	// Primary is the base URL of the primary, e.g. http://primary:8080
+	Primary string
+
+	// APIKey is presented to the primary as a bearer token; empty sends none
+	APIKey string
+
+	// StatePath is the file where the primary's log position the follower
+	// has applied up to is kept across restarts
+	StatePath string
+
+	// Client sends the requests to the primary; nil uses
+	// http.DefaultClient
+	Client *http.Client
+
+	// Logger receives progress and errors; nil uses slog.Default()
+	Logger *slog.Logger
+}
+
+// Run keeps the database in sync with the primary until ctx is done,
+// reconnecting with back-off whenever the stream breaks
+func (f *Follower) Run(ctx context.Context) {
+	delay := time.Second
+	for {
+		progressed, err := f.followOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errResync) {
+			f.logger().Warn("replication position is stale; reloading", "primary", f.Primary)
+			continue
+		}
+		if progressed {
+			delay = time.Second
+		}
+		f.logger().Error("replication interrupted", "primary", f.Primary, "err", err, "retry_in", delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// followOnce streams the primary's log from the saved position, loading a
+// snapshot first if there is none, and reports whether it applied anything
+func (f *Follower) followOnce(ctx context.Context) (bool, error) {
+	pos, err := loadPosition(f.StatePath)
+	if errors.Is(err, os.ErrNotExist) {
+		pos, err = f.loadSnapshot(ctx)
+		if err == nil {
+			err = savePosition(f.StatePath, pos)
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := f.get(ctx, "/replication/log?from="+url.QueryEscape(pos.String()))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone {
+		if err := os.Remove(f.StatePath); err != nil {
+			return false, err
+		}
+		return false, errResync
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("primary answered %s", resp.Status)
+	}
+
+	progressed := false
+	saved := time.Now()
+	defer func() {
+		if progressed {
+			savePosition(f.StatePath, pos)
+		}
+	}()
+
+	// Records the primary wrote together are held back until the last of
+	// them arrives, then applied together
+	var batch []db.Record
+	scanner := bufio.NewScanner(resp.Body)
+	// Lines carry whole values
+	scanner.Buffer(nil, 1<<30)
+	for scanner.Scan() {
+		var line LogRecord
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return progressed, err
+		}
+		next, err := db.ParsePosition(line.Position)
+		if err != nil {
+			return progressed, err
+		}
+		batch = append(batch, line.Record)
+		if line.Record.Batch > 0 {
+			continue
+		}
+		if err := f.DB.Apply(batch...); err != nil {
+			return progressed, err
+		}
+		batch = batch[:0]
+		pos, progressed = next, true
+
+		if time.Since(saved) >= positionSaveInterval {
+			if err := savePosition(f.StatePath, pos); err != nil {
+				return progressed, err
+			}
+			saved = time.Now()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return progressed, err
+	}
+	return progressed, errors.New("primary closed the stream")
+}
+
+// loadSnapshot replaces the contents of the database with a snapshot of the
+// primary and returns the log position to follow on from
+func (f *Follower) loadSnapshot(ctx context.Context) (db.Position, error) {
+	resp, err := f.get(ctx, "/replication/snapshot")
+	if err != nil {
+		return db.Position{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return db.Position{}, fmt.Errorf("primary answered %s", resp.Status)
+	}
+
+	// The trailer is only there once the whole dump was read, and the
+	// database only changes if it is
+	var pos db.Position
+	body := &trailerCheck{resp: resp, pos: &pos}
+	loaded, err := f.DB.Load(body)
+	if err != nil {
+		return db.Position{}, err
+	}
+
+	f.logger().Info("loaded snapshot", "primary", f.Primary, "keys", loaded)
+	return pos, nil
+}
+
+// trailerCheck reads a snapshot response body and fails the read that hits
+// its end unless the X-Log-Position trailer, which the primary only sends
+// after a complete dump, is there
+type trailerCheck struct {
+	resp *http.Response
+	pos  *db.Position
+}
+
+func (t *trailerCheck) Read(p []byte) (int, error) {
+	n, err := t.resp.Body.Read(p)
+	if err != io.EOF {
+		return n, err
+	}
+	pos, parseErr := db.ParsePosition(t.resp.Trailer.Get("X-Log-Position"))
+	if parseErr != nil {
+		return n, fmt.Errorf("incomplete snapshot: %w", parseErr)
+	}
+	*t.pos = pos
+	return n, io.EOF
+}
+
+// get sends an authenticated GET for path to the primary
+func (f *Follower) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(f.Primary, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+f.APIKey)
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+func (f *Follower) logger() *slog.Logger {
+	if f.Logger == nil {
+		return slog.Default()
+	}
+	return f.Logger
+}
+
+func loadPosition(path string) (db.Position, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return db.Position{}, err
+	}
+	return db.ParsePosition(string(raw))
+}
+
+func savePosition(path string, pos db.Position) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(pos.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
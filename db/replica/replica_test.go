@@ -0,0 +1,190 @@
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"saaster.tech/own-db/db"
+)
+
+// primary serves a snapshot of the keys in snapshot followed by log, and
+// closes the log stream once log is sent
+type primary struct {
+	t        *testing.T
+	snapshot map[string]string
+	log      []LogRecord
+	apiKey   string
+	trailer  bool // Whether the snapshot ends with its X-Log-Position trailer
+}
+
+func (p *primary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.apiKey != "" && r.Header.Get("Authorization") != "Bearer "+p.apiKey {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/replication/snapshot":
+		src, err := db.OpenDB(filepath.Join(p.t.TempDir(), "primary.db"))
+		if err != nil {
+			p.t.Fatal(err)
+		}
+		defer src.Close()
+		for key, value := range p.snapshot {
+			if err := src.Set(key, value); err != nil {
+				p.t.Fatal(err)
+			}
+		}
+		w.Header().Set("Trailer", "X-Log-Position")
+		if _, err := src.Checkpoint(w); err != nil {
+			p.t.Fatal(err)
+		}
+		if p.trailer {
+			w.Header().Set("X-Log-Position", "1.0.0")
+		}
+	case "/replication/log":
+		enc := json.NewEncoder(w)
+		for _, line := range p.log {
+			enc.Encode(line)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestFollowOnce(t *testing.T) {
+	set := func(pos, key string, batch int) LogRecord {
+		return LogRecord{Position: pos, Record: db.Record{Key: key, Value: []byte(key), Batch: batch}}
+	}
+
+	tests := []struct {
+		name     string
+		primary  primary
+		apiKey   string
+		want     []string // Keys the replica ends up with
+		wantPos  string   // Saved position, empty for none
+		progress bool
+	}{
+		{
+			name:    "snapshot only",
+			primary: primary{snapshot: map[string]string{"a": "a", "b": "b"}, trailer: true},
+			want:    []string{"a", "b"},
+			wantPos: "1.0.0",
+		},
+		{
+			name: "snapshot and log",
+			primary: primary{
+				snapshot: map[string]string{"a": "a"},
+				log:      []LogRecord{set("1.0.10", "c", 0), set("1.0.20", "d", 1), set("1.0.30", "e", 0)},
+				trailer:  true,
+			},
+			want:     []string{"a", "c", "d", "e"},
+			wantPos:  "1.0.30",
+			progress: true,
+		},
+		{
+			name: "batch cut short",
+			primary: primary{
+				snapshot: map[string]string{"a": "a"},
+				log:      []LogRecord{set("1.0.10", "c", 0), set("1.0.20", "d", 1)},
+				trailer:  true,
+			},
+			want:     []string{"a", "c"},
+			wantPos:  "1.0.10",
+			progress: true,
+		},
+		{
+			name:    "snapshot cut short",
+			primary: primary{snapshot: map[string]string{"a": "a"}},
+			want:    []string{"old"},
+		},
+		{
+			name:    "primary API key",
+			primary: primary{snapshot: map[string]string{"a": "a"}, apiKey: "secret", trailer: true},
+			apiKey:  "secret",
+			want:    []string{"a"},
+			wantPos: "1.0.0",
+		},
+		{
+			name:    "wrong API key",
+			primary: primary{snapshot: map[string]string{"a": "a"}, apiKey: "secret", trailer: true},
+			apiKey:  "other",
+			want:    []string{"old"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.primary.t = t
+			srv := httptest.NewServer(&tt.primary)
+			defer srv.Close()
+
+			dir := t.TempDir()
+			d, err := db.OpenDB(filepath.Join(dir, "replica.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+			if err := d.Set("old", "old"); err != nil {
+				t.Fatal(err)
+			}
+
+			f := &Follower{DB: d, Primary: srv.URL + "/", APIKey: tt.apiKey, StatePath: filepath.Join(dir, "replica.db.replica")}
+			progressed, err := f.followOnce(context.Background())
+			if err == nil {
+				t.Fatal("followOnce returned no error once the stream ended")
+			}
+			if progressed != tt.progress {
+				t.Fatalf("followOnce reported progress %v, want %v", progressed, tt.progress)
+			}
+
+			if got := d.Keys(); !slices.Equal(got, tt.want) {
+				t.Fatalf("Keys() = %v, want %v", got, tt.want)
+			}
+			pos, err := loadPosition(f.StatePath)
+			if tt.wantPos == "" {
+				if err == nil {
+					t.Fatalf("position %s saved, want none", pos)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pos.String() != tt.wantPos {
+				t.Fatalf("saved position %s, want %s", pos, tt.wantPos)
+			}
+		})
+	}
+}
+
+func TestFollowOnceResync(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	d, err := db.OpenDB(filepath.Join(dir, "replica.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	f := &Follower{DB: d, Primary: srv.URL, StatePath: filepath.Join(dir, "replica.db.replica")}
+	if err := savePosition(f.StatePath, db.Position{Generation: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.followOnce(context.Background()); !errors.Is(err, errResync) {
+		t.Fatalf("followOnce = %v, want errResync", err)
+	}
+	if _, err := loadPosition(f.StatePath); err == nil {
+		t.Fatal("stale position was kept")
+	}
+}
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrStalePosition is returned by ReadLog, ReadFrom and ReadRange when the
+// position they were given no longer refers to the log, because the
+// database was compacted, cleared or reopened since. The follower has to
+// start over from a Checkpoint.
+var ErrStalePosition = errors.New("log position is stale")
+
+// Position identifies a point in the log, for followers to resume from.
+// Generation changes whenever the files are rewritten, which invalidates
+// every earlier position.
+type Position struct {
+	Generation int64
+	Segment    int
+	Offset     int64
+}
+
+// String formats the position as generation.segment.offset
+func (p Position) String() string {
+	return fmt.Sprintf("%d.%d.%d", p.Generation, p.Segment, p.Offset)
+}
+
+// ParsePosition parses a position formatted by Position.String
+func ParsePosition(s string) (Position, error) {
+	var p Position
+	if _, err := fmt.Sscanf(s, "%d.%d.%d", &p.Generation, &p.Segment, &p.Offset); err != nil {
+		return Position{}, fmt.Errorf("invalid log position %q", s)
+	}
+	return p, nil
+}
+
+// Checkpoint is like Backup but also returns the log position the dump
+// corresponds to. Loading the dump with Restore and then applying
+// everything ReadLog returns from that position reproduces the database.
+// As with ReadLog, values are written decompressed and decrypted, so the
+// follower applies its own compression and encryption settings.
+func (db *SimpleDB) Checkpoint(w io.Writer) (Position, error) {
+	it, err := db.NewIterator()
+	if err != nil {
+		return Position{}, err
+	}
+	defer it.Close()
+
+	if err := db.backup(it, w, true); err != nil {
+		return Position{}, err
+	}
+	return it.position, nil
+}
+
+// ReadLog calls fn with every record appended from position from onwards,
+// in log order, along with the position just past it. Once it has caught up
+// it waits for new records until ctx is done. Values are handed over
+// decompressed and decrypted. It returns ErrStalePosition as soon as the
+// position no longer refers to the log, and otherwise the first error from
+// fn or ctx. As with ReadFrom, the zero Position starts at the beginning.
+func (db *SimpleDB) ReadLog(ctx context.Context, from Position, fn func(entry Record, next Position) error) error {
+	pos := from
+	// Only the caller's position needs checking; later ones come from the reader
+	check := true
+	for {
+		db.mu.RLock()
+		if db.closed {
+			db.mu.RUnlock()
+			return ErrClosed
+		}
+		// Taken before the reader so a record appended in between still wakes us
+		appended := db.appended
+		db.mu.RUnlock()
+
+		lr, err := db.openLog(pos, nil, check)
+		if err != nil {
+			return err
+		}
+		check = false
+		for lr.Next() {
+			if err := fn(lr.Record(), lr.Position()); err != nil {
+				lr.Close()
+				return err
+			}
+		}
+		pos = lr.Position()
+		err = lr.Err()
+		lr.Close()
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-appended:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// plainRecord returns entry with its value decompressed and decrypted
+func plainRecord(aead cipher.AEAD, entry Record) (Record, error) {
+	if entry.Deleted || entry.Touched {
+		return entry, nil
+	}
+	value, err := openValue(aead, entry)
+	if err != nil {
+		return Record{}, err
+	}
+	entry.Value, entry.Compression, entry.Nonce = value, CompressionNone, nil
+	return entry, nil
+}
+
+// Apply applies records read from another database's log with ReadLog,
+// with a single write so they take effect together or not at all: values
+// are written with their expiry, tombstones delete the key and expiry
+// updates move its expiry. Tombstones and expiry updates for keys that
+// don't exist are ignored, so a record can safely be applied twice. Records
+// the other database wrote together, which ReadLog hands over with Batch
+// counting down to zero, should be applied in one call.
+func (db *SimpleDB) Apply(entries ...Record) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return db.UpdateTx(func(tx *WriteTx) error {
+		for _, entry := range entries {
+			if err := tx.apply(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// apply buffers a record read from another database's log
+func (tx *WriteTx) apply(entry Record) error {
+	if entry.Deleted || entry.Touched {
+		_, err := tx.Get(entry.Key)
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if entry.Deleted {
+			tx.buffer(Record{Key: entry.Key, Deleted: true})
+			return nil
+		}
+		// Not pending: reads in the transaction still see the value
+		tx.ops = append(tx.ops, Record{Key: entry.Key, Touched: true, ExpiresAt: entry.ExpiresAt})
+		return nil
+	}
+
+	if err := tx.db.checkKey(entry.Key, len(entry.Value)); err != nil {
+		return err
+	}
+	tx.buffer(Record{Key: entry.Key, Value: entry.Value, ExpiresAt: entry.ExpiresAt})
+	return nil
+}
+
+// logChanged wakes ReadLog callers waiting for new records. Callers must
+// hold the write lock.
+func (db *SimpleDB) logChanged() {
+	close(db.appended)
+	db.appended = make(chan struct{})
+}
+
+// rewritten starts a new generation after the files were rewritten, so
+// followers know their positions are no longer valid. Callers must hold the
+// write lock.
+func (db *SimpleDB) rewritten() {
+	db.generation++
+	db.logChanged()
+}
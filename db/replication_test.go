@@ -0,0 +1,82 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApply(t *testing.T) {
+	later := time.Now().Add(time.Hour).UnixNano()
+
+	tests := []struct {
+		name    string
+		entries []Record
+		want    map[string]string // Keys expected afterwards; "a" starts out as "one"
+		wantTTL bool              // Whether "a" ends up with an expiry
+		wantErr bool
+	}{
+		{
+			name:    "set",
+			entries: []Record{{Key: "b", Value: []byte("two")}},
+			want:    map[string]string{"a": "one", "b": "two"},
+		},
+		{
+			name:    "delete",
+			entries: []Record{{Key: "a", Deleted: true}},
+			want:    map[string]string{},
+		},
+		{
+			name:    "delete of a missing key",
+			entries: []Record{{Key: "b", Deleted: true}},
+			want:    map[string]string{"a": "one"},
+		},
+		{
+			name:    "touch",
+			entries: []Record{{Key: "a", Touched: true, ExpiresAt: later}, {Key: "b", Touched: true, ExpiresAt: later}},
+			want:    map[string]string{"a": "one"},
+			wantTTL: true,
+		},
+		{
+			name:    "batch",
+			entries: []Record{{Key: "b", Value: []byte("two"), Batch: 2}, {Key: "a", Deleted: true, Batch: 1}, {Key: "c", Value: []byte("three")}},
+			want:    map[string]string{"b": "two", "c": "three"},
+		},
+		{
+			name:    "batch with a bad record",
+			entries: []Record{{Key: "b", Value: []byte("two"), Batch: 1}, {Key: "c", Value: []byte(strings.Repeat("x", 100))}},
+			want:    map[string]string{"a": "one"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{MaxValueSize: 50})
+			mustSet(t, db, "a", "one")
+
+			err := db.Apply(tt.entries...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() = %v, want error %v", err, tt.wantErr)
+			}
+			check := func(db *SimpleDB) {
+				t.Helper()
+				for key, value := range tt.want {
+					wantValue(t, db, key, value)
+				}
+				if got := db.Len(); got != len(tt.want) {
+					t.Fatalf("Len() = %d, want %d", got, len(tt.want))
+				}
+			}
+			check(db)
+			if _, ttl, err := db.GetWithTTL("a"); err == nil && (ttl != 0) != tt.wantTTL {
+				t.Fatalf("a expires in %s, want an expiry %v", ttl, tt.wantTTL)
+			}
+
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			check(reopenTestDB(t, path, Options{MaxValueSize: 50}))
+		})
+	}
+}
@@ -0,0 +1,331 @@
+// gRPC interface to an own-db database. Regenerate the Go code in ../pb with:
+//
+//   protoc -I . --go_out=../pb --go_opt=paths=source_relative \
+//     --go-grpc_out=../pb --go-grpc_opt=paths=source_relative owndb.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v25.3.0
+// source: owndb.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	OwnDB_Set_FullMethodName    = "/owndb.v1.OwnDB/Set"
+	OwnDB_Get_FullMethodName    = "/owndb.v1.OwnDB/Get"
+	OwnDB_Delete_FullMethodName = "/owndb.v1.OwnDB/Delete"
+	OwnDB_Scan_FullMethodName   = "/owndb.v1.OwnDB/Scan"
+	OwnDB_Watch_FullMethodName  = "/owndb.v1.OwnDB/Watch"
+)
+
+// OwnDBClient is the client API for OwnDB service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type OwnDBClient interface {
+	// Set adds or updates a key, optionally expiring it after ttl_seconds
+	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	// Get returns the value of a key, or NOT_FOUND
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	// Delete removes a key, or returns NOT_FOUND if it doesn't exist
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// Scan streams every pair whose key starts with prefix, in key order
+	Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (OwnDB_ScanClient, error)
+	// Watch streams every set and delete of a key starting with prefix until
+	// the client cancels. Headers are sent once the watch is registered.
+	// Events are dropped if the client falls too far behind.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (OwnDB_WatchClient, error)
+}
+
+type ownDBClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewOwnDBClient(cc grpc.ClientConnInterface) OwnDBClient {
+	return &ownDBClient{cc}
+}
+
+func (c *ownDBClient) Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error) {
+	out := new(SetResponse)
+	err := c.cc.Invoke(ctx, OwnDB_Set_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ownDBClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, OwnDB_Get_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ownDBClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, OwnDB_Delete_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ownDBClient) Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (OwnDB_ScanClient, error) {
+	stream, err := c.cc.NewStream(ctx, &OwnDB_ServiceDesc.Streams[0], OwnDB_Scan_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ownDBScanClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type OwnDB_ScanClient interface {
+	Recv() (*KeyValue, error)
+	grpc.ClientStream
+}
+
+type ownDBScanClient struct {
+	grpc.ClientStream
+}
+
+func (x *ownDBScanClient) Recv() (*KeyValue, error) {
+	m := new(KeyValue)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *ownDBClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (OwnDB_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &OwnDB_ServiceDesc.Streams[1], OwnDB_Watch_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ownDBWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type OwnDB_WatchClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type ownDBWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *ownDBWatchClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// OwnDBServer is the server API for OwnDB service.
+// All implementations must embed UnimplementedOwnDBServer
+// for forward compatibility
+type OwnDBServer interface {
+	// Set adds or updates a key, optionally expiring it after ttl_seconds
+	Set(context.Context, *SetRequest) (*SetResponse, error)
+	// Get returns the value of a key, or NOT_FOUND
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	// Delete removes a key, or returns NOT_FOUND if it doesn't exist
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// Scan streams every pair whose key starts with prefix, in key order
+	Scan(*ScanRequest, OwnDB_ScanServer) error
+	// Watch streams every set and delete of a key starting with prefix until
+	// the client cancels. Headers are sent once the watch is registered.
+	// Events are dropped if the client falls too far behind.
+	Watch(*WatchRequest, OwnDB_WatchServer) error
+	mustEmbedUnimplementedOwnDBServer()
+}
+
+// UnimplementedOwnDBServer must be embedded to have forward compatible implementations.
+type UnimplementedOwnDBServer struct {
+}
+
+func (UnimplementedOwnDBServer) Set(context.Context, *SetRequest) (*SetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Set not implemented")
+}
+func (UnimplementedOwnDBServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedOwnDBServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedOwnDBServer) Scan(*ScanRequest, OwnDB_ScanServer) error {
+	return status.Errorf(codes.Unimplemented, "method Scan not implemented")
+}
+func (UnimplementedOwnDBServer) Watch(*WatchRequest, OwnDB_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedOwnDBServer) mustEmbedUnimplementedOwnDBServer() {}
+
+// UnsafeOwnDBServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to OwnDBServer will
+// result in compilation errors.
+type UnsafeOwnDBServer interface {
+	mustEmbedUnimplementedOwnDBServer()
+}
+
+func RegisterOwnDBServer(s grpc.ServiceRegistrar, srv OwnDBServer) {
+	s.RegisterService(&OwnDB_ServiceDesc, srv)
+}
+
+func _OwnDB_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OwnDBServer).Set(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OwnDB_Set_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OwnDBServer).Set(ctx, req.(*SetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OwnDB_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OwnDBServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OwnDB_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OwnDBServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OwnDB_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OwnDBServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OwnDB_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OwnDBServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OwnDB_Scan_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ScanRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OwnDBServer).Scan(m, &ownDBScanServer{stream})
+}
+
+type OwnDB_ScanServer interface {
+	Send(*KeyValue) error
+	grpc.ServerStream
+}
+
+type ownDBScanServer struct {
+	grpc.ServerStream
+}
+
+func (x *ownDBScanServer) Send(m *KeyValue) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _OwnDB_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OwnDBServer).Watch(m, &ownDBWatchServer{stream})
+}
+
+type OwnDB_WatchServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type ownDBWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *ownDBWatchServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// OwnDB_ServiceDesc is the grpc.ServiceDesc for OwnDB service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var OwnDB_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "owndb.v1.OwnDB",
+	HandlerType: (*OwnDBServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Set",
+			Handler:    _OwnDB_Set_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _OwnDB_Get_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _OwnDB_Delete_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Scan",
+			Handler:       _OwnDB_Scan_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _OwnDB_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "owndb.proto",
+}
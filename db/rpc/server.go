@@ -0,0 +1,153 @@
+// Package rpc serves a SimpleDB over gRPC. It is separate from the db package
+// so programs that only use the HTTP API don't depend on gRPC.
+package rpc
+
+//go:generate protoc -I proto --go_out=pb --go_opt=paths=source_relative --go-grpc_out=pb --go-grpc_opt=paths=source_relative owndb.proto
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"saaster.tech/own-db/db"
+	"saaster.tech/own-db/db/rpc/pb"
+)
+
+// Server implements the OwnDB gRPC service on top of a database
+type Server struct {
+	pb.UnimplementedOwnDBServer
+	db       *db.SimpleDB
+	stop     chan struct{} // Closed by Stop to end Watch streams
+	stopOnce sync.Once
+}
+
+// NewServer returns a service backed by d
+func NewServer(d *db.SimpleDB) *Server {
+	return &Server{db: d, stop: make(chan struct{})}
+}
+
+// Register adds the OwnDB service backed by d to s and returns it
+func Register(s *grpc.Server, d *db.SimpleDB) *Server {
+	srv := NewServer(d)
+	pb.RegisterOwnDBServer(s, srv)
+	return srv
+}
+
+// Stop ends every Watch stream, which otherwise only ends when the client
+// goes away, so a graceful stop of the gRPC server doesn't wait on them.
+// Watch streams started afterwards end straight away.
+func (s *Server) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+func (s *Server) Set(ctx context.Context, req *pb.SetRequest) (*pb.SetResponse, error) {
+	var err error
+	if req.TtlSeconds > 0 {
+		err = s.db.SetWithTTL(req.Key, string(req.Value), time.Duration(req.TtlSeconds)*time.Second)
+	} else {
+		err = s.db.SetBytesContext(ctx, req.Key, req.Value)
+	}
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.SetResponse{}, nil
+}
+
+func (s *Server) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	value, err := s.db.GetBytesContext(ctx, req.Key)
+	if err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.GetResponse{Value: value}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	if err := s.db.DeleteContext(ctx, req.Key); err != nil {
+		return nil, toStatus(err, codes.Internal)
+	}
+	return &pb.DeleteResponse{}, nil
+}
+
+// Scan reads values one at a time from an iterator, so large results are
+// never held in memory
+func (s *Server) Scan(req *pb.ScanRequest, stream pb.OwnDB_ScanServer) error {
+	it, err := s.db.NewIterator()
+	if err != nil {
+		return toStatus(err, codes.Internal)
+	}
+	defer it.Close()
+
+	for it.Next() {
+		if err := stream.Context().Err(); err != nil {
+			return toStatus(err, codes.Internal)
+		}
+		if !strings.HasPrefix(it.Key(), req.Prefix) {
+			continue
+		}
+		value, err := it.Value()
+		if err != nil {
+			return toStatus(err, codes.Internal)
+		}
+		if err := stream.Send(&pb.KeyValue{Key: it.Key(), Value: []byte(value)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Watch sends the response headers once the subscription is in place, so a
+// client can wait on Header to know no later change will be missed
+func (s *Server) Watch(req *pb.WatchRequest, stream pb.OwnDB_WatchServer) error {
+	events, cancel := s.db.WatchPrefix(req.Prefix)
+	defer cancel()
+
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.stop:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case event, ok := <-events:
+			if !ok {
+				return toStatus(db.ErrClosed, codes.Unavailable)
+			}
+			msg := &pb.Event{Type: pb.Event_SET, Key: event.Key, Value: []byte(event.Value)}
+			if event.Type == db.EventDelete {
+				msg.Type = pb.Event_DELETE
+			}
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// toStatus converts a database error to a gRPC status, using fallback for
+// errors without a more specific code
+func toStatus(err error, fallback codes.Code) error {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	case errors.Is(err, db.ErrKeyNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, db.ErrKeyTooLarge), errors.Is(err, db.ErrValueTooLarge), errors.Is(err, db.ErrInvalidKey):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, db.ErrReadOnly):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, db.ErrClosed):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, db.ErrCorrupt), errors.Is(err, db.ErrDecrypt):
+		return status.Error(codes.DataLoss, err.Error())
+	}
+	return status.Error(fallback, err.Error())
+}
@@ -0,0 +1,303 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"saaster.tech/own-db/db"
+	"saaster.tech/own-db/db/rpc/pb"
+)
+
+// watchStream is a Watch stream that hands sent events to a channel
+type watchStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	events chan *pb.Event
+}
+
+func (w *watchStream) Context() context.Context { return w.ctx }
+
+func (w *watchStream) SendHeader(metadata.MD) error { return nil }
+
+// Send drops events nobody is waiting for, so Watch never blocks on it
+func (w *watchStream) Send(event *pb.Event) error {
+	select {
+	case w.events <- event:
+	default:
+	}
+	return nil
+}
+
+func TestWatchEnds(t *testing.T) {
+	tests := []struct {
+		name string
+		end  func(s *Server, d *db.SimpleDB, cancel context.CancelFunc)
+		code codes.Code
+	}{
+		{name: "client goes away", end: func(_ *Server, _ *db.SimpleDB, cancel context.CancelFunc) { cancel() }, code: codes.OK},
+		{name: "server stops", end: func(s *Server, _ *db.SimpleDB, _ context.CancelFunc) { s.Stop() }, code: codes.Unavailable},
+		{name: "database closes", end: func(_ *Server, d *db.SimpleDB, _ context.CancelFunc) { d.Close() }, code: codes.Unavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := db.OpenDB(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+			s := NewServer(d)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stream := &watchStream{ctx: ctx, events: make(chan *pb.Event, 1)}
+			done := make(chan error, 1)
+			go func() { done <- s.Watch(&pb.WatchRequest{Prefix: "a"}, stream) }()
+
+			// Once an event comes through the watch is in place
+			deadline := time.After(5 * time.Second)
+			for received := false; !received; {
+				if err := d.Set("a", "1"); err != nil {
+					t.Fatal(err)
+				}
+				select {
+				case <-stream.events:
+					received = true
+				case <-time.After(10 * time.Millisecond):
+				case <-deadline:
+					t.Fatal("no event")
+				}
+			}
+
+			tt.end(s, d, cancel)
+			select {
+			case err := <-done:
+				if got := status.Code(err); got != tt.code {
+					t.Fatalf("Watch returned %v, want code %v", err, tt.code)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Watch did not return")
+			}
+		})
+	}
+}
+
+// dial starts an in-process gRPC server backed by a fresh database and
+// returns a client connected to it
+func dial(t *testing.T, opts db.Options) (pb.OwnDBClient, *db.SimpleDB) {
+	t.Helper()
+	d, err := db.OpenDBWithOptions(filepath.Join(t.TempDir(), "test.db"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	srv := Register(s, d)
+	go s.Serve(lis)
+	t.Cleanup(func() {
+		srv.Stop()
+		s.Stop()
+	})
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewOwnDBClient(conn), d
+}
+
+func TestUnary(t *testing.T) {
+	tests := []struct {
+		name string
+		opts db.Options
+		call func(ctx context.Context, c pb.OwnDBClient) (string, error)
+		want string
+		code codes.Code
+	}{
+		{
+			name: "get",
+			call: func(ctx context.Context, c pb.OwnDBClient) (string, error) {
+				resp, err := c.Get(ctx, &pb.GetRequest{Key: "a"})
+				return string(resp.GetValue()), err
+			},
+			want: "one",
+		},
+		{
+			name: "set",
+			call: func(ctx context.Context, c pb.OwnDBClient) (string, error) {
+				if _, err := c.Set(ctx, &pb.SetRequest{Key: "a", Value: []byte("two")}); err != nil {
+					return "", err
+				}
+				resp, err := c.Get(ctx, &pb.GetRequest{Key: "a"})
+				return string(resp.GetValue()), err
+			},
+			want: "two",
+		},
+		{
+			name: "set with ttl",
+			call: func(ctx context.Context, c pb.OwnDBClient) (string, error) {
+				if _, err := c.Set(ctx, &pb.SetRequest{Key: "b", Value: []byte("soon"), TtlSeconds: 60}); err != nil {
+					return "", err
+				}
+				resp, err := c.Get(ctx, &pb.GetRequest{Key: "b"})
+				return string(resp.GetValue()), err
+			},
+			want: "soon",
+		},
+		{
+			name: "delete",
+			call: func(ctx context.Context, c pb.OwnDBClient) (string, error) {
+				if _, err := c.Delete(ctx, &pb.DeleteRequest{Key: "a"}); err != nil {
+					return "", err
+				}
+				resp, err := c.Get(ctx, &pb.GetRequest{Key: "a"})
+				return string(resp.GetValue()), err
+			},
+			code: codes.NotFound,
+		},
+		{
+			name: "missing",
+			call: func(ctx context.Context, c pb.OwnDBClient) (string, error) {
+				resp, err := c.Get(ctx, &pb.GetRequest{Key: "missing"})
+				return string(resp.GetValue()), err
+			},
+			code: codes.NotFound,
+		},
+		{
+			name: "empty key",
+			call: func(ctx context.Context, c pb.OwnDBClient) (string, error) {
+				_, err := c.Set(ctx, &pb.SetRequest{Key: "", Value: []byte("x")})
+				return "", err
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "value too large",
+			opts: db.Options{MaxValueSize: 4},
+			call: func(ctx context.Context, c pb.OwnDBClient) (string, error) {
+				_, err := c.Set(ctx, &pb.SetRequest{Key: "a", Value: []byte("too long")})
+				return "", err
+			},
+			code: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, d := dial(t, tt.opts)
+			if err := d.Set("a", "one"); err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			got, err := tt.call(ctx, c)
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("error = %v, want code %v", err, tt.code)
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		want   []string
+	}{
+		{name: "all", want: []string{"user:1=alice", "user:2=bob", "zone=eu"}},
+		{name: "prefix", prefix: "user:", want: []string{"user:1=alice", "user:2=bob"}},
+		{name: "no match", prefix: "missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, d := dial(t, db.Options{})
+			for key, value := range map[string]string{"user:1": "alice", "user:2": "bob", "zone": "eu"} {
+				if err := d.Set(key, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			stream, err := c.Scan(ctx, &pb.ScanRequest{Prefix: tt.prefix})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for {
+				kv, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, kv.Key+"="+string(kv.Value))
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("Scan(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatch(t *testing.T) {
+	c, d := dial(t, db.Options{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := c.Watch(ctx, &pb.WatchRequest{Prefix: "user:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Headers arrive once the subscription is in place
+	if _, err := stream.Header(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Set("other", "ignored"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set("user:1", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete("user:1"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*pb.Event{
+		{Type: pb.Event_SET, Key: "user:1", Value: []byte("alice")},
+		{Type: pb.Event_DELETE, Key: "user:1"},
+	}
+	for _, w := range want {
+		got, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Type != w.Type || got.Key != w.Key || string(got.Value) != string(w.Value) {
+			t.Fatalf("got %v, want %v", got, w)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Keys returns a snapshot of all live keys in ascending lexicographic order.
+// If spilled keys can't be read back, the failure is logged and only the
+// keys held in memory are returned. A closed database has no keys.
+func (db *SimpleDB) Keys() []string {
+	db.mu.RLock()
+	if db.closed {
+		db.mu.RUnlock()
+		return []string{}
+	}
+	all, err := db.indexed()
+	if err != nil {
+		db.opts.Logger.Error("reading spilled keys failed", "path", db.path, "err", err)
+		all = db.data
+	}
+	keys := make([]string, 0, len(all))
+	for key := range all {
+		if !db.expired(key) {
+			keys = append(keys, key)
+		}
+	}
+	db.mu.RUnlock()
+
+	sort.Strings(keys)
+	return keys
+}
+
+// ScanPrefix returns every live key starting with prefix along with its value.
+// An empty prefix matches all keys. The index is an unordered map, so this
+// walks every key in the database (O(n)) regardless of how many match.
+func (db *SimpleDB) ScanPrefix(prefix string) (map[string]string, error) {
+	return db.ScanPrefixContext(context.Background(), prefix)
+}
+
+// ScanPrefixContext is like ScanPrefix but stops reading values and returns
+// the context's error as soon as ctx is done
+func (db *SimpleDB) ScanPrefixContext(ctx context.Context, prefix string) (_ map[string]string, err error) {
+	prefix = db.normalize(prefix)
+	defer db.observe(OpScan, db.start(OpScan), &err)
+	span := db.startSpan(ctx, OpScan, prefix)
+	defer func() { span.End(0, err) }()
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	all, err := db.indexed()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string)
+	for key, loc := range all {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(key, prefix) || db.expired(key) {
+			continue
+		}
+
+		value, err := db.readValue(loc)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = string(value)
+	}
+
+	return result, nil
+}
+
+// ScanRange returns the pairs with start <= key < end in ascending key order.
+// An empty end means no upper bound. Keys are sorted on demand, so each call
+// costs O(n log n) in the total number of keys.
+func (db *SimpleDB) ScanRange(start, end string) ([]KVPair, error) {
+	return db.ScanRangeContext(context.Background(), start, end)
+}
+
+// ScanRangeContext is like ScanRange but stops reading values and returns
+// the context's error as soon as ctx is done
+func (db *SimpleDB) ScanRangeContext(ctx context.Context, start, end string) ([]KVPair, error) {
+	return db.ScanRangeLimit(ctx, start, end, 0)
+}
+
+// ScanRangeLimit is like ScanRangeContext but returns only the first limit
+// pairs, and only reads their values. Zero means no limit. Pages can be
+// continued by starting the next one just after the last key returned.
+func (db *SimpleDB) ScanRangeLimit(ctx context.Context, start, end string, limit int) (_ []KVPair, err error) {
+	start, end = db.normalize(start), db.normalize(end)
+	defer db.observe(OpScan, db.start(OpScan), &err)
+	span := db.startSpan(ctx, OpScan, start)
+	defer func() { span.End(0, err) }()
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	all, err := db.indexed()
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for key := range all {
+		if key >= start && (end == "" || key < end) && !db.expired(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	pairs := make([]KVPair, 0, len(keys))
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		value, err := db.readValue(all[key])
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, KVPair{Key: key, Value: string(value)})
+	}
+
+	return pairs, nil
+}
+
+// DeleteRange deletes every key with start <= key < end under a single write
+// lock and returns how many were removed. As with ScanRange, an empty end
+// means no upper bound, so DeleteRange("", "") deletes everything.
+func (db *SimpleDB) DeleteRange(start, end string) (int, error) {
+	start, end = db.normalize(start), db.normalize(end)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return 0, ErrClosed
+	}
+
+	all, err := db.indexed()
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for key := range all {
+		if key < start || (end != "" && key >= end) || db.expired(key) {
+			continue
+		}
+		if err := db.del(key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, db *SimpleDB)
+		want  []string
+	}{
+		{name: "empty"},
+		{
+			name: "sorted",
+			setup: func(t *testing.T, db *SimpleDB) {
+				for _, key := range []string{"c", "a", "b"} {
+					mustSet(t, db, key, "v")
+				}
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "overwritten once",
+			setup: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "a", "1")
+				mustSet(t, db, "a", "2")
+			},
+			want: []string{"a"},
+		},
+		{
+			name: "without deleted and expired keys",
+			setup: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "a", "v")
+				mustSet(t, db, "b", "v")
+				if err := db.Delete("b"); err != nil {
+					t.Fatal(err)
+				}
+				if err := db.SetWithTTL("c", "v", time.Millisecond); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(5 * time.Millisecond)
+			},
+			want: []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			if tt.setup != nil {
+				tt.setup(t, db)
+			}
+			if got := db.Keys(); !slices.Equal(got, tt.want) {
+				t.Fatalf("Keys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		want   map[string]string
+	}{
+		{name: "empty prefix", prefix: "", want: map[string]string{"user:1:name": "ann", "user:1:age": "30", "user:2:name": "bob", "users": "2"}},
+		{name: "one user", prefix: "user:1:", want: map[string]string{"user:1:name": "ann", "user:1:age": "30"}},
+		{name: "whole key", prefix: "users", want: map[string]string{"users": "2"}},
+		{name: "no match", prefix: "order:", want: map[string]string{}},
+	}
+
+	db, _ := openTestDB(t, Options{})
+	for key, value := range tests[0].want {
+		mustSet(t, db, key, value)
+	}
+	mustSet(t, db, "user:3:name", "cat")
+	if err := db.Delete("user:3:name"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.ScanPrefix(tt.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Fatalf("ScanPrefix(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end string
+		limit      int
+		want       []string
+	}{
+		{name: "everything", want: []string{"a", "b", "ba", "c", "d"}},
+		{name: "bounded", start: "b", end: "c", want: []string{"b", "ba"}},
+		{name: "start between keys", start: "bb", want: []string{"c", "d"}},
+		{name: "end is exclusive", end: "d", want: []string{"a", "b", "ba", "c"}},
+		{name: "empty range", start: "c", end: "c"},
+		{name: "inverted range", start: "d", end: "a"},
+		{name: "limit", start: "b", limit: 2, want: []string{"b", "ba"}},
+	}
+
+	db, _ := openTestDB(t, Options{})
+	for _, key := range []string{"d", "ba", "a", "c", "b", "e"} {
+		mustSet(t, db, key, "value of "+key)
+	}
+	if err := db.Delete("e"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pairs, err := db.ScanRangeLimit(context.Background(), tt.start, tt.end, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var keys []string
+			for _, pair := range pairs {
+				if pair.Value != "value of "+pair.Key {
+					t.Fatalf("%q holds %q", pair.Key, pair.Value)
+				}
+				keys = append(keys, pair.Key)
+			}
+			if !slices.Equal(keys, tt.want) {
+				t.Fatalf("ScanRange(%q, %q) = %v, want %v", tt.start, tt.end, keys, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end string
+		want       []string // Keys left
+	}{
+		{name: "everything", want: nil},
+		{name: "bounded", start: "b", end: "c", want: []string{"a", "c", "d"}},
+		{name: "start is inclusive", start: "c", want: []string{"a", "b", "ba"}},
+		{name: "end is exclusive", end: "c", want: []string{"c", "d"}},
+		{name: "empty range", start: "c", end: "c", want: []string{"a", "b", "ba", "c", "d"}},
+		{name: "inverted range", start: "d", end: "a", want: []string{"a", "b", "ba", "c", "d"}},
+		{name: "no keys in range", start: "bb", end: "bz", want: []string{"a", "b", "ba", "c", "d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			for _, key := range []string{"d", "ba", "a", "c", "b"} {
+				mustSet(t, db, key, "v")
+			}
+			// Already gone, so not counted
+			if err := db.SetWithTTL("bb", "v", time.Millisecond); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			deleted, err := db.DeleteRange(tt.start, tt.end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := 5 - len(tt.want); deleted != want {
+				t.Fatalf("DeleteRange(%q, %q) = %d, want %d", tt.start, tt.end, deleted, want)
+			}
+			if got := db.Keys(); !slices.Equal(got, tt.want) {
+				t.Fatalf("keys left %v, want %v", got, tt.want)
+			}
+
+			// The deletes are in the log, not just the index
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			db = reopenTestDB(t, path, Options{})
+			if got := db.Keys(); !slices.Equal(got, tt.want) {
+				t.Fatalf("keys left after reopening %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
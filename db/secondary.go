@@ -0,0 +1,268 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// secondarySuffix is appended to the database path for the file listing
+// the secondary indexes
+const secondarySuffix = ".indexes"
+
+// ErrNoIndex is returned when querying or dropping an index that doesn't exist
+var ErrNoIndex = errors.New("no such index")
+
+// secondaryIndex maps the value of one JSON field to the keys holding it
+type secondaryIndex struct {
+	Path  string                         `json:"path"`
+	keys  map[string]map[string]struct{} // Field value to the keys that have it
+	field map[string]string              // Indexed field value of each key
+}
+
+// CreateIndex starts maintaining a secondary index called name over the
+// field at jsonPath, a dot-separated path into values that are JSON objects
+// such as "user.email". Strings are indexed as-is and numbers and booleans
+// by their JSON text; keys whose value isn't JSON or lacks the field are
+// left out. The index is built from every live key before CreateIndex
+// returns and is kept up to date by every later write and delete.
+//
+// Index definitions are stored next to the data file and the indexes are
+// rebuilt on open, which reads every value. Creating an index that already
+// exists with the same path does nothing.
+func (db *SimpleDB) CreateIndex(name, jsonPath string) error {
+	if jsonPath == "" {
+		return errors.New("index path must not be empty")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	if idx, exists := db.indexes[name]; exists {
+		if idx.Path == jsonPath {
+			return nil
+		}
+		return errors.New("index " + name + " already exists with a different path")
+	}
+
+	idx, err := db.buildIndex(jsonPath)
+	if err != nil {
+		return err
+	}
+	if db.indexes == nil {
+		db.indexes = make(map[string]*secondaryIndex)
+	}
+	db.indexes[name] = idx
+	if db.opts.ReadOnly {
+		return nil
+	}
+	if err := db.saveIndexes(); err != nil {
+		delete(db.indexes, name)
+		return err
+	}
+	return nil
+}
+
+// DropIndex stops maintaining the named index and forgets its definition
+func (db *SimpleDB) DropIndex(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	if _, exists := db.indexes[name]; !exists {
+		return ErrNoIndex
+	}
+	delete(db.indexes, name)
+	if db.opts.ReadOnly {
+		return nil
+	}
+	return db.saveIndexes()
+}
+
+// QueryIndex returns the live keys, in ascending order, whose indexed field
+// equals fieldValue
+func (db *SimpleDB) QueryIndex(name, fieldValue string) ([]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	idx, exists := db.indexes[name]
+	if !exists {
+		return nil, ErrNoIndex
+	}
+	keys := make([]string, 0, len(idx.keys[fieldValue]))
+	for key := range idx.keys[fieldValue] {
+		// Expired keys stay indexed until the sweep or a compaction
+		live, err := db.exists(key)
+		if err != nil {
+			return nil, err
+		}
+		if live {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// loadIndexes reads the index definitions saved by CreateIndex and builds
+// each index from the current data. A missing file means there are none.
+func (db *SimpleDB) loadIndexes() error {
+	raw, err := os.ReadFile(db.path + secondarySuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var defs map[string]*secondaryIndex
+	if err := json.Unmarshal(raw, &defs); err != nil {
+		return err
+	}
+	db.indexes = defs
+	return db.rebuildIndexes()
+}
+
+// rebuildIndexes rebuilds every secondary index from the current data.
+// Callers must hold the write lock.
+func (db *SimpleDB) rebuildIndexes() error {
+	for name, def := range db.indexes {
+		idx, err := db.buildIndex(def.Path)
+		if err != nil {
+			return err
+		}
+		db.indexes[name] = idx
+	}
+	return nil
+}
+
+// saveIndexes writes the index definitions next to the data file. Callers
+// must hold the write lock.
+func (db *SimpleDB) saveIndexes() error {
+	raw, err := json.Marshal(db.indexes)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := db.path + secondarySuffix + ".tmp"
+	if err := os.WriteFile(tmpPath, raw, db.opts.FileMode); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, db.path+secondarySuffix)
+}
+
+// buildIndex indexes the field at jsonPath across every key. Callers must
+// hold at least the read lock.
+func (db *SimpleDB) buildIndex(jsonPath string) (*secondaryIndex, error) {
+	idx := &secondaryIndex{
+		Path:  jsonPath,
+		keys:  make(map[string]map[string]struct{}),
+		field: make(map[string]string),
+	}
+	all, err := db.indexed()
+	if err != nil {
+		return nil, err
+	}
+	for key, loc := range all {
+		value, err := db.readValue(loc)
+		if err != nil {
+			return nil, err
+		}
+		idx.set(key, value)
+	}
+	return idx, nil
+}
+
+// reindex applies a change to every secondary index. Callers must hold the
+// write lock.
+func (db *SimpleDB) reindex(event Event) {
+	for _, idx := range db.indexes {
+		idx.remove(event.Key)
+		if event.Type == EventSet {
+			idx.set(event.Key, []byte(event.Value))
+		}
+	}
+}
+
+// unindex drops key from every secondary index, for keys that go away
+// without an event. Callers must hold the write lock.
+func (db *SimpleDB) unindex(key string) {
+	for _, idx := range db.indexes {
+		idx.remove(key)
+	}
+}
+
+// set indexes key under the field found in value, if any, replacing
+// whatever it was indexed under before
+func (idx *secondaryIndex) set(key string, value []byte) {
+	idx.remove(key)
+	field, ok := jsonField(value, idx.Path)
+	if !ok {
+		return
+	}
+	if idx.keys[field] == nil {
+		idx.keys[field] = make(map[string]struct{})
+	}
+	idx.keys[field][key] = struct{}{}
+	idx.field[key] = field
+}
+
+// remove drops key from the index
+func (idx *secondaryIndex) remove(key string) {
+	field, ok := idx.field[key]
+	if !ok {
+		return
+	}
+	delete(idx.keys[field], key)
+	if len(idx.keys[field]) == 0 {
+		delete(idx.keys, field)
+	}
+	delete(idx.field, key)
+}
+
+// jsonField returns the string, number or boolean at the dot-separated path
+// within a JSON object, formatted as it is matched by QueryIndex
+func jsonField(value []byte, path string) (string, bool) {
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	var current any
+	if err := dec.Decode(&current); err != nil {
+		return "", false
+	}
+
+	for _, name := range strings.Split(path, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		current, ok = object[name]
+		if !ok {
+			return "", false
+		}
+	}
+
+	switch v := current.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSecondaryIndexDropsKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		remove func(t *testing.T, db *SimpleDB)
+		kept   bool // Whether b stays in the index under another value
+	}{
+		{
+			name: "delete",
+			remove: func(t *testing.T, db *SimpleDB) {
+				if err := db.Delete("b"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "overwrite",
+			remove: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "b", `{"team":"blue"}`)
+			},
+			kept: true,
+		},
+		{
+			name: "expiry sweep",
+			remove: func(t *testing.T, db *SimpleDB) {
+				time.Sleep(10 * time.Millisecond)
+				if _, err := db.sweepExpired(); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "compaction of an expired key",
+			remove: func(t *testing.T, db *SimpleDB) {
+				time.Sleep(10 * time.Millisecond)
+				if err := db.Compact(); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			if err := db.CreateIndex("team", "team"); err != nil {
+				t.Fatal(err)
+			}
+			mustSet(t, db, "a", `{"team":"red"}`)
+			if err := db.SetWithTTL("b", `{"team":"red"}`, time.Millisecond); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.remove(t, db)
+			keys, err := db.QueryIndex("team", "red")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(keys, []string{"a"}) {
+				t.Fatalf("QueryIndex(red) = %v, want [a]", keys)
+			}
+			// Not just hidden from the query, but gone from the index
+			if _, ok := db.indexes["team"].field["b"]; ok != tt.kept {
+				t.Fatalf("b in the index: %v, want %v", ok, tt.kept)
+			}
+			if _, ok := db.indexes["team"].keys["red"]["b"]; ok {
+				t.Fatal("b is still indexed under red")
+			}
+		})
+	}
+}
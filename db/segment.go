@@ -0,0 +1,155 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// location is where a record lives: a segment, the byte offset of the
+// record within it and its framed length. It also carries the record's
+// version and creation time, so writes can stamp the next version without
+// reading the record back.
+type location struct {
+	Segment int   `json:"segment"`
+	Offset  int64 `json:"offset"`
+	Size    int64 `json:"size"`
+	Version int64 `json:"version,omitempty"`
+	Created int64 `json:"created,omitempty"`
+}
+
+// segmentPath returns the file name of a segment. Segment 0 is the database
+// path itself, so a database that never rolls over is a single plain file;
+// later segments get a zero-padded numeric suffix.
+func segmentPath(path string, id int) string {
+	if id == 0 {
+		return path
+	}
+	return fmt.Sprintf("%s.%06d", path, id)
+}
+
+// listSegments returns the IDs of the segment files that exist for path, in
+// ascending order
+func listSegments(path string) ([]int, error) {
+	var ids []int
+	if _, err := os.Stat(path); err == nil {
+		ids = append(ids, 0)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(path) + "."
+	for _, entry := range entries {
+		suffix, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok || suffix == "" || strings.Trim(suffix, "0123456789") != "" {
+			continue
+		}
+		id, err := strconv.Atoi(suffix)
+		if err != nil || id == 0 {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// segmentIDs returns the IDs of the open segments in ascending order.
+// Callers must hold at least the read lock.
+func (db *SimpleDB) segmentIDs() []int {
+	ids := make([]int, 0, len(db.segments))
+	for id := range db.segments {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// openSegments opens a separate read-only handle on every segment, for
+// readers that must keep working after a compaction swaps the files out.
+// Buffered writes are flushed first so the handles see them. Callers must
+// hold at least the read lock.
+func (db *SimpleDB) openSegments() (map[int]*os.File, error) {
+	if err := db.flushWrites(); err != nil {
+		return nil, err
+	}
+	files := make(map[int]*os.File, len(db.segments))
+	for id := range db.segments {
+		file, err := os.Open(segmentPath(db.path, id))
+		if err != nil {
+			closeSegments(files)
+			return nil, err
+		}
+		files[id] = file
+	}
+	return files, nil
+}
+
+// closeSegments closes every file in files, returning the first error
+func closeSegments(files map[int]*os.File) error {
+	var errs []error
+	for _, file := range files {
+		errs = append(errs, file.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// maybeRoll starts a new segment when appending n more bytes would take the
+// current one past Options.SegmentSize. A record bigger than SegmentSize
+// still gets written, alone in a fresh segment. Callers must hold the write
+// lock.
+func (db *SimpleDB) maybeRoll(n int64) error {
+	if db.opts.SegmentSize == 0 || db.segmentSize == 0 || db.segmentSize+n <= db.opts.SegmentSize {
+		return nil
+	}
+
+	// The finished segment is never appended to again, so make it durable
+	// before anything lands in the next one
+	if err := db.flushWrites(); err != nil {
+		return err
+	}
+	if err := db.file.Sync(); err != nil {
+		return err
+	}
+
+	id := db.segment + 1
+	file, err := os.OpenFile(segmentPath(db.path, id), os.O_CREATE|os.O_EXCL|os.O_RDWR|os.O_APPEND, db.opts.FileMode)
+	if err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(db.path))
+
+	db.segments[id] = file
+	db.segment = id
+	db.file = file
+	db.resetWriter(file)
+	db.segmentSize = 0
+	return nil
+}
+
+// readEntry decodes the entry stored at loc. Callers must hold at least the
+// read lock.
+func (db *SimpleDB) readEntry(loc location) (Record, error) {
+	if err := db.flushFor(loc); err != nil {
+		return Record{}, err
+	}
+	return readEntryAt(db.opts.Codec, db.readerAt(loc.Segment), loc)
+}
+
+// readValue reads the plain value of the entry stored at loc. Callers must
+// hold at least the read lock.
+func (db *SimpleDB) readValue(loc location) ([]byte, error) {
+	if err := db.flushFor(loc); err != nil {
+		return nil, err
+	}
+	return readValueAt(db.opts.Codec, db.aead, db.readerAt(loc.Segment), loc)
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+)
+
+// ErrNotSet is returned by the set operations when the value stored at the
+// key isn't a set, that is a JSON array of strings
+var ErrNotSet = errors.New("value is not a set")
+
+// The set operations treat the value of a key as a set of strings, stored
+// as a sorted JSON array without duplicates, for tags, memberships and the
+// like. As with lists, every write decodes and rewrites the whole set under
+// the write lock, so they suit sets of modest size. A missing key is an
+// empty set, removing the last member deletes the key, and every write
+// clears any TTL.
+
+// SAdd adds members to the set at key and returns how many weren't in it
+// already. Adding only members that are present writes nothing.
+func (db *SimpleDB) SAdd(key string, members ...string) (int, error) {
+	key = db.normalize(key)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return 0, ErrClosed
+	}
+
+	set, err := db.lookupSet(key)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, member := range members {
+		if _, ok := set[member]; !ok {
+			set[member] = struct{}{}
+			added++
+		}
+	}
+	if added == 0 {
+		return 0, nil
+	}
+
+	if err := db.setSet(key, set); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// SRem removes members from the set at key and returns how many were in it
+func (db *SimpleDB) SRem(key string, members ...string) (int, error) {
+	key = db.normalize(key)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return 0, ErrClosed
+	}
+
+	set, err := db.lookupSet(key)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, member := range members {
+		if _, ok := set[member]; ok {
+			delete(set, member)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	if len(set) == 0 {
+		err = db.del(key)
+	} else {
+		err = db.setSet(key, set)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// SIsMember reports whether member is in the set at key
+func (db *SimpleDB) SIsMember(key, member string) (bool, error) {
+	key = db.normalize(key)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return false, ErrClosed
+	}
+
+	set, err := db.lookupSet(key)
+	if err != nil {
+		return false, err
+	}
+	_, ok := set[member]
+	return ok, nil
+}
+
+// SMembers returns the members of the set at key in ascending order
+func (db *SimpleDB) SMembers(key string) ([]string, error) {
+	key = db.normalize(key)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	set, err := db.lookupSet(key)
+	if err != nil {
+		return nil, err
+	}
+	return sortedMembers(set), nil
+}
+
+// lookupSet returns the set stored at key, empty if the key is missing.
+// Callers must hold at least the read lock.
+func (db *SimpleDB) lookupSet(key string) (map[string]struct{}, error) {
+	value, exists, err := db.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]struct{})
+	if !exists {
+		return set, nil
+	}
+
+	var members []string
+	if err := decodeJSON(value, &members); err != nil || members == nil {
+		return nil, ErrNotSet
+	}
+	for _, member := range members {
+		set[member] = struct{}{}
+	}
+	return set, nil
+}
+
+// setSet stores set at key. Callers must hold the write lock.
+func (db *SimpleDB) setSet(key string, set map[string]struct{}) error {
+	value, err := json.Marshal(sortedMembers(set))
+	if err != nil {
+		return err
+	}
+	return db.set(key, value)
+}
+
+// sortedMembers returns the members of set in ascending order
+func sortedMembers(set map[string]struct{}) []string {
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
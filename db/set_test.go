@@ -0,0 +1,270 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// wantMembers fails unless the set at key holds exactly want
+func wantMembers(t *testing.T, db *SimpleDB, key string, want []string) {
+	t.Helper()
+	got, err := db.SMembers(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("SMembers(%q) = %q, want %q", key, got, want)
+	}
+}
+
+func TestSAdd(t *testing.T) {
+	tests := []struct {
+		name       string
+		members    []string // Added to a set holding b and d
+		wantAdded  int
+		want       []string
+		wantWrites int64 // Log writes SAdd makes
+	}{
+		{name: "new", members: []string{"a", "c"}, wantAdded: 2, want: []string{"a", "b", "c", "d"}, wantWrites: 1},
+		{name: "all present", members: []string{"b", "d"}, want: []string{"b", "d"}},
+		{name: "some present", members: []string{"b", "e"}, wantAdded: 1, want: []string{"b", "d", "e"}, wantWrites: 1},
+		{name: "duplicates in one call", members: []string{"a", "a", "a"}, wantAdded: 1, want: []string{"a", "b", "d"}, wantWrites: 1},
+		{name: "none", want: []string{"b", "d"}},
+		{name: "empty member", members: []string{""}, wantAdded: 1, want: []string{"", "b", "d"}, wantWrites: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			if _, err := db.SAdd("s", "d", "b"); err != nil {
+				t.Fatal(err)
+			}
+			before, err := db.Stats()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			added, err := db.SAdd("s", tt.members...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if added != tt.wantAdded {
+				t.Fatalf("SAdd() = %d, want %d", added, tt.wantAdded)
+			}
+			after, err := db.Stats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if writes := after.Writes - before.Writes; writes != tt.wantWrites {
+				t.Fatalf("%d writes, want %d", writes, tt.wantWrites)
+			}
+
+			wantMembers(t, db, "s", tt.want)
+			db.Close()
+			wantMembers(t, reopenTestDB(t, path, Options{}), "s", tt.want)
+		})
+	}
+}
+
+func TestSAddIdempotent(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	for i := 0; i < 3; i++ {
+		added, err := db.SAdd("s", "a", "b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 0
+		if i == 0 {
+			want = 2
+		}
+		if added != want {
+			t.Fatalf("SAdd() call %d = %d, want %d", i, added, want)
+		}
+	}
+	wantMembers(t, db, "s", []string{"a", "b"})
+	wantValue(t, db, "s", `["a","b"]`)
+}
+
+func TestSRem(t *testing.T) {
+	tests := []struct {
+		name        string
+		members     []string // Removed from a set holding a, b and c
+		wantRemoved int
+		want        []string // Empty when the key should be gone
+	}{
+		{name: "one", members: []string{"b"}, wantRemoved: 1, want: []string{"a", "c"}},
+		{name: "absent", members: []string{"x"}, want: []string{"a", "b", "c"}},
+		{name: "some absent", members: []string{"a", "x"}, wantRemoved: 1, want: []string{"b", "c"}},
+		{name: "duplicates in one call", members: []string{"a", "a"}, wantRemoved: 1, want: []string{"b", "c"}},
+		{name: "last members delete the key", members: []string{"a", "b", "c"}, wantRemoved: 3},
+		{name: "none", want: []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			if _, err := db.SAdd("s", "a", "b", "c"); err != nil {
+				t.Fatal(err)
+			}
+
+			removed, err := db.SRem("s", tt.members...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != tt.wantRemoved {
+				t.Fatalf("SRem() = %d, want %d", removed, tt.wantRemoved)
+			}
+
+			check := func(db *SimpleDB) {
+				t.Helper()
+				got, err := db.SMembers("s")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !slices.Equal(got, tt.want) && len(got)+len(tt.want) > 0 {
+					t.Fatalf("SMembers() = %q, want %q", got, tt.want)
+				}
+				if exists := db.Exists("s"); exists != (len(tt.want) > 0) {
+					t.Fatalf("Exists() = %v, want %v", exists, len(tt.want) > 0)
+				}
+			}
+			check(db)
+			db.Close()
+			check(reopenTestDB(t, path, Options{}))
+		})
+	}
+}
+
+func TestSRemMissing(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	if removed, err := db.SRem("missing", "a"); err != nil || removed != 0 {
+		t.Fatalf("SRem() = %d, %v, want 0", removed, err)
+	}
+	wantMissing(t, db, "missing")
+}
+
+func TestSIsMember(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		member string
+		want   bool
+	}{
+		{name: "member", key: "s", member: "a", want: true},
+		{name: "not a member", key: "s", member: "z"},
+		{name: "empty member", key: "s", member: ""},
+		{name: "missing key", key: "missing", member: "a"},
+	}
+
+	db, _ := openTestDB(t, Options{})
+	if _, err := db.SAdd("s", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.SIsMember(tt.key, tt.member)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("SIsMember(%q, %q) = %v, want %v", tt.key, tt.member, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSMembersStoredArray(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string // Written with Set rather than SAdd
+		want  []string
+	}{
+		{name: "unsorted", value: `["c","a","b"]`, want: []string{"a", "b", "c"}},
+		{name: "duplicates", value: `["a","b","a"]`, want: []string{"a", "b"}},
+		{name: "empty", value: `[]`, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			mustSet(t, db, "s", tt.value)
+			wantMembers(t, db, "s", tt.want)
+		})
+	}
+}
+
+func TestSetNotASet(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "text", value: "plain"},
+		{name: "object", value: `{"a":1}`},
+		{name: "numbers", value: `[1,2]`},
+		{name: "null", value: `null`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			mustSet(t, db, "k", tt.value)
+			ops := map[string]func() error{
+				"SAdd":      func() error { _, err := db.SAdd("k", "v"); return err },
+				"SRem":      func() error { _, err := db.SRem("k", "v"); return err },
+				"SIsMember": func() error { _, err := db.SIsMember("k", "v"); return err },
+				"SMembers":  func() error { _, err := db.SMembers("k"); return err },
+			}
+			for op, run := range ops {
+				if err := run(); !errors.Is(err, ErrNotSet) {
+					t.Fatalf("%s() = %v, want ErrNotSet", op, err)
+				}
+			}
+			wantValue(t, db, "k", tt.value)
+		})
+	}
+}
+
+func TestSAddConcurrent(t *testing.T) {
+	const workers, each = 8, 50
+	db, _ := openTestDB(t, Options{})
+
+	// Every worker adds the same members, so each is new to exactly one
+	var wg sync.WaitGroup
+	added := make(chan int, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			total := 0
+			for i := 0; i < each; i++ {
+				n, err := db.SAdd("s", fmt.Sprintf("m%03d", i))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				total += n
+			}
+			added <- total
+		}()
+	}
+	wg.Wait()
+	close(added)
+
+	total := 0
+	for n := range added {
+		total += n
+	}
+	if total != each {
+		t.Fatalf("%d members reported added, want %d", total, each)
+	}
+	members, err := db.SMembers("s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != each {
+		t.Fatalf("%d members, want %d", len(members), each)
+	}
+}
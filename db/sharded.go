@@ -0,0 +1,187 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ShardedDB spreads keys over several databases by a hash of the key, so
+// writes to different shards don't wait on each other's lock. Each shard is
+// a complete SimpleDB with its own log, compaction and index.
+//
+// Operations on a single key go to the shard that owns it; Keys and scans
+// ask every shard and merge the results, so they see no consistent snapshot
+// across shards. Transactions and batches can't span shards: use Shard to
+// reach the database owning a key for anything ShardedDB doesn't wrap.
+type ShardedDB struct {
+	shards    []*SimpleDB
+	normalize func(key string) string
+}
+
+// shardName is the file name of each shard inside the directory
+const shardName = "shard%03d"
+
+// OpenSharded opens a database of n shards in dir, creating the directory
+// if needed. Every shard is opened with opts. A database must always be
+// reopened with the same number of shards, since that decides where each
+// key lives; opening it with another count fails.
+func OpenSharded(dir string, n int, opts Options) (*ShardedDB, error) {
+	if n < 1 {
+		return nil, errors.New("a sharded database needs at least one shard")
+	}
+
+	existing, err := countShards(dir)
+	if err != nil {
+		return nil, err
+	}
+	if existing > 0 && existing != n {
+		return nil, fmt.Errorf("%s holds %d shards, not %d", dir, existing, n)
+	}
+
+	mode := opts.FileMode
+	if mode == 0 {
+		mode = defaultFileMode
+	}
+	if !opts.ReadOnly {
+		if err := os.MkdirAll(dir, dirMode(mode)); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &ShardedDB{shards: make([]*SimpleDB, n)}
+	for i := range s.shards {
+		shard, err := OpenDBWithOptions(filepath.Join(dir, fmt.Sprintf(shardName, i)), opts)
+		if err != nil {
+			s.shards = s.shards[:i]
+			s.Close()
+			return nil, err
+		}
+		s.shards[i] = shard
+	}
+	s.normalize = s.shards[0].normalize
+	return s, nil
+}
+
+// countShards returns how many shards there are in dir. The glob also
+// matches each shard's segment and lock files, which the name check skips.
+func countShards(dir string) (int, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "shard[0-9]*"))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, match := range matches {
+		name := filepath.Base(match)
+		id, err := strconv.Atoi(strings.TrimPrefix(name, "shard"))
+		if err == nil && id >= 0 && fmt.Sprintf(shardName, id) == name {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Shard returns the database that owns key
+func (s *ShardedDB) Shard(key string) *SimpleDB {
+	h := fnv.New32a()
+	h.Write([]byte(s.normalize(key)))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// Get retrieves the value of key from its shard
+func (s *ShardedDB) Get(key string) (string, error) {
+	return s.Shard(key).Get(key)
+}
+
+// Set adds or updates key in its shard
+func (s *ShardedDB) Set(key, value string) error {
+	return s.Shard(key).Set(key, value)
+}
+
+// Delete removes key from its shard
+func (s *ShardedDB) Delete(key string) error {
+	return s.Shard(key).Delete(key)
+}
+
+// Exists reports whether key is present in its shard
+func (s *ShardedDB) Exists(key string) bool {
+	return s.Shard(key).Exists(key)
+}
+
+// Keys returns the live keys of every shard in ascending order
+func (s *ShardedDB) Keys() []string {
+	var keys []string
+	for _, shard := range s.shards {
+		keys = append(keys, shard.Keys()...)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Len returns the number of live keys across all shards
+func (s *ShardedDB) Len() int {
+	n := 0
+	for _, shard := range s.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+// ScanPrefix returns every key starting with prefix, from all shards, with
+// its value
+func (s *ShardedDB) ScanPrefix(prefix string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, shard := range s.shards {
+		pairs, err := shard.ScanPrefix(prefix)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range pairs {
+			result[key] = value
+		}
+	}
+	return result, nil
+}
+
+// ScanRange returns the pairs with keys in [start, end) from all shards,
+// sorted by key. An empty end means no upper bound.
+func (s *ShardedDB) ScanRange(start, end string) ([]KVPair, error) {
+	var pairs []KVPair
+	for _, shard := range s.shards {
+		shardPairs, err := shard.ScanRange(start, end)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, shardPairs...)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Key < pairs[j].Key
+	})
+	return pairs, nil
+}
+
+// Flush writes out and syncs every shard
+func (s *ShardedDB) Flush() error {
+	for _, shard := range s.shards {
+		if err := shard.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every shard, returning the first error
+func (s *ShardedDB) Close() error {
+	var first error
+	for _, shard := range s.shards {
+		if err := shard.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,266 @@
+package db
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCountShards(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  int
+	}{
+		{name: "empty"},
+		{name: "shards", files: []string{"shard000", "shard001", "shard002"}, want: 3},
+		{name: "segment and lock files", files: []string{"shard000", "shard000.000001", "shard000.lock", "shard000.idx", "shard001"}, want: 2},
+		{name: "a thousand and more", files: []string{"shard998", "shard999", "shard1000", "shard1001"}, want: 4},
+		{name: "other files", files: []string{"shard000", "shard1", "shards", "shard-1", "notes"}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := countShards(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("countShards() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenShardedCount(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenSharded(dir, 3, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := s.Set(fmt.Sprintf("key-%d", i), "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []int{2, 4} {
+		if s, err := OpenSharded(dir, n, Options{}); err == nil {
+			s.Close()
+			t.Fatalf("reopening 3 shards as %d succeeded", n)
+		}
+	}
+	s, err = OpenSharded(dir, 3, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := s.Len(); got != 20 {
+		t.Fatalf("Len() = %d, want 20", got)
+	}
+}
+
+// openTestSharded opens a sharded database in a temporary directory that
+// is closed when the test ends, returning it and the directory
+func openTestSharded(t *testing.T, n int, opts Options) (*ShardedDB, string) {
+	t.Helper()
+	dir := t.TempDir()
+	s, err := OpenSharded(dir, n, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, dir
+}
+
+func TestShardedRouting(t *testing.T) {
+	tests := []struct {
+		name   string
+		shards int
+		opts   Options
+		set    string // How keys are spelled when set
+		get    string // How they are spelled when read back
+	}{
+		{name: "one shard", shards: 1, set: "key-%d", get: "key-%d"},
+		{name: "several shards", shards: 4, set: "key-%d", get: "key-%d"},
+		{name: "many shards", shards: 16, set: "key-%d", get: "key-%d"},
+		{name: "normalized", shards: 4, opts: Options{KeyNormalizer: LowercaseKeys}, set: "KEY-%d", get: "Key-%d"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, dir := openTestSharded(t, tt.shards, tt.opts)
+			const n = 200
+			for i := 0; i < n; i++ {
+				if err := s.Set(fmt.Sprintf(tt.set, i), fmt.Sprint(i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			used := make(map[*SimpleDB]bool)
+			check := func(s *ShardedDB) {
+				t.Helper()
+				for i := 0; i < n; i++ {
+					key := fmt.Sprintf(tt.get, i)
+					// The owning shard holds the key, and only that one
+					shard := s.Shard(key)
+					wantValue(t, shard, key, fmt.Sprint(i))
+					if s.Shard(fmt.Sprintf(tt.set, i)) != shard {
+						t.Fatalf("spellings of key %d go to different shards", i)
+					}
+					for _, other := range s.shards {
+						if other != shard && other.Exists(key) {
+							t.Fatalf("%s is in a shard that doesn't own it", key)
+						}
+					}
+					if got, err := s.Get(key); err != nil || got != fmt.Sprint(i) {
+						t.Fatalf("Get(%s) = %q, %v", key, got, err)
+					}
+					used[shard] = true
+				}
+			}
+			check(s)
+			if len(used) != tt.shards {
+				t.Fatalf("keys landed in %d of %d shards", len(used), tt.shards)
+			}
+
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			s, err := OpenSharded(dir, tt.shards, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			check(s)
+		})
+	}
+}
+
+func TestShardedMerge(t *testing.T) {
+	s, _ := openTestSharded(t, 4, Options{})
+	want := make(map[string]string)
+	for _, prefix := range []string{"a", "b", "c"} {
+		for i := 0; i < 10; i++ {
+			key := fmt.Sprintf("%s-%02d", prefix, i)
+			if err := s.Set(key, key); err != nil {
+				t.Fatal(err)
+			}
+			want[key] = key
+		}
+	}
+	if err := s.Delete("b-05"); err != nil {
+		t.Fatal(err)
+	}
+	delete(want, "b-05")
+	keys := make([]string, 0, len(want))
+	for key := range want {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	t.Run("keys", func(t *testing.T) {
+		if got := s.Keys(); !slices.Equal(got, keys) {
+			t.Fatalf("Keys() = %v, want %v", got, keys)
+		}
+		if got := s.Len(); got != len(want) {
+			t.Fatalf("Len() = %d, want %d", got, len(want))
+		}
+	})
+
+	t.Run("scan prefix", func(t *testing.T) {
+		got, err := s.ScanPrefix("b-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantPrefix := maps.Clone(want)
+		maps.DeleteFunc(wantPrefix, func(key, _ string) bool { return key[0] != 'b' })
+		if !maps.Equal(got, wantPrefix) {
+			t.Fatalf("ScanPrefix(b-) = %v, want %v", got, wantPrefix)
+		}
+	})
+
+	tests := []struct {
+		name       string
+		start, end string
+	}{
+		{name: "bounded", start: "a-05", end: "c-03"},
+		{name: "open end", start: "b-08"},
+		{name: "everything"},
+		{name: "empty", start: "d"},
+	}
+	for _, tt := range tests {
+		t.Run("scan range "+tt.name, func(t *testing.T) {
+			got, err := s.ScanRange(tt.start, tt.end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var wantPairs []KVPair
+			for _, key := range keys {
+				if key >= tt.start && (tt.end == "" || key < tt.end) {
+					wantPairs = append(wantPairs, KVPair{Key: key, Value: want[key]})
+				}
+			}
+			if len(got) != len(wantPairs) || len(got) > 0 && !slices.Equal(got, wantPairs) {
+				t.Fatalf("ScanRange(%q, %q) = %v, want %v", tt.start, tt.end, got, wantPairs)
+			}
+		})
+	}
+}
+
+// BenchmarkShardedSet has 100 writers per CPU setting keys through a
+// ShardedDB, against a single SimpleDB taking the same writes
+func BenchmarkShardedSet(b *testing.B) {
+	tests := []struct {
+		name   string
+		shards int // Zero for a single SimpleDB
+	}{
+		{name: "single"},
+		{name: "4 shards", shards: 4},
+		{name: "16 shards", shards: 16},
+	}
+
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			var set func(key, value string) error
+			if tt.shards == 0 {
+				db, err := OpenDBWithOptions(filepath.Join(b.TempDir(), "bench.db"), Options{})
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer db.Close()
+				set = db.Set
+			} else {
+				s, err := OpenSharded(b.TempDir(), tt.shards, Options{})
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer s.Close()
+				set = s.Set
+			}
+
+			b.SetParallelism(100)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if err := set(fmt.Sprintf("key-%d", i%1000), "value"); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
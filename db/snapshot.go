@@ -0,0 +1,118 @@
+package db
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// indexSuffix is appended to the database path for the persisted index
+const indexSuffix = ".idx"
+
+// snapshotFormat is bumped whenever the index gains something that older
+// snapshots lack, so they are ignored and the log scanned instead
+const snapshotFormat = 2
+
+// indexSnapshot is the on-disk form of the in-memory index. Segment and Size
+// are the segment being appended to when the snapshot was taken and its
+// length at the time; anything past that was appended later and is replayed
+// from the log on open.
+type indexSnapshot struct {
+	Format     int                 `json:"format"`
+	Segment    int                 `json:"segment"`
+	Size       int64               `json:"size"`
+	Data       map[string]location `json:"data"`
+	Expires    map[string]int64    `json:"expires"`
+	Dead       int64               `json:"dead"`
+	MaxVersion int64               `json:"max_version"`
+}
+
+// loadSnapshot restores the index from the sidecar file if it is usable and
+// returns the position the log must be replayed from. A missing or unusable
+// snapshot leaves the index empty and returns the zero location so every
+// segment is scanned.
+func (db *SimpleDB) loadSnapshot() location {
+	// Spilled keys aren't in it, so the log is always scanned in full
+	if db.spill != nil {
+		return location{}
+	}
+	raw, err := os.ReadFile(db.path + indexSuffix)
+	if err != nil {
+		return location{}
+	}
+
+	var snap indexSnapshot
+	if err := json.Unmarshal(raw, &snap); err != nil || snap.Data == nil || snap.Format != snapshotFormat {
+		return location{}
+	}
+
+	// Segments only ever grow between snapshots; compaction removes the
+	// sidecar before swapping files. A missing or shorter segment means the
+	// snapshot describes something else.
+	file, ok := db.segments[snap.Segment]
+	if !ok {
+		return location{}
+	}
+	info, err := file.Stat()
+	if err != nil || info.Size() < snap.Size {
+		return location{}
+	}
+
+	// Snapshots from before the index held record sizes can't say how
+	// much of the file is dead
+	for _, loc := range snap.Data {
+		if loc.Size == 0 {
+			return location{}
+		}
+	}
+
+	db.data = snap.Data
+	if snap.Expires != nil {
+		db.expires = snap.Expires
+	}
+	db.dead = snap.Dead
+	db.maxVersion = snap.MaxVersion
+	return location{Segment: snap.Segment, Offset: snap.Size}
+}
+
+// saveSnapshot writes the index to the sidecar file. Callers must hold the
+// write lock and have flushed buffered writes, so the index matches the
+// file size recorded alongside it. Nothing is written while keys can be
+// spilled, since they aren't in memory to write out; any older snapshot is
+// left alone, as it still describes the start of the log.
+func (db *SimpleDB) saveSnapshot() error {
+	if db.spill != nil {
+		return nil
+	}
+	info, err := db.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(indexSnapshot{
+		Format:     snapshotFormat,
+		Segment:    db.segment,
+		Size:       info.Size(),
+		Data:       db.data,
+		Expires:    db.expires,
+		Dead:       db.dead,
+		MaxVersion: db.maxVersion,
+	})
+	if err != nil {
+		return err
+	}
+
+	tmpPath := db.path + indexSuffix + ".tmp"
+	if err := os.WriteFile(tmpPath, raw, db.opts.FileMode); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, db.path+indexSuffix)
+}
+
+// removeSnapshot deletes the sidecar file so it can't be applied to a
+// rewritten data file
+func (db *SimpleDB) removeSnapshot() error {
+	if err := os.Remove(db.path + indexSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
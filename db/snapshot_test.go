@@ -0,0 +1,125 @@
+package db
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// editSnapshot rewrites the index snapshot of the database at path
+func editSnapshot(t *testing.T, path string, edit func(snap *indexSnapshot)) {
+	t.Helper()
+	raw, err := os.ReadFile(path + indexSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snap indexSnapshot
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		t.Fatal(err)
+	}
+	edit(&snap)
+	if raw, err = json.Marshal(snap); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+indexSuffix, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, path string) // Runs after the database holding a and b is closed
+		want   map[string]string               // "" for keys that must be missing
+		used   bool                            // Whether the snapshot is usable
+	}{
+		{
+			name:   "intact",
+			change: func(t *testing.T, path string) {},
+			want:   map[string]string{"a": "one", "b": "two"},
+			used:   true,
+		},
+		{
+			name: "missing",
+			change: func(t *testing.T, path string) {
+				if err := os.Remove(path + indexSuffix); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: map[string]string{"a": "one", "b": "two"},
+		},
+		{
+			name: "corrupt",
+			change: func(t *testing.T, path string) {
+				if err := os.WriteFile(path+indexSuffix, []byte("{"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: map[string]string{"a": "one", "b": "two"},
+		},
+		{
+			name: "older format",
+			change: func(t *testing.T, path string) {
+				editSnapshot(t, path, func(snap *indexSnapshot) { snap.Format-- })
+			},
+			want: map[string]string{"a": "one", "b": "two"},
+		},
+		{
+			name: "longer than the segment",
+			change: func(t *testing.T, path string) {
+				editSnapshot(t, path, func(snap *indexSnapshot) { snap.Size += 100 })
+			},
+			want: map[string]string{"a": "one", "b": "two"},
+		},
+		{
+			name: "log written past it",
+			change: func(t *testing.T, path string) {
+				// Keep the snapshot from before the writes below
+				copyFile(t, path+indexSuffix, path+".old")
+				db := reopenTestDB(t, path, Options{})
+				mustSet(t, db, "c", "three")
+				mustSet(t, db, "b", "four")
+				if err := db.Delete("a"); err != nil {
+					t.Fatal(err)
+				}
+				if err := db.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Rename(path+".old", path+indexSuffix); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: map[string]string{"a": "", "b": "four", "c": "three"},
+			used: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			mustSet(t, db, "a", "one")
+			mustSet(t, db, "b", "two")
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			tt.change(t, path)
+
+			db = reopenTestDB(t, path, Options{})
+			for key, value := range tt.want {
+				if value == "" {
+					wantMissing(t, db, key)
+				} else {
+					wantValue(t, db, key, value)
+				}
+			}
+
+			// Loading it again replaces the index, so this comes last
+			db.mu.Lock()
+			used := db.loadSnapshot() != location{}
+			db.mu.Unlock()
+			if used != tt.used {
+				t.Fatalf("snapshot used: %v, want %v", used, tt.used)
+			}
+		})
+	}
+}
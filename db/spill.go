@@ -0,0 +1,492 @@
+package db
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/maphash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// spillIndex holds the part of the index that Options.IndexBudget pushed
+// out of memory: an open-addressing hash table in a scratch file, mapping
+// keys to the locations of their records. Slots have a fixed size and point
+// at the key's bytes in a second file, so a lookup reads a slot or two and
+// the key rather than the record itself. Both files are unlinked as soon as
+// they are created, since the table is rebuilt from the log on every open.
+// A bloom filter over the keys held spares lookups of keys the table
+// doesn't hold, such as keys that don't exist at all, from reading it.
+// Lookups may run concurrently under the database read lock; everything
+// else needs the write lock.
+type spillIndex struct {
+	dir    string
+	rate   float64      // False-positive rate of filter
+	filter *bloomFilter // Over the hashes of every key put since the table was last rebuilt
+	seed   maphash.Seed
+	slots  *os.File
+	keys   *os.File
+	size   int64 // Number of slots, a power of two
+	live   int64 // Keys held
+	used   int64 // Slots holding a key or left behind by a removed one
+	keyEnd int64 // Length of the keys file
+}
+
+const (
+	// spillSlotSize is the size of one slot: the key's hash, where its
+	// bytes are in the keys file and how long they are, and its location
+	spillSlotSize = 56
+
+	// minSpillSlots is the size of an empty table
+	minSpillSlots = 64
+
+	// Hashes that mark a slot as never used or as left by a removed key;
+	// real hashes are moved clear of them
+	slotEmpty   = 0
+	slotRemoved = 1
+)
+
+// spillSlot is the decoded form of one slot
+type spillSlot struct {
+	hash   uint64
+	keyAt  int64
+	keyLen uint32
+	loc    location
+}
+
+// newSpillIndex returns an empty table kept in scratch files in dir, or in
+// the system temporary directory if dir is empty, whose filter has false
+// positives at rate
+func newSpillIndex(dir string, rate float64) (*spillIndex, error) {
+	slots, err := scratchFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := scratchFile(dir)
+	if err != nil {
+		closeScratch(slots)
+		return nil, err
+	}
+
+	s := &spillIndex{dir: dir, rate: rate, seed: maphash.MakeSeed(), slots: slots, keys: keys, size: minSpillSlots}
+	s.filter = s.newFilter()
+	if err := slots.Truncate(s.size * spillSlotSize); err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// scratchFile creates a file in dir that goes away once closed. It is
+// unlinked straight away where the platform allows that, so not even a
+// crash leaves it behind.
+func scratchFile(dir string) (*os.File, error) {
+	f, err := os.CreateTemp(dir, ".spill-*")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(f.Name())
+	return f, nil
+}
+
+// closeScratch closes a file made by scratchFile and removes it if it
+// couldn't be unlinked while open
+func closeScratch(f *os.File) error {
+	err := f.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// close releases both files. A nil spillIndex has none.
+func (s *spillIndex) close() error {
+	if s == nil {
+		return nil
+	}
+	err := closeScratch(s.slots)
+	if keysErr := closeScratch(s.keys); err == nil {
+		err = keysErr
+	}
+	return err
+}
+
+// newFilter returns an empty filter sized for as many keys as the table
+// can take before it has to be rebuilt
+func (s *spillIndex) newFilter() *bloomFilter {
+	return newBloomFilter(s.size/2, s.rate)
+}
+
+// hash returns the hash of key, clear of the marker values
+func (s *spillIndex) hash(key string) uint64 {
+	return max(maphash.String(s.seed, key), slotRemoved+1)
+}
+
+// get returns the location of key, if the table holds it
+func (s *spillIndex) get(key string) (location, bool, error) {
+	i, slot, err := s.find(key)
+	if err != nil || i < 0 {
+		return location{}, false, err
+	}
+	return slot.loc, true, nil
+}
+
+// find returns the index and contents of the slot holding key, or -1 if the
+// table doesn't hold it
+func (s *spillIndex) find(key string) (int64, spillSlot, error) {
+	hash := s.hash(key)
+	if !s.filter.mayContain(hash) {
+		return -1, spillSlot{}, nil
+	}
+	for i, n := int64(hash)&(s.size-1), int64(0); n < s.size; i, n = (i+1)&(s.size-1), n+1 {
+		slot, err := s.readSlot(i)
+		if err != nil {
+			return -1, spillSlot{}, err
+		}
+		if slot.hash == slotEmpty {
+			break
+		}
+		if slot.hash != hash || int(slot.keyLen) != len(key) {
+			continue
+		}
+		stored, err := s.readKey(slot)
+		if err != nil {
+			return -1, spillSlot{}, err
+		}
+		if stored == key {
+			return i, slot, nil
+		}
+	}
+	return -1, spillSlot{}, nil
+}
+
+// put stores key's location, replacing any the table already holds for it
+func (s *spillIndex) put(key string, loc location) error {
+	i, slot, err := s.find(key)
+	if err != nil {
+		return err
+	}
+	if i >= 0 {
+		slot.loc = loc
+		return s.writeSlot(i, slot)
+	}
+
+	// Removed slots only go away when the table is rebuilt
+	if (s.used+1)*2 > s.size {
+		if err := s.rebuild(); err != nil {
+			return err
+		}
+	}
+	if _, err := s.keys.WriteAt([]byte(key), s.keyEnd); err != nil {
+		return err
+	}
+	slot = spillSlot{hash: s.hash(key), keyAt: s.keyEnd, keyLen: uint32(len(key)), loc: loc}
+	s.keyEnd += int64(len(key))
+	reused, err := s.insert(slot)
+	if err != nil {
+		return err
+	}
+	s.filter.add(slot.hash)
+	s.live++
+	if !reused {
+		s.used++
+	}
+	return nil
+}
+
+// insert writes slot into the first free slot along its probe sequence,
+// reporting whether that slot was left by a removed key. The table must not
+// already hold the key.
+func (s *spillIndex) insert(slot spillSlot) (bool, error) {
+	for i := int64(slot.hash) & (s.size - 1); ; i = (i + 1) & (s.size - 1) {
+		existing, err := s.readSlot(i)
+		if err != nil {
+			return false, err
+		}
+		if existing.hash == slotEmpty || existing.hash == slotRemoved {
+			return existing.hash == slotRemoved, s.writeSlot(i, slot)
+		}
+	}
+}
+
+// remove drops key from the table and returns the location it held
+func (s *spillIndex) remove(key string) (location, bool, error) {
+	i, slot, err := s.find(key)
+	if err != nil || i < 0 {
+		return location{}, false, err
+	}
+	if err := s.writeSlot(i, spillSlot{hash: slotRemoved}); err != nil {
+		return location{}, false, err
+	}
+	s.live--
+	return slot.loc, true, nil
+}
+
+// each calls fn with every key in the table and its location, stopping at
+// the first error
+func (s *spillIndex) each(fn func(key string, loc location) error) error {
+	r := bufio.NewReader(io.NewSectionReader(s.slots, 0, s.size*spillSlotSize))
+	var buf [spillSlotSize]byte
+	for i := int64(0); i < s.size; i++ {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return err
+		}
+		slot := decodeSlot(buf[:])
+		if slot.hash == slotEmpty || slot.hash == slotRemoved {
+			continue
+		}
+		key, err := s.readKey(slot)
+		if err != nil {
+			return err
+		}
+		if err := fn(key, slot.loc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuild moves the live keys into fresh files with a table sized for
+// them, dropping removed slots and the bytes of removed keys
+func (s *spillIndex) rebuild() error {
+	size := int64(minSpillSlots)
+	for size < (s.live+1)*4 {
+		size *= 2
+	}
+	next, err := newSpillIndex(s.dir, s.rate)
+	if err != nil {
+		return err
+	}
+	next.seed = s.seed
+	next.size = size
+	next.filter = next.newFilter()
+	if err := next.slots.Truncate(size * spillSlotSize); err != nil {
+		next.close()
+		return err
+	}
+
+	err = s.each(func(key string, loc location) error {
+		if _, err := next.keys.WriteAt([]byte(key), next.keyEnd); err != nil {
+			return err
+		}
+		slot := spillSlot{hash: s.hash(key), keyAt: next.keyEnd, keyLen: uint32(len(key)), loc: loc}
+		next.keyEnd += int64(len(key))
+		next.live++
+		next.used++
+		next.filter.add(slot.hash)
+		_, err := next.insert(slot)
+		return err
+	})
+	if err != nil {
+		next.close()
+		return err
+	}
+
+	s.close()
+	*s = *next
+	return nil
+}
+
+// reset empties the table
+func (s *spillIndex) reset() error {
+	next, err := newSpillIndex(s.dir, s.rate)
+	if err != nil {
+		return err
+	}
+	s.close()
+	*s = *next
+	return nil
+}
+
+// readSlot reads and decodes slot i
+func (s *spillIndex) readSlot(i int64) (spillSlot, error) {
+	var buf [spillSlotSize]byte
+	if _, err := s.slots.ReadAt(buf[:], i*spillSlotSize); err != nil {
+		return spillSlot{}, err
+	}
+	return decodeSlot(buf[:]), nil
+}
+
+// writeSlot encodes slot and writes it as slot i
+func (s *spillIndex) writeSlot(i int64, slot spillSlot) error {
+	var buf [spillSlotSize]byte
+	binary.LittleEndian.PutUint64(buf[0:], slot.hash)
+	binary.LittleEndian.PutUint64(buf[8:], uint64(slot.keyAt))
+	binary.LittleEndian.PutUint32(buf[16:], slot.keyLen)
+	binary.LittleEndian.PutUint32(buf[20:], uint32(slot.loc.Segment))
+	binary.LittleEndian.PutUint64(buf[24:], uint64(slot.loc.Offset))
+	binary.LittleEndian.PutUint64(buf[32:], uint64(slot.loc.Size))
+	binary.LittleEndian.PutUint64(buf[40:], uint64(slot.loc.Version))
+	binary.LittleEndian.PutUint64(buf[48:], uint64(slot.loc.Created))
+	_, err := s.slots.WriteAt(buf[:], i*spillSlotSize)
+	return err
+}
+
+// decodeSlot decodes one slot
+func decodeSlot(buf []byte) spillSlot {
+	return spillSlot{
+		hash:   binary.LittleEndian.Uint64(buf[0:]),
+		keyAt:  int64(binary.LittleEndian.Uint64(buf[8:])),
+		keyLen: binary.LittleEndian.Uint32(buf[16:]),
+		loc: location{
+			Segment: int(binary.LittleEndian.Uint32(buf[20:])),
+			Offset:  int64(binary.LittleEndian.Uint64(buf[24:])),
+			Size:    int64(binary.LittleEndian.Uint64(buf[32:])),
+			Version: int64(binary.LittleEndian.Uint64(buf[40:])),
+			Created: int64(binary.LittleEndian.Uint64(buf[48:])),
+		},
+	}
+}
+
+// readKey reads the key a slot points at
+func (s *spillIndex) readKey(slot spillSlot) (string, error) {
+	buf := make([]byte, slot.keyLen)
+	if _, err := s.keys.ReadAt(buf, slot.keyAt); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// spillDir returns the directory for the spill files of the database at
+// path: next to it, unless the database is opened read-only and might be
+// somewhere it can't write
+func spillDir(path string, opts Options) string {
+	if opts.ReadOnly {
+		return ""
+	}
+	return filepath.Dir(path)
+}
+
+// locate returns the location of key's record, looking in the spill file
+// if it isn't held in memory. Callers must hold at least the read lock.
+func (db *SimpleDB) locate(key string) (location, bool, error) {
+	if loc, exists := db.data[key]; exists || db.spill == nil {
+		return loc, exists, nil
+	}
+	return db.spill.get(key)
+}
+
+// exists reports whether key is live, looking in the spill file if it
+// isn't held in memory. Callers must hold at least the read lock.
+func (db *SimpleDB) exists(key string) (bool, error) {
+	_, exists, err := db.locate(key)
+	return exists && !db.expired(key), err
+}
+
+// indexed returns the location of every key in the index. Without spilled
+// keys that is the in-memory index itself, which callers must not modify;
+// otherwise it is a copy with the spilled keys read back in, which holds
+// the whole index in memory until the caller drops it. Callers must hold at
+// least the read lock.
+func (db *SimpleDB) indexed() (map[string]location, error) {
+	if db.spill == nil || db.spill.live == 0 {
+		return db.data, nil
+	}
+	all := make(map[string]location, len(db.data)+int(db.spill.live))
+	for key, loc := range db.data {
+		all[key] = loc
+	}
+	err := db.spill.each(func(key string, loc location) error {
+		all[key] = loc
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// indexLen returns the number of keys in the index, spilled or not.
+// Callers must hold at least the read lock.
+func (db *SimpleDB) indexLen() int {
+	if db.spill == nil {
+		return len(db.data)
+	}
+	return len(db.data) + int(db.spill.live)
+}
+
+// promote moves key back into memory from the spill file, if it is there,
+// ahead of a write to it. Every write goes through here first, so a key is
+// never in both places. Callers must hold the write lock.
+func (db *SimpleDB) promote(key string) error {
+	if db.spill == nil {
+		return nil
+	}
+	if _, exists := db.data[key]; exists {
+		return nil
+	}
+	loc, exists, err := db.spill.remove(key)
+	if err != nil || !exists {
+		return err
+	}
+	db.indexKey(key, loc)
+	return nil
+}
+
+// spillCold moves the least recently used keys out to the spill file until
+// the in-memory index fits in IndexBudget. The key used last always stays,
+// however small the budget. Callers must hold the write lock.
+func (db *SimpleDB) spillCold() error {
+	for db.spill != nil && db.indexSize > db.opts.IndexBudget && len(db.data) > 1 {
+		key, ok := db.lru.oldest()
+		if !ok {
+			return nil
+		}
+		loc, exists := db.data[key]
+		if !exists {
+			db.lru.remove(key)
+			continue
+		}
+		if err := db.spill.put(key, loc); err != nil {
+			return err
+		}
+		db.unindexKey(key)
+	}
+	return nil
+}
+
+// trimIndex runs spillCold after a write. The write has succeeded by then,
+// so a failure is logged and reported by Health, and the keys it couldn't
+// move stay in memory. Callers must hold the write lock.
+func (db *SimpleDB) trimIndex() {
+	if err := db.spillCold(); err != nil {
+		db.opts.Logger.Error("spilling index failed", "path", db.path, "err", err)
+		db.backgroundErr = err
+	}
+}
+
+// indexKey points key at loc in the in-memory index and marks it as used.
+// Callers must hold the write lock.
+func (db *SimpleDB) indexKey(key string, loc location) {
+	if _, exists := db.data[key]; !exists {
+		db.indexSize += db.keyCost(key)
+	}
+	db.data[key] = loc
+	db.lru.add(key)
+}
+
+// unindexKey drops key from the in-memory index. Callers must hold the
+// write lock.
+func (db *SimpleDB) unindexKey(key string) {
+	if _, exists := db.data[key]; exists {
+		db.indexSize -= db.keyCost(key)
+		delete(db.data, key)
+	}
+	db.lru.remove(key)
+}
+
+// countIndex works out indexSize afresh after the in-memory index was
+// replaced wholesale. Callers must hold the write lock.
+func (db *SimpleDB) countIndex() {
+	db.indexSize = 0
+	for key := range db.data {
+		db.indexSize += db.keyCost(key)
+	}
+}
+
+// keyCost estimates the memory holding key in the in-memory index takes
+func (db *SimpleDB) keyCost(key string) int64 {
+	cost := indexEntryOverhead + int64(len(key))
+	if db.lru != nil {
+		cost += keyOrderOverhead
+	}
+	return cost
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSpillIndex(t *testing.T) {
+	s, err := newSpillIndex(t.TempDir(), defaultFilterFalsePositiveRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	// Enough keys to grow the table several times, with removals between
+	const n = 2000
+	for i := 0; i < n; i++ {
+		if err := s.put(fmt.Sprintf("key-%d", i), location{Segment: i % 3, Offset: int64(i), Size: 10}); err != nil {
+			t.Fatal(err)
+		}
+		if i%4 == 3 {
+			if _, ok, err := s.remove(fmt.Sprintf("key-%d", i-1)); err != nil || !ok {
+				t.Fatalf("remove(key-%d) = %v, %v", i-1, ok, err)
+			}
+		}
+	}
+	if err := s.put("key-0", location{Offset: 99, Size: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		loc, ok, err := s.get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := location{Segment: i % 3, Offset: int64(i), Size: 10}
+		if i == 0 {
+			want = location{Offset: 99, Size: 10}
+		}
+		if removed := i%4 == 2; ok == removed || ok && loc != want {
+			t.Fatalf("get(%q) = %+v, %v, want %+v, %v", key, loc, ok, want, !removed)
+		}
+	}
+	if _, ok, err := s.get("missing"); ok || err != nil {
+		t.Fatalf("get(missing) = %v, %v", ok, err)
+	}
+
+	seen := 0
+	err = s.each(func(key string, loc location) error {
+		seen++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := n - n/4; seen != want || s.live != int64(want) {
+		t.Fatalf("each saw %d keys and live is %d, want %d", seen, s.live, want)
+	}
+}
+
+// wantKeys checks the live keys of db and its stats
+func wantKeys(t *testing.T, db *SimpleDB, want map[string]string, budget int64) {
+	t.Helper()
+	for key, value := range want {
+		wantValue(t, db, key, value)
+	}
+	keys := make([]string, 0, len(want))
+	for key := range want {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	if got := db.Keys(); !slices.Equal(got, keys) {
+		t.Fatalf("Keys() = %d keys, want %d", len(got), len(keys))
+	}
+	if got := db.Len(); got != len(want) {
+		t.Fatalf("Len() = %d, want %d", got, len(want))
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One key always stays in memory, whatever the budget
+	if limit := budget + indexEntryOverhead + keyOrderOverhead + 16; stats.IndexBytes > limit {
+		t.Fatalf("IndexBytes = %d, want at most %d", stats.IndexBytes, limit)
+	}
+	if stats.Spilled == 0 {
+		t.Fatal("no keys were spilled")
+	}
+}
+
+func TestIndexBudget(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "tiny", opts: Options{IndexBudget: 1}},
+		{name: "some in memory", opts: Options{IndexBudget: 4096}},
+		{name: "segments", opts: Options{IndexBudget: 4096, SegmentSize: 2048}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, tt.opts)
+			want := make(map[string]string)
+			for i := 0; i < 200; i++ {
+				key, value := fmt.Sprintf("key-%03d", i), fmt.Sprintf("value-%d", i)
+				mustSet(t, db, key, value)
+				want[key] = value
+			}
+			wantKeys(t, db, want, tt.opts.IndexBudget)
+
+			// The oldest keys are the ones spilled
+			for i := 0; i < 20; i++ {
+				key := fmt.Sprintf("key-%03d", i)
+				if i%2 == 0 {
+					if err := db.Delete(key); err != nil {
+						t.Fatal(err)
+					}
+					delete(want, key)
+					wantMissing(t, db, key)
+					continue
+				}
+				mustSet(t, db, key, "new")
+				want[key] = "new"
+			}
+			wantKeys(t, db, want, tt.opts.IndexBudget)
+
+			if err := db.Compact(); err != nil {
+				t.Fatal(err)
+			}
+			wantKeys(t, db, want, tt.opts.IndexBudget)
+
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			db = reopenTestDB(t, path, tt.opts)
+			wantKeys(t, db, want, tt.opts.IndexBudget)
+
+			// Read-only opens keep their spill files elsewhere
+			readOnly := tt.opts
+			readOnly.ReadOnly = true
+			wantKeys(t, reopenTestDB(t, path, readOnly), want, tt.opts.IndexBudget)
+
+			// Without a budget everything is back in memory
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			db = reopenTestDB(t, path, Options{SegmentSize: tt.opts.SegmentSize})
+			for key, value := range want {
+				wantValue(t, db, key, value)
+			}
+			if got := db.Len(); got != len(want) {
+				t.Fatalf("Len() without a budget = %d, want %d", got, len(want))
+			}
+		})
+	}
+}
+
+func TestIndexBudgetVersions(t *testing.T) {
+	db, _ := openTestDB(t, Options{IndexBudget: 1})
+	mustSet(t, db, "a", "one")
+	version := mustVersion(t, db, "a")
+	mustSet(t, db, "b", "two")
+	if stats, err := db.Stats(); err != nil || stats.Spilled != 1 {
+		t.Fatalf("Stats() = %+v, %v, want a spilled key", stats, err)
+	}
+
+	next, err := db.SetIfVersion("a", "three", version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next <= version {
+		t.Fatalf("SetIfVersion on a spilled key returned version %d, want more than %d", next, version)
+	}
+	wantValue(t, db, "a", "three")
+}
+
+func TestIndexBudgetOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "negative", opts: Options{IndexBudget: -1}},
+		{name: "with MaxKeys", opts: Options{IndexBudget: 1024, MaxKeys: 10}},
+		{name: "negative false-positive rate", opts: Options{IndexBudget: 1024, FilterFalsePositiveRate: -0.1}},
+		{name: "false-positive rate of one", opts: Options{IndexBudget: 1024, FilterFalsePositiveRate: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := OpenDBWithOptions(filepath.Join(t.TempDir(), "test.db"), tt.opts); err == nil {
+				t.Fatal("open succeeded")
+			}
+		})
+	}
+}
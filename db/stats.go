@@ -0,0 +1,67 @@
+package db
+
+// Stats returns key counts, file size and I/O counters. FileSize covers all
+// segments. DeadBytes counts overwritten values, deleted keys with their
+// tombstones and expiry updates; expired keys aren't counted, although
+// compaction drops them too.
+func (db *SimpleDB) Stats() (Stats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return Stats{}, ErrClosed
+	}
+
+	var size int64
+	for _, file := range db.segments {
+		info, err := file.Stat()
+		if err != nil {
+			return Stats{}, err
+		}
+		size += info.Size()
+	}
+
+	return Stats{
+		Keys:       db.liveCount(),
+		FileSize:   size,
+		Segments:   len(db.segments),
+		Corrupt:    db.corrupt,
+		DeadBytes:  db.dead,
+		Buffered:   db.buffered(),
+		IndexBytes: db.indexSize,
+		Spilled:    db.indexLen() - len(db.data),
+		Reads:      db.reads.Load(),
+		Writes:     db.writes.Load(),
+		Evicted:    db.evicted,
+	}, nil
+}
+
+// indexEntryOverhead approximates what the index costs per key on top of
+// the key's own bytes: the string header, the location and the map's
+// bucket overhead
+const indexEntryOverhead = 72
+
+// Len returns the number of live keys. It doesn't touch the disk; only keys
+// with a TTL need checking, so it is O(1) for databases that don't use them.
+// A closed database has no keys.
+func (db *SimpleDB) Len() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return 0
+	}
+	return db.liveCount()
+}
+
+// liveCount counts indexed keys that haven't expired. Callers must hold at
+// least the read lock.
+func (db *SimpleDB) liveCount() int {
+	count := db.indexLen()
+	for key := range db.expires {
+		if db.expired(key) {
+			count--
+		}
+	}
+	return count
+}
@@ -0,0 +1,271 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	tests := []struct {
+		name       string
+		ops        func(t *testing.T, db *SimpleDB)
+		wantKeys   int
+		wantReads  int64
+		wantWrites int64
+		wantDead   bool // Whether any bytes are reclaimable
+	}{
+		{name: "empty", ops: func(t *testing.T, db *SimpleDB) {}},
+		{
+			name: "sets and reads",
+			ops: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "a", "one")
+				mustSet(t, db, "b", "two")
+				wantValue(t, db, "a", "one")
+				wantValue(t, db, "a", "one")
+			},
+			wantKeys:   2,
+			wantReads:  2,
+			wantWrites: 2,
+		},
+		{
+			name: "overwrite",
+			ops: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "a", "one")
+				mustSet(t, db, "a", "two")
+			},
+			wantKeys:   1,
+			wantWrites: 2,
+			wantDead:   true,
+		},
+		{
+			name: "delete",
+			ops: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "a", "one")
+				if err := db.Delete("a"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantWrites: 2,
+			wantDead:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			tt.ops(t, db)
+
+			stats, err := db.Stats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Keys != tt.wantKeys || stats.Reads != tt.wantReads || stats.Writes != tt.wantWrites {
+				t.Fatalf("Stats() = %d keys, %d reads, %d writes, want %d, %d, %d",
+					stats.Keys, stats.Reads, stats.Writes, tt.wantKeys, tt.wantReads, tt.wantWrites)
+			}
+			if got := stats.DeadBytes > 0; got != tt.wantDead {
+				t.Fatalf("DeadBytes = %d, want reclaimable bytes: %v", stats.DeadBytes, tt.wantDead)
+			}
+			if stats.DeadBytes > stats.FileSize {
+				t.Fatalf("DeadBytes %d is more than FileSize %d", stats.DeadBytes, stats.FileSize)
+			}
+		})
+	}
+}
+
+func TestStatsDeadBytesGrow(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	mustSet(t, db, "a", "value")
+
+	var last int64
+	for i := 0; i < 3; i++ {
+		mustSet(t, db, "a", "value")
+		stats, err := db.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.DeadBytes <= last {
+			t.Fatalf("DeadBytes = %d after overwrite %d, was %d", stats.DeadBytes, i+1, last)
+		}
+		last = stats.DeadBytes
+	}
+}
+
+func TestLen(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  func(t *testing.T, db *SimpleDB)
+		want int
+	}{
+		{name: "empty", ops: func(t *testing.T, db *SimpleDB) {}},
+		{
+			name: "sets",
+			ops: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "a", "1")
+				mustSet(t, db, "b", "2")
+				mustSet(t, db, "a", "3")
+			},
+			want: 2,
+		},
+		{
+			name: "deletes",
+			ops: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "a", "1")
+				mustSet(t, db, "b", "2")
+				if err := db.Delete("a"); err != nil {
+					t.Fatal(err)
+				}
+				if err := db.Delete("missing"); err != nil && !errors.Is(err, ErrKeyNotFound) {
+					t.Fatal(err)
+				}
+			},
+			want: 1,
+		},
+		{
+			name: "expired",
+			ops: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "a", "1")
+				if err := db.SetWithTTL("b", "2", time.Millisecond); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(5 * time.Millisecond)
+			},
+			want: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			tt.ops(t, db)
+			if got := db.Len(); got != tt.want {
+				t.Fatalf("Len() = %d, want %d", got, tt.want)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			db = reopenTestDB(t, path, Options{})
+			if got := db.Len(); got != tt.want {
+				t.Fatalf("Len() after reopen = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeadBytesMatchRescan(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		write func(t *testing.T, db *SimpleDB)
+	}{
+		{name: "overwrites", write: func(t *testing.T, db *SimpleDB) { mustSet(t, db, "a", "a much longer value than before") }},
+		{
+			name: "deletes",
+			write: func(t *testing.T, db *SimpleDB) {
+				if _, err := db.DeleteMulti([]string{"a", "b"}); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "touch",
+			write: func(t *testing.T, db *SimpleDB) {
+				if err := db.Touch("a", time.Hour); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "batch",
+			write: func(t *testing.T, db *SimpleDB) {
+				if err := db.BatchSet([]KVPair{{Key: "a", Value: "x"}, {Key: "a", Value: "y"}, {Key: "d", Value: "z"}}); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "transaction",
+			write: func(t *testing.T, db *SimpleDB) {
+				err := db.UpdateTx(func(tx *WriteTx) error {
+					if err := tx.Set("a", "x"); err != nil {
+						return err
+					}
+					return tx.Delete("b")
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "expiry sweep",
+			write: func(t *testing.T, db *SimpleDB) {
+				if err := db.SetWithTTL("a", "soon", time.Millisecond); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(5 * time.Millisecond)
+				if _, err := db.sweepExpired(); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "increment and append",
+			write: func(t *testing.T, db *SimpleDB) {
+				if _, err := db.Increment("n", 2); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := db.Append("a", "-more"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{name: "segments", opts: Options{SegmentSize: 64}, write: func(t *testing.T, db *SimpleDB) { mustSet(t, db, "a", "x") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, tt.opts)
+			mustSet(t, db, "a", "one")
+			mustSet(t, db, "b", "two")
+			mustSet(t, db, "c", "three")
+			if _, err := db.Increment("n", 1); err != nil {
+				t.Fatal(err)
+			}
+			tt.write(t, db)
+			stats, err := db.Stats()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The count survives a reopen from the snapshot, and rescanning
+			// the whole log counts the same from scratch
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			db = reopenTestDB(t, path, tt.opts)
+			reopened, err := db.Stats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.DeadBytes != reopened.DeadBytes {
+				t.Fatalf("DeadBytes = %d, after reopening %d", stats.DeadBytes, reopened.DeadBytes)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Remove(path + indexSuffix); err != nil {
+				t.Fatal(err)
+			}
+			rescanned, err := reopenTestDB(t, path, tt.opts).Stats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.DeadBytes != rescanned.DeadBytes {
+				t.Fatalf("DeadBytes = %d, rescan counts %d", stats.DeadBytes, rescanned.DeadBytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package db
+
+import "context"
+
+// Tracer starts a span for every operation an Observer sees, so they show up
+// in distributed traces. The tracing package implements it with
+// OpenTelemetry; it is an interface so this package doesn't depend on it.
+// Implementations must be safe for concurrent use.
+type Tracer interface {
+	// StartSpan begins a span for op, a child of any span carried by ctx.
+	// key is the key, prefix or range start the operation acts on, and
+	// empty for BatchSet and Compact. Operations that don't take a context
+	// use context.Background.
+	StartSpan(ctx context.Context, op, key string) Span
+}
+
+// Span is an operation being traced
+type Span interface {
+	// End finishes the span. bytes is the size of the value read or
+	// written, summed over a batch and zero for scans, deletes and Compact.
+	End(bytes int, err error)
+}
+
+// noopSpan is used when no Tracer is configured
+type noopSpan struct{}
+
+func (noopSpan) End(int, error) {}
+
+// startSpan starts a span for op with the configured Tracer, if any
+func (db *SimpleDB) startSpan(ctx context.Context, op, key string) Span {
+	if db.opts.Tracer == nil {
+		return noopSpan{}
+	}
+	return db.opts.Tracer.StartSpan(ctx, op, key)
+}
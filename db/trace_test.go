@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordedSpan is a span a recordingTracer saw end
+type recordedSpan struct {
+	op, key string
+	parent  any // The ctxKey value of the context the span started in
+	bytes   int
+	err     error
+}
+
+// ctxKey marks contexts so spans can be matched to their parent
+type ctxKey struct{}
+
+// recordingTracer remembers every span started with it once it ends
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []recordedSpan
+}
+
+func (tr *recordingTracer) StartSpan(ctx context.Context, op, key string) Span {
+	return &recordingSpan{tracer: tr, span: recordedSpan{op: op, key: key, parent: ctx.Value(ctxKey{})}}
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+	span   recordedSpan
+}
+
+func (s *recordingSpan) End(bytes int, err error) {
+	s.span.bytes, s.span.err = bytes, err
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.spans = append(s.tracer.spans, s.span)
+}
+
+func TestTracer(t *testing.T) {
+	parent := context.WithValue(context.Background(), ctxKey{}, "request")
+	tests := []struct {
+		name    string
+		op      func(db *SimpleDB) error
+		want    []recordedSpan
+		wantErr error // The error the span ended with
+	}{
+		{
+			name: "get",
+			op:   func(db *SimpleDB) error { _, err := db.GetContext(parent, "a"); return err },
+			want: []recordedSpan{{op: OpGet, key: "a", parent: "request", bytes: 3}},
+		},
+		{
+			name:    "get missing",
+			op:      func(db *SimpleDB) error { db.Get("missing"); return nil },
+			want:    []recordedSpan{{op: OpGet, key: "missing"}},
+			wantErr: ErrKeyNotFound,
+		},
+		{
+			name: "set",
+			op:   func(db *SimpleDB) error { return db.SetContext(parent, "b", "hello") },
+			want: []recordedSpan{{op: OpSet, key: "b", parent: "request", bytes: 5}},
+		},
+		{
+			name: "set with TTL",
+			op:   func(db *SimpleDB) error { return db.SetWithTTL("b", "hello", time.Hour) },
+			want: []recordedSpan{{op: OpSet, key: "b", bytes: 5}},
+		},
+		{
+			name: "delete",
+			op:   func(db *SimpleDB) error { return db.DeleteContext(parent, "a") },
+			want: []recordedSpan{{op: OpDelete, key: "a", parent: "request"}},
+		},
+		{
+			name: "batch",
+			op: func(db *SimpleDB) error {
+				return db.BatchSet([]KVPair{{Key: "b", Value: "12"}, {Key: "c", Value: "345"}})
+			},
+			want: []recordedSpan{{op: OpBatchSet, bytes: 5}},
+		},
+		{
+			name: "scan prefix",
+			op:   func(db *SimpleDB) error { _, err := db.ScanPrefixContext(parent, "a"); return err },
+			want: []recordedSpan{{op: OpScan, key: "a", parent: "request"}},
+		},
+		{
+			name: "scan range",
+			op:   func(db *SimpleDB) error { _, err := db.ScanRangeContext(parent, "a", "z"); return err },
+			want: []recordedSpan{{op: OpScan, key: "a", parent: "request"}},
+		},
+		{
+			name: "compact",
+			op:   func(db *SimpleDB) error { return db.Compact() },
+			want: []recordedSpan{{op: OpCompact}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer := &recordingTracer{}
+			db, _ := openTestDB(t, Options{Tracer: tracer})
+			mustSet(t, db, "a", "one")
+			tracer.spans = nil
+
+			if err := tt.op(db); err != nil {
+				t.Fatal(err)
+			}
+			tracer.mu.Lock()
+			defer tracer.mu.Unlock()
+			if len(tracer.spans) != len(tt.want) {
+				t.Fatalf("spans %+v, want %+v", tracer.spans, tt.want)
+			}
+			for i, span := range tracer.spans {
+				if !errors.Is(span.err, tt.wantErr) {
+					t.Fatalf("span ended with %v, want %v", span.err, tt.wantErr)
+				}
+				span.err = nil
+				if span != tt.want[i] {
+					t.Fatalf("span %+v, want %+v", span, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNoTracer(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	if span := db.startSpan(context.Background(), OpGet, "a"); span != (noopSpan{}) {
+		t.Fatalf("startSpan without a Tracer = %T, want noopSpan", span)
+	}
+	mustSet(t, db, "a", "one")
+	wantValue(t, db, "a", "one")
+}
@@ -0,0 +1,59 @@
+// Package tracing traces SimpleDB operations with OpenTelemetry. It lives in
+// its own package so programs that don't trace don't pull in OpenTelemetry.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"saaster.tech/own-db/db"
+)
+
+// instrumentationName identifies the spans' source to the tracer provider
+const instrumentationName = "saaster.tech/own-db/db"
+
+// Tracer starts an OpenTelemetry span named "owndb.<op>" for each operation,
+// with the operation, key and value size as attributes. Failed operations
+// record their error and mark the span as failed.
+// Pass it as db.Options.Tracer.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New returns a Tracer that creates spans with provider, usually
+// otel.GetTracerProvider()
+func New(provider trace.TracerProvider) *Tracer {
+	return &Tracer{tracer: provider.Tracer(instrumentationName)}
+}
+
+// StartSpan implements db.Tracer
+func (t *Tracer) StartSpan(ctx context.Context, op, key string) db.Span {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "owndb"),
+		attribute.String("db.operation", op),
+	}
+	if key != "" {
+		attrs = append(attrs, attribute.String("owndb.key", key))
+	}
+	_, span := t.tracer.Start(ctx, "owndb."+op,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrs...))
+	return otelSpan{span}
+}
+
+// otelSpan adapts a trace.Span to db.Span
+type otelSpan struct {
+	span trace.Span
+}
+
+// End implements db.Span
+func (s otelSpan) End(bytes int, err error) {
+	s.span.SetAttributes(attribute.Int("owndb.bytes", bytes))
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"saaster.tech/own-db/db"
+)
+
+func TestTracer(t *testing.T) {
+	tests := []struct {
+		name       string
+		op         func(ctx context.Context, d *db.SimpleDB)
+		wantName   string
+		wantAttrs  map[attribute.Key]attribute.Value
+		noKey      bool // Whether the span must have no owndb.key
+		root       bool // Whether the operation takes no context, so has no parent
+		wantStatus codes.Code
+	}{
+		{
+			name:     "get",
+			op:       func(ctx context.Context, d *db.SimpleDB) { d.GetContext(ctx, "a") },
+			wantName: "owndb.get",
+			wantAttrs: map[attribute.Key]attribute.Value{
+				"db.system":    attribute.StringValue("owndb"),
+				"db.operation": attribute.StringValue("get"),
+				"owndb.key":    attribute.StringValue("a"),
+				"owndb.bytes":  attribute.IntValue(3),
+			},
+		},
+		{
+			name:     "get missing",
+			op:       func(ctx context.Context, d *db.SimpleDB) { d.GetContext(ctx, "missing") },
+			wantName: "owndb.get",
+			wantAttrs: map[attribute.Key]attribute.Value{
+				"owndb.key":   attribute.StringValue("missing"),
+				"owndb.bytes": attribute.IntValue(0),
+			},
+			wantStatus: codes.Error,
+		},
+		{
+			name:     "set",
+			op:       func(ctx context.Context, d *db.SimpleDB) { d.SetContext(ctx, "b", "hello") },
+			wantName: "owndb.set",
+			wantAttrs: map[attribute.Key]attribute.Value{
+				"db.operation": attribute.StringValue("set"),
+				"owndb.key":    attribute.StringValue("b"),
+				"owndb.bytes":  attribute.IntValue(5),
+			},
+		},
+		{
+			name:     "compact",
+			op:       func(ctx context.Context, d *db.SimpleDB) { d.Compact() },
+			wantName: "owndb.compact",
+			noKey:    true,
+			root:     true,
+			wantAttrs: map[attribute.Key]attribute.Value{
+				"db.operation": attribute.StringValue("compact"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			// Write the initial value untraced, so only the operation's span
+			// is recorded
+			path := filepath.Join(t.TempDir(), "test.db")
+			d, err := db.OpenDB(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := d.Set("a", "one"); err != nil {
+				t.Fatal(err)
+			}
+			d.Close()
+			d, err = db.OpenDBWithOptions(path, db.Options{Tracer: New(provider)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+
+			ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+			tt.op(ctx, d)
+			parent.End()
+
+			spans := recorder.Ended()
+			if len(spans) != 2 {
+				t.Fatalf("%d spans ended, want the operation and its parent", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != tt.wantName {
+				t.Fatalf("span name %q, want %q", span.Name(), tt.wantName)
+			}
+			if tt.root && span.Parent().IsValid() {
+				t.Fatal("span has a parent")
+			}
+			if !tt.root && span.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Fatal("span is not a child of the request span")
+			}
+			attrs := make(map[attribute.Key]attribute.Value)
+			for _, kv := range span.Attributes() {
+				attrs[kv.Key] = kv.Value
+			}
+			for key, want := range tt.wantAttrs {
+				if got, ok := attrs[key]; !ok || got != want {
+					t.Errorf("attribute %s = %v, want %v", key, got.Emit(), want.Emit())
+				}
+			}
+			if _, ok := attrs["owndb.key"]; ok && tt.noKey {
+				t.Error("span has a key")
+			}
+			if span.Status().Code != tt.wantStatus {
+				t.Errorf("status %v, want %v", span.Status().Code, tt.wantStatus)
+			}
+			if tt.wantStatus == codes.Error && len(span.Events()) == 0 {
+				t.Error("error not recorded on the span")
+			}
+		})
+	}
+}
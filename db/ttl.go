@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// sweepInterval is how often expired keys are tombstoned in the background
+const sweepInterval = time.Minute
+
+// SetWithTTL adds or updates a key that expires after ttl. Expired keys
+// behave as if they were deleted; they are tombstoned by a background sweep
+// and dropped entirely on the next compaction.
+func (db *SimpleDB) SetWithTTL(key, value string, ttl time.Duration) (err error) {
+	key = db.normalize(key)
+	defer db.observe(OpSet, db.start(OpSet), &err)
+	span := db.startSpan(context.Background(), OpSet, key)
+	defer func() { span.End(len(value), err) }()
+
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+
+	entry := Record{
+		Key:       key,
+		Value:     []byte(value),
+		ExpiresAt: time.Now().Add(ttl).UnixNano(),
+	}
+	if db.opts.GroupCommit {
+		return db.enqueue(entry)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	return db.write(entry)
+}
+
+// Touch sets key to expire after ttl from now without rewriting its value,
+// which keeps refreshing large values such as sessions cheap. Only a small
+// expiry record is appended; the next compaction folds it into the value.
+// Keys that don't exist or have already expired are reported as not found.
+func (db *SimpleDB) Touch(key string, ttl time.Duration) error {
+	key = db.normalize(key)
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	exists, err := db.exists(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrKeyNotFound
+	}
+
+	return db.touch(key, time.Now().Add(ttl).UnixNano())
+}
+
+// touch appends an expiry record for key and applies it. Callers must hold
+// the write lock.
+func (db *SimpleDB) touch(key string, expiresAt int64) error {
+	loc, err := db.appendEntry(Record{Key: key, Touched: true, ExpiresAt: expiresAt})
+	if err != nil {
+		return err
+	}
+	db.expires[key] = expiresAt
+	db.dead += loc.Size
+	db.maybeCompact()
+	return nil
+}
+
+// GetWithTTL returns the value of key and how long it has left before it
+// expires. The remaining time is zero for keys that never expire; a key
+// whose TTL has run out is reported as not found.
+func (db *SimpleDB) GetWithTTL(key string) (string, time.Duration, error) {
+	value, meta, err := db.GetWithMeta(key)
+	if err != nil {
+		return "", 0, err
+	}
+	if meta.ExpiresAt.IsZero() {
+		return value, 0, nil
+	}
+	return value, time.Until(meta.ExpiresAt), nil
+}
+
+// expired reports whether key has a TTL that has already passed.
+// Callers must hold at least the read lock.
+func (db *SimpleDB) expired(key string) bool {
+	expiresAt, ok := db.expires[key]
+	return ok && expiresAt <= time.Now().UnixNano()
+}
+
+// sweepLoop periodically tombstones expired keys until the database closes
+func (db *SimpleDB) sweepLoop() {
+	defer db.background.Done()
+
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.stop:
+			return
+		case <-ticker.C:
+			_, err := db.sweepExpired()
+			if err != nil {
+				db.opts.Logger.Error("expiry sweep failed", "path", db.path, "err", err)
+			}
+			db.mu.Lock()
+			db.backgroundErr = err
+			db.mu.Unlock()
+		}
+	}
+}
+
+// sweepExpired writes tombstones for every key whose TTL has passed and
+// returns how many there were
+func (db *SimpleDB) sweepExpired() (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return 0, ErrClosed
+	}
+
+	swept := 0
+	for key := range db.expires {
+		if !db.expired(key) {
+			continue
+		}
+		if err := db.del(key); err != nil {
+			return swept, err
+		}
+		swept++
+	}
+	return swept, nil
+}
@@ -0,0 +1,229 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetWithTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		wait    time.Duration
+		reopen  bool
+		wantErr bool
+		live    bool // Whether the key is still there afterwards
+	}{
+		{name: "live", ttl: time.Hour, live: true},
+		{name: "expired", ttl: time.Millisecond, wait: 5 * time.Millisecond},
+		{name: "live after reopen", ttl: time.Hour, reopen: true, live: true},
+		{name: "expired after reopen", ttl: time.Millisecond, wait: 5 * time.Millisecond, reopen: true},
+		{name: "zero", wantErr: true},
+		{name: "negative", ttl: -time.Second, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			err := db.SetWithTTL("a", "one", tt.ttl)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetWithTTL() error = %v, want error: %v", err, tt.wantErr)
+			}
+			time.Sleep(tt.wait)
+			if tt.reopen {
+				if err := db.Close(); err != nil {
+					t.Fatal(err)
+				}
+				db = reopenTestDB(t, path, Options{})
+			}
+
+			if !tt.live {
+				wantMissing(t, db, "a")
+				if db.Exists("a") {
+					t.Fatal("Exists() reports a missing key")
+				}
+				return
+			}
+			wantValue(t, db, "a", "one")
+			_, left, err := db.GetWithTTL("a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if left <= 0 || left > tt.ttl {
+				t.Fatalf("GetWithTTL() left %v, want within %v", left, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestSetClearsTTL(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	if err := db.SetWithTTL("a", "one", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	mustSet(t, db, "a", "two")
+	time.Sleep(5 * time.Millisecond)
+	wantValue(t, db, "a", "two")
+}
+
+func TestSweepExpired(t *testing.T) {
+	db, path := openTestDB(t, Options{})
+	mustSet(t, db, "a", "one")
+	for _, key := range []string{"b", "c"} {
+		if err := db.SetWithTTL(key, "gone", time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SetWithTTL("d", "later", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	swept, err := db.sweepExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if swept != 2 {
+		t.Fatalf("sweepExpired() = %d, want 2", swept)
+	}
+	if swept, _ := db.sweepExpired(); swept != 0 {
+		t.Fatalf("second sweepExpired() = %d, want 0", swept)
+	}
+
+	// The tombstones are on disk, not just in memory
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db = reopenTestDB(t, path, Options{})
+	wantValue(t, db, "a", "one")
+	wantValue(t, db, "d", "later")
+	for _, key := range []string{"b", "c"} {
+		wantMissing(t, db, key)
+	}
+}
+
+func TestGetWithTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration // Zero sets the key without a TTL
+		wait    time.Duration
+		wantErr error
+	}{
+		{name: "no ttl"},
+		{name: "live", ttl: time.Hour, wait: 20 * time.Millisecond},
+		{name: "expired", ttl: time.Millisecond, wait: 5 * time.Millisecond, wantErr: ErrKeyNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			if tt.ttl == 0 {
+				mustSet(t, db, "a", "one")
+			} else if err := db.SetWithTTL("a", "one", tt.ttl); err != nil {
+				t.Fatal(err)
+			}
+			_, first, _ := db.GetWithTTL("a")
+			time.Sleep(tt.wait)
+
+			value, left, err := db.GetWithTTL("a")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetWithTTL() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if value != "one" {
+				t.Fatalf("GetWithTTL() = %q, want one", value)
+			}
+			if tt.ttl == 0 {
+				if left != 0 {
+					t.Fatalf("GetWithTTL() left %v on a key without a TTL", left)
+				}
+				return
+			}
+			// Time left goes down as time passes
+			if left <= 0 || left > first-tt.wait {
+				t.Fatalf("GetWithTTL() left %v, want at most %v", left, first-tt.wait)
+			}
+		})
+	}
+}
+
+func TestTouch(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration // Of the key before the touch; zero for none
+		key     string
+		touch   time.Duration
+		wantErr error
+	}{
+		{name: "extends", ttl: 20 * time.Millisecond, key: "a", touch: time.Hour},
+		{name: "adds a ttl", key: "a", touch: time.Hour},
+		{name: "missing", key: "missing", touch: time.Hour, wantErr: ErrKeyNotFound},
+		{name: "already expired", ttl: time.Millisecond, key: "a", touch: time.Hour, wantErr: ErrKeyNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, Options{})
+			value := strings.Repeat("v", 4096)
+			if tt.ttl == 0 {
+				mustSet(t, db, "a", value)
+			} else if err := db.SetWithTTL("a", value, tt.ttl); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != nil {
+				time.Sleep(5 * time.Millisecond)
+			}
+			before := fileSize(t, db)
+
+			err := db.Touch(tt.key, tt.touch)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Touch() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			// Only a small record is written, not the value again
+			if grown := fileSize(t, db) - before; grown >= int64(len(value)) {
+				t.Fatalf("Touch() grew the file by %d bytes", grown)
+			}
+
+			// Outlives the old TTL, across a reopen and a compaction
+			time.Sleep(2 * tt.ttl)
+			check := func() {
+				t.Helper()
+				wantValue(t, db, "a", value)
+				_, left, err := db.GetWithTTL("a")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if left <= tt.ttl || left > tt.touch {
+					t.Fatalf("GetWithTTL() left %v, want within %v", left, tt.touch)
+				}
+			}
+			check()
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			db = reopenTestDB(t, path, Options{})
+			check()
+			if err := db.Compact(); err != nil {
+				t.Fatal(err)
+			}
+			check()
+		})
+	}
+}
+
+func TestTouchInvalidTTL(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	mustSet(t, db, "a", "one")
+	for _, ttl := range []time.Duration{0, -time.Second} {
+		if err := db.Touch("a", ttl); err == nil {
+			t.Fatalf("Touch(%v) succeeded", ttl)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package db
+
+import (
+	"crypto/cipher"
+	"os"
+	"sort"
+	"time"
+)
+
+// ReadTx is a consistent, read-only view of the database passed to View.
+// Every read sees the database as it was when the transaction started,
+// however many writes, deletes and compactions happen meanwhile.
+type ReadTx struct {
+	locs      map[string]location
+	expires   map[string]int64
+	files     map[int]*os.File // Own handles so a compaction swapping files can't invalidate locations
+	codec     Codec
+	aead      cipher.AEAD
+	normalize func(key string) string
+}
+
+// View runs fn with a read transaction over a snapshot of the index and
+// returns its error. Taking the snapshot copies the whole index, so it costs
+// O(n) in the number of keys but holds the read lock only for the copy.
+// The transaction must not be used after fn returns.
+func (db *SimpleDB) View(fn func(tx *ReadTx) error) error {
+	db.mu.RLock()
+	if db.closed {
+		db.mu.RUnlock()
+		return ErrClosed
+	}
+	all, err := db.indexed()
+	if err != nil {
+		db.mu.RUnlock()
+		return err
+	}
+	files, err := db.openSegments()
+	if err != nil {
+		db.mu.RUnlock()
+		return err
+	}
+	tx := &ReadTx{
+		locs:      make(map[string]location, len(all)),
+		expires:   make(map[string]int64, len(db.expires)),
+		files:     files,
+		codec:     db.opts.Codec,
+		aead:      db.aead,
+		normalize: db.normalize,
+	}
+	for key, loc := range all {
+		tx.locs[key] = loc
+	}
+	for key, expiresAt := range db.expires {
+		tx.expires[key] = expiresAt
+	}
+	db.mu.RUnlock()
+
+	defer closeSegments(files)
+	return fn(tx)
+}
+
+// Get returns the value of key as of the start of the transaction
+func (tx *ReadTx) Get(key string) (string, error) {
+	value, err := tx.GetBytes(key)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// GetBytes is like Get but returns the raw bytes of the value
+func (tx *ReadTx) GetBytes(key string) ([]byte, error) {
+	key = tx.normalize(key)
+	loc, exists := tx.locs[key]
+	if !exists || tx.expired(key) {
+		return nil, ErrKeyNotFound
+	}
+	return readValueAt(tx.codec, tx.aead, tx.files[loc.Segment], loc)
+}
+
+// Exists reports whether key was present at the start of the transaction
+func (tx *ReadTx) Exists(key string) bool {
+	key = tx.normalize(key)
+	_, exists := tx.locs[key]
+	return exists && !tx.expired(key)
+}
+
+// Keys returns the live keys of the snapshot in ascending order
+func (tx *ReadTx) Keys() []string {
+	keys := make([]string, 0, len(tx.locs))
+	for key := range tx.locs {
+		if !tx.expired(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// expired reports whether key's TTL has passed. Keys can still expire
+// while the transaction runs.
+func (tx *ReadTx) expired(key string) bool {
+	expiresAt, ok := tx.expires[key]
+	return ok && expiresAt <= time.Now().UnixNano()
+}
+
+// WriteTx buffers the writes made inside UpdateTx. Its reads see the
+// database as modified by the writes made so far in the transaction.
+type WriteTx struct {
+	db      *SimpleDB
+	ops     []Record          // Buffered writes in the order they were made
+	pending map[string]Record // Latest buffered write per key
+}
+
+// UpdateTx runs fn with a write transaction and, if fn returns nil, applies
+// everything it buffered with a single write, like BatchSet. If fn returns
+// an error, or any write can't be applied, nothing is written and the error
+// is returned. Unlike Update, the transaction can span any number of keys.
+//
+// The write lock is held while fn runs, so other reads and writes wait for
+// it; fn must not call methods on the database itself.
+func (db *SimpleDB) UpdateTx(fn func(tx *WriteTx) error) error {
+	if db.opts.ReadOnly {
+		return ErrReadOnly
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	tx := &WriteTx{db: db, pending: make(map[string]Record)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// Get returns the value of key, taking writes buffered in the transaction
+// into account
+func (tx *WriteTx) Get(key string) (string, error) {
+	key = tx.db.normalize(key)
+	if entry, ok := tx.pending[key]; ok {
+		if entry.Deleted {
+			return "", ErrKeyNotFound
+		}
+		return string(entry.Value), nil
+	}
+
+	value, exists, err := tx.db.lookup(key)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", ErrKeyNotFound
+	}
+	return string(value), nil
+}
+
+// Set buffers a write of key. Size limits are checked straight away.
+func (tx *WriteTx) Set(key, value string) error {
+	key = tx.db.normalize(key)
+	if err := tx.db.checkKey(key, len(value)); err != nil {
+		return err
+	}
+	tx.buffer(Record{Key: key, Value: []byte(value)})
+	return nil
+}
+
+// Delete buffers the deletion of key, returning ErrKeyNotFound if it
+// doesn't exist as far as the transaction can see
+func (tx *WriteTx) Delete(key string) error {
+	key = tx.db.normalize(key)
+	if _, err := tx.Get(key); err != nil {
+		return err
+	}
+	tx.buffer(Record{Key: key, Deleted: true})
+	return nil
+}
+
+// buffer queues entry to be written on commit
+func (tx *WriteTx) buffer(entry Record) {
+	tx.ops = append(tx.ops, entry)
+	tx.pending[entry.Key] = entry
+}
+
+// commit writes the buffered operations and applies them to the index.
+// The caller holds the write lock.
+func (tx *WriteTx) commit() error {
+	if len(tx.ops) == 0 {
+		return nil
+	}
+	db := tx.db
+
+	entries := make([]Record, len(tx.ops))
+	// Values written earlier in this transaction, so repeats get increasing
+	// versions and a key set after being deleted starts over
+	written := make(map[string]Record)
+	for i, op := range tx.ops {
+		if err := db.promote(op.Key); err != nil {
+			return err
+		}
+		if op.Deleted {
+			entries[i] = op
+			written[op.Key] = Record{}
+			continue
+		}
+		if op.Touched {
+			entries[i] = op
+			continue
+		}
+
+		var prev *Record
+		if entry, ok := written[op.Key]; ok {
+			prev = &entry
+		}
+		entry := db.stamp(op, prev)
+		written[op.Key] = entry
+
+		var err error
+		entries[i], err = db.prepareValue(entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	locs, err := db.appendEntries(entries, db.opts.SyncWrites)
+	if err != nil {
+		return err
+	}
+	for i, op := range tx.ops {
+		if op.Deleted {
+			if err := db.removeIndex(op.Key, locs[i]); err != nil {
+				return err
+			}
+			db.publish(Event{Type: EventDelete, Key: op.Key})
+			continue
+		}
+		if op.Touched {
+			db.expires[op.Key] = op.ExpiresAt
+			db.dead += locs[i].Size
+			continue
+		}
+		if err := db.setIndex(op.Key, locs[i], op.ExpiresAt); err != nil {
+			return err
+		}
+		db.publish(Event{Type: EventSet, Key: op.Key, Value: string(op.Value)})
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package db
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestView(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(t *testing.T, db *SimpleDB) // Runs during the transaction
+	}{
+		{name: "overwrite", write: func(t *testing.T, db *SimpleDB) { mustSet(t, db, "a", "changed") }},
+		{name: "new key", write: func(t *testing.T, db *SimpleDB) { mustSet(t, db, "c", "new") }},
+		{
+			name: "delete",
+			write: func(t *testing.T, db *SimpleDB) {
+				if err := db.Delete("a"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "compaction",
+			write: func(t *testing.T, db *SimpleDB) {
+				mustSet(t, db, "a", "changed")
+				if err := db.Compact(); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "clear",
+			write: func(t *testing.T, db *SimpleDB) {
+				if err := db.Clear(); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			mustSet(t, db, "a", "one")
+			mustSet(t, db, "b", "two")
+
+			err := db.View(func(tx *ReadTx) error {
+				// The write goes ahead while the transaction is open
+				tt.write(t, db)
+
+				for key, want := range map[string]string{"a": "one", "b": "two"} {
+					if got, err := tx.Get(key); err != nil || got != want {
+						t.Fatalf("tx.Get(%q) = %q, %v, want %q", key, got, err, want)
+					}
+				}
+				if _, err := tx.Get("c"); !errors.Is(err, ErrKeyNotFound) {
+					t.Fatalf("tx.Get(c) error = %v, want %v", err, ErrKeyNotFound)
+				}
+				if !tx.Exists("a") || tx.Exists("c") {
+					t.Fatal("tx.Exists() doesn't match the snapshot")
+				}
+				if keys := tx.Keys(); !slices.Equal(keys, []string{"a", "b"}) {
+					t.Fatalf("tx.Keys() = %v, want [a b]", keys)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestViewResult(t *testing.T) {
+	errStop := errors.New("stop")
+	tests := []struct {
+		name    string
+		closed  bool
+		fnErr   error
+		wantErr error
+	}{
+		{name: "ok"},
+		{name: "callback fails", fnErr: errStop, wantErr: errStop},
+		{name: "closed", closed: true, wantErr: ErrClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			if tt.closed {
+				if err := db.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := db.View(func(*ReadTx) error { return tt.fnErr })
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("View() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpdateTx(t *testing.T) {
+	errStop := errors.New("stop")
+	tests := []struct {
+		name    string
+		opts    Options
+		fn      func(t *testing.T, tx *WriteTx) error
+		wantErr error
+		want    map[string]string // Contents afterwards; "" for missing
+	}{
+		{
+			name: "commit",
+			fn: func(t *testing.T, tx *WriteTx) error {
+				if err := tx.Set("a", "changed"); err != nil {
+					return err
+				}
+				if err := tx.Set("c", "new"); err != nil {
+					return err
+				}
+				return tx.Delete("b")
+			},
+			want: map[string]string{"a": "changed", "b": "", "c": "new"},
+		},
+		{
+			name: "rollback",
+			fn: func(t *testing.T, tx *WriteTx) error {
+				if err := tx.Set("a", "changed"); err != nil {
+					return err
+				}
+				if err := tx.Delete("b"); err != nil {
+					return err
+				}
+				return errStop
+			},
+			wantErr: errStop,
+			want:    map[string]string{"a": "one", "b": "two"},
+		},
+		{
+			name: "read your writes",
+			fn: func(t *testing.T, tx *WriteTx) error {
+				reads := []struct {
+					write func() error
+					key   string
+					want  string // "" for missing
+				}{
+					{write: func() error { return tx.Set("a", "changed") }, key: "a", want: "changed"},
+					{write: func() error { return tx.Delete("b") }, key: "b"},
+					{write: func() error { return tx.Set("b", "back") }, key: "b", want: "back"},
+					{write: func() error { return tx.Set("c", "new") }, key: "c", want: "new"},
+				}
+				for _, r := range reads {
+					if err := r.write(); err != nil {
+						return err
+					}
+					got, err := tx.Get(r.key)
+					if r.want == "" && !errors.Is(err, ErrKeyNotFound) || r.want != "" && (err != nil || got != r.want) {
+						t.Fatalf("tx.Get(%q) = %q, %v, want %q", r.key, got, err, r.want)
+					}
+				}
+				return nil
+			},
+			want: map[string]string{"a": "changed", "b": "back", "c": "new"},
+		},
+		{
+			name: "delete missing",
+			fn: func(t *testing.T, tx *WriteTx) error {
+				if err := tx.Set("a", "changed"); err != nil {
+					return err
+				}
+				return tx.Delete("missing")
+			},
+			wantErr: ErrKeyNotFound,
+			want:    map[string]string{"a": "one", "b": "two"},
+		},
+		{
+			name: "value too large",
+			opts: Options{MaxValueSize: 8},
+			fn: func(t *testing.T, tx *WriteTx) error {
+				if err := tx.Set("a", "changed"); err != nil {
+					return err
+				}
+				return tx.Set("b", "far too long a value")
+			},
+			wantErr: ErrValueTooLarge,
+			want:    map[string]string{"a": "one", "b": "two"},
+		},
+		{
+			name: "nothing written",
+			fn:   func(t *testing.T, tx *WriteTx) error { return nil },
+			want: map[string]string{"a": "one", "b": "two"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, tt.opts)
+			mustSet(t, db, "a", "one")
+			mustSet(t, db, "b", "two")
+			before := fileSize(t, db)
+
+			err := db.UpdateTx(func(tx *WriteTx) error { return tt.fn(t, tx) })
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateTx() = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil && fileSize(t, db) != before {
+				t.Fatal("a failed transaction wrote to the file")
+			}
+
+			check := func(db *SimpleDB) {
+				t.Helper()
+				for key, value := range tt.want {
+					if value == "" {
+						wantMissing(t, db, key)
+					} else {
+						wantValue(t, db, key, value)
+					}
+				}
+			}
+			check(db)
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			check(reopenTestDB(t, path, tt.opts))
+		})
+	}
+}
+
+func TestUpdateTxUnwritable(t *testing.T) {
+	tests := []struct {
+		name    string
+		open    func(t *testing.T) *SimpleDB
+		wantErr error
+	}{
+		{
+			name: "closed",
+			open: func(t *testing.T) *SimpleDB {
+				db, _ := openTestDB(t, Options{})
+				if err := db.Close(); err != nil {
+					t.Fatal(err)
+				}
+				return db
+			},
+			wantErr: ErrClosed,
+		},
+		{
+			name: "read-only",
+			open: func(t *testing.T) *SimpleDB {
+				_, path := openTestDB(t, Options{})
+				ro, err := OpenReadOnly(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { ro.Close() })
+				return ro
+			},
+			wantErr: ErrReadOnly,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := tt.open(t)
+			called := false
+			err := db.UpdateTx(func(*WriteTx) error { called = true; return nil })
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateTx() = %v, want %v", err, tt.wantErr)
+			}
+			if called {
+				t.Fatal("the transaction ran")
+			}
+		})
+	}
+}
@@ -1,6 +1,78 @@
 package db
 
+import "time"
+
 type KVPair struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
 }
+
+// Record is a single entry as stored in the log, exported so a Codec can
+// serialize it. Values are kept as raw bytes so binary data round-trips.
+type Record struct {
+	Key         string      `json:"key"`
+	Value       []byte      `json:"value,omitempty"`
+	Deleted     bool        `json:"deleted,omitempty"`     // Tombstone marker written by Delete
+	Touched     bool        `json:"touched,omitempty"`     // Expiry-only update written by Touch; the value stays in its earlier record
+	ExpiresAt   int64       `json:"expires_at,omitempty"`  // Unix nanoseconds after which the key is gone; zero means never
+	Version     int64       `json:"version,omitempty"`     // Bumped on every write to the key, never repeated after a delete
+	CreatedAt   int64       `json:"created_at,omitempty"`  // Unix nanoseconds of the first write since the key was created
+	UpdatedAt   int64       `json:"updated_at,omitempty"`  // Unix nanoseconds of this write
+	Compression Compression `json:"compression,omitempty"` // How Value is compressed, if at all
+	Nonce       []byte      `json:"nonce,omitempty"`       // AES-GCM nonce when Value is encrypted
+	Batch       int         `json:"batch,omitempty"`       // Records after this one written in the same append; see appendEntries
+}
+
+// Meta describes a stored value without its contents
+type Meta struct {
+	Version   int64     `json:"version"`
+	Size      int       `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	ExpiresAt time.Time `json:"expires_at"` // Zero if the key never expires
+}
+
+// Stats is a point-in-time summary of the database
+type Stats struct {
+	Keys       int   `json:"keys"`
+	FileSize   int64 `json:"file_size"`
+	Segments   int   `json:"segments"`
+	Corrupt    int   `json:"corrupt"`     // Corrupt records skipped when the index was built
+	DeadBytes  int64 `json:"dead_bytes"`  // Bytes of overwritten and deleted records
+	Buffered   int64 `json:"buffered"`    // Bytes written but not yet flushed to the file
+	IndexBytes int64 `json:"index_bytes"` // Estimated memory held by the in-memory index
+	Spilled    int   `json:"spilled"`     // Keys moved out of memory to stay within IndexBudget
+	Reads      int64 `json:"reads"`       // Values read since open
+	Writes     int64 `json:"writes"`      // Records written since open
+	Evicted    int64 `json:"evicted"`     // Keys deleted since open to stay within MaxKeys
+}
+
+// VerifyReport lists the problems Verify found
+type VerifyReport struct {
+	Records  int         `json:"records"`  // Readable records across all segments
+	Corrupt  []BadRecord `json:"corrupt"`  // Records that fail their checksum or are cut short
+	Orphaned []string    `json:"orphaned"` // Indexed keys whose record can't be read back
+}
+
+// OK reports whether Verify found no problems
+func (r VerifyReport) OK() bool {
+	return len(r.Corrupt) == 0 && len(r.Orphaned) == 0
+}
+
+// MaintenanceReport describes what Maintenance did. Keys counts indexed
+// keys, including expired ones not yet swept; Size is the bytes in the log.
+type MaintenanceReport struct {
+	Expired    int           `json:"expired"` // Expired keys that were tombstoned
+	KeysBefore int           `json:"keys_before"`
+	KeysAfter  int           `json:"keys_after"`
+	SizeBefore int64         `json:"size_before"`
+	SizeAfter  int64         `json:"size_after"`
+	Took       time.Duration `json:"took"`
+}
+
+// BadRecord locates a damaged record in the log
+type BadRecord struct {
+	Segment int    `json:"segment"`
+	Offset  int64  `json:"offset"`
+	Reason  string `json:"reason"`
+}
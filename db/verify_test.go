@@ -0,0 +1,94 @@
+package db
+
+import (
+	"maps"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   Options
+		damage func(t *testing.T, db *SimpleDB, path string, locs map[string]location)
+		want   func(locs map[string]location) VerifyReport
+	}{
+		{
+			name:   "clean",
+			damage: func(*testing.T, *SimpleDB, string, map[string]location) {},
+			want:   func(map[string]location) VerifyReport { return VerifyReport{Records: 4} },
+		},
+		{
+			name:   "clean segments",
+			opts:   Options{SegmentSize: 64},
+			damage: func(*testing.T, *SimpleDB, string, map[string]location) {},
+			want:   func(map[string]location) VerifyReport { return VerifyReport{Records: 4} },
+		},
+		{
+			name: "corrupt record",
+			damage: func(t *testing.T, _ *SimpleDB, path string, locs map[string]location) {
+				flipLastByte(t, path, locs["b"])
+			},
+			want: func(locs map[string]location) VerifyReport {
+				return VerifyReport{
+					Records:  3,
+					Corrupt:  []BadRecord{{Segment: locs["b"].Segment, Offset: locs["b"].Offset, Reason: "corrupt"}},
+					Orphaned: []string{"b"},
+				}
+			},
+		},
+		{
+			name: "truncated",
+			damage: func(t *testing.T, _ *SimpleDB, path string, locs map[string]location) {
+				c := locs["c"]
+				if err := os.Truncate(segmentPath(path, c.Segment), c.Offset+c.Size/2); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: func(locs map[string]location) VerifyReport {
+				return VerifyReport{
+					Records:  3,
+					Corrupt:  []BadRecord{{Segment: locs["c"].Segment, Offset: locs["c"].Offset, Reason: "truncated"}},
+					Orphaned: []string{"c"},
+				}
+			},
+		},
+		{
+			name: "index points at another key",
+			damage: func(_ *testing.T, db *SimpleDB, _ string, locs map[string]location) {
+				db.data["a"] = locs["c"]
+			},
+			want: func(map[string]location) VerifyReport {
+				return VerifyReport{Records: 4, Orphaned: []string{"a"}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, path := openTestDB(t, tt.opts)
+			mustSet(t, db, "a", "one")
+			mustSet(t, db, "b", "old")
+			mustSet(t, db, "b", "two")
+			mustSet(t, db, "c", "three")
+			if err := db.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			locs := maps.Clone(db.data)
+
+			tt.damage(t, db, path, locs)
+			got, err := db.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want(locs)
+			if got.Records != want.Records || !slices.Equal(got.Corrupt, want.Corrupt) || !slices.Equal(got.Orphaned, want.Orphaned) {
+				t.Fatalf("Verify() = %+v, want %+v", got, want)
+			}
+			if got.OK() != want.OK() {
+				t.Fatalf("OK() = %v, want %v", got.OK(), want.OK())
+			}
+		})
+	}
+}
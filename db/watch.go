@@ -0,0 +1,132 @@
+package db
+
+import "strings"
+
+// watchBuffer is how many events a watcher can fall behind by before new
+// events for it are dropped
+const watchBuffer = 16
+
+// EventType says what happened to a watched key
+type EventType int
+
+const (
+	EventSet EventType = iota
+	EventDelete
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Event describes a change to a watched key. Value is empty for deletes.
+type Event struct {
+	Type  EventType
+	Key   string
+	Value string
+}
+
+// watchSet holds the channels subscribed to one key or prefix
+type watchSet map[chan Event]struct{}
+
+// Watch returns a channel that receives an event every time key is set or
+// deleted, including deletes by the TTL sweep, and a function that stops the
+// watch and closes the channel. Closing the database closes the channel
+// too, so a watcher should stop once it sees that; watching a closed
+// database returns a channel that is already closed.
+//
+// Events are delivered without blocking writes: each watcher has a buffer of
+// watchBuffer events, and events arriving while it is full are dropped. A
+// watcher that must not miss changes should drain the channel promptly and
+// re-read the key after falling behind.
+func (db *SimpleDB) Watch(key string) (<-chan Event, func()) {
+	return db.subscribe(&db.watchers, db.normalize(key))
+}
+
+// WatchPrefix is like Watch but receives events for every key starting with
+// prefix. An empty prefix watches the whole database.
+func (db *SimpleDB) WatchPrefix(prefix string) (<-chan Event, func()) {
+	return db.subscribe(&db.prefixWatchers, db.normalize(prefix))
+}
+
+// subscribe registers a new channel under name in *watchers and returns it
+// with its cancel function
+func (db *SimpleDB) subscribe(watchers *map[string]watchSet, name string) (<-chan Event, func()) {
+	ch := make(chan Event, watchBuffer)
+
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	if *watchers == nil {
+		*watchers = make(map[string]watchSet)
+	}
+	if (*watchers)[name] == nil {
+		(*watchers)[name] = make(watchSet)
+	}
+	(*watchers)[name][ch] = struct{}{}
+	db.mu.Unlock()
+
+	cancel := func() {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+
+		// Already stopped, or closed by Close
+		if _, ok := (*watchers)[name][ch]; !ok {
+			return
+		}
+		delete((*watchers)[name], ch)
+		if len((*watchers)[name]) == 0 {
+			delete(*watchers, name)
+		}
+		close(ch)
+	}
+	return ch, cancel
+}
+
+// publish applies an event to the secondary indexes and sends it to every
+// watcher of its key or a prefix of it, dropping it for watchers whose
+// buffer is full. Callers must hold the write lock, which is also what keeps
+// cancel from closing a channel mid-send.
+func (db *SimpleDB) publish(event Event) {
+	db.reindex(event)
+	for ch := range db.watchers[event.Key] {
+		send(ch, event)
+	}
+	for prefix, set := range db.prefixWatchers {
+		if !strings.HasPrefix(event.Key, prefix) {
+			continue
+		}
+		for ch := range set {
+			send(ch, event)
+		}
+	}
+}
+
+// closeWatchers closes every watch channel. Callers must hold the write
+// lock.
+func (db *SimpleDB) closeWatchers() {
+	for _, watchers := range []map[string]watchSet{db.watchers, db.prefixWatchers} {
+		for _, set := range watchers {
+			for ch := range set {
+				close(ch)
+			}
+		}
+	}
+	db.watchers, db.prefixWatchers = nil, nil
+}
+
+// send delivers event unless ch's buffer is full
+func send(ch chan Event, event Event) {
+	select {
+	case ch <- event:
+	default:
+	}
+}
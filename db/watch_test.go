@@ -0,0 +1,118 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// nextEvent waits for an event on events, failing the test if the channel
+// is closed or nothing arrives
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("watch channel closed")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+	return Event{}
+}
+
+// wantClosed checks that events is closed once anything buffered is drained
+func wantClosed(t *testing.T, events <-chan Event) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("watch channel still open")
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		watch func(db *SimpleDB) (<-chan Event, func())
+	}{
+		{name: "key", watch: func(db *SimpleDB) (<-chan Event, func()) { return db.Watch("user:1") }},
+		{name: "prefix", watch: func(db *SimpleDB) (<-chan Event, func()) { return db.WatchPrefix("user:") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTestDB(t, Options{})
+			events, cancel := tt.watch(db)
+			defer cancel()
+
+			mustSet(t, db, "other", "ignored")
+			mustSet(t, db, "user:1", "one")
+			if event := nextEvent(t, events); event.Type != EventSet || event.Key != "user:1" || event.Value != "one" {
+				t.Fatalf("got %+v, want a set of user:1", event)
+			}
+			if err := db.Delete("user:1"); err != nil {
+				t.Fatal(err)
+			}
+			if event := nextEvent(t, events); event.Type != EventDelete || event.Key != "user:1" {
+				t.Fatalf("got %+v, want a delete of user:1", event)
+			}
+
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			wantClosed(t, events)
+			cancel()
+
+			// Watching a closed database ends straight away
+			late, lateCancel := tt.watch(db)
+			wantClosed(t, late)
+			lateCancel()
+		})
+	}
+}
+
+func TestWatchCancel(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	events, cancel := db.Watch("a")
+	cancel()
+	cancel()
+	wantClosed(t, events)
+
+	// Closing the database leaves a cancelled watch alone
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchFullBuffer(t *testing.T) {
+	db, _ := openTestDB(t, Options{})
+	events, cancel := db.Watch("a")
+	defer cancel()
+
+	// Nobody reads, so writes past the buffer must not block
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < watchBuffer+10; i++ {
+			if err := db.Set("a", "x"); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writes blocked on a full watcher")
+	}
+	if got := len(events); got != watchBuffer {
+		t.Fatalf("%d events buffered, want %d", got, watchBuffer)
+	}
+}